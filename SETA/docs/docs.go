@@ -15,9 +15,9 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/v1/deposit": {
-            "post": {
-                "description": "Api will return status 200 if the transaction is successful, 400 if the request is invalid and 500 if there is an internal server error",
+        "/api/v1/accounts/{account_id}/balance": {
+            "get": {
+                "description": "Returns the available balance of the account in a currency and the amount held for withdrawals that have not settled yet, an account without any transaction has a zero balance\nApi will return status 200 with the balance, 400 if the currency is invalid and 500 if there is an internal server error",
                 "consumes": [
                     "application/json"
                 ],
@@ -25,25 +25,41 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Transaction"
+                    "Account"
                 ],
-                "summary": "API To create a deposit transaction",
+                "summary": "API To get the balance of an account",
                 "parameters": [
                     {
-                        "description": "Transaction Request",
-                        "name": "TransactionRequest",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/controller.DepositRequest"
-                        }
+                        "type": "string",
+                        "description": "Account ID",
+                        "name": "account_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ISO 4217 currency, defaults to USD",
+                        "name": "currency",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.TransactionResponse"
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.AccountBalance"
+                                        }
+                                    }
+                                }
+                            ]
                         }
                     },
                     "400": {
@@ -85,28 +101,48 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/transaction": {
-            "put": {
-                "description": "Api will return status 200 if the transaction is updated, 400 if the request is invalid and 500 if there is an internal server error",
+        "/api/v1/callbacks/{gateway}": {
+            "post": {
+                "description": "The body is the gateway's native payload (JSON for Payment Gateway A, a SOAP envelope for Payment Gateway B). The callback must be signed with the secret shared with the gateway: X-Signature is the hex HMAC-SHA256 of \"\u003cX-Signature-Timestamp\u003e.\u003cX-Signature-Nonce\u003e.\u003cbody\u003e\".\nApi will return status 200 if the transaction is updated, 400 if the payload is invalid, 401 if the signature is invalid or the timestamp is stale, 404 if the gateway or the transaction is not found, 409 if the callback was replayed or the transaction cannot move to the status and 500 if there is an internal server error",
                 "consumes": [
-                    "application/json"
+                    "application/json",
+                    "text/xml"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Transaction"
+                    "Callback"
                 ],
-                "summary": "API To update a transaction",
+                "summary": "API for the payment gateways to notify a transaction status",
                 "parameters": [
                     {
-                        "description": "Transaction Request",
-                        "name": "TransactionRequest",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/controller.UpdateTransactionRequest"
-                        }
+                        "type": "string",
+                        "description": "Gateway name",
+                        "name": "gateway",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Hex HMAC-SHA256 signature",
+                        "name": "X-Signature",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Unix timestamp (seconds)",
+                        "name": "X-Signature-Timestamp",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Unique nonce",
+                        "name": "X-Signature-Nonce",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -128,6 +164,42 @@ const docTemplate = `{
                             ]
                         }
                     },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {
@@ -146,6 +218,24 @@ const docTemplate = `{
                             ]
                         }
                     },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -167,9 +257,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/transaction/{transaction_id}": {
-            "get": {
-                "description": "Api will return status 200 if the transaction is found, 404 if the transaction is not found and 500 if there is an internal server error",
+        "/api/v1/deposit": {
+            "post": {
+                "description": "The currency defaults to USD when omitted, the amount cannot have more decimals than the currency allows (none for JPY)\nWith a quote_id the gateway is sent the amount converted at the rate of the quote, the amount and currency default to those of the quote\nWith an Idempotency-Key the deposit is created at most once per key, a retry gets the response of the first request with the Idempotent-Replayed header\nApi will return status 200 if the transaction is successful, 202 if the risk rules sent it to pending_review or its outcome at the gateway is unknown, 400 if the request is invalid, the currency is not supported or the quote is unknown or does not match, 409 if the quote expired or was already used or the request of the idempotency key is still in progress, 422 with the code limit_exceeded if the deposit breaches a limit of the account, risk_denied if the risk rules deny it or idempotency_key_reused if the idempotency key was used for another request and 500 if there is an internal server error",
                 "consumes": [
                     "application/json"
                 ],
@@ -179,14 +269,22 @@ const docTemplate = `{
                 "tags": [
                     "Transaction"
                 ],
-                "summary": "API To get a transaction",
+                "summary": "API To create a deposit transaction",
                 "parameters": [
+                    {
+                        "description": "Transaction Request",
+                        "name": "TransactionRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.DepositRequest"
+                        }
+                    },
                     {
                         "type": "string",
-                        "description": "Transaction ID",
-                        "name": "transaction_id",
-                        "in": "path",
-                        "required": true
+                        "description": "Makes the request safe to retry, up to 255 characters",
+                        "name": "Idempotency-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -196,8 +294,50 @@ const docTemplate = `{
                             "$ref": "#/definitions/model.TransactionResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/model.TransactionResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
                         "schema": {
                             "allOf": [
                                 {
@@ -206,6 +346,9 @@ const docTemplate = `{
                                 {
                                     "type": "object",
                                     "properties": {
+                                        "code": {
+                                            "type": "string"
+                                        },
                                         "error": {
                                             "type": "string"
                                         }
@@ -235,9 +378,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/v1/withdraw": {
+        "/api/v1/fx/quotes": {
             "post": {
-                "description": "Api will return status 200 if the transaction is successful, 400 if the request is invalid and 500 if there is an internal server error",
+                "description": "Converts the amount at the current rate and locks that rate until the quote expires (FX_QUOTE_TTL, 30s by default). Pass the quote_id to /deposit or /withdraw to have the gateway process the converted amount, a quote can only be used once.\nApi will return status 200 with the quote, 400 if the request is invalid, 404 if there is no rate for the pair and 500 if there is an internal server error",
                 "consumes": [
                     "application/json"
                 ],
@@ -245,17 +388,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Transaction"
+                    "FX"
                 ],
-                "summary": "API To create a withdraw transaction",
+                "summary": "API To lock an exchange rate",
                 "parameters": [
                     {
-                        "description": "Transaction Request",
-                        "name": "TransactionRequest",
+                        "description": "FX Quote Request",
+                        "name": "FXQuoteRequest",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/controller.DepositRequest"
+                            "$ref": "#/definitions/controller.FXQuoteRequest"
                         }
                     }
                 ],
@@ -263,7 +406,19 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.TransactionResponse"
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.FXQuote"
+                                        }
+                                    }
+                                }
+                            ]
                         }
                     },
                     "400": {
@@ -284,6 +439,24 @@ const docTemplate = `{
                             ]
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -304,57 +477,1551 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "controller.DepositRequest": {
-            "type": "object",
-            "properties": {
-                "account_id": {
-                    "type": "string"
-                },
-                "amount": {
-                    "type": "string"
-                }
-            }
-        },
-        "controller.UpdateTransactionRequest": {
-            "type": "object",
-            "properties": {
-                "account_id": {
-                    "type": "string"
-                },
-                "status": {
-                    "$ref": "#/definitions/model.TransactionStatus"
-                },
-                "transaction_id": {
-                    "type": "string"
-                }
-            }
-        },
-        "model.DefaultError": {
-            "type": "object",
-            "properties": {
-                "error": {
-                    "type": "string"
-                }
-            }
-        },
-        "model.DefaultResponse": {
-            "type": "object",
-            "properties": {
-                "data": {}
-            }
         },
-        "model.TransactionData": {
-            "type": "object",
-            "properties": {
-                "account_id": {
-                    "type": "string"
-                },
-                "amount": {
-                    "type": "string"
-                },
+        "/api/v1/fx/rates": {
+            "get": {
+                "description": "Api will return status 200 with the rate valid now, 400 if a currency is invalid, 404 if there is no rate for the pair and 500 if there is an internal server error",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "FX"
+                ],
+                "summary": "API To get the current exchange rate of a currency pair",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ISO 4217 currency converted from",
+                        "name": "from",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ISO 4217 currency converted to",
+                        "name": "to",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.FXRate"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Stores rates with their validity window, a rate for the same currency pair and valid_from replaces the previous one. Requires the FX_ADMIN_TOKEN as a bearer token.\nApi will return status 200 if the rates are stored, 400 if a rate is invalid, 401 if the token is missing or wrong, 403 if the admin API is disabled and 500 if there is an internal server error",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "FX"
+                ],
+                "summary": "API To load exchange rates",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer \u003cFX_ADMIN_TOKEN\u003e",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "FX Rates Request",
+                        "name": "FXRatesRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.FXRatesRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/routing/explain": {
+            "get": {
+                "description": "Api will return status 200 with the routing rule the transaction matches and the gateways it would be sent to, 400 if the request is invalid and 500 if there is an internal server error",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Routing"
+                ],
+                "summary": "API To explain how a transaction would be routed",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Account ID",
+                        "name": "account_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Amount",
+                        "name": "amount",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ISO 4217 currency, the gateways that do not support it are left out",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Transaction type (deposit or withdraw)",
+                        "name": "type",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.RoutingExplanation"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transaction": {
+            "put": {
+                "description": "A pending transaction can move to success or failed, refunded and reversed transactions are only updated by refunds. A pending_review transaction is approved with initiated, which sends it to the payment gateways, or rejected with failed. Setting the status the transaction already has is a no-op. Requires the TRANSACTION_ADMIN_TOKEN as a bearer token.\nApi will return status 200 if the transaction is updated, 400 if the request is invalid, 401 if the token is missing or wrong, 403 if the admin API is disabled, 404 if the transaction is not found, 409 if the transaction cannot move to the status, was updated concurrently or no payment gateway accepts an approved transaction and 500 if there is an internal server error",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "API To update a transaction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer \u003cTRANSACTION_ADMIN_TOKEN\u003e",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Transaction Request",
+                        "name": "TransactionRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.UpdateTransactionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transaction/{transaction_id}": {
+            "get": {
+                "description": "Api will return status 200 if the transaction is found, 404 if the transaction is not found, 409 if several accounts have a transaction with the ID and 500 if there is an internal server error",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "API To get a transaction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Transaction ID",
+                        "name": "transaction_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.TransactionResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transaction/{transaction_id}/attempts": {
+            "get": {
+                "description": "Returns every call made to a payment gateway for the transaction, in the order they were made, with its timing, status code, error category and the fingerprints of the request and response\nApi will return status 200 if the transaction is found, 404 if the transaction is not found, 409 if several accounts have a transaction with the ID and 500 if there is an internal server error",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "API To get the payment gateway attempts of a transaction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Transaction ID",
+                        "name": "transaction_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.TransactionAttempt"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transaction/{transaction_id}/events": {
+            "get": {
+                "description": "Returns every event of the transaction, oldest first: its creation, the gateway attempts that led to it, its status changes and the gateway callbacks received for it\nApi will return status 200 if the transaction is found, 404 if the transaction is not found, 409 if several accounts have a transaction with the ID and 500 if there is an internal server error",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "API To get the history of a transaction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Transaction ID",
+                        "name": "transaction_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/model.TransactionEvent"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transactions": {
+            "get": {
+                "description": "Lists the transactions matching every filter given, newest first unless order is asc. A page has up to limit transactions (50 by default, at most 200), the next one is read by passing its next_cursor as the cursor with the same filters and order.\nApi will return status 200 with the page, 400 if a filter or the cursor is invalid and 500 if there is an internal server error",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "API To list transactions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Account ID",
+                        "name": "account_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Transaction status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Transaction type (deposit, withdraw, refund or reversal)",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name of the gateway that processed the transaction",
+                        "name": "gateway",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Minimum amount, inclusive",
+                        "name": "min_amount",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Maximum amount, inclusive",
+                        "name": "max_amount",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time the transactions were created at or after",
+                        "name": "created_from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time the transactions were created before",
+                        "name": "created_to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "asc or desc (default) creation time",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/model.TransactionPage"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transactions/{transaction_id}/refund": {
+            "post": {
+                "description": "Refunds all or part of a transaction on the payment gateway that processed it, the refund is recorded as a new transaction linked to the original one. A pending transaction is reversed instead, in full only. Omit the amount to refund everything that is left. Requires the TRANSACTION_ADMIN_TOKEN as a bearer token.\nApi will return status 200 if the refund is successful, 202 if its outcome at the gateway is unknown, 400 if the request is invalid or the amount exceeds what is left to refund, 401 if the token is missing or wrong, 403 if the admin API is disabled, 404 if the transaction is not found, 409 if the transaction cannot be refunded or several accounts have a transaction with the ID, 422 if the balance does not cover the refund of a deposit and 500 if there is an internal server error",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "API To refund a transaction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer \u003cTRANSACTION_ADMIN_TOKEN\u003e",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Transaction ID",
+                        "name": "transaction_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Refund Request",
+                        "name": "RefundRequest",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/controller.RefundRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.TransactionResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/model.TransactionResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/withdraw": {
+            "post": {
+                "description": "The amount is held on the account before any payment gateway is called, and captured or released once the withdrawal settles\nWith a quote_id the gateway is sent the amount converted at the rate of the quote, the amount held is the one in the currency of the account\nWith an Idempotency-Key the withdrawal is created at most once per key, a retry gets the response of the first request with the Idempotent-Replayed header\nApi will return status 200 if the transaction is successful, 202 if the risk rules sent it to pending_review or its outcome at the gateway is unknown, 400 if the request is invalid, the currency is not supported or the quote is unknown or does not match, 409 if the quote expired or was already used or the request of the idempotency key is still in progress, 422 if the available balance does not cover the amount (or with the code limit_exceeded if the withdrawal breaches a limit of the account, risk_denied if the risk rules deny it, idempotency_key_reused if the idempotency key was used for another request) and 500 if there is an internal server error",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "API To create a withdraw transaction",
+                "parameters": [
+                    {
+                        "description": "Transaction Request",
+                        "name": "TransactionRequest",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/controller.DepositRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Makes the request safe to retry, up to 255 characters",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.TransactionResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/model.TransactionResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "code": {
+                                            "type": "string"
+                                        },
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/model.DefaultError"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "error": {
+                                            "type": "string"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "controller.DepositRequest": {
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string"
+                },
+                "amount": {
+                    "type": "string"
+                },
+                "currency": {
+                    "description": "ISO 4217 code, the default currency when omitted",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.Currency"
+                        }
+                    ],
+                    "example": "USD"
+                },
+                "quote_id": {
+                    "description": "FX quote the amount is converted with, the amount and currency default to those of the quote",
+                    "type": "string"
+                }
+            }
+        },
+        "controller.FXQuoteRequest": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "string"
+                },
+                "from": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.Currency"
+                        }
+                    ],
+                    "example": "EUR"
+                },
+                "to": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.Currency"
+                        }
+                    ],
+                    "example": "USD"
+                }
+            }
+        },
+        "controller.FXRatesRequest": {
+            "type": "object",
+            "properties": {
+                "rates": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.FXRate"
+                    }
+                }
+            }
+        },
+        "controller.RefundRequest": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "string"
+                }
+            }
+        },
+        "controller.UpdateTransactionRequest": {
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/model.TransactionStatus"
+                },
+                "transaction_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.AccountBalance": {
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string"
+                },
+                "available": {
+                    "type": "string"
+                },
+                "currency": {
+                    "$ref": "#/definitions/model.Currency"
+                },
+                "held": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.Currency": {
+            "type": "string",
+            "enum": [
+                "USD"
+            ],
+            "x-enum-varnames": [
+                "DefaultCurrency"
+            ]
+        },
+        "model.DefaultError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "set for the errors a client may need to tell apart from others with the same status",
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.DefaultResponse": {
+            "type": "object",
+            "properties": {
+                "data": {}
+            }
+        },
+        "model.FXConversion": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "string"
+                },
+                "currency": {
+                    "$ref": "#/definitions/model.Currency"
+                },
+                "quote_id": {
+                    "type": "string"
+                },
+                "rate": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.FXQuote": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "description": "in From",
+                    "type": "string"
+                },
+                "converted_amount": {
+                    "description": "in To, rounded to its minor units",
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "from": {
+                    "$ref": "#/definitions/model.Currency"
+                },
+                "quote_id": {
+                    "type": "string"
+                },
+                "rate": {
+                    "type": "string"
+                },
+                "to": {
+                    "$ref": "#/definitions/model.Currency"
+                }
+            }
+        },
+        "model.FXRate": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "$ref": "#/definitions/model.Currency"
+                },
+                "rate": {
+                    "type": "string"
+                },
+                "to": {
+                    "$ref": "#/definitions/model.Currency"
+                },
+                "valid_from": {
+                    "type": "string"
+                },
+                "valid_to": {
+                    "description": "open-ended when omitted",
+                    "type": "string"
+                }
+            }
+        },
+        "model.RiskDecision": {
+            "type": "string",
+            "enum": [
+                "allow",
+                "review",
+                "deny"
+            ],
+            "x-enum-comments": {
+                "RiskDecisionDeny": "the transaction is rejected before any gateway is called",
+                "RiskDecisionReview": "the transaction waits in pending_review for an analyst"
+            },
+            "x-enum-varnames": [
+                "RiskDecisionAllow",
+                "RiskDecisionReview",
+                "RiskDecisionDeny"
+            ]
+        },
+        "model.RiskHit": {
+            "type": "object",
+            "properties": {
+                "decision": {
+                    "$ref": "#/definitions/model.RiskDecision"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "rule": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.RoutingExplanation": {
+            "type": "object",
+            "properties": {
+                "gateways": {
+                    "description": "gateway names, in the order they are tried when a rule matched",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "rule": {
+                    "description": "name of the matched rule, empty when no rule matched",
+                    "type": "string"
+                },
+                "strategy": {
+                    "description": "\"rule\" when a rule matched, otherwise the strategy that orders the gateways",
+                    "type": "string"
+                }
+            }
+        },
+        "model.TransactionAttempt": {
+            "type": "object",
+            "properties": {
+                "ended_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "the error of a failed attempt",
+                    "type": "string"
+                },
+                "error_category": {
+                    "description": "the category of the gateway error, empty for the attempt that succeeded",
+                    "type": "string"
+                },
+                "gateway": {
+                    "type": "string"
+                },
+                "latency_ms": {
+                    "type": "integer"
+                },
+                "request_fingerprint": {
+                    "description": "SHA-256 of what was sent to the gateway, the same for two identical requests",
+                    "type": "string"
+                },
+                "response_fingerprint": {
+                    "description": "SHA-256 of the raw response, before redaction",
+                    "type": "string"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status_code": {
+                    "description": "0 when no response was received",
+                    "type": "integer"
+                }
+            }
+        },
+        "model.TransactionData": {
+            "type": "object",
+            "properties": {
+                "account_id": {
+                    "type": "string"
+                },
+                "amount": {
+                    "type": "string"
+                },
+                "conversion": {
+                    "description": "set when the gateway processed the transaction in another currency",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.FXConversion"
+                        }
+                    ]
+                },
+                "created_at": {
+                    "description": "set once the transaction is stored",
+                    "type": "string"
+                },
+                "currency": {
+                    "$ref": "#/definitions/model.Currency"
+                },
+                "gateway": {
+                    "description": "name of the gateway that processed the transaction, set by SETA",
+                    "type": "string"
+                },
+                "gateway_reference": {
+                    "description": "the ID the gateway gave the transaction, set by SETA",
+                    "type": "string"
+                },
+                "gateway_response": {
+                    "description": "the response of the gateway as JSON, redacted",
+                    "type": "object"
+                },
+                "parent_transaction_id": {
+                    "description": "the transaction a refund or reversal undoes",
+                    "type": "string"
+                },
+                "risk_hits": {
+                    "description": "the risk rules that did not allow the transaction",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.RiskHit"
+                    }
+                },
                 "status": {
                     "$ref": "#/definitions/model.TransactionStatus"
                 },
@@ -366,6 +2033,81 @@ const docTemplate = `{
                 }
             }
         },
+        "model.TransactionEvent": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "detail": {
+                    "description": "eg. the error of a failed gateway attempt",
+                    "type": "string"
+                },
+                "payload_reference": {
+                    "description": "where the raw payload can be found: the request ID, the callback nonce or the refund transaction ID",
+                    "type": "string"
+                },
+                "previous_status": {
+                    "description": "empty for creations and gateway attempts",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.TransactionStatus"
+                        }
+                    ]
+                },
+                "source": {
+                    "description": "who caused the event",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "the status after the event",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.TransactionStatus"
+                        }
+                    ]
+                },
+                "type": {
+                    "$ref": "#/definitions/model.TransactionEventType"
+                }
+            }
+        },
+        "model.TransactionEventType": {
+            "type": "string",
+            "enum": [
+                "created",
+                "gateway_attempt",
+                "status_changed",
+                "callback"
+            ],
+            "x-enum-comments": {
+                "TransactionEventCallback": "a gateway callback was applied, also recorded when it did not change the status",
+                "TransactionEventCreated": "the transaction was recorded",
+                "TransactionEventGatewayAttempt": "a payment gateway was called, or skipped as its circuit was open",
+                "TransactionEventStatusChanged": "the status was updated through the API, the reconciler, the recovery or a refund"
+            },
+            "x-enum-varnames": [
+                "TransactionEventCreated",
+                "TransactionEventGatewayAttempt",
+                "TransactionEventStatusChanged",
+                "TransactionEventCallback"
+            ]
+        },
+        "model.TransactionPage": {
+            "type": "object",
+            "properties": {
+                "next_cursor": {
+                    "description": "the cursor of the next page, empty on the last one",
+                    "type": "string"
+                },
+                "transactions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.TransactionData"
+                    }
+                }
+            }
+        },
         "model.TransactionResponse": {
             "type": "object",
             "properties": {
@@ -379,23 +2121,43 @@ const docTemplate = `{
             "enum": [
                 "success",
                 "failed",
-                "pending"
+                "pending",
+                "partially_refunded",
+                "refunded",
+                "reversed",
+                "pending_review",
+                "unknown",
+                "initiated"
             ],
             "x-enum-varnames": [
                 "TransactionStatusSuccess",
                 "TransactionStatusFailed",
-                "TransactionStatusPending"
+                "TransactionStatusPending",
+                "TransactionStatusPartiallyRefunded",
+                "TransactionStatusRefunded",
+                "TransactionStatusReversed",
+                "TransactionStatusPendingReview",
+                "TransactionStatusUnknown",
+                "TransactionStatusInitiated"
             ]
         },
         "model.TransactionType": {
             "type": "string",
             "enum": [
                 "deposit",
-                "withdraw"
+                "withdraw",
+                "refund",
+                "reversal"
             ],
+            "x-enum-comments": {
+                "TransactionTypeRefund": "returns all or part of a settled transaction",
+                "TransactionTypeReversal": "cancels a transaction before it settled"
+            },
             "x-enum-varnames": [
                 "TransactionTypeDeposit",
-                "TransactionTypeWithdraw"
+                "TransactionTypeWithdraw",
+                "TransactionTypeRefund",
+                "TransactionTypeReversal"
             ]
         }
     }
@@ -4,13 +4,17 @@ import (
 	"context"
 	"log"
 	"seta/pkg/clients/paymentgateway"
-	"seta/pkg/clients/paymentgateway/paymentgatewaya"
-	"seta/pkg/clients/paymentgateway/paymentgatewayb"
+	_ "seta/pkg/clients/paymentgateway/paymentgatewaya"    // registers the gatewaya type
+	_ "seta/pkg/clients/paymentgateway/paymentgatewayb"    // registers the gatewayb type
+	_ "seta/pkg/clients/paymentgateway/paymentgatewayrest" // registers the rest type
 	"seta/pkg/config"
 	"seta/pkg/controller"
 	"seta/pkg/infra/pg"
 	"seta/pkg/logger"
+	"seta/pkg/model"
 	"seta/pkg/repository"
+	"seta/pkg/risk"
+	"seta/pkg/routing"
 	"seta/pkg/service"
 	"strings"
 
@@ -28,7 +32,10 @@ import (
 // @Schemes http
 func main() {
 	godotenv.Load()
-	config := config.GetConfigManager()
+	config, err := config.GetConfigManager()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	dbPool, err := pg.DBPoolProvider(config.GetDatabaseDSN(), context.Background())
 	if err != nil {
@@ -37,16 +44,114 @@ func main() {
 
 	defer dbPool.DB.Close()
 
-	transactionService := service.TransactionServiceProvider(repository.TransactionRepositoryProvider(dbPool.DB), []paymentgateway.IPaymentGateway{
-		paymentgatewaya.ClientProvider(config.GetGatewayAEndpoint()),
-		paymentgatewayb.ClientProvider(config.GetGatewayBEndpoint()),
+	// the gateways come from GATEWAYS_CONFIG_FILE, or the legacy GATEWAY_A_* and GATEWAY_B_* variables when it is not set
+	gatewayConfigs, err := config.GetGateways()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	paymentGateways, err := paymentgateway.BuildAll(gatewayConfigs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	weights := make(map[string]int, len(gatewayConfigs))
+	currencies := make(map[string][]model.Currency, len(gatewayConfigs))
+	for _, gatewayConfig := range gatewayConfigs {
+		weights[gatewayConfig.Name] = gatewayConfig.Weight
+		currencies[gatewayConfig.Name] = gatewayConfig.Currencies
+	}
+
+	defaultCurrency, supportedCurrencies, err := config.GetCurrencies()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	routingConfig := config.GetRouting()
+	strategyRouter, err := routing.RouterProvider(paymentGateways, routing.RouterConfig{
+		Strategy:      routing.Strategy(routingConfig.Strategy),
+		Weights:       weights,
+		LatencyWindow: routingConfig.LatencyWindow,
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// routing rules are evaluated first, transactions that match no rule are routed by the strategy
+	var routingRules []routing.Rule
+	if routingConfig.RulesFile != "" {
+		routingRules, err = routing.LoadRules(routingConfig.RulesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// built on the gateways of the strategy router, so that the rule routed calls are measured as well
+	router, err := routing.RulesRouterProvider(routingRules, routing.RoutedGateways(strategyRouter, paymentGateways), currencies, routing.Strategy(routingConfig.Strategy), strategyRouter)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// the rates of FX_RATES_FILE are stored at startup, more can be loaded through the admin API
+	fxConfig := config.GetFX()
+	fxService := service.FXServiceProvider(repository.FXRepositoryProvider(dbPool.DB), fxConfig.QuoteTTL)
+	if fxConfig.RatesFile != "" {
+		rates, err := service.LoadRates(fxConfig.RatesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := fxService.SaveRates(context.Background(), rates); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// the limits of LIMITS_FILE apply to every account, an account can have overrides in the account_limits table
+	var limitRules []model.LimitRule
+	if config.GetLimitsFile() != "" {
+		limitRules, err = service.LoadLimits(config.GetLimitsFile())
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	limitService := service.LimitServiceProvider(repository.LimitRepositoryProvider(dbPool.DB), limitRules)
+
+	// the rules of RISK_RULES_FILE assess every deposit and withdrawal in their order, before any gateway is called
+	var riskRules []risk.Rule
+	if config.GetRiskRulesFile() != "" {
+		riskRules, err = risk.LoadRules(config.GetRiskRulesFile())
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	transactionRepository := repository.TransactionRepositoryProvider(dbPool.DB)
+	ledgerService := service.LedgerServiceProvider(repository.LedgerRepositoryProvider(dbPool.DB), transactionRepository)
+	transactionService := service.TransactionServiceProvider(transactionRepository, router, service.WithTransactionTimeout(config.GetTransactionTimeout()), service.WithPaymentGateways(paymentGateways), service.WithLedger(ledgerService), service.WithCurrencies(defaultCurrency, supportedCurrencies), service.WithFX(fxService), service.WithLimits(limitService), service.WithRisk(risk.EngineProvider(riskRules)))
+	routingService := service.RoutingServiceProvider(router)
+	callbackService := service.CallbackServiceProvider(transactionService, repository.CallbackRepositoryProvider(dbPool.DB), paymentGateways, gatewayConfigs)
+
+	// pending transactions are checked with their gateway in the background until they settle or get too old
+	reconcilerCtx, stopReconciler := context.WithCancel(context.Background())
+	defer stopReconciler()
+	go service.ReconcilerProvider(transactionRepository, paymentGateways, config.GetReconciler(), ledgerService).Run(reconcilerCtx)
+	// the transactions left initiated by a previous run are resolved with the gateways, those still unknown are reconciled
+	go service.RecoveryProvider(transactionRepository, paymentGateways, config.GetRecovery(), ledgerService).Run(reconcilerCtx)
+
+	idempotencyService := service.IdempotencyServiceProvider(repository.IdempotencyRepositoryProvider(dbPool.DB), config.GetIdempotencyKeyTTL())
 
-	transactionController := controller.TransactionControllerProvider(transactionService)
+	transactionController := controller.TransactionControllerProvider(transactionService, idempotencyService, config.GetTransactionAdminToken())
+	routingController := controller.RoutingControllerProvider(routingService)
+	callbackController := controller.CallbackControllerProvider(callbackService)
+	accountController := controller.AccountControllerProvider(ledgerService)
+	fxController := controller.FXControllerProvider(fxService, fxConfig.AdminToken)
 
-	e := controller.SetupRoutes(transactionController)
+	e := controller.SetupRoutes(transactionController, routingController, callbackController, accountController, fxController)
 
 	transactionController.SetupRoutes(e.Group("/api/v1"))
+	routingController.SetupRoutes(e.Group("/api/v1"))
+	callbackController.SetupRoutes(e.Group("/api/v1"))
+	accountController.SetupRoutes(e.Group("/api/v1"))
+	fxController.SetupRoutes(e.Group("/api/v1"))
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 	e.Use(logger.LogMiddleware)
 	e.Use(middleware.GzipWithConfig(middleware.GzipConfig{
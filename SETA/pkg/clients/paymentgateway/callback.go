@@ -0,0 +1,64 @@
+package paymentgateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"seta/pkg/model"
+)
+
+// Callbacks are signed with HMAC-SHA256 over "<timestamp>.<nonce>.<body>" with the secret shared with the gateway. The
+// signature is hex encoded and sent with the timestamp (unix seconds) and nonce in the headers below
+const (
+	CallbackSignatureHeader = "X-Signature"
+	CallbackTimestampHeader = "X-Signature-Timestamp"
+	CallbackNonceHeader     = "X-Signature-Nonce"
+)
+
+var ErrInvalidCallbackSignature = errors.New("invalid callback signature")
+
+// CallbackParser is implemented by the gateways that notify SETA of transaction updates, it reads the provider's
+// native callback payload
+type CallbackParser interface {
+	ParseCallback(body []byte) (*model.TransactionResponse, error)
+}
+
+// Unwrapper is implemented by the gateway wrappers (circuit breaker, retrier, ...) to give access to the gateway they wrap
+type Unwrapper interface {
+	Unwrap() IPaymentGateway
+}
+
+// AsCallbackParser finds the callback parser of a gateway through the wrappers around it
+func AsCallbackParser(gateway IPaymentGateway) (CallbackParser, bool) {
+	for gateway != nil {
+		if parser, ok := gateway.(CallbackParser); ok {
+			return parser, true
+		}
+
+		unwrapper, ok := gateway.(Unwrapper)
+		if !ok {
+			return nil, false
+		}
+		gateway = unwrapper.Unwrap()
+	}
+
+	return nil, false
+}
+
+// SignCallback returns the signature of a callback, as a gateway computes it
+func SignCallback(secret string, timestamp string, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + nonce + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCallbackSignature checks the signature of a callback in constant time
+func VerifyCallbackSignature(secret string, timestamp string, nonce string, body []byte, signature string) error {
+	expected := SignCallback(secret, timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidCallbackSignature
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package paymentgateway
+
+import (
+	"context"
+	"errors"
+	"seta/pkg/config"
+	"seta/pkg/logger"
+	"seta/pkg/model"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+type CircuitState string
+
+const (
+	CircuitStateClosed   CircuitState = "closed"    // requests go through, failures are counted
+	CircuitStateOpen     CircuitState = "open"      // requests are rejected straight away until the cool-down is over
+	CircuitStateHalfOpen CircuitState = "half_open" // a single trial request is let through to probe the gateway
+)
+
+// ErrCircuitOpen is wrapped in the GatewayError returned when a gateway is skipped because its circuit is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker wraps a payment gateway and stops calling it after too many consecutive failures, so that requests
+// go straight to the next gateway instead of waiting on one that is down
+type CircuitBreaker struct {
+	Gateway IPaymentGateway
+	Config  config.CircuitBreakerConfig
+
+	mu               sync.Mutex
+	state            CircuitState
+	failures         int
+	openedAt         time.Time
+	halfOpenInFlight bool
+	now              func() time.Time
+}
+
+func CircuitBreakerProvider(gateway IPaymentGateway, circuitBreakerConfig config.CircuitBreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{
+		Gateway: gateway,
+		Config:  circuitBreakerConfig,
+		state:   CircuitStateClosed,
+		now:     time.Now,
+	}
+}
+
+func (cb *CircuitBreaker) Name() string {
+	return cb.Gateway.Name()
+}
+
+func (cb *CircuitBreaker) Unwrap() IPaymentGateway {
+	return cb.Gateway
+}
+
+func (cb *CircuitBreaker) Deposit(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+
+	transactionResponse, err := cb.Gateway.Deposit(ctx, AccountID, amount, currency)
+	cb.record(err)
+	return transactionResponse, err
+}
+
+func (cb *CircuitBreaker) Withdraw(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+
+	transactionResponse, err := cb.Gateway.Withdraw(ctx, AccountID, amount, currency)
+	cb.record(err)
+	return transactionResponse, err
+}
+
+func (cb *CircuitBreaker) Refund(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+
+	transactionResponse, err := cb.Gateway.Refund(ctx, gatewayTransactionID, amount, currency)
+	cb.record(err)
+	return transactionResponse, err
+}
+
+func (cb *CircuitBreaker) Reverse(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+
+	transactionResponse, err := cb.Gateway.Reverse(ctx, gatewayTransactionID, amount, currency)
+	cb.record(err)
+	return transactionResponse, err
+}
+
+func (cb *CircuitBreaker) GetTransactionStatus(ctx context.Context, gatewayTransactionID string) (*model.TransactionResponse, error) {
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+
+	transactionResponse, err := cb.Gateway.GetTransactionStatus(ctx, gatewayTransactionID)
+	cb.record(err)
+	return transactionResponse, err
+}
+
+// GetTransactionStatusByReference is sent even when the circuit is open and is not counted, it is what tells whether a
+// transaction the gateway just failed can safely be sent to another one
+func (cb *CircuitBreaker) GetTransactionStatusByReference(ctx context.Context, clientReference string) (*model.TransactionResponse, error) {
+	return cb.Gateway.GetTransactionStatusByReference(ctx, clientReference)
+}
+
+// State returns the current state of the circuit, an open circuit past its cool-down is reported as half-open
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitStateOpen && cb.now().Sub(cb.openedAt) >= cb.Config.CoolDown {
+		return CircuitStateHalfOpen
+	}
+	return cb.state
+}
+
+// allow decides whether a request may be sent to the gateway
+func (cb *CircuitBreaker) allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitStateOpen:
+		if cb.now().Sub(cb.openedAt) < cb.Config.CoolDown {
+			return NewGatewayError(cb.Name(), ErrorCategoryNetwork, 0, ErrCircuitOpen)
+		}
+		cb.setState(CircuitStateHalfOpen)
+		cb.halfOpenInFlight = true
+		return nil
+	case CircuitStateHalfOpen:
+		// only one trial request at a time, the others keep skipping the gateway until it has proven healthy
+		if cb.halfOpenInFlight {
+			return NewGatewayError(cb.Name(), ErrorCategoryNetwork, 0, ErrCircuitOpen)
+		}
+		cb.halfOpenInFlight = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record updates the circuit with the outcome of a request. Only failures of the gateway itself count, a declined or
+// invalid request shows the gateway is up and answering
+func (cb *CircuitBreaker) record(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	// the caller gave up on the request, that says nothing about the gateway
+	if errors.Is(err, context.Canceled) {
+		if cb.state == CircuitStateHalfOpen {
+			cb.halfOpenInFlight = false
+		}
+		return
+	}
+
+	var gatewayError *GatewayError
+	failed := errors.As(err, &gatewayError) && gatewayError.Retryable()
+
+	switch cb.state {
+	case CircuitStateHalfOpen:
+		cb.halfOpenInFlight = false
+		if failed {
+			cb.open()
+		} else {
+			cb.failures = 0
+			cb.setState(CircuitStateClosed)
+		}
+	case CircuitStateClosed:
+		if !failed {
+			cb.failures = 0
+			return
+		}
+		cb.failures++
+		if cb.failures >= cb.Config.FailureThreshold {
+			cb.open()
+		}
+	}
+}
+
+func (cb *CircuitBreaker) open() {
+	cb.openedAt = cb.now()
+	cb.setState(CircuitStateOpen)
+}
+
+func (cb *CircuitBreaker) setState(state CircuitState) {
+	if cb.state == state {
+		return
+	}
+
+	logger.Logger.WithFields(logrus.Fields{
+		"gateway":   cb.Name(),
+		"from":      cb.state,
+		"to":        state,
+		"failures":  cb.failures,
+		"cool_down": cb.Config.CoolDown.String(),
+	}).Warn("payment gateway circuit breaker state changed")
+
+	cb.state = state
+}
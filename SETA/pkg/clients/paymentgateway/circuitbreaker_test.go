@@ -0,0 +1,78 @@
+package paymentgateway
+
+import (
+	"context"
+	"errors"
+	"seta/pkg/config"
+	"seta/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCircuitBreaker(gateway *MockClient, clock *time.Time) *CircuitBreaker {
+	circuitBreaker := CircuitBreakerProvider(gateway, config.CircuitBreakerConfig{FailureThreshold: 2, CoolDown: time.Minute})
+	circuitBreaker.now = func() time.Time { return *clock }
+	return circuitBreaker
+}
+
+func TestCircuitBreaker_OpensAfterThreshold(t *testing.T) {
+	clock := time.Now()
+	gateway := &MockClient{StatusCode: 500}
+	circuitBreaker := newTestCircuitBreaker(gateway, &clock)
+
+	for i := 0; i < 2; i++ {
+		_, err := circuitBreaker.Deposit(context.Background(), "acc123", decimal.NewFromInt(100), "USD")
+		assert.False(t, errors.Is(err, ErrCircuitOpen))
+	}
+	assert.Equal(t, CircuitStateOpen, circuitBreaker.State())
+
+	// the gateway is skipped without being called while the circuit is open
+	gateway.Delay = time.Hour
+	_, err := circuitBreaker.Deposit(context.Background(), "acc123", decimal.NewFromInt(100), "USD")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	var gatewayError *GatewayError
+	assert.ErrorAs(t, err, &gatewayError)
+	assert.True(t, gatewayError.Retryable())
+}
+
+func TestCircuitBreaker_HalfOpenTrial(t *testing.T) {
+	clock := time.Now()
+	gateway := &MockClient{StatusCode: 500}
+	circuitBreaker := newTestCircuitBreaker(gateway, &clock)
+
+	for i := 0; i < 2; i++ {
+		circuitBreaker.Withdraw(context.Background(), "acc123", decimal.NewFromInt(100), "USD")
+	}
+	assert.Equal(t, CircuitStateOpen, circuitBreaker.State())
+
+	// after the cool-down a failing trial request opens the circuit again
+	clock = clock.Add(time.Minute)
+	assert.Equal(t, CircuitStateHalfOpen, circuitBreaker.State())
+	_, err := circuitBreaker.Withdraw(context.Background(), "acc123", decimal.NewFromInt(100), "USD")
+	assert.False(t, errors.Is(err, ErrCircuitOpen))
+	assert.Equal(t, CircuitStateOpen, circuitBreaker.State())
+
+	// and a successful one closes it
+	clock = clock.Add(time.Minute)
+	gateway.StatusCode = 200
+	gateway.TransactionResponse = &model.TransactionResponse{}
+	_, err = circuitBreaker.Withdraw(context.Background(), "acc123", decimal.NewFromInt(100), "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitStateClosed, circuitBreaker.State())
+}
+
+func TestCircuitBreaker_IgnoresNonRetryableErrors(t *testing.T) {
+	clock := time.Now()
+	gateway := &MockClient{StatusCode: 400}
+	circuitBreaker := newTestCircuitBreaker(gateway, &clock)
+
+	// a rejected request means the gateway is up and answering
+	for i := 0; i < 5; i++ {
+		circuitBreaker.Deposit(context.Background(), "acc123", decimal.NewFromInt(100), "USD")
+	}
+	assert.Equal(t, CircuitStateClosed, circuitBreaker.State())
+}
@@ -1,12 +1,59 @@
 package paymentgateway
 
 import (
+	"context"
 	"seta/pkg/model"
 
 	"github.com/shopspring/decimal"
 )
 
+// IPaymentGateway is implemented by every payment gateway client. Failures are returned as a *GatewayError
 type IPaymentGateway interface {
-	Deposit(AccountID string, amount decimal.Decimal) (*model.TransactionResponse, *int, error)
-	Withdraw(AccountID string, amount decimal.Decimal) (*model.TransactionResponse, *int, error)
+	Name() string
+	Deposit(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error)
+	Withdraw(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error)
+	// Refund returns all or part of a settled transaction, gatewayTransactionID is the ID the gateway gave the original transaction
+	Refund(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error)
+	// Reverse cancels a transaction the gateway has not settled yet, so that it never reaches the account
+	Reverse(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error)
+	// GetTransactionStatus asks the gateway for the current state of a transaction it processed
+	GetTransactionStatus(ctx context.Context, gatewayTransactionID string) (*model.TransactionResponse, error)
+	// GetTransactionStatusByReference looks a transaction up by the client reference SETA sent with it, the error wraps
+	// ErrReferenceNotFound when the gateway has no transaction with that reference
+	GetTransactionStatusByReference(ctx context.Context, clientReference string) (*model.TransactionResponse, error)
+}
+
+type idempotencyKeyContextKey struct{}
+
+type clientReferenceContextKey struct{}
+
+const (
+	// IdempotencyKeyHeader is the header REST gateways expect the idempotency key in
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// ClientReferenceHeader is the header REST gateways are sent the client reference in
+	ClientReferenceHeader = "X-Client-Reference"
+)
+
+// WithIdempotencyKey attaches the key a gateway uses to recognise a repeated request, every attempt of the same
+// transaction must carry the same key so that a retry cannot be executed twice
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns the idempotency key attached to ctx, or an empty string
+func IdempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyContextKey{}).(string)
+	return key
+}
+
+// WithClientReference attaches the reference SETA gives a transaction, it is sent to every gateway the transaction is
+// tried on so that each of them can be asked later whether it processed it
+func WithClientReference(ctx context.Context, reference string) context.Context {
+	return context.WithValue(ctx, clientReferenceContextKey{}, reference)
+}
+
+// ClientReferenceFromContext returns the client reference attached to ctx, or an empty string
+func ClientReferenceFromContext(ctx context.Context) string {
+	reference, _ := ctx.Value(clientReferenceContextKey{}).(string)
+	return reference
 }
@@ -0,0 +1,126 @@
+package paymentgateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+type ErrorCategory string
+
+const (
+	ErrorCategoryNetwork    ErrorCategory = "network"    // the gateway could not be reached or the connection dropped
+	ErrorCategoryTimeout    ErrorCategory = "timeout"    // the gateway did not answer in time
+	ErrorCategoryDeclined   ErrorCategory = "declined"   // the gateway refused the transaction (eg. insufficient funds, duplicate)
+	ErrorCategoryValidation ErrorCategory = "validation" // the gateway rejected the request as malformed or invalid
+	ErrorCategoryAuth       ErrorCategory = "auth"       // the gateway rejected our credentials
+	ErrorCategoryServer     ErrorCategory = "server"     // the gateway failed to process a valid request
+	ErrorCategoryUnknown    ErrorCategory = "unknown"    // the gateway answered with something we could not make sense of
+)
+
+// ErrNotSupported is wrapped in the validation GatewayError returned when a gateway does not offer an operation
+var ErrNotSupported = errors.New("operation not supported by the gateway")
+
+// ErrReferenceNotFound is wrapped in the validation GatewayError returned when a gateway has no transaction with a client reference
+var ErrReferenceNotFound = errors.New("no transaction with the client reference")
+
+// GatewayError is the error returned by every payment gateway client, the category drives the failover decision
+type GatewayError struct {
+	Gateway    string
+	Category   ErrorCategory
+	StatusCode int // raw status code returned by the gateway, 0 when no response was received
+	Err        error
+}
+
+func NewGatewayError(gateway string, category ErrorCategory, statusCode int, err error) *GatewayError {
+	return &GatewayError{
+		Gateway:    gateway,
+		Category:   category,
+		StatusCode: statusCode,
+		Err:        err,
+	}
+}
+
+func (e *GatewayError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("payment gateway %s failed with %s error: %v", e.Gateway, e.Category, e.Err)
+	}
+	return fmt.Sprintf("payment gateway %s failed with %s error (status code %d): %v", e.Gateway, e.Category, e.StatusCode, e.Err)
+}
+
+func (e *GatewayError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the transaction can be sent to another gateway. Only failures of the gateway itself are
+// retryable, a request that was declined or rejected as invalid would fail the same way everywhere
+func (e *GatewayError) Retryable() bool {
+	switch e.Category {
+	case ErrorCategoryNetwork, ErrorCategoryTimeout, ErrorCategoryServer:
+		return true
+	default:
+		return false
+	}
+}
+
+// Ambiguous reports whether the gateway may have processed the transaction in spite of the error: it did not answer in
+// time, failed on its side or dropped the connection after the request was sent. A request that was shed or never
+// left SETA (circuit open, connection refused) certainly was not processed
+func (e *GatewayError) Ambiguous() bool {
+	switch e.Category {
+	case ErrorCategoryTimeout:
+		return true
+	case ErrorCategoryServer:
+		return e.StatusCode != http.StatusTooManyRequests
+	case ErrorCategoryNetwork:
+		var opErr *net.OpError
+		if errors.Is(e.Err, ErrCircuitOpen) || (errors.As(e.Err, &opErr) && opErr.Op == "dial") {
+			return false
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// CategoryFromStatusCode maps a non successful HTTP status code returned by a gateway to an error category
+func CategoryFromStatusCode(statusCode int) ErrorCategory {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrorCategoryAuth
+	case statusCode == http.StatusPaymentRequired || statusCode == http.StatusConflict:
+		return ErrorCategoryDeclined
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusGatewayTimeout:
+		return ErrorCategoryTimeout
+	case statusCode == http.StatusTooManyRequests:
+		// the gateway is shedding load, another gateway may still take the transaction
+		return ErrorCategoryServer
+	case statusCode >= 400 && statusCode < 500:
+		return ErrorCategoryValidation
+	case statusCode >= 500:
+		return ErrorCategoryServer
+	default:
+		return ErrorCategoryUnknown
+	}
+}
+
+// NewStatusError builds the error for a response with a non successful status code
+func NewStatusError(gateway string, statusCode int) *GatewayError {
+	return NewGatewayError(gateway, CategoryFromStatusCode(statusCode), statusCode, fmt.Errorf("unexpected status %s", http.StatusText(statusCode)))
+}
+
+// NewTransportError builds the error for a request that did not get a response from the gateway
+func NewTransportError(gateway string, err error) *GatewayError {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return NewGatewayError(gateway, ErrorCategoryTimeout, 0, err)
+	}
+	return NewGatewayError(gateway, ErrorCategoryNetwork, 0, err)
+}
+
+// NewReferenceNotFoundError builds the error for a client reference the gateway has no transaction for
+func NewReferenceNotFoundError(gateway string, statusCode int, clientReference string) *GatewayError {
+	return NewGatewayError(gateway, ErrorCategoryValidation, statusCode, fmt.Errorf("%w: %s", ErrReferenceNotFound, clientReference))
+}
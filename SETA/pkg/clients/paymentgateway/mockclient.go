@@ -1,17 +1,33 @@
 package paymentgateway
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"seta/pkg/model"
+	"time"
 
 	"github.com/shopspring/decimal"
 )
 
+const MockClientName = "mock"
+
 type MockClient struct {
+	GatewayName         string
 	TransactionResponse *model.TransactionResponse
 	StatusCode          int
 	Err                 error
 	IsServiceDown       bool
+	Delay               time.Duration // simulates a slow gateway, the call is cut short if the context is done first
+	// what a lookup by client reference returns: ReferenceErr if set, else ReferenceResponse, else a reference not found error
+	ReferenceResponse *model.TransactionResponse
+	ReferenceErr      error
+	// the idempotency key and client reference the last call was made with
+	IdempotencyKey  string
+	ClientReference string
 }
 
 func MockClientProvider(transactionResponse *model.TransactionResponse, statusCode int, err error, isServiceDown bool) IPaymentGateway {
@@ -23,18 +39,97 @@ func MockClientProvider(transactionResponse *model.TransactionResponse, statusCo
 	}
 }
 
-func (c *MockClient) Deposit(AccountID string, amount decimal.Decimal) (*model.TransactionResponse, *int, error) {
-	if c.IsServiceDown {
-		return nil, &c.StatusCode, fmt.Errorf("service is down")
+func (c *MockClient) Name() string {
+	if c.GatewayName == "" {
+		return MockClientName
+	}
+	return c.GatewayName
+}
+
+func (c *MockClient) Deposit(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	return c.respond(ctx)
+}
+
+func (c *MockClient) Withdraw(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	return c.respond(ctx)
+}
+
+func (c *MockClient) Refund(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	return c.respond(ctx)
+}
+
+func (c *MockClient) Reverse(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	return c.respond(ctx)
+}
+
+func (c *MockClient) GetTransactionStatus(ctx context.Context, gatewayTransactionID string) (*model.TransactionResponse, error) {
+	return c.respond(ctx)
+}
+
+func (c *MockClient) GetTransactionStatusByReference(ctx context.Context, clientReference string) (*model.TransactionResponse, error) {
+	var gatewayError *GatewayError
+	switch {
+	case errors.As(c.ReferenceErr, &gatewayError):
+		return nil, c.ReferenceErr
+	case c.ReferenceErr != nil:
+		return nil, NewGatewayError(c.Name(), ErrorCategoryUnknown, 0, c.ReferenceErr)
+	case c.ReferenceResponse == nil:
+		return nil, NewReferenceNotFoundError(c.Name(), http.StatusNotFound, clientReference)
 	}
 
-	return c.TransactionResponse, &c.StatusCode, c.Err
+	transactionResponse := *c.ReferenceResponse
+	transactionResponse.Data.GatewayStatusCode = http.StatusOK
+	return &transactionResponse, nil
+}
+
+// ParseCallback reads the callback as a JSON TransactionResponse
+func (c *MockClient) ParseCallback(body []byte) (*model.TransactionResponse, error) {
+	var transactionResponse model.TransactionResponse
+	if err := json.Unmarshal(body, &transactionResponse); err != nil {
+		return nil, err
+	}
+	return &transactionResponse, nil
 }
 
-func (c *MockClient) Withdraw(AccountID string, amount decimal.Decimal) (*model.TransactionResponse, *int, error) {
+// respond mimics a real client: failures are returned as a *GatewayError, categorised from the status code unless Err already is one
+func (c *MockClient) respond(ctx context.Context) (*model.TransactionResponse, error) {
+	c.IdempotencyKey, c.ClientReference = IdempotencyKeyFromContext(ctx), ClientReferenceFromContext(ctx)
+
+	if c.Delay > 0 {
+		select {
+		case <-time.After(c.Delay):
+		case <-ctx.Done():
+			return nil, NewTransportError(c.Name(), ctx.Err())
+		}
+	}
+
+	// like a refused connection, the request never reached the gateway
 	if c.IsServiceDown {
-		return nil, &c.StatusCode, fmt.Errorf("service is down")
+		return nil, NewTransportError(c.Name(), &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("service is down")})
 	}
 
-	return c.TransactionResponse, &c.StatusCode, c.Err
+	var gatewayError *GatewayError
+	if errors.As(c.Err, &gatewayError) {
+		return nil, c.Err
+	}
+
+	if c.StatusCode >= 400 {
+		err := c.Err
+		if err == nil {
+			err = fmt.Errorf("unexpected status code %d", c.StatusCode)
+		}
+		return nil, NewGatewayError(c.Name(), CategoryFromStatusCode(c.StatusCode), c.StatusCode, err)
+	}
+
+	if c.Err != nil {
+		return nil, NewGatewayError(c.Name(), ErrorCategoryUnknown, c.StatusCode, c.Err)
+	}
+
+	// a copy, like a real client returns a new response on every call
+	if c.TransactionResponse == nil {
+		return nil, nil
+	}
+	transactionResponse := *c.TransactionResponse
+	transactionResponse.Data.GatewayStatusCode = c.StatusCode
+	return &transactionResponse, nil
 }
@@ -2,85 +2,210 @@ package paymentgatewaya
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/config"
 	"seta/pkg/model"
-	"time"
 
 	"github.com/shopspring/decimal"
 )
 
+// Name is the type Payment Gateway A is registered under, and the default name of its client
+const Name = "gatewaya"
+
+func init() {
+	paymentgateway.Register(Name, Factory)
+}
+
 type Client struct {
-	Endpoint   string
-	HTTPClient *http.Client
-	// AuthToken string // implied that the client requires an auth token
+	GatewayName string
+	Endpoint    string
+	HTTPClient  *http.Client
+	AuthToken   string // sent as a bearer token when set
 }
 
 func ClientProvider(Endpoint string) paymentgateway.IPaymentGateway {
 	httpClient := &http.Client{}
-	httpClient.Timeout = 60 * time.Second
+	httpClient.Timeout = config.DefaultGatewayTimeout // upper bound only, the request context deadline is what normally ends a call
 
 	return &Client{
-		Endpoint:   Endpoint,
-		HTTPClient: httpClient,
+		GatewayName: Name,
+		Endpoint:    Endpoint,
+		HTTPClient:  httpClient,
 	}
 }
 
-func (c *Client) Deposit(AccountID string, amount decimal.Decimal) (*model.TransactionResponse, *int, error) {
+// Factory builds the client from the gateways config, the auth_token credential is sent as a bearer token
+func Factory(gatewayConfig config.GatewayConfig) (paymentgateway.IPaymentGateway, error) {
+	if gatewayConfig.Endpoint == "" {
+		return nil, fmt.Errorf("endpoint is required")
+	}
+
+	return &Client{
+		GatewayName: gatewayConfig.Name,
+		Endpoint:    gatewayConfig.Endpoint,
+		HTTPClient:  &http.Client{Timeout: gatewayConfig.Timeout},
+		AuthToken:   gatewayConfig.Credentials["auth_token"],
+	}, nil
+}
+
+func (c *Client) Name() string {
+	return c.GatewayName
+}
+
+func (c *Client) Deposit(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
 	depositRequest := &model.DepositRequest{
-		AccountID: AccountID,
-		Amount:    amount,
+		AccountID:       AccountID,
+		Amount:          amount,
+		Currency:        currency,
+		ClientReference: paymentgateway.ClientReferenceFromContext(ctx),
 	}
 
 	payload, err := json.Marshal(depositRequest)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	// Call the payment gateway API
-	resp, err := c.HTTPClient.Post(c.Endpoint+"/deposit", "application/json", bytes.NewBuffer(payload))
+	return c.post(ctx, "/deposit", payload)
+}
+
+func (c *Client) Withdraw(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	withdrawRequest := &model.WithdrawRequest{
+		AccountID:       AccountID,
+		Amount:          amount,
+		Currency:        currency,
+		ClientReference: paymentgateway.ClientReferenceFromContext(ctx),
+	}
+
+	payload, err := json.Marshal(withdrawRequest)
 	if err != nil {
-		return nil, &resp.StatusCode, err
+		return nil, err
 	}
 
-	// Parse the response
-	var gatewayATransactionResponse model.GatewayATransactionResponse
-	err = json.NewDecoder(resp.Body).Decode(&gatewayATransactionResponse)
+	return c.post(ctx, "/withdraw", payload)
+}
+
+func (c *Client) Refund(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	refundRequest := &model.RefundRequest{
+		TransactionID:   gatewayTransactionID,
+		Amount:          amount,
+		Currency:        currency,
+		ClientReference: paymentgateway.ClientReferenceFromContext(ctx),
+	}
+
+	payload, err := json.Marshal(refundRequest)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	transactionResponse := model.MapGatewayATransactionResponse(&gatewayATransactionResponse)
+	return c.post(ctx, "/refund", payload)
+}
+
+func (c *Client) Reverse(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	reverseRequest := &model.RefundRequest{
+		TransactionID:   gatewayTransactionID,
+		Amount:          amount,
+		Currency:        currency,
+		ClientReference: paymentgateway.ClientReferenceFromContext(ctx),
+	}
+
+	payload, err := json.Marshal(reverseRequest)
+	if err != nil {
+		return nil, err
+	}
 
-	return &transactionResponse, &resp.StatusCode, nil
+	return c.post(ctx, "/reverse", payload)
 }
 
-func (c *Client) Withdraw(AccountID string, amount decimal.Decimal) (*model.TransactionResponse, *int, error) {
-	withdrawRequest := &model.WithdrawRequest{
-		AccountID: AccountID,
-		Amount:    amount,
+func (c *Client) GetTransactionStatus(ctx context.Context, gatewayTransactionID string) (*model.TransactionResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Endpoint+"/transaction/"+url.PathEscape(gatewayTransactionID), nil)
+	if err != nil {
+		return nil, err
 	}
 
-	payload, err := json.Marshal(withdrawRequest)
+	return c.do(req)
+}
+
+// GetTransactionStatusByReference queries GET /transaction?client_reference=, Payment Gateway A answers a reference it
+// has no transaction for with a 404
+func (c *Client) GetTransactionStatusByReference(ctx context.Context, clientReference string) (*model.TransactionResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Endpoint+"/transaction?client_reference="+url.QueryEscape(clientReference), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	transactionResponse, err := c.do(req)
+	var gatewayError *paymentgateway.GatewayError
+	if errors.As(err, &gatewayError) && gatewayError.StatusCode == http.StatusNotFound {
+		return nil, paymentgateway.NewReferenceNotFoundError(c.Name(), gatewayError.StatusCode, clientReference)
+	}
+	return transactionResponse, err
+}
+
+func (c *Client) post(ctx context.Context, path string, payload []byte) (*model.TransactionResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint+path, bytes.NewBuffer(payload))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey := paymentgateway.IdempotencyKeyFromContext(ctx); idempotencyKey != "" {
+		req.Header.Set(paymentgateway.IdempotencyKeyHeader, idempotencyKey)
+	}
+	if clientReference := paymentgateway.ClientReferenceFromContext(ctx); clientReference != "" {
+		req.Header.Set(paymentgateway.ClientReferenceHeader, clientReference)
+	}
+
+	return c.do(req)
+}
+
+func (c *Client) do(req *http.Request) (*model.TransactionResponse, error) {
+	if c.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AuthToken)
 	}
 
 	// Call the payment gateway API
-	resp, err := c.HTTPClient.Post(c.Endpoint+"/withdraw", "application/json", bytes.NewBuffer(payload))
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return nil, &resp.StatusCode, err
+		// no response was received (network error, timeout or cancellation)
+		return nil, paymentgateway.NewTransportError(c.Name(), err)
 	}
+	defer resp.Body.Close()
 
-	// Parse the response
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, paymentgateway.NewStatusError(c.Name(), resp.StatusCode)
+	}
+
+	// Parse the response, it is kept as is for support
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, paymentgateway.NewTransportError(c.Name(), err)
+	}
 	var gatewayATransactionResponse model.GatewayATransactionResponse
-	err = json.NewDecoder(resp.Body).Decode(&gatewayATransactionResponse)
+	err = json.Unmarshal(body, &gatewayATransactionResponse)
 	if err != nil {
-		return nil, nil, err
+		return nil, paymentgateway.NewGatewayError(c.Name(), paymentgateway.ErrorCategoryUnknown, resp.StatusCode, err)
 	}
 
 	transactionResponse := model.MapGatewayATransactionResponse(&gatewayATransactionResponse)
+	transactionResponse.Data.GatewayResponse = body
+	transactionResponse.Data.GatewayStatusCode = resp.StatusCode
+
+	return &transactionResponse, nil
+}
 
-	return &transactionResponse, &resp.StatusCode, nil
+// ParseCallback reads a callback, Payment Gateway A sends the same JSON document as its API responses
+func (c *Client) ParseCallback(body []byte) (*model.TransactionResponse, error) {
+	var gatewayATransactionResponse model.GatewayATransactionResponse
+	if err := json.Unmarshal(body, &gatewayATransactionResponse); err != nil {
+		return nil, err
+	}
+
+	transactionResponse := model.MapGatewayATransactionResponse(&gatewayATransactionResponse)
+	return &transactionResponse, nil
 }
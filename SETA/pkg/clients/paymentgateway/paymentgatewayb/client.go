@@ -3,86 +3,265 @@ package paymentgatewayb
 // paymentgatewayb is a client for Payment Gateway B. This one uses SOAP/XML. but the API is similar to Payment Gateway A.
 
 import (
-	"bytes"
+	"context"
+	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"net/http"
 	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/clients/soap"
+	"seta/pkg/config"
 	"seta/pkg/model"
-	"time"
+	"strings"
 
 	"github.com/shopspring/decimal"
 )
 
+const (
+	Name           = "gatewayb" // the type Payment Gateway B is registered under, and the default name of its client
+	Namespace      = "urn:paymentgatewayb"
+	DepositAction  = Namespace + "/Deposit"
+	WithdrawAction = Namespace + "/Withdraw"
+	RefundAction   = Namespace + "/Refund"
+	ReverseAction  = Namespace + "/Reverse"
+	StatusAction   = Namespace + "/GetTransactionStatus"
+)
+
+func init() {
+	paymentgateway.Register(Name, Factory)
+}
+
 type Client struct {
-	Endpoint   string
-	HTTPClient *http.Client
-	// AuthToken string // implied that the client requires an auth token
+	GatewayName string
+	Endpoint    string
+	HTTPClient  *http.Client
+	SOAPVersion soap.Version
+	AuthToken   string // sent as a bearer token when set
+}
+
+// depositRequest and withdrawRequest are the SOAP body payloads, namespaced to the gateway's service
+type depositRequest struct {
+	XMLName xml.Name `xml:"urn:paymentgatewayb DepositRequest"`
+	model.DepositRequest
+}
+
+type withdrawRequest struct {
+	XMLName xml.Name `xml:"urn:paymentgatewayb WithdrawRequest"`
+	model.WithdrawRequest
+}
+
+type refundRequest struct {
+	XMLName xml.Name `xml:"urn:paymentgatewayb RefundRequest"`
+	model.RefundRequest
+}
+
+type reverseRequest struct {
+	XMLName xml.Name `xml:"urn:paymentgatewayb ReverseRequest"`
+	model.RefundRequest
+}
+
+// statusRequest asks for a transaction by the ID the gateway gave it or by the client reference it was sent with
+type statusRequest struct {
+	XMLName         xml.Name `xml:"urn:paymentgatewayb GetTransactionStatusRequest"`
+	TransactionID   string   `xml:"TransactionID,omitempty"`
+	ClientReference string   `xml:"ClientReference,omitempty"`
+}
+
+// requestHeader is the SOAP header block, the gateway uses the idempotency key to recognise a retried request
+type requestHeader struct {
+	XMLName        xml.Name `xml:"urn:paymentgatewayb RequestHeader"`
+	IdempotencyKey string   `xml:"IdempotencyKey"`
 }
 
-func ClientProvider(Endpoint string) paymentgateway.IPaymentGateway {
+func ClientProvider(Endpoint string, soapVersion soap.Version) paymentgateway.IPaymentGateway {
 	httpClient := &http.Client{}
-	httpClient.Timeout = 60 * time.Second
+	httpClient.Timeout = config.DefaultGatewayTimeout // upper bound only, the request context deadline is what normally ends a call
 
 	return &Client{
-		Endpoint:   Endpoint,
-		HTTPClient: httpClient,
+		GatewayName: Name,
+		Endpoint:    Endpoint,
+		HTTPClient:  httpClient,
+		SOAPVersion: soapVersion,
+	}
+}
+
+// Factory builds the client from the gateways config. The soap_version option selects SOAP 1.1 (default) or 1.2 and
+// the auth_token credential is sent as a bearer token
+func Factory(gatewayConfig config.GatewayConfig) (paymentgateway.IPaymentGateway, error) {
+	if gatewayConfig.Endpoint == "" {
+		return nil, fmt.Errorf("endpoint is required")
 	}
+
+	return &Client{
+		GatewayName: gatewayConfig.Name,
+		Endpoint:    gatewayConfig.Endpoint,
+		HTTPClient:  &http.Client{Timeout: gatewayConfig.Timeout},
+		SOAPVersion: soap.ParseVersion(gatewayConfig.Options["soap_version"]),
+		AuthToken:   gatewayConfig.Credentials["auth_token"],
+	}, nil
+}
+
+func (c *Client) Name() string {
+	return c.GatewayName
 }
 
-func (c *Client) Deposit(AccountID string, amount decimal.Decimal) (*model.TransactionResponse, *int, error) {
-	depositRequest := &model.DepositRequest{
-		AccountID: AccountID,
-		Amount:    amount,
+func (c *Client) Deposit(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	request := &depositRequest{
+		DepositRequest: model.DepositRequest{
+			AccountID:       AccountID,
+			Amount:          amount,
+			Currency:        currency,
+			ClientReference: paymentgateway.ClientReferenceFromContext(ctx),
+		},
 	}
 
-	payload, err := xml.Marshal(depositRequest)
+	return c.call(ctx, "/deposit", DepositAction, request)
+}
+
+func (c *Client) Withdraw(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	request := &withdrawRequest{
+		WithdrawRequest: model.WithdrawRequest{
+			AccountID:       AccountID,
+			Amount:          amount,
+			Currency:        currency,
+			ClientReference: paymentgateway.ClientReferenceFromContext(ctx),
+		},
+	}
+
+	return c.call(ctx, "/withdraw", WithdrawAction, request)
+}
+
+func (c *Client) Refund(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	request := &refundRequest{
+		RefundRequest: model.RefundRequest{
+			TransactionID:   gatewayTransactionID,
+			Amount:          amount,
+			Currency:        currency,
+			ClientReference: paymentgateway.ClientReferenceFromContext(ctx),
+		},
+	}
+
+	return c.call(ctx, "/refund", RefundAction, request)
+}
+
+func (c *Client) Reverse(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	request := &reverseRequest{
+		RefundRequest: model.RefundRequest{
+			TransactionID:   gatewayTransactionID,
+			Amount:          amount,
+			Currency:        currency,
+			ClientReference: paymentgateway.ClientReferenceFromContext(ctx),
+		},
+	}
+
+	return c.call(ctx, "/reverse", ReverseAction, request)
+}
+
+func (c *Client) GetTransactionStatus(ctx context.Context, gatewayTransactionID string) (*model.TransactionResponse, error) {
+	request := &statusRequest{TransactionID: gatewayTransactionID}
+
+	return c.call(ctx, "/status", StatusAction, request)
+}
+
+// GetTransactionStatusByReference sends the status request with the client reference, Payment Gateway B answers a
+// reference it has no transaction for with a Client.NotFound fault (a Sender fault with a NotFound subcode in SOAP 1.2)
+func (c *Client) GetTransactionStatusByReference(ctx context.Context, clientReference string) (*model.TransactionResponse, error) {
+	request := &statusRequest{ClientReference: clientReference}
+
+	transactionResponse, err := c.call(ctx, "/status", StatusAction, request)
+	var fault *soap.Fault
+	if errors.As(err, &fault) && isNotFoundFault(fault) {
+		var gatewayError *paymentgateway.GatewayError
+		errors.As(err, &gatewayError)
+		return nil, paymentgateway.NewReferenceNotFoundError(c.Name(), gatewayError.StatusCode, clientReference)
+	}
+	return transactionResponse, err
+}
+
+func (c *Client) call(ctx context.Context, path string, action string, request interface{}) (*model.TransactionResponse, error) {
+	var header interface{}
+	if idempotencyKey := paymentgateway.IdempotencyKeyFromContext(ctx); idempotencyKey != "" {
+		header = &requestHeader{IdempotencyKey: idempotencyKey}
+	}
+
+	req, err := soap.NewRequest(ctx, c.SOAPVersion, c.Endpoint+path, action, header, request)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	if c.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AuthToken)
 	}
 
 	// Call the payment gateway API
-	resp, err := c.HTTPClient.Post(c.Endpoint+"/deposit", "application/xml", bytes.NewBuffer(payload))
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return nil, &resp.StatusCode, err
+		// no response was received (network error, timeout or cancellation)
+		return nil, paymentgateway.NewTransportError(c.Name(), err)
 	}
+	defer resp.Body.Close()
 
-	// // Parse the response
+	// Parse the response, a soap:Fault is returned as a *soap.Fault error
 	var gatewayBTransactionResponse model.GatewayBTransactionResponse
-	err = xml.NewDecoder(resp.Body).Decode(&gatewayBTransactionResponse)
+	err = soap.DecodeResponse(resp, &gatewayBTransactionResponse)
 	if err != nil {
-		return nil, nil, err
+		return nil, c.mapError(resp.StatusCode, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, paymentgateway.NewStatusError(c.Name(), resp.StatusCode)
 	}
 
 	transactionResponse := model.MapGatewayBTransactionResponse(&gatewayBTransactionResponse)
+	// the response is kept for support as the JSON of its SOAP body, the envelope says nothing about the transaction
+	if document, err := json.Marshal(gatewayBTransactionResponse); err == nil {
+		transactionResponse.Data.GatewayResponse = document
+	}
+	transactionResponse.Data.GatewayStatusCode = resp.StatusCode
 
-	return &transactionResponse, &resp.StatusCode, nil
+	return &transactionResponse, nil
 }
 
-func (c *Client) Withdraw(AccountID string, amount decimal.Decimal) (*model.TransactionResponse, *int, error) {
-	withdrawRequest := &model.WithdrawRequest{
-		AccountID: AccountID,
-		Amount:    amount,
+// mapError categorises a response that could not be decoded into a transaction. Faults are categorised on their code
+// rather than on the status code, as SOAP 1.1 gateways answer every fault with a 500
+func (c *Client) mapError(statusCode int, err error) *paymentgateway.GatewayError {
+	var fault *soap.Fault
+	if errors.As(err, &fault) {
+		switch {
+		case fault.IsClientFault():
+			return paymentgateway.NewGatewayError(c.Name(), paymentgateway.ErrorCategoryValidation, statusCode, err)
+		case fault.IsServerFault():
+			return paymentgateway.NewGatewayError(c.Name(), paymentgateway.ErrorCategoryServer, statusCode, err)
+		default:
+			return paymentgateway.NewGatewayError(c.Name(), paymentgateway.ErrorCategoryUnknown, statusCode, err)
+		}
 	}
 
-	payload, err := xml.Marshal(withdrawRequest)
-	if err != nil {
-		return nil, nil, err
+	// not a SOAP response at all, fall back on the status code
+	if statusCode < 200 || statusCode > 299 {
+		return paymentgateway.NewGatewayError(c.Name(), paymentgateway.CategoryFromStatusCode(statusCode), statusCode, err)
 	}
 
-	// Call the payment gateway API
-	resp, err := c.HTTPClient.Post(c.Endpoint+"/withdraw", "application/xml", bytes.NewBuffer(payload))
-	if err != nil {
-		return nil, &resp.StatusCode, err
+	return paymentgateway.NewGatewayError(c.Name(), paymentgateway.ErrorCategoryUnknown, statusCode, err)
+}
+
+func isNotFoundFault(fault *soap.Fault) bool {
+	if !fault.IsClientFault() {
+		return false
+	}
+	if fault.CodeValue() == "Client.NotFound" {
+		return true
 	}
+	return fault.Code.Subcode != nil && strings.HasSuffix(fault.Code.Subcode.Value, "NotFound")
+}
 
-	// Parse the response
+// ParseCallback reads a callback, Payment Gateway B posts a SOAP envelope with the same body as its API responses
+func (c *Client) ParseCallback(body []byte) (*model.TransactionResponse, error) {
 	var gatewayBTransactionResponse model.GatewayBTransactionResponse
-	err = xml.NewDecoder(resp.Body).Decode(&gatewayBTransactionResponse)
-	if err != nil {
-		return nil, nil, err
+	if err := soap.Unmarshal(body, &gatewayBTransactionResponse); err != nil {
+		return nil, err
 	}
 
 	transactionResponse := model.MapGatewayBTransactionResponse(&gatewayBTransactionResponse)
-
-	return &transactionResponse, &resp.StatusCode, nil
+	return &transactionResponse, nil
 }
@@ -0,0 +1,173 @@
+package paymentgatewayb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/clients/soap"
+	"seta/pkg/model"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+const depositResponse = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Body>
+		<Data>
+			<AccountID>acc123</AccountID>
+			<Amount>350</Amount>
+			<TransactionID>txn123</TransactionID>
+			<Status>pending</Status>
+			<Type>deposit</Type>
+		</Data>
+	</soap:Body>
+</soap:Envelope>`
+
+func faultResponse(code string) string {
+	return `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Body>
+		<soap:Fault>
+			<faultcode>` + code + `</faultcode>
+			<faultstring>gateway fault</faultstring>
+		</soap:Fault>
+	</soap:Body>
+</soap:Envelope>`
+}
+
+func gatewayServer(t *testing.T, statusCode int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, `"`+DepositAction+`"`, r.Header.Get("SOAPAction"))
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.WriteHeader(statusCode)
+		w.Write([]byte(body))
+	}))
+}
+
+func TestDeposit_Success(t *testing.T) {
+	server := gatewayServer(t, http.StatusOK, depositResponse)
+	defer server.Close()
+
+	client := ClientProvider(server.URL, soap.V11)
+	transactionResponse, err := client.Deposit(context.Background(), "acc123", decimal.NewFromInt(350), "USD")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "txn123", transactionResponse.Data.TransactionID)
+	assert.Equal(t, model.TransactionStatusPending, transactionResponse.Data.Status)
+	assert.True(t, decimal.NewFromInt(350).Equal(transactionResponse.Data.Amount))
+}
+
+func TestDeposit_Faults(t *testing.T) {
+	testCases := map[string]paymentgateway.ErrorCategory{
+		"soap:Client":          paymentgateway.ErrorCategoryValidation,
+		"soap:Server":          paymentgateway.ErrorCategoryServer,
+		"soap:VersionMismatch": paymentgateway.ErrorCategoryUnknown,
+	}
+
+	for code, category := range testCases {
+		server := gatewayServer(t, http.StatusInternalServerError, faultResponse(code))
+
+		client := ClientProvider(server.URL, soap.V11)
+		transactionResponse, err := client.Deposit(context.Background(), "acc123", decimal.NewFromInt(350), "USD")
+		server.Close()
+
+		var gatewayError *paymentgateway.GatewayError
+		assert.ErrorAs(t, err, &gatewayError, code)
+		assert.Equal(t, category, gatewayError.Category, code)
+		assert.Equal(t, Name, gatewayError.Gateway)
+		assert.Equal(t, http.StatusInternalServerError, gatewayError.StatusCode)
+		assert.Nil(t, transactionResponse)
+	}
+}
+
+func TestDeposit_Unreachable(t *testing.T) {
+	server := gatewayServer(t, http.StatusOK, depositResponse)
+	server.Close()
+
+	client := ClientProvider(server.URL, soap.V11)
+	transactionResponse, err := client.Deposit(context.Background(), "acc123", decimal.NewFromInt(350), "USD")
+
+	var gatewayError *paymentgateway.GatewayError
+	assert.ErrorAs(t, err, &gatewayError)
+	assert.Equal(t, paymentgateway.ErrorCategoryNetwork, gatewayError.Category)
+	assert.Equal(t, 0, gatewayError.StatusCode)
+	assert.True(t, gatewayError.Retryable())
+	assert.Nil(t, transactionResponse)
+}
+
+func TestRefund_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/refund", r.URL.Path)
+		assert.Equal(t, `"`+RefundAction+`"`, r.Header.Get("SOAPAction"))
+
+		body, _ := io.ReadAll(r.Body)
+		assert.Contains(t, string(body), `<RefundRequest xmlns="urn:paymentgatewayb"><TransactionID>txn123</TransactionID><Amount>50</Amount><Currency>USD</Currency></RefundRequest>`)
+
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.Write([]byte(depositResponse))
+	}))
+	defer server.Close()
+
+	client := ClientProvider(server.URL, soap.V11)
+	transactionResponse, err := client.Refund(context.Background(), "txn123", decimal.NewFromInt(50), "USD")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "txn123", transactionResponse.Data.TransactionID)
+}
+
+func TestGetTransactionStatusByReference(t *testing.T) {
+	testCases := map[string]struct {
+		body     string
+		notFound bool
+	}{
+		"found":        {body: depositResponse},
+		"not found":    {body: faultResponse("soap:Client.NotFound"), notFound: true},
+		"client fault": {body: faultResponse("soap:Client")},
+	}
+
+	for name, testCase := range testCases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, `"`+StatusAction+`"`, r.Header.Get("SOAPAction"))
+
+			body, _ := io.ReadAll(r.Body)
+			assert.Contains(t, string(body), `<GetTransactionStatusRequest xmlns="urn:paymentgatewayb"><ClientReference>ref123</ClientReference></GetTransactionStatusRequest>`, name)
+
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			if testCase.body != depositResponse {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write([]byte(testCase.body))
+		}))
+
+		client := ClientProvider(server.URL, soap.V11)
+		transactionResponse, err := client.GetTransactionStatusByReference(context.Background(), "ref123")
+		server.Close()
+
+		assert.Equal(t, testCase.notFound, errors.Is(err, paymentgateway.ErrReferenceNotFound), name)
+		if testCase.body == depositResponse {
+			assert.NoError(t, err, name)
+			assert.Equal(t, "txn123", transactionResponse.Data.TransactionID, name)
+		} else {
+			assert.Error(t, err, name)
+		}
+	}
+}
+
+func TestDeposit_ClientReference(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Contains(t, string(body), `<DepositRequest xmlns="urn:paymentgatewayb"><AccountID>acc123</AccountID><Amount>350</Amount><Currency>USD</Currency><ClientReference>ref123</ClientReference></DepositRequest>`)
+
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.Write([]byte(depositResponse))
+	}))
+	defer server.Close()
+
+	client := ClientProvider(server.URL, soap.V11)
+	_, err := client.Deposit(paymentgateway.WithClientReference(context.Background(), "ref123"), "acc123", decimal.NewFromInt(350), "USD")
+
+	assert.NoError(t, err)
+}
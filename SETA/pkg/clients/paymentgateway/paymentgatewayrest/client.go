@@ -0,0 +1,313 @@
+package paymentgatewayrest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/config"
+	"seta/pkg/model"
+	"strings"
+	"text/template"
+
+	"github.com/shopspring/decimal"
+)
+
+// Type is the type the declarative REST adapter is registered under, the gateway itself is described by the spec
+// file given in the spec_file option
+const Type = "rest"
+
+func init() {
+	paymentgateway.Register(Type, Factory)
+}
+
+type Client struct {
+	GatewayName string
+	Endpoint    string
+	HTTPClient  *http.Client
+	AuthToken   string // sent as a bearer token when set
+	Spec        *Spec
+
+	requestTemplate *template.Template
+}
+
+// ClientProvider builds a client for the gateway described by the spec, a spec that is incomplete or whose request
+// template does not render JSON is an error
+func ClientProvider(name string, endpoint string, spec *Spec) (*Client, error) {
+	requestTemplate, err := spec.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.Method == "" {
+		spec.Method = http.MethodPost
+	}
+
+	return &Client{
+		GatewayName:     name,
+		Endpoint:        endpoint,
+		HTTPClient:      &http.Client{Timeout: config.DefaultGatewayTimeout}, // upper bound only, the request context deadline is what normally ends a call
+		Spec:            spec,
+		requestTemplate: requestTemplate,
+	}, nil
+}
+
+// Factory builds the client from the gateways config, the spec is read from the spec_file option and the auth_token
+// credential is sent as a bearer token
+func Factory(gatewayConfig config.GatewayConfig) (paymentgateway.IPaymentGateway, error) {
+	if gatewayConfig.Endpoint == "" {
+		return nil, fmt.Errorf("endpoint is required")
+	}
+
+	specFile := gatewayConfig.Options["spec_file"]
+	if specFile == "" {
+		return nil, fmt.Errorf("the spec_file option is required")
+	}
+
+	spec, err := LoadSpec(specFile)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := ClientProvider(gatewayConfig.Name, gatewayConfig.Endpoint, spec)
+	if err != nil {
+		return nil, err
+	}
+	client.HTTPClient.Timeout = gatewayConfig.Timeout
+	client.AuthToken = gatewayConfig.Credentials["auth_token"]
+
+	return client, nil
+}
+
+func (c *Client) Name() string {
+	return c.GatewayName
+}
+
+func (c *Client) Deposit(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	return c.call(ctx, model.TransactionTypeDeposit, TemplateData{AccountID: AccountID, Currency: currency, ClientReference: paymentgateway.ClientReferenceFromContext(ctx)}, amount)
+}
+
+func (c *Client) Withdraw(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	return c.call(ctx, model.TransactionTypeWithdraw, TemplateData{AccountID: AccountID, Currency: currency, ClientReference: paymentgateway.ClientReferenceFromContext(ctx)}, amount)
+}
+
+func (c *Client) Refund(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	return c.call(ctx, model.TransactionTypeRefund, TemplateData{TransactionID: gatewayTransactionID, Currency: currency, ClientReference: paymentgateway.ClientReferenceFromContext(ctx)}, amount)
+}
+
+func (c *Client) Reverse(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	return c.call(ctx, model.TransactionTypeReversal, TemplateData{TransactionID: gatewayTransactionID, Currency: currency, ClientReference: paymentgateway.ClientReferenceFromContext(ctx)}, amount)
+}
+
+// GetTransactionStatus sends a GET to the spec status_path, the response is mapped like any other. Fields the
+// response mapping does not cover are left empty as there is no request to take them from
+func (c *Client) GetTransactionStatus(ctx context.Context, gatewayTransactionID string) (*model.TransactionResponse, error) {
+	if c.Spec.StatusPath == "" {
+		return nil, paymentgateway.NewGatewayError(c.Name(), paymentgateway.ErrorCategoryValidation, 0, fmt.Errorf("status: %w", paymentgateway.ErrNotSupported))
+	}
+
+	path := strings.ReplaceAll(c.Spec.StatusPath, "{transaction_id}", url.PathEscape(gatewayTransactionID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.do(req, "", TemplateData{}, decimal.Zero)
+}
+
+// GetTransactionStatusByReference sends a GET to the spec reference_path, a 404 means the gateway has no transaction
+// with the reference
+func (c *Client) GetTransactionStatusByReference(ctx context.Context, clientReference string) (*model.TransactionResponse, error) {
+	if c.Spec.ReferencePath == "" {
+		return nil, paymentgateway.NewGatewayError(c.Name(), paymentgateway.ErrorCategoryValidation, 0, fmt.Errorf("status by reference: %w", paymentgateway.ErrNotSupported))
+	}
+
+	path := strings.ReplaceAll(c.Spec.ReferencePath, "{client_reference}", url.QueryEscape(clientReference))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	transactionResponse, err := c.do(req, "", TemplateData{}, decimal.Zero)
+	var gatewayError *paymentgateway.GatewayError
+	if errors.As(err, &gatewayError) && gatewayError.StatusCode == http.StatusNotFound {
+		return nil, paymentgateway.NewReferenceNotFoundError(c.Name(), gatewayError.StatusCode, clientReference)
+	}
+	return transactionResponse, err
+}
+
+func (c *Client) call(ctx context.Context, transactionType model.TransactionType, data TemplateData, amount decimal.Decimal) (*model.TransactionResponse, error) {
+	path, ok := c.Spec.Paths[transactionType]
+	if !ok || path == "" {
+		return nil, paymentgateway.NewGatewayError(c.Name(), paymentgateway.ErrorCategoryValidation, 0, fmt.Errorf("%s: %w", transactionType, paymentgateway.ErrNotSupported))
+	}
+
+	idempotencyKey := paymentgateway.IdempotencyKeyFromContext(ctx)
+	data.Amount = amount.String()
+	data.Type = transactionType
+	data.IdempotencyKey = idempotencyKey
+
+	var payload bytes.Buffer
+	if err := c.requestTemplate.Execute(&payload, data); err != nil {
+		return nil, paymentgateway.NewGatewayError(c.Name(), paymentgateway.ErrorCategoryValidation, 0, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, c.Spec.Method, c.Endpoint+path, &payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set(paymentgateway.IdempotencyKeyHeader, idempotencyKey)
+	}
+	if data.ClientReference != "" {
+		req.Header.Set(paymentgateway.ClientReferenceHeader, data.ClientReference)
+	}
+
+	return c.do(req, transactionType, data, amount)
+}
+
+// do sends the request and maps the response, data and amount are what the unmapped fields default to
+func (c *Client) do(req *http.Request, transactionType model.TransactionType, data TemplateData, amount decimal.Decimal) (*model.TransactionResponse, error) {
+	for key, value := range c.Spec.Headers {
+		req.Header.Set(key, os.ExpandEnv(value))
+	}
+	if c.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	}
+
+	// Call the payment gateway API
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		// no response was received (network error, timeout or cancellation)
+		return nil, paymentgateway.NewTransportError(c.Name(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, paymentgateway.NewStatusError(c.Name(), resp.StatusCode)
+	}
+
+	// Parse the response, numbers are kept as their JSON text so amounts are not rounded through a float
+	var document interface{}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, paymentgateway.NewGatewayError(c.Name(), paymentgateway.ErrorCategoryUnknown, resp.StatusCode, err)
+	}
+
+	transactionData, err := c.mapResponse(document, transactionType, data.AccountID, amount, data.Currency)
+	if err != nil {
+		return nil, paymentgateway.NewGatewayError(c.Name(), paymentgateway.ErrorCategoryUnknown, resp.StatusCode, err)
+	}
+	// kept for support, the numbers keep their JSON text
+	if raw, err := json.Marshal(document); err == nil {
+		transactionData.GatewayResponse = raw
+	}
+	transactionData.GatewayStatusCode = resp.StatusCode
+
+	return &model.TransactionResponse{Data: *transactionData}, nil
+}
+
+// mapResponse builds the transaction from the response with the spec mappings, the fields the spec does not map are
+// taken from the request
+func (c *Client) mapResponse(document interface{}, transactionType model.TransactionType, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionData, error) {
+	mapping := c.Spec.Response
+
+	transactionID, err := lookup(document, mapping.TransactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	statusValue, err := lookup(document, mapping.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := c.mapStatus(statusValue)
+	if err != nil {
+		return nil, err
+	}
+
+	transactionData := &model.TransactionData{
+		AccountID:     AccountID,
+		TransactionID: transactionID,
+		Status:        status,
+		Type:          transactionType,
+		Amount:        amount,
+		Currency:      currency,
+	}
+
+	if mapping.AccountID != "" {
+		if transactionData.AccountID, err = lookup(document, mapping.AccountID); err != nil {
+			return nil, err
+		}
+	}
+
+	if mapping.Type != "" {
+		value, err := lookup(document, mapping.Type)
+		if err != nil {
+			return nil, err
+		}
+		transactionData.Type = model.TransactionType(strings.ToLower(value))
+	}
+
+	if mapping.Amount != "" {
+		value, err := lookup(document, mapping.Amount)
+		if err != nil {
+			return nil, err
+		}
+		if transactionData.Amount, err = decimal.NewFromString(value); err != nil {
+			return nil, fmt.Errorf("%s is not an amount: %w", mapping.Amount, err)
+		}
+	}
+
+	if mapping.Currency != "" {
+		value, err := lookup(document, mapping.Currency)
+		if err != nil {
+			return nil, err
+		}
+		transactionData.Currency = model.Currency(strings.ToUpper(value))
+	}
+
+	return transactionData, nil
+}
+
+func (c *Client) mapStatus(value string) (model.TransactionStatus, error) {
+	if len(c.Spec.StatusValues) == 0 {
+		status := model.TransactionStatus(strings.ToLower(value))
+		if !validStatus(status) {
+			return "", fmt.Errorf("unknown status %q", value)
+		}
+		return status, nil
+	}
+
+	status, ok := c.Spec.StatusValues[value]
+	if !ok {
+		return "", fmt.Errorf("status %q is not in the spec status values", value)
+	}
+	return status, nil
+}
+
+// ParseCallback reads a callback with the spec response mapping, the gateway is expected to post the same document as
+// its API responses
+func (c *Client) ParseCallback(body []byte) (*model.TransactionResponse, error) {
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	transactionData, err := c.mapResponse(document, "", "", decimal.Zero, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.TransactionResponse{Data: *transactionData}, nil
+}
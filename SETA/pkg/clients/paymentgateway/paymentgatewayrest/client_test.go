@@ -0,0 +1,181 @@
+package paymentgatewayrest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/model"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSpec = `{
+	"paths": {"deposit": "/v1/payins", "withdraw": "/v1/payouts"},
+	"status_path": "/v1/payments/{transaction_id}",
+	"reference_path": "/v1/payments?reference={client_reference}",
+	"request_template": "{\"account\": {{json .AccountID}}, \"amount\": {{json .Amount}}, \"currency\": {{json .Currency}}, \"kind\": {{json .Type}}, \"reference\": {{json .IdempotencyKey}}}",
+	"response": {
+		"transaction_id": "$.payment.id",
+		"status": "$.payment.state",
+		"amount": "$.payment['amount']",
+		"account_id": "$.payment.parties[0].account"
+	},
+	"status_values": {"SETTLED": "success", "REJECTED": "failed", "PROCESSING": "pending"}
+}`
+
+func testClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	var spec Spec
+	assert.NoError(t, json.Unmarshal([]byte(testSpec), &spec))
+
+	client, err := ClientProvider("gatewayc", server.URL, &spec)
+	assert.NoError(t, err)
+	return client
+}
+
+func TestDeposit_Success(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/payins", r.URL.Path)
+		assert.Equal(t, "key-1", r.Header.Get(paymentgateway.IdempotencyKeyHeader))
+
+		body, _ := io.ReadAll(r.Body)
+		assert.JSONEq(t, `{"account": "acc123", "amount": "350.5", "currency": "EUR", "kind": "deposit", "reference": "key-1"}`, string(body))
+
+		w.Write([]byte(`{"payment": {"id": "pay_1", "state": "PROCESSING", "amount": 350.50, "parties": [{"account": "acc123"}]}}`))
+	})
+
+	ctx := paymentgateway.WithIdempotencyKey(context.Background(), "key-1")
+	transactionResponse, err := client.Deposit(ctx, "acc123", decimal.RequireFromString("350.5"), "EUR")
+
+	assert.NoError(t, err)
+	// the response is kept as it was received
+	assert.JSONEq(t, `{"payment": {"id": "pay_1", "state": "PROCESSING", "amount": 350.50, "parties": [{"account": "acc123"}]}}`, string(transactionResponse.Data.GatewayResponse))
+	transactionResponse.Data.GatewayResponse = nil
+	assert.Equal(t, model.TransactionData{
+		AccountID:         "acc123",
+		TransactionID:     "pay_1",
+		Status:            model.TransactionStatusPending,
+		Type:              model.TransactionTypeDeposit,
+		Amount:            decimal.RequireFromString("350.50"),
+		Currency:          "EUR",
+		GatewayStatusCode: http.StatusOK,
+	}, transactionResponse.Data)
+}
+
+func TestWithdraw_UnmappedStatus(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/payouts", r.URL.Path)
+		w.Write([]byte(`{"payment": {"id": "pay_1", "state": "ON_HOLD", "amount": 10, "parties": [{"account": "acc123"}]}}`))
+	})
+
+	_, err := client.Withdraw(context.Background(), "acc123", decimal.NewFromInt(10), "USD")
+
+	var gatewayError *paymentgateway.GatewayError
+	assert.True(t, errors.As(err, &gatewayError))
+	assert.Equal(t, paymentgateway.ErrorCategoryUnknown, gatewayError.Category)
+}
+
+func TestGetTransactionStatus(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/v1/payments/pay_1", r.URL.Path)
+		w.Write([]byte(`{"payment": {"id": "pay_1", "state": "SETTLED", "amount": "10", "parties": [{"account": "acc123"}]}}`))
+	})
+
+	transactionResponse, err := client.GetTransactionStatus(context.Background(), "pay_1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.TransactionStatusSuccess, transactionResponse.Data.Status)
+	assert.Equal(t, "acc123", transactionResponse.Data.AccountID)
+}
+
+func TestGetTransactionStatusByReference(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/payments", r.URL.Path)
+		if r.URL.Query().Get("reference") != "ref123" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"payment": {"id": "pay_1", "state": "SETTLED", "amount": "10", "parties": [{"account": "acc123"}]}}`))
+	})
+
+	transactionResponse, err := client.GetTransactionStatusByReference(context.Background(), "ref123")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "pay_1", transactionResponse.Data.TransactionID)
+	assert.Equal(t, model.TransactionStatusSuccess, transactionResponse.Data.Status)
+
+	_, err = client.GetTransactionStatusByReference(context.Background(), "ref456")
+
+	assert.ErrorIs(t, err, paymentgateway.ErrReferenceNotFound)
+}
+
+func TestRefund_NotSupported(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("no request is sent for an operation the spec does not describe")
+	})
+
+	_, err := client.Refund(context.Background(), "pay_1", decimal.NewFromInt(10), "USD")
+
+	assert.ErrorIs(t, err, paymentgateway.ErrNotSupported)
+}
+
+func TestDeposit_StatusError(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	})
+
+	_, err := client.Deposit(context.Background(), "acc123", decimal.NewFromInt(10), "USD")
+
+	var gatewayError *paymentgateway.GatewayError
+	assert.True(t, errors.As(err, &gatewayError))
+	assert.Equal(t, paymentgateway.ErrorCategoryValidation, gatewayError.Category)
+	assert.Equal(t, "gatewayc", gatewayError.Gateway)
+}
+
+func TestClientProvider_InvalidSpec(t *testing.T) {
+	testCases := map[string]Spec{
+		"missing path":       {Paths: map[model.TransactionType]string{model.TransactionTypeDeposit: "/deposit"}, RequestTemplate: `{}`, Response: ResponseMapping{TransactionID: "$.id", Status: "$.status"}},
+		"missing status":     {Paths: map[model.TransactionType]string{model.TransactionTypeDeposit: "/d", model.TransactionTypeWithdraw: "/w"}, RequestTemplate: `{}`, Response: ResponseMapping{TransactionID: "$.id"}},
+		"invalid json path":  {Paths: map[model.TransactionType]string{model.TransactionTypeDeposit: "/d", model.TransactionTypeWithdraw: "/w"}, RequestTemplate: `{}`, Response: ResponseMapping{TransactionID: "id", Status: "$.status"}},
+		"unknown status":     {Paths: map[model.TransactionType]string{model.TransactionTypeDeposit: "/d", model.TransactionTypeWithdraw: "/w"}, RequestTemplate: `{}`, Response: ResponseMapping{TransactionID: "$.id", Status: "$.status"}, StatusValues: map[string]model.TransactionStatus{"OK": "done"}},
+		"template not json":  {Paths: map[model.TransactionType]string{model.TransactionTypeDeposit: "/d", model.TransactionTypeWithdraw: "/w"}, RequestTemplate: `{"account": {{.AccountID}}}`, Response: ResponseMapping{TransactionID: "$.id", Status: "$.status"}},
+		"template bad field": {Paths: map[model.TransactionType]string{model.TransactionTypeDeposit: "/d", model.TransactionTypeWithdraw: "/w"}, RequestTemplate: `{{.Currency}}`, Response: ResponseMapping{TransactionID: "$.id", Status: "$.status"}},
+	}
+
+	for name, spec := range testCases {
+		spec := spec
+		_, err := ClientProvider("gatewayc", "http://localhost", &spec)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	var document interface{}
+	decoder := json.NewDecoder(strings.NewReader(`{"a": {"b": [{"c": "x"}, {"c": 1.10}], "ok": true}}`))
+	decoder.UseNumber()
+	assert.NoError(t, decoder.Decode(&document))
+
+	value, err := lookup(document, "$.a.b[1].c")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.10", value)
+
+	value, err = lookup(document, "$['a'].ok")
+	assert.NoError(t, err)
+	assert.Equal(t, "true", value)
+
+	_, err = lookup(document, "$.a.b[2].c")
+	assert.Error(t, err)
+
+	_, err = lookup(document, "$.a.b")
+	assert.Error(t, err)
+}
@@ -0,0 +1,98 @@
+package paymentgatewayrest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathStep is either an object key or an array index
+type pathStep struct {
+	key   string
+	index int
+}
+
+// parsePath parses the JSONPath subset the response mappings use: "$" followed by ".key", "['key']" and "[index]" steps
+func parsePath(jsonPath string) ([]pathStep, error) {
+	if !strings.HasPrefix(jsonPath, "$") {
+		return nil, fmt.Errorf("json path %q must start with $", jsonPath)
+	}
+
+	var steps []pathStep
+	rest := jsonPath[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("json path %q has an empty key", jsonPath)
+			}
+			steps = append(steps, pathStep{key: key})
+			rest = rest[end+1:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("json path %q has an unclosed [", jsonPath)
+			}
+			inner := rest[1:end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, pathStep{key: inner[1 : len(inner)-1]})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("json path %q has an invalid index %q", jsonPath, inner)
+				}
+				steps = append(steps, pathStep{index: index})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("json path %q is invalid at %q", jsonPath, rest)
+		}
+	}
+
+	return steps, nil
+}
+
+// lookup returns the value at the path as a string. Numbers keep their exact JSON text so amounts do not go through a
+// float, the document must have been decoded with UseNumber
+func lookup(document interface{}, jsonPath string) (string, error) {
+	steps, err := parsePath(jsonPath)
+	if err != nil {
+		return "", err
+	}
+
+	value := document
+	for _, step := range steps {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			next, ok := node[step.key]
+			if step.key == "" || !ok {
+				return "", fmt.Errorf("%s not found in the response", jsonPath)
+			}
+			value = next
+		case []interface{}:
+			if step.key != "" || step.index >= len(node) {
+				return "", fmt.Errorf("%s not found in the response", jsonPath)
+			}
+			value = node[step.index]
+		default:
+			return "", fmt.Errorf("%s not found in the response", jsonPath)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", fmt.Errorf("%s is not a scalar value", jsonPath)
+	}
+}
@@ -0,0 +1,125 @@
+package paymentgatewayrest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"seta/pkg/model"
+	"text/template"
+)
+
+// Spec describes a "POST JSON, read JSON" gateway, so that onboarding one is a config change instead of a new package
+//
+//	{
+//	  "paths": {"deposit": "/v1/payins", "withdraw": "/v1/payouts"},
+//	  "request_template": "{\"account\": {{json .AccountID}}, \"amount\": {{json .Amount}}, \"currency\": {{json .Currency}}, \"reference\": {{json .IdempotencyKey}}}",
+//	  "reference_path": "/v1/payments?reference={client_reference}",
+//	  "response": {"transaction_id": "$.payment.id", "status": "$.payment.state", "amount": "$.payment.amount"},
+//	  "status_values": {"SETTLED": "success", "REJECTED": "failed", "PROCESSING": "pending"}
+//	}
+type Spec struct {
+	Method          string                             `json:"method"`           // defaults to POST
+	Paths           map[model.TransactionType]string   `json:"paths"`            // path appended to the endpoint, per transaction type. refund and reversal are optional
+	Headers         map[string]string                  `json:"headers"`          // extra request headers, values can reference environment variables as ${NAME}
+	StatusPath      string                             `json:"status_path"`      // path of the GET status query, {transaction_id} is replaced by the gateway transaction ID. optional
+	ReferencePath   string                             `json:"reference_path"`   // path of the GET query by client reference, {client_reference} is replaced by the reference. optional, a 404 means the gateway has no such transaction
+	RequestTemplate string                             `json:"request_template"` // text/template of the request body, see TemplateData
+	Response        ResponseMapping                    `json:"response"`
+	StatusValues    map[string]model.TransactionStatus `json:"status_values"` // gateway status value to transaction status, the value is used as is when empty
+}
+
+// ResponseMapping holds the JSONPath of every transaction field in the gateway response, eg. "$.data.items[0].id". Only
+// the transaction ID and status are required, the other fields default to the values of the request
+type ResponseMapping struct {
+	TransactionID string `json:"transaction_id"`
+	Status        string `json:"status"`
+	AccountID     string `json:"account_id"`
+	Type          string `json:"type"`
+	Amount        string `json:"amount"`
+	Currency      string `json:"currency"`
+}
+
+// TemplateData is what the request template is executed with. The template can use the json function to quote a
+// value, eg. {{json .AccountID}}
+type TemplateData struct {
+	AccountID       string // empty for refunds and reversals
+	TransactionID   string // the gateway ID of the transaction being refunded or reversed, empty otherwise
+	Amount          string // decimal string, eg. "350.5"
+	Currency        model.Currency
+	Type            model.TransactionType
+	IdempotencyKey  string
+	ClientReference string // the ID SETA gives the transaction, or the refund or reversal
+}
+
+// LoadSpec reads and checks a spec file
+func LoadSpec(filePath string) (*Spec, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gateway spec: %w", err)
+	}
+
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse gateway spec: %w", err)
+	}
+
+	return &spec, nil
+}
+
+// compile checks the spec and parses its request template
+func (s *Spec) compile() (*template.Template, error) {
+	for _, transactionType := range []model.TransactionType{model.TransactionTypeDeposit, model.TransactionTypeWithdraw} {
+		if s.Paths[transactionType] == "" {
+			return nil, fmt.Errorf("spec has no path for %s", transactionType)
+		}
+	}
+
+	if s.Response.TransactionID == "" || s.Response.Status == "" {
+		return nil, fmt.Errorf("spec response must map the transaction_id and status")
+	}
+
+	for _, jsonPath := range []string{s.Response.TransactionID, s.Response.Status, s.Response.AccountID, s.Response.Type, s.Response.Amount, s.Response.Currency} {
+		if jsonPath == "" {
+			continue
+		}
+		if _, err := parsePath(jsonPath); err != nil {
+			return nil, err
+		}
+	}
+
+	for value, status := range s.StatusValues {
+		if !validStatus(status) {
+			return nil, fmt.Errorf("spec maps status value %q to unknown status %q", value, status)
+		}
+	}
+
+	requestTemplate, err := template.New("request").Option("missingkey=error").Funcs(template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			encoded, err := json.Marshal(value)
+			return string(encoded), err
+		},
+	}).Parse(s.RequestTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("spec has an invalid request template: %w", err)
+	}
+
+	// a template that does not render valid JSON is a spec error, better found at startup than on the first transaction
+	var body bytes.Buffer
+	if err := requestTemplate.Execute(&body, TemplateData{AccountID: "acc", TransactionID: "txn", Amount: "1", Currency: model.DefaultCurrency, Type: model.TransactionTypeDeposit, IdempotencyKey: "key", ClientReference: "ref"}); err != nil {
+		return nil, fmt.Errorf("spec has an invalid request template: %w", err)
+	}
+	if !json.Valid(body.Bytes()) {
+		return nil, fmt.Errorf("spec request template does not render valid JSON: %s", body.String())
+	}
+
+	return requestTemplate, nil
+}
+
+func validStatus(status model.TransactionStatus) bool {
+	switch status {
+	case model.TransactionStatusSuccess, model.TransactionStatusFailed, model.TransactionStatusPending:
+		return true
+	}
+	return false
+}
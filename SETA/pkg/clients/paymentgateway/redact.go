@@ -0,0 +1,63 @@
+package paymentgateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// RedactedValue replaces the values of the sensitive fields of a gateway response
+const RedactedValue = "[REDACTED]"
+
+// sensitiveFields are matched case insensitively against the field names of a response, a field whose name contains
+// one of them is redacted whatever its value
+var sensitiveFields = []string{"token", "secret", "password", "authorization", "signature", "api_key", "apikey", "card", "cvv", "cvc", "iban", "account_number"}
+
+// RedactResponse returns the JSON response of a gateway with the values of its sensitive fields replaced, at any
+// depth, so that it can be stored and shown to support. A response that is not JSON is dropped
+func RedactResponse(response []byte) json.RawMessage {
+	if len(response) == 0 {
+		return nil
+	}
+
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(response))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil
+	}
+
+	redacted, err := json.Marshal(redact(document))
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+func redact(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for field, fieldValue := range value {
+			if isSensitiveField(field) {
+				value[field] = RedactedValue
+				continue
+			}
+			value[field] = redact(fieldValue)
+		}
+	case []interface{}:
+		for i := range value {
+			value[i] = redact(value[i])
+		}
+	}
+	return value
+}
+
+func isSensitiveField(field string) bool {
+	field = strings.ToLower(field)
+	for _, sensitiveField := range sensitiveFields {
+		if strings.Contains(field, sensitiveField) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package paymentgateway
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactResponse(t *testing.T) {
+	response := `{"data": {"transaction_id": "txn1", "amount": 100.10, "card": {"number": "4111111111111111"}, "auth_token": "secret",
+		"payer": [{"IBAN": "DE89370400440532013000", "name": "Jane"}]}}`
+
+	redacted := RedactResponse([]byte(response))
+
+	assert.JSONEq(t, `{"data": {"transaction_id": "txn1", "amount": 100.10, "card": "[REDACTED]", "auth_token": "[REDACTED]",
+		"payer": [{"IBAN": "[REDACTED]", "name": "Jane"}]}}`, string(redacted))
+}
+
+func TestRedactResponse_NotJSON(t *testing.T) {
+	assert.Nil(t, RedactResponse([]byte("<Envelope/>")))
+	assert.Nil(t, RedactResponse(nil))
+}
@@ -0,0 +1,82 @@
+package paymentgateway
+
+import (
+	"fmt"
+	"seta/pkg/config"
+	"sort"
+	"sync"
+)
+
+// Factory builds a gateway client from its configuration
+type Factory func(gatewayConfig config.GatewayConfig) (IPaymentGateway, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// Register makes a gateway implementation available under the given type name. Gateway packages call it from their
+// init function, so importing the package is all it takes for the type to be usable in the gateways config
+func Register(gatewayType string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("paymentgateway: Register factory is nil for " + gatewayType)
+	}
+	if _, exists := factories[gatewayType]; exists {
+		panic("paymentgateway: Register called twice for " + gatewayType)
+	}
+
+	factories[gatewayType] = factory
+}
+
+// Types returns the registered gateway types, sorted
+func Types() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	types := make([]string, 0, len(factories))
+	for gatewayType := range factories {
+		types = append(types, gatewayType)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// Build creates the client of a single gateway with the factory registered for its type
+func Build(gatewayConfig config.GatewayConfig) (IPaymentGateway, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[gatewayConfig.Type]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("gateway %q has unknown type %q (registered types: %v)", gatewayConfig.Name, gatewayConfig.Type, Types())
+	}
+
+	gateway, err := factory(gatewayConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build gateway %q: %w", gatewayConfig.Name, err)
+	}
+
+	return gateway, nil
+}
+
+// BuildAll creates the clients of the configured gateways, in order. Each one is wrapped in its own circuit breaker so
+// that a gateway that is down is skipped, and a retrier sits on top so that every attempt is seen by the circuit breaker
+// and retries stop as soon as it opens
+func BuildAll(gatewayConfigs []config.GatewayConfig) ([]IPaymentGateway, error) {
+	gateways := make([]IPaymentGateway, 0, len(gatewayConfigs))
+	for _, gatewayConfig := range gatewayConfigs {
+		gateway, err := Build(gatewayConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		circuitBreaker := CircuitBreakerProvider(gateway, gatewayConfig.CircuitBreaker)
+		gateways = append(gateways, RetrierProvider(circuitBreaker, gatewayConfig.Retry))
+	}
+
+	return gateways, nil
+}
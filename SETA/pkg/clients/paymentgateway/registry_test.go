@@ -0,0 +1,53 @@
+package paymentgateway
+
+import (
+	"context"
+	"errors"
+	"seta/pkg/config"
+	"seta/pkg/model"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	Register(MockClientName, func(gatewayConfig config.GatewayConfig) (IPaymentGateway, error) {
+		if gatewayConfig.Endpoint == "" {
+			return nil, errors.New("endpoint is required")
+		}
+		return &MockClient{GatewayName: gatewayConfig.Name, StatusCode: 200, TransactionResponse: &model.TransactionResponse{}}, nil
+	})
+}
+
+func TestRegister_Twice(t *testing.T) {
+	assert.Panics(t, func() {
+		Register(MockClientName, func(config.GatewayConfig) (IPaymentGateway, error) { return nil, nil })
+	})
+}
+
+func TestBuild_UnknownType(t *testing.T) {
+	_, err := Build(config.GatewayConfig{Name: "gatewayc", Type: "carrier-pigeon"})
+	assert.ErrorContains(t, err, "unknown type")
+}
+
+func TestBuild_FactoryError(t *testing.T) {
+	_, err := Build(config.GatewayConfig{Name: "mock-1", Type: MockClientName})
+	assert.ErrorContains(t, err, "endpoint is required")
+}
+
+func TestBuildAll(t *testing.T) {
+	gateways, err := BuildAll([]config.GatewayConfig{
+		{Name: "mock-1", Type: MockClientName, Endpoint: "http://mock-1"},
+		{Name: "mock-2", Type: MockClientName, Endpoint: "http://mock-2"},
+	})
+	assert.NoError(t, err)
+
+	// the same type can be configured more than once, every instance keeps its own name and order
+	assert.Len(t, gateways, 2)
+	assert.Equal(t, "mock-1", gateways[0].Name())
+	assert.Equal(t, "mock-2", gateways[1].Name())
+
+	_, err = gateways[0].Deposit(context.Background(), "acc123", decimal.NewFromInt(100), "USD")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,139 @@
+package paymentgateway
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"seta/pkg/config"
+	"seta/pkg/logger"
+	"seta/pkg/model"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Retrier wraps a payment gateway and retries the calls that failed with a retryable error, waiting an exponentially
+// growing, jittered delay between attempts. It gives up early rather than wait past the deadline of the request
+type Retrier struct {
+	Gateway IPaymentGateway
+	Policy  config.RetryConfig
+
+	random func() float64
+	sleep  func(ctx context.Context, delay time.Duration) error
+}
+
+func RetrierProvider(gateway IPaymentGateway, policy config.RetryConfig) *Retrier {
+	return &Retrier{
+		Gateway: gateway,
+		Policy:  policy,
+		random:  rand.Float64,
+		sleep:   sleep,
+	}
+}
+
+func (r *Retrier) Name() string {
+	return r.Gateway.Name()
+}
+
+func (r *Retrier) Unwrap() IPaymentGateway {
+	return r.Gateway
+}
+
+func (r *Retrier) Deposit(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	return r.do(ctx, func(ctx context.Context) (*model.TransactionResponse, error) {
+		return r.Gateway.Deposit(ctx, AccountID, amount, currency)
+	})
+}
+
+func (r *Retrier) Withdraw(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	return r.do(ctx, func(ctx context.Context) (*model.TransactionResponse, error) {
+		return r.Gateway.Withdraw(ctx, AccountID, amount, currency)
+	})
+}
+
+func (r *Retrier) Refund(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	return r.do(ctx, func(ctx context.Context) (*model.TransactionResponse, error) {
+		return r.Gateway.Refund(ctx, gatewayTransactionID, amount, currency)
+	})
+}
+
+func (r *Retrier) Reverse(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	return r.do(ctx, func(ctx context.Context) (*model.TransactionResponse, error) {
+		return r.Gateway.Reverse(ctx, gatewayTransactionID, amount, currency)
+	})
+}
+
+func (r *Retrier) GetTransactionStatus(ctx context.Context, gatewayTransactionID string) (*model.TransactionResponse, error) {
+	return r.do(ctx, func(ctx context.Context) (*model.TransactionResponse, error) {
+		return r.Gateway.GetTransactionStatus(ctx, gatewayTransactionID)
+	})
+}
+
+func (r *Retrier) GetTransactionStatusByReference(ctx context.Context, clientReference string) (*model.TransactionResponse, error) {
+	return r.do(ctx, func(ctx context.Context) (*model.TransactionResponse, error) {
+		return r.Gateway.GetTransactionStatusByReference(ctx, clientReference)
+	})
+}
+
+func (r *Retrier) do(ctx context.Context, call func(ctx context.Context) (*model.TransactionResponse, error)) (*model.TransactionResponse, error) {
+	if IdempotencyKeyFromContext(ctx) == "" {
+		ctx = WithIdempotencyKey(ctx, uuid.New().String())
+	}
+
+	for attempt := 1; ; attempt++ {
+		transactionResponse, err := call(ctx)
+		if err == nil || attempt >= r.Policy.MaxAttempts || !r.retryable(err) {
+			return transactionResponse, err
+		}
+
+		delay := r.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			// the next attempt could not finish in time, leave what is left of the budget to the next gateway
+			logger.WithRequestID(ctx).Warnf("payment gateway %s attempt %d failed, not retrying as the deadline is too close. error: %v", r.Name(), attempt, err)
+			return nil, err
+		}
+
+		logger.WithRequestID(ctx).Warnf("payment gateway %s attempt %d/%d failed, retrying in %s. error: %v", r.Name(), attempt, r.Policy.MaxAttempts, delay, err)
+		if sleepErr := r.sleep(ctx, delay); sleepErr != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryable reports whether the call is safe to send again to the same gateway
+func (r *Retrier) retryable(err error) bool {
+	// the circuit breaker already decided the gateway should be left alone
+	if errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	var gatewayError *GatewayError
+	return errors.As(err, &gatewayError) && gatewayError.Retryable()
+}
+
+// backoff returns the delay before the next attempt: BaseDelay doubled for every failed attempt, capped at MaxDelay,
+// with up to Jitter of it taken off at random so that concurrent requests do not retry in lockstep
+func (r *Retrier) backoff(attempt int) time.Duration {
+	delay := r.Policy.BaseDelay
+	for i := 1; i < attempt && delay < r.Policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > r.Policy.MaxDelay {
+		delay = r.Policy.MaxDelay
+	}
+
+	return delay - time.Duration(float64(delay)*r.Policy.Jitter*r.random())
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,102 @@
+package paymentgateway
+
+import (
+	"context"
+	"seta/pkg/config"
+	"seta/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyGateway fails with the given status code until it has been called failures times
+type flakyGateway struct {
+	MockClient
+	failures        int
+	statusCode      int
+	idempotencyKeys []string
+}
+
+func (g *flakyGateway) Deposit(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	g.idempotencyKeys = append(g.idempotencyKeys, IdempotencyKeyFromContext(ctx))
+	if len(g.idempotencyKeys) <= g.failures {
+		return nil, NewStatusError(g.Name(), g.statusCode)
+	}
+	return &model.TransactionResponse{}, nil
+}
+
+func newTestRetrier(gateway IPaymentGateway, maxAttempts int) (*Retrier, *[]time.Duration) {
+	var delays []time.Duration
+	retrier := RetrierProvider(gateway, config.RetryConfig{MaxAttempts: maxAttempts, BaseDelay: 100 * time.Millisecond, MaxDelay: 250 * time.Millisecond, Jitter: 0.5})
+	retrier.random = func() float64 { return 0 }
+	retrier.sleep = func(ctx context.Context, delay time.Duration) error {
+		delays = append(delays, delay)
+		return nil
+	}
+	return retrier, &delays
+}
+
+func TestRetrier_RetriesServerErrorsWithBackoff(t *testing.T) {
+	gateway := &flakyGateway{failures: 3, statusCode: 503}
+	retrier, delays := newTestRetrier(gateway, 4)
+
+	transactionResponse, err := retrier.Deposit(context.Background(), "acc123", decimal.NewFromInt(100), "USD")
+
+	assert.NoError(t, err)
+	assert.NotNil(t, transactionResponse)
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 250 * time.Millisecond}, *delays)
+
+	// every attempt carries the same idempotency key so the gateway can tell it is the same deposit
+	assert.Len(t, gateway.idempotencyKeys, 4)
+	assert.NotEmpty(t, gateway.idempotencyKeys[0])
+	for _, idempotencyKey := range gateway.idempotencyKeys {
+		assert.Equal(t, gateway.idempotencyKeys[0], idempotencyKey)
+	}
+}
+
+func TestRetrier_KeepsCallerIdempotencyKey(t *testing.T) {
+	gateway := &flakyGateway{failures: 1, statusCode: 500}
+	retrier, _ := newTestRetrier(gateway, 2)
+
+	_, err := retrier.Deposit(WithIdempotencyKey(context.Background(), "key123"), "acc123", decimal.NewFromInt(100), "USD")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"key123", "key123"}, gateway.idempotencyKeys)
+}
+
+func TestRetrier_StopsAfterMaxAttempts(t *testing.T) {
+	gateway := &flakyGateway{failures: 5, statusCode: 500}
+	retrier, _ := newTestRetrier(gateway, 3)
+
+	_, err := retrier.Deposit(context.Background(), "acc123", decimal.NewFromInt(100), "USD")
+
+	assert.Error(t, err)
+	assert.Len(t, gateway.idempotencyKeys, 3)
+}
+
+func TestRetrier_DoesNotRetryNonRetryableErrors(t *testing.T) {
+	gateway := &flakyGateway{failures: 5, statusCode: 400}
+	retrier, delays := newTestRetrier(gateway, 3)
+
+	_, err := retrier.Deposit(context.Background(), "acc123", decimal.NewFromInt(100), "USD")
+
+	assert.Error(t, err)
+	assert.Len(t, gateway.idempotencyKeys, 1)
+	assert.Empty(t, *delays)
+}
+
+func TestRetrier_StaysWithinDeadline(t *testing.T) {
+	gateway := &flakyGateway{failures: 5, statusCode: 500}
+	retrier, delays := newTestRetrier(gateway, 3)
+
+	// the first delay (100ms) does not fit in what is left of the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := retrier.Deposit(ctx, "acc123", decimal.NewFromInt(100), "USD")
+
+	assert.Error(t, err)
+	assert.Len(t, gateway.idempotencyKeys, 1)
+	assert.Empty(t, *delays)
+}
@@ -0,0 +1,159 @@
+package soap
+
+// soap is a small SOAP 1.1/1.2 codec used by the SOAP based payment gateway clients. It wraps payloads in an
+// Envelope/Header/Body, builds requests with the right content type and action for the SOAP version and decodes
+// responses, turning a soap:Fault into a *Fault error.
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type Version int
+
+const (
+	V11 Version = iota // SOAP 1.1
+	V12                // SOAP 1.2
+)
+
+const (
+	NamespaceV11 = "http://schemas.xmlsoap.org/soap/envelope/"
+	NamespaceV12 = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// ParseVersion maps a configured version ("1.1" or "1.2") to a Version, anything else falls back to SOAP 1.1
+func ParseVersion(version string) Version {
+	if version == "1.2" {
+		return V12
+	}
+	return V11
+}
+
+func (v Version) Namespace() string {
+	if v == V12 {
+		return NamespaceV12
+	}
+	return NamespaceV11
+}
+
+// ContentType returns the Content-Type header for the version. SOAP 1.2 carries the action as a media type parameter
+// while SOAP 1.1 sends it in a separate SOAPAction header
+func (v Version) ContentType(action string) string {
+	if v == V12 {
+		if action == "" {
+			return "application/soap+xml; charset=utf-8"
+		}
+		return fmt.Sprintf("application/soap+xml; charset=utf-8; action=%q", action)
+	}
+	return "text/xml; charset=utf-8"
+}
+
+func (v Version) String() string {
+	if v == V12 {
+		return "1.2"
+	}
+	return "1.1"
+}
+
+//---------------- Envelope models ---------------- //
+
+type envelope struct {
+	XMLName   xml.Name `xml:"soap:Envelope"`
+	Namespace string   `xml:"xmlns:soap,attr"`
+	Header    *header  `xml:"soap:Header,omitempty"`
+	Body      body     `xml:"soap:Body"`
+}
+
+type header struct {
+	Content interface{}
+}
+
+type body struct {
+	Content interface{}
+}
+
+// responseEnvelope matches elements on their local name only, so it decodes both versions regardless of the prefix used
+type responseEnvelope struct {
+	XMLName xml.Name     `xml:"Envelope"`
+	Body    responseBody `xml:"Body"`
+}
+
+type responseBody struct {
+	Fault   *Fault `xml:"Fault"`
+	Content []byte `xml:",innerxml"`
+}
+
+//---------------- Codec ---------------- //
+
+// Marshal wraps the body (and the optional header block) in a SOAP envelope for the given version. The header and body
+// values should name their element (and namespace) through an XMLName field, eg. `xml:"urn:gateway DepositRequest"`
+func Marshal(version Version, headerContent interface{}, bodyContent interface{}) ([]byte, error) {
+	env := envelope{
+		Namespace: version.Namespace(),
+		Body:      body{Content: bodyContent},
+	}
+	if headerContent != nil {
+		env.Header = &header{Content: headerContent}
+	}
+
+	payload, err := xml.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), payload...), nil
+}
+
+// Unmarshal decodes the content of the SOAP body into v. If the body carries a soap:Fault it is returned as a *Fault
+func Unmarshal(data []byte, v interface{}) error {
+	var env responseEnvelope
+	if err := xml.Unmarshal(data, &env); err != nil {
+		return fmt.Errorf("invalid soap envelope: %w", err)
+	}
+
+	if env.Body.Fault != nil {
+		return env.Body.Fault
+	}
+
+	if len(bytes.TrimSpace(env.Body.Content)) == 0 {
+		return fmt.Errorf("empty soap body")
+	}
+
+	return xml.Unmarshal(env.Body.Content, v)
+}
+
+// NewRequest builds a POST request with the body wrapped in a SOAP envelope and the action set as the version requires
+func NewRequest(ctx context.Context, version Version, url string, action string, headerContent interface{}, bodyContent interface{}) (*http.Request, error) {
+	payload, err := Marshal(version, headerContent, bodyContent)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", version.ContentType(action))
+	if version == V11 {
+		// SOAP 1.1 requires the header to be present and quoted, even when the action is empty
+		req.Header.Set("SOAPAction", fmt.Sprintf("%q", action))
+	}
+
+	return req, nil
+}
+
+// DecodeResponse reads the response body and decodes it with Unmarshal. Faults are returned as *Fault
+// whatever the HTTP status code is, as SOAP 1.1 gateways send them with a 500 and SOAP 1.2 ones may use 400
+func DecodeResponse(resp *http.Response, v interface{}) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return Unmarshal(data, v)
+}
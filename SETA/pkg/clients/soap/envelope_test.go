@@ -0,0 +1,110 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testRequest struct {
+	XMLName   xml.Name `xml:"urn:test DepositRequest"`
+	AccountID string   `xml:"AccountID"`
+}
+
+type testResponse struct {
+	TransactionID string `xml:"TransactionID"`
+	Status        string `xml:"Status"`
+}
+
+func TestMarshal_V11(t *testing.T) {
+	payload, err := Marshal(V11, nil, &testRequest{AccountID: "acc123"})
+
+	assert.NoError(t, err)
+	assert.Contains(t, string(payload), `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">`)
+	assert.Contains(t, string(payload), `<soap:Body><DepositRequest xmlns="urn:test"><AccountID>acc123</AccountID></DepositRequest></soap:Body>`)
+	assert.NotContains(t, string(payload), "soap:Header")
+}
+
+func TestNewRequest_Headers(t *testing.T) {
+	req11, err := NewRequest(context.Background(), V11, "http://gateway/deposit", "urn:test/Deposit", nil, &testRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "text/xml; charset=utf-8", req11.Header.Get("Content-Type"))
+	assert.Equal(t, `"urn:test/Deposit"`, req11.Header.Get("SOAPAction"))
+
+	req12, err := NewRequest(context.Background(), V12, "http://gateway/deposit", "urn:test/Deposit", nil, &testRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, `application/soap+xml; charset=utf-8; action="urn:test/Deposit"`, req12.Header.Get("Content-Type"))
+	assert.Empty(t, req12.Header.Get("SOAPAction"))
+}
+
+func TestUnmarshal_Body(t *testing.T) {
+	data := `<?xml version="1.0"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+	<env:Header/>
+	<env:Body>
+		<m:DepositResponse xmlns:m="urn:test">
+			<m:TransactionID>txn123</m:TransactionID>
+			<m:Status>success</m:Status>
+		</m:DepositResponse>
+	</env:Body>
+</env:Envelope>`
+
+	var response testResponse
+	err := Unmarshal([]byte(data), &response)
+
+	assert.NoError(t, err)
+	assert.Equal(t, testResponse{TransactionID: "txn123", Status: "success"}, response)
+}
+
+func TestUnmarshal_V11ClientFault(t *testing.T) {
+	data := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Body>
+		<soap:Fault>
+			<faultcode>soap:Client.Validation</faultcode>
+			<faultstring>invalid account</faultstring>
+		</soap:Fault>
+	</soap:Body>
+</soap:Envelope>`
+
+	err := Unmarshal([]byte(data), &testResponse{})
+
+	var fault *Fault
+	assert.True(t, errors.As(err, &fault))
+	assert.Equal(t, "Client.Validation", fault.CodeValue())
+	assert.Equal(t, "invalid account", fault.ReasonText())
+	assert.True(t, fault.IsClientFault())
+	assert.False(t, fault.IsServerFault())
+}
+
+func TestUnmarshal_V12ServerFault(t *testing.T) {
+	data := `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+	<env:Body>
+		<env:Fault>
+			<env:Code><env:Value>env:Receiver</env:Value></env:Code>
+			<env:Reason><env:Text xml:lang="en">gateway unavailable</env:Text></env:Reason>
+			<env:Detail><RetryAfter>30</RetryAfter></env:Detail>
+		</env:Fault>
+	</env:Body>
+</env:Envelope>`
+
+	err := Unmarshal([]byte(data), &testResponse{})
+
+	var fault *Fault
+	assert.True(t, errors.As(err, &fault))
+	assert.Equal(t, "Receiver", fault.CodeValue())
+	assert.Equal(t, "gateway unavailable", fault.ReasonText())
+	assert.Equal(t, "<RetryAfter>30</RetryAfter>", fault.DetailContent())
+	assert.True(t, fault.IsServerFault())
+	assert.False(t, fault.IsClientFault())
+}
+
+func TestUnmarshal_NotAnEnvelope(t *testing.T) {
+	err := Unmarshal([]byte(`<Data><TransactionID>txn123</TransactionID></Data>`), &testResponse{})
+
+	var fault *Fault
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &fault))
+}
@@ -0,0 +1,94 @@
+package soap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fault is a soap:Fault returned by a gateway. It holds the fields of both SOAP 1.1 (faultcode, faultstring) and
+// SOAP 1.2 (Code/Value, Reason/Text), only the ones of the version the gateway speaks are set
+type Fault struct {
+	// SOAP 1.1
+	FaultCode   string      `xml:"faultcode"`
+	FaultString string      `xml:"faultstring"`
+	FaultActor  string      `xml:"faultactor"`
+	FaultDetail faultDetail `xml:"detail"`
+
+	// SOAP 1.2
+	Code   faultCode   `xml:"Code"`
+	Reason []faultText `xml:"Reason>Text"`
+	Detail faultDetail `xml:"Detail"`
+}
+
+type faultCode struct {
+	Value   string     `xml:"Value"`
+	Subcode *faultCode `xml:"Subcode"`
+}
+
+type faultText struct {
+	Lang string `xml:"lang,attr"`
+	Text string `xml:",chardata"`
+}
+
+type faultDetail struct {
+	Content string `xml:",innerxml"`
+}
+
+// CodeValue returns the fault code without its namespace prefix, eg. "Client" for "soap:Client"
+func (f *Fault) CodeValue() string {
+	code := f.FaultCode
+	if code == "" {
+		code = f.Code.Value
+	}
+
+	if i := strings.LastIndex(code, ":"); i >= 0 {
+		code = code[i+1:]
+	}
+
+	return strings.TrimSpace(code)
+}
+
+// ReasonText returns the human readable reason of the fault
+func (f *Fault) ReasonText() string {
+	if f.FaultString != "" {
+		return strings.TrimSpace(f.FaultString)
+	}
+
+	for _, reason := range f.Reason {
+		if reason.Lang == "" || strings.HasPrefix(reason.Lang, "en") {
+			return strings.TrimSpace(reason.Text)
+		}
+	}
+
+	if len(f.Reason) > 0 {
+		return strings.TrimSpace(f.Reason[0].Text)
+	}
+
+	return ""
+}
+
+// DetailContent returns the raw inner XML of the fault detail
+func (f *Fault) DetailContent() string {
+	if f.FaultDetail.Content != "" {
+		return strings.TrimSpace(f.FaultDetail.Content)
+	}
+	return strings.TrimSpace(f.Detail.Content)
+}
+
+// IsClientFault reports whether the gateway rejected the request itself (soap:Client in 1.1, env:Sender in 1.2).
+// Sending the same request again, to this or any other gateway, will not succeed
+func (f *Fault) IsClientFault() bool {
+	code := f.CodeValue()
+	// SOAP 1.1 allows dotted specialisations such as "Client.Authentication"
+	return code == "Sender" || code == "Client" || strings.HasPrefix(code, "Client.")
+}
+
+// IsServerFault reports whether the gateway failed to process a valid request (soap:Server in 1.1, env:Receiver in 1.2)
+func (f *Fault) IsServerFault() bool {
+	code := f.CodeValue()
+	return code == "Receiver" || code == "Server" || strings.HasPrefix(code, "Server.")
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("soap fault %s: %s", f.CodeValue(), f.ReasonText())
+}
@@ -1,35 +1,362 @@
 package config
 
-import "os"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"seta/pkg/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTransactionTimeout is the time budget for a transaction across all payment gateways when TRANSACTION_TIMEOUT is not set
+	DefaultTransactionTimeout = 30 * time.Second
+	// DefaultCircuitFailureThreshold is the number of consecutive gateway failures that open its circuit breaker
+	DefaultCircuitFailureThreshold = 5
+	// DefaultCircuitCoolDown is how long an open circuit breaker skips its gateway before letting a trial request through
+	DefaultCircuitCoolDown = 30 * time.Second
+	// DefaultRetryMaxAttempts is the number of attempts (the first call included) made on a gateway before failing over
+	DefaultRetryMaxAttempts = 3
+	// DefaultRetryBaseDelay is the delay before the first retry, doubled for every following one
+	DefaultRetryBaseDelay = 100 * time.Millisecond
+	// DefaultRetryMaxDelay caps the delay between two attempts
+	DefaultRetryMaxDelay = 2 * time.Second
+	// DefaultRetryJitter is the fraction of the delay that is randomly taken off
+	DefaultRetryJitter = 0.5
+	// DefaultGatewayWeight is the weight of a gateway for the weighted routing strategy
+	DefaultGatewayWeight = 1
+	// DefaultReconcileInterval is how often pending transactions are checked with their gateway
+	DefaultReconcileInterval = time.Minute
+	// DefaultReconcileMaxAge is the age after which a pending transaction is no longer checked and is left for manual resolution
+	DefaultReconcileMaxAge = 24 * time.Hour
+	// DefaultReconcileBatchSize is the number of pending transactions checked per run
+	DefaultReconcileBatchSize = 100
+	// DefaultRecoveryStaleAfter is the age after which an initiated transaction is taken as interrupted, it has to be
+	// longer than the transaction timeout so that no transaction still being processed is recovered
+	DefaultRecoveryStaleAfter = 5 * time.Minute
+	// DefaultRecoveryBatchSize is the number of initiated transactions recovered per run
+	DefaultRecoveryBatchSize = 100
+	// DefaultCallbackTolerance is how far the timestamp of a gateway callback may be from the current time
+	DefaultCallbackTolerance = 5 * time.Minute
+	// DefaultFXQuoteTTL is how long an FX quote locks its rate when FX_QUOTE_TTL is not set
+	DefaultFXQuoteTTL = 30 * time.Second
+	// DefaultIdempotencyKeyTTL is how long the idempotency key of a deposit or withdrawal is kept
+	DefaultIdempotencyKeyTTL = 24 * time.Hour
+	// DefaultGatewayTimeout is the upper bound of a single call to a gateway, the transaction deadline normally ends a call first
+	DefaultGatewayTimeout = 60 * time.Second
+)
 
 type ConfigManager struct {
 	configModel ConfigModel
 }
 
 type ConfigModel struct {
-	GatewayAEndpoint string
-	GatewayBEndpoint string
-	DatabaseDSN      string
+	DatabaseDSN        string
+	TransactionTimeout time.Duration
+	GatewaysFile       string
+	LimitsFile         string
+	RiskRulesFile      string
+	IdempotencyKeyTTL  time.Duration
+	AdminToken         string // bearer token of PUT /transaction and the refunds, which are disabled when it is empty
+	Routing            RoutingConfig
+	Reconciler         ReconcilerConfig
+	Recovery           RecoveryConfig
+	Currencies         CurrencyConfig
+	FX                 FXConfig
+}
+
+type FXConfig struct {
+	RatesFile  string        // JSON file with the rates loaded at startup
+	QuoteTTL   time.Duration // how long a quote locks its rate
+	AdminToken string        // bearer token of the rates admin API, which is disabled when it is empty
+}
+
+type CurrencyConfig struct {
+	Default   string   // currency of the requests that do not give one
+	Supported []string // ISO 4217 codes transactions can be made in
+}
+
+type CircuitBreakerConfig struct {
+	FailureThreshold int           // consecutive failures that open the circuit
+	CoolDown         time.Duration // time the circuit stays open before a trial request is let through
+}
+
+type RoutingConfig struct {
+	Strategy      string // priority, weighted, round_robin or least_latency
+	LatencyWindow int    // number of recent calls per gateway the p95 latency is computed on
+	RulesFile     string // JSON file with the routing rules, evaluated before the strategy
+}
+
+type ReconcilerConfig struct {
+	Interval  time.Duration // time between two runs
+	MinAge    time.Duration // a transaction is first checked once it is this old, so the gateway has time to settle it
+	MaxAge    time.Duration // a transaction older than this is no longer checked
+	BatchSize int           // pending transactions checked per run
+	Timeout   time.Duration // upper bound of a single status query
 }
 
-func GetConfigManager() *ConfigManager {
-	return &ConfigManager{
+type RecoveryConfig struct {
+	StaleAfter time.Duration // an initiated transaction older than this was interrupted before its outcome was recorded
+	BatchSize  int           // initiated transactions recovered per run
+	Timeout    time.Duration // upper bound of the lookups made for a single transaction
+}
+
+type CallbackConfig struct {
+	Secret    string        // HMAC secret shared with the gateway, callbacks are rejected when it is empty
+	Tolerance time.Duration // maximum distance between the callback timestamp and the current time
+}
+
+type RetryConfig struct {
+	MaxAttempts int           // attempts made on the gateway, the first call included
+	BaseDelay   time.Duration // delay before the first retry, doubled for every following one
+	MaxDelay    time.Duration // upper bound of the delay between two attempts
+	Jitter      float64       // fraction (0 to 1) of the delay randomly taken off
+}
+
+// GetConfigManager reads the configuration from the environment, it fails on an invalid or inconsistent setting
+func GetConfigManager() (*ConfigManager, error) {
+	env := &envReader{}
+	transactionTimeout := env.getDuration("TRANSACTION_TIMEOUT", DefaultTransactionTimeout)
+	recoveryStaleAfter := env.getDuration("RECOVERY_STALE_AFTER", DefaultRecoveryStaleAfter)
+
+	configManager := &ConfigManager{
 		ConfigModel{
-			GatewayAEndpoint: os.Getenv("GATEWAY_A_ENDPOINT"),
-			GatewayBEndpoint: os.Getenv("GATEWAY_B_ENDPOINT"),
-			DatabaseDSN:      os.Getenv("DATABASE_DSN"),
+			DatabaseDSN:        os.Getenv("DATABASE_DSN"),
+			TransactionTimeout: transactionTimeout,
+			GatewaysFile:       os.Getenv("GATEWAYS_CONFIG_FILE"),
+			LimitsFile:         os.Getenv("LIMITS_FILE"),
+			RiskRulesFile:      os.Getenv("RISK_RULES_FILE"),
+			IdempotencyKeyTTL:  env.getDuration("IDEMPOTENCY_KEY_TTL", DefaultIdempotencyKeyTTL),
+			AdminToken:         os.Getenv("TRANSACTION_ADMIN_TOKEN"),
+			Routing: RoutingConfig{
+				Strategy:      os.Getenv("GATEWAY_ROUTING_STRATEGY"),
+				LatencyWindow: env.getInt("GATEWAY_LATENCY_WINDOW", 0),
+				RulesFile:     os.Getenv("ROUTING_RULES_FILE"),
+			},
+			Reconciler: ReconcilerConfig{
+				Interval:  env.getDuration("RECONCILE_INTERVAL", DefaultReconcileInterval),
+				MinAge:    env.getDuration("RECONCILE_MIN_AGE", DefaultReconcileInterval),
+				MaxAge:    env.getDuration("RECONCILE_MAX_AGE", DefaultReconcileMaxAge),
+				BatchSize: env.getInt("RECONCILE_BATCH_SIZE", DefaultReconcileBatchSize),
+				Timeout:   transactionTimeout,
+			},
+			Recovery: RecoveryConfig{
+				StaleAfter: recoveryStaleAfter,
+				BatchSize:  env.getInt("RECOVERY_BATCH_SIZE", DefaultRecoveryBatchSize),
+				Timeout:    transactionTimeout,
+			},
+			Currencies: CurrencyConfig{
+				Default:   os.Getenv("DEFAULT_CURRENCY"),
+				Supported: getListEnv("SUPPORTED_CURRENCIES"),
+			},
+			FX: FXConfig{
+				RatesFile:  os.Getenv("FX_RATES_FILE"),
+				QuoteTTL:   env.getDuration("FX_QUOTE_TTL", DefaultFXQuoteTTL),
+				AdminToken: os.Getenv("FX_ADMIN_TOKEN"),
+			},
 		},
 	}
-}
+	if env.err != nil {
+		return nil, env.err
+	}
 
-func (cm *ConfigManager) GetGatewayAEndpoint() string {
-	return cm.configModel.GatewayAEndpoint
-}
+	// a transaction still being processed must not be taken for one left initiated by a previous run
+	if recoveryStaleAfter <= transactionTimeout {
+		return nil, fmt.Errorf("RECOVERY_STALE_AFTER: %s must be longer than TRANSACTION_TIMEOUT (%s)", recoveryStaleAfter, transactionTimeout)
+	}
 
-func (cm *ConfigManager) GetGatewayBEndpoint() string {
-	return cm.configModel.GatewayBEndpoint
+	// the transactions the risk rules send to review can only be approved or rejected with PUT /transaction
+	if configManager.configModel.RiskRulesFile != "" && configManager.configModel.AdminToken == "" {
+		return nil, errors.New("TRANSACTION_ADMIN_TOKEN: must be set with RISK_RULES_FILE, transactions in review are resolved with it")
+	}
+
+	return configManager, nil
 }
 
 func (cm *ConfigManager) GetDatabaseDSN() string {
 	return cm.configModel.DatabaseDSN
 }
+
+func (cm *ConfigManager) GetTransactionTimeout() time.Duration {
+	return cm.configModel.TransactionTimeout
+}
+
+// GetGateways returns the enabled payment gateways in the order they are tried, read from GATEWAYS_CONFIG_FILE. When
+// no file is configured, Payment Gateway A and B are configured from the GATEWAY_A_* and GATEWAY_B_* variables
+func (cm *ConfigManager) GetGateways() ([]GatewayConfig, error) {
+	if cm.configModel.GatewaysFile == "" {
+		return getLegacyGatewayConfigs()
+	}
+	return LoadGatewayConfigs(cm.configModel.GatewaysFile)
+}
+
+// GetLimitsFile returns the JSON file with the transaction limits, no limits are enforced when it is empty
+func (cm *ConfigManager) GetLimitsFile() string {
+	return cm.configModel.LimitsFile
+}
+
+// GetRiskRulesFile returns the JSON file with the risk rules, no transaction is assessed when it is empty
+func (cm *ConfigManager) GetRiskRulesFile() string {
+	return cm.configModel.RiskRulesFile
+}
+
+// GetIdempotencyKeyTTL returns how long the idempotency key of a deposit or withdrawal is kept, from its first request
+func (cm *ConfigManager) GetIdempotencyKeyTTL() time.Duration {
+	return cm.configModel.IdempotencyKeyTTL
+}
+
+// GetTransactionAdminToken returns the bearer token of the manual status updates and the refunds, they are disabled when it is empty
+func (cm *ConfigManager) GetTransactionAdminToken() string {
+	return cm.configModel.AdminToken
+}
+
+func (cm *ConfigManager) GetRouting() RoutingConfig {
+	return cm.configModel.Routing
+}
+
+func (cm *ConfigManager) GetReconciler() ReconcilerConfig {
+	return cm.configModel.Reconciler
+}
+
+func (cm *ConfigManager) GetRecovery() RecoveryConfig {
+	return cm.configModel.Recovery
+}
+
+func (cm *ConfigManager) GetFX() FXConfig {
+	return cm.configModel.FX
+}
+
+// GetCurrencies returns the default currency and the supported ones from DEFAULT_CURRENCY and SUPPORTED_CURRENCIES. The
+// default currency is USD when unset and is always supported, only it is supported when SUPPORTED_CURRENCIES is unset
+func (cm *ConfigManager) GetCurrencies() (model.Currency, []model.Currency, error) {
+	defaultCurrency := model.DefaultCurrency
+	if cm.configModel.Currencies.Default != "" {
+		var ok bool
+		if defaultCurrency, ok = model.ParseCurrency(cm.configModel.Currencies.Default); !ok {
+			return "", nil, fmt.Errorf("DEFAULT_CURRENCY: %q is not an ISO 4217 currency", cm.configModel.Currencies.Default)
+		}
+	}
+
+	supported, err := parseCurrencies(cm.configModel.Currencies.Supported)
+	if err != nil {
+		return "", nil, fmt.Errorf("SUPPORTED_CURRENCIES: %w", err)
+	}
+
+	for _, currency := range supported {
+		if currency == defaultCurrency {
+			return defaultCurrency, supported, nil
+		}
+	}
+	return defaultCurrency, append(supported, defaultCurrency), nil
+}
+
+// parseCurrencies checks that every code is an ISO 4217 currency, the codes are returned in upper case
+func parseCurrencies(codes []string) ([]model.Currency, error) {
+	currencies := make([]model.Currency, 0, len(codes))
+	for _, code := range codes {
+		currency, ok := model.ParseCurrency(code)
+		if !ok {
+			return nil, fmt.Errorf("%q is not an ISO 4217 currency", code)
+		}
+		currencies = append(currencies, currency)
+	}
+	return currencies, nil
+}
+
+// getCircuitBreakerConfig reads the <prefix>_CIRCUIT_FAILURE_THRESHOLD and <prefix>_CIRCUIT_COOL_DOWN settings of a gateway
+func getCircuitBreakerConfig(env *envReader, prefix string) CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		FailureThreshold: env.getInt(prefix+"_CIRCUIT_FAILURE_THRESHOLD", DefaultCircuitFailureThreshold),
+		CoolDown:         env.getDuration(prefix+"_CIRCUIT_COOL_DOWN", DefaultCircuitCoolDown),
+	}
+}
+
+// getRetryConfig reads the <prefix>_RETRY_MAX_ATTEMPTS, <prefix>_RETRY_BASE_DELAY, <prefix>_RETRY_MAX_DELAY and
+// <prefix>_RETRY_JITTER settings of a gateway
+func getRetryConfig(env *envReader, prefix string) RetryConfig {
+	return RetryConfig{
+		MaxAttempts: env.getInt(prefix+"_RETRY_MAX_ATTEMPTS", DefaultRetryMaxAttempts),
+		BaseDelay:   env.getDuration(prefix+"_RETRY_BASE_DELAY", DefaultRetryBaseDelay),
+		MaxDelay:    env.getDuration(prefix+"_RETRY_MAX_DELAY", DefaultRetryMaxDelay),
+		Jitter:      env.getFraction(prefix+"_RETRY_JITTER", DefaultRetryJitter),
+	}
+}
+
+// getCallbackConfig reads the <prefix>_CALLBACK_SECRET and <prefix>_CALLBACK_TOLERANCE settings of a gateway
+func getCallbackConfig(env *envReader, prefix string) CallbackConfig {
+	return CallbackConfig{
+		Secret:    os.Getenv(prefix + "_CALLBACK_SECRET"),
+		Tolerance: env.getDuration(prefix+"_CALLBACK_TOLERANCE", DefaultCallbackTolerance),
+	}
+}
+
+// getListEnv splits a comma separated list from the environment, empty items are left out
+func getListEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// envReader reads numeric settings from the environment, the default is only used when a setting is unset. The first
+// setting that is set to an invalid value is kept in err
+type envReader struct {
+	err error
+}
+
+// fail records the error of the setting unless an earlier one already failed
+func (r *envReader) fail(key string, raw string, expected string) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%s: %q is not %s", key, raw, expected)
+	}
+}
+
+// getInt parses a positive integer
+func (r *envReader) getInt(key string, defaultValue int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		r.fail(key, raw, "a positive integer")
+		return defaultValue
+	}
+	return value
+}
+
+// getDuration parses a positive duration (eg. "30s", "1m")
+func (r *envReader) getDuration(key string, defaultValue time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+
+	value, err := time.ParseDuration(raw)
+	if err != nil || value <= 0 {
+		r.fail(key, raw, "a positive duration")
+		return defaultValue
+	}
+	return value
+}
+
+// getFraction parses a number between 0 and 1
+func (r *envReader) getFraction(key string, defaultValue float64) float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || value < 0 || value > 1 {
+		r.fail(key, raw, "a number between 0 and 1")
+		return defaultValue
+	}
+	return value
+}
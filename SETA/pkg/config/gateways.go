@@ -0,0 +1,223 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"seta/pkg/model"
+	"time"
+)
+
+// GatewayConfig configures one payment gateway. Type selects the registered gateway implementation, Name identifies
+// this instance in logs, routing rules and errors, so the same implementation can be configured more than once
+type GatewayConfig struct {
+	Name           string
+	Type           string
+	Endpoint       string
+	Timeout        time.Duration
+	Credentials    map[string]string // eg. auth_token, values can reference environment variables as ${NAME}
+	Options        map[string]string // implementation specific settings, eg. soap_version
+	Weight         int
+	Currencies     []model.Currency // currencies the gateway accepts, every supported currency when empty
+	CircuitBreaker CircuitBreakerConfig
+	Retry          RetryConfig
+	Callback       CallbackConfig
+}
+
+//---------------- File models ---------------- //
+
+type gatewaysFile struct {
+	Gateways []gatewayFileConfig `json:"gateways"`
+}
+
+type gatewayFileConfig struct {
+	Name           string            `json:"name"`
+	Type           string            `json:"type"`
+	Enabled        *bool             `json:"enabled"`
+	Endpoint       string            `json:"endpoint"`
+	Timeout        string            `json:"timeout"`
+	Credentials    map[string]string `json:"credentials"`
+	Options        map[string]string `json:"options"`
+	Weight         *int              `json:"weight"`
+	Currencies     []string          `json:"currencies"`
+	CircuitBreaker struct {
+		FailureThreshold int    `json:"failure_threshold"`
+		CoolDown         string `json:"cool_down"`
+	} `json:"circuit_breaker"`
+	Retry struct {
+		MaxAttempts int      `json:"max_attempts"`
+		BaseDelay   string   `json:"base_delay"`
+		MaxDelay    string   `json:"max_delay"`
+		Jitter      *float64 `json:"jitter"`
+	} `json:"retry"`
+	Callback struct {
+		Secret    string `json:"secret"`
+		Tolerance string `json:"tolerance"`
+	} `json:"callback"`
+}
+
+// LoadGatewayConfigs reads the gateways from a JSON file of the form {"gateways": [...]}. The file order is the
+// priority order, disabled gateways are left out and unset settings get their defaults
+func LoadGatewayConfigs(filePath string) ([]GatewayConfig, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gateways config: %w", err)
+	}
+
+	var file gatewaysFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse gateways config: %w", err)
+	}
+
+	names := map[string]bool{}
+	gatewayConfigs := make([]GatewayConfig, 0, len(file.Gateways))
+	for _, gateway := range file.Gateways {
+		if gateway.Enabled != nil && !*gateway.Enabled {
+			continue
+		}
+
+		gatewayConfig, err := gateway.toGatewayConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		if names[gatewayConfig.Name] {
+			return nil, fmt.Errorf("gateway %q is configured more than once", gatewayConfig.Name)
+		}
+		names[gatewayConfig.Name] = true
+
+		gatewayConfigs = append(gatewayConfigs, gatewayConfig)
+	}
+
+	return gatewayConfigs, nil
+}
+
+func (g *gatewayFileConfig) toGatewayConfig() (GatewayConfig, error) {
+	if g.Type == "" {
+		return GatewayConfig{}, fmt.Errorf("gateway %q has no type", g.Name)
+	}
+
+	name := g.Name
+	if name == "" {
+		name = g.Type
+	}
+
+	gatewayConfig := GatewayConfig{
+		Name:        name,
+		Type:        g.Type,
+		Endpoint:    os.ExpandEnv(g.Endpoint),
+		Credentials: map[string]string{},
+		Options:     map[string]string{},
+		Weight:      DefaultGatewayWeight,
+		CircuitBreaker: CircuitBreakerConfig{
+			FailureThreshold: DefaultCircuitFailureThreshold,
+		},
+		Retry: RetryConfig{
+			MaxAttempts: DefaultRetryMaxAttempts,
+			Jitter:      DefaultRetryJitter,
+		},
+		Callback: CallbackConfig{
+			Secret: os.ExpandEnv(g.Callback.Secret),
+		},
+	}
+
+	// secrets are usually kept out of the file and referenced as ${NAME}
+	for key, value := range g.Credentials {
+		gatewayConfig.Credentials[key] = os.ExpandEnv(value)
+	}
+	for key, value := range g.Options {
+		gatewayConfig.Options[key] = value
+	}
+
+	if g.Weight != nil {
+		gatewayConfig.Weight = *g.Weight
+	}
+	currencies, err := parseCurrencies(g.Currencies)
+	if err != nil {
+		return GatewayConfig{}, fmt.Errorf("gateway %q: %w", name, err)
+	}
+	gatewayConfig.Currencies = currencies
+
+	if g.CircuitBreaker.FailureThreshold > 0 {
+		gatewayConfig.CircuitBreaker.FailureThreshold = g.CircuitBreaker.FailureThreshold
+	}
+	if g.Retry.MaxAttempts > 0 {
+		gatewayConfig.Retry.MaxAttempts = g.Retry.MaxAttempts
+	}
+	if g.Retry.Jitter != nil {
+		gatewayConfig.Retry.Jitter = *g.Retry.Jitter
+	}
+
+	durations := []struct {
+		field        string
+		value        string
+		defaultValue time.Duration
+		target       *time.Duration
+	}{
+		{"timeout", g.Timeout, DefaultGatewayTimeout, &gatewayConfig.Timeout},
+		{"circuit_breaker.cool_down", g.CircuitBreaker.CoolDown, DefaultCircuitCoolDown, &gatewayConfig.CircuitBreaker.CoolDown},
+		{"retry.base_delay", g.Retry.BaseDelay, DefaultRetryBaseDelay, &gatewayConfig.Retry.BaseDelay},
+		{"retry.max_delay", g.Retry.MaxDelay, DefaultRetryMaxDelay, &gatewayConfig.Retry.MaxDelay},
+		{"callback.tolerance", g.Callback.Tolerance, DefaultCallbackTolerance, &gatewayConfig.Callback.Tolerance},
+	}
+	for _, duration := range durations {
+		*duration.target = duration.defaultValue
+		if duration.value == "" {
+			continue
+		}
+
+		value, err := time.ParseDuration(duration.value)
+		if err != nil {
+			return GatewayConfig{}, fmt.Errorf("gateway %q has an invalid %s: %w", name, duration.field, err)
+		}
+		*duration.target = value
+	}
+
+	return gatewayConfig, nil
+}
+
+// getLegacyGatewayConfigs configures Payment Gateway A and B from the environment, as before the gateways file existed
+func getLegacyGatewayConfigs() ([]GatewayConfig, error) {
+	env := &envReader{}
+	currenciesA, err := parseCurrencies(getListEnv("GATEWAY_A_CURRENCIES"))
+	if err != nil {
+		return nil, fmt.Errorf("GATEWAY_A_CURRENCIES: %w", err)
+	}
+	currenciesB, err := parseCurrencies(getListEnv("GATEWAY_B_CURRENCIES"))
+	if err != nil {
+		return nil, fmt.Errorf("GATEWAY_B_CURRENCIES: %w", err)
+	}
+
+	gatewayConfigs := []GatewayConfig{
+		{
+			Name:           "gatewaya",
+			Type:           "gatewaya",
+			Endpoint:       os.Getenv("GATEWAY_A_ENDPOINT"),
+			Timeout:        DefaultGatewayTimeout,
+			Credentials:    map[string]string{},
+			Options:        map[string]string{},
+			Weight:         env.getInt("GATEWAY_A_WEIGHT", DefaultGatewayWeight),
+			Currencies:     currenciesA,
+			CircuitBreaker: getCircuitBreakerConfig(env, "GATEWAY_A"),
+			Retry:          getRetryConfig(env, "GATEWAY_A"),
+			Callback:       getCallbackConfig(env, "GATEWAY_A"),
+		},
+		{
+			Name:           "gatewayb",
+			Type:           "gatewayb",
+			Endpoint:       os.Getenv("GATEWAY_B_ENDPOINT"),
+			Timeout:        DefaultGatewayTimeout,
+			Credentials:    map[string]string{},
+			Options:        map[string]string{"soap_version": os.Getenv("GATEWAY_B_SOAP_VERSION")},
+			Weight:         env.getInt("GATEWAY_B_WEIGHT", DefaultGatewayWeight),
+			Currencies:     currenciesB,
+			CircuitBreaker: getCircuitBreakerConfig(env, "GATEWAY_B"),
+			Retry:          getRetryConfig(env, "GATEWAY_B"),
+			Callback:       getCallbackConfig(env, "GATEWAY_B"),
+		},
+	}
+	if env.err != nil {
+		return nil, env.err
+	}
+	return gatewayConfigs, nil
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"fmt"
+	"seta/pkg/model"
+	"seta/pkg/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+type AccountController struct {
+	LedgerService service.ILedgerService
+}
+
+func AccountControllerProvider(ledgerService service.ILedgerService) model.IController {
+	return &AccountController{LedgerService: ledgerService}
+}
+
+func (ac *AccountController) SetupRoutes(r *echo.Group) {
+	r.GET("/accounts/:account_id/balance", ac.GetBalance)
+}
+
+//------------------Controller Methods------------------//
+
+// @BasePath /
+// Get Balance GET
+// @Summary API To get the balance of an account
+// @Schemes
+// @Description Returns the available balance of the account in a currency and the amount held for withdrawals that have not settled yet, an account without any transaction has a zero balance
+// @Description Api will return status 200 with the balance, 400 if the currency is invalid and 500 if there is an internal server error
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.DefaultResponse{data=model.AccountBalance}
+// @Failure 400 {object} model.DefaultError{error=string}
+// @Failure 500 {object} model.DefaultError{error=string}
+// @Param account_id path string true "Account ID"
+// @Param currency query string false "ISO 4217 currency, defaults to USD"
+// @Router /api/v1/accounts/{account_id}/balance [get]
+func (ac *AccountController) GetBalance(c echo.Context) error {
+	currency := model.DefaultCurrency
+	if c.QueryParam("currency") != "" {
+		var ok bool
+		if currency, ok = model.ParseCurrency(c.QueryParam("currency")); !ok {
+			return c.JSON(400, model.DefaultError{Error: fmt.Sprintf("invalid currency %q", c.QueryParam("currency"))})
+		}
+	}
+
+	balance, err := ac.LedgerService.GetBalance(c.Request().Context(), c.Param("account_id"), currency)
+	if err != nil {
+		return c.JSON(500, model.DefaultError{Error: err.Error()})
+	}
+
+	return c.JSON(200, model.DefaultResponse{Data: balance})
+}
@@ -0,0 +1,23 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"seta/pkg/model"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// authorizeAdmin checks the bearer token of an admin API, which is disabled when adminToken is empty. It writes the
+// 403 or 401 response and returns false when the request is not authorized
+func authorizeAdmin(c echo.Context, adminToken string, api string) (bool, error) {
+	if adminToken == "" {
+		return false, c.JSON(403, model.DefaultError{Error: "the " + api + " admin API is disabled"})
+	}
+
+	token := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		return false, c.JSON(401, model.DefaultError{Error: "invalid admin token"})
+	}
+	return true, nil
+}
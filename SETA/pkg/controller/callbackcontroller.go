@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/model"
+	"seta/pkg/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxCallbackSize bounds the callback body that is read, the body is read before the signature can be checked
+const maxCallbackSize = 1 << 20
+
+type CallbackController struct {
+	CallbackService service.ICallbackService
+}
+
+func CallbackControllerProvider(callbackService service.ICallbackService) model.IController {
+	return &CallbackController{CallbackService: callbackService}
+}
+
+func (cc *CallbackController) SetupRoutes(r *echo.Group) {
+	r.POST("/callbacks/:gateway", cc.HandleCallback)
+}
+
+//------------------Controller Methods------------------//
+
+// @BasePath /
+// Gateway Callback POST
+// @Summary API for the payment gateways to notify a transaction status
+// @Schemes
+// @Description The body is the gateway's native payload (JSON for Payment Gateway A, a SOAP envelope for Payment Gateway B). The callback must be signed with the secret shared with the gateway: X-Signature is the hex HMAC-SHA256 of "<X-Signature-Timestamp>.<X-Signature-Nonce>.<body>".
+// @Description Api will return status 200 if the transaction is updated, 400 if the payload is invalid, 401 if the signature is invalid or the timestamp is stale, 404 if the gateway or the transaction is not found, 409 if the callback was replayed or the transaction cannot move to the status and 500 if there is an internal server error
+// @Tags Callback
+// @Accept json,xml
+// @Produce json
+// @Success 200 {object} model.DefaultResponse{data=string}
+// @Failure 400 {object} model.DefaultError{error=string}
+// @Failure 401 {object} model.DefaultError{error=string}
+// @Failure 404 {object} model.DefaultError{error=string}
+// @Failure 409 {object} model.DefaultError{error=string}
+// @Failure 500 {object} model.DefaultError{error=string}
+// @Param gateway path string true "Gateway name"
+// @Param X-Signature header string true "Hex HMAC-SHA256 signature"
+// @Param X-Signature-Timestamp header string true "Unix timestamp (seconds)"
+// @Param X-Signature-Nonce header string true "Unique nonce"
+// @Router /api/v1/callbacks/{gateway} [post]
+func (cc *CallbackController) HandleCallback(c echo.Context) error {
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxCallbackSize))
+	if err != nil {
+		return c.JSON(400, model.DefaultError{Error: "invalid request body"})
+	}
+
+	signature := model.CallbackSignature{
+		Timestamp: c.Request().Header.Get(paymentgateway.CallbackTimestampHeader),
+		Nonce:     c.Request().Header.Get(paymentgateway.CallbackNonceHeader),
+		Signature: c.Request().Header.Get(paymentgateway.CallbackSignatureHeader),
+	}
+
+	err = cc.CallbackService.HandleCallback(c.Request().Context(), c.Param("gateway"), signature, body)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCallbackPayload):
+			return c.JSON(400, model.DefaultError{Error: err.Error()})
+		case errors.Is(err, paymentgateway.ErrInvalidCallbackSignature), errors.Is(err, service.ErrStaleCallback):
+			return c.JSON(401, model.DefaultError{Error: err.Error()})
+		case errors.Is(err, service.ErrUnknownCallbackGateway), errors.Is(err, service.ErrTransactionNotFound):
+			return c.JSON(404, model.DefaultError{Error: err.Error()})
+		case errors.Is(err, service.ErrReplayedCallback), errors.Is(err, service.ErrInvalidStatusTransition), errors.Is(err, service.ErrTransactionStatusChanged):
+			return c.JSON(409, model.DefaultError{Error: err.Error()})
+		}
+		return c.JSON(500, model.DefaultError{Error: err.Error()})
+	}
+
+	return c.JSON(200, model.DefaultResponse{Data: "success"})
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"seta/pkg/model"
+	"seta/pkg/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+type FXController struct {
+	FXService  service.IFXService
+	AdminToken string // bearer token of the rates admin API, which is disabled when it is empty
+}
+
+func FXControllerProvider(fxService service.IFXService, adminToken string) model.IController {
+	return &FXController{FXService: fxService, AdminToken: adminToken}
+}
+
+func (fc *FXController) SetupRoutes(r *echo.Group) {
+	r.POST("/fx/rates", fc.SaveRates)
+	r.GET("/fx/rates", fc.GetRate)
+	r.POST("/fx/quotes", fc.CreateQuote)
+}
+
+//------------------Controller Methods------------------//
+
+// @BasePath /
+// Save FX Rates POST
+// @Summary API To load exchange rates
+// @Schemes
+// @Description Stores rates with their validity window, a rate for the same currency pair and valid_from replaces the previous one. Requires the FX_ADMIN_TOKEN as a bearer token.
+// @Description Api will return status 200 if the rates are stored, 400 if a rate is invalid, 401 if the token is missing or wrong, 403 if the admin API is disabled and 500 if there is an internal server error
+// @Tags FX
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.DefaultResponse{data=string}
+// @Failure 400 {object} model.DefaultError{error=string}
+// @Failure 401 {object} model.DefaultError{error=string}
+// @Failure 403 {object} model.DefaultError{error=string}
+// @Failure 500 {object} model.DefaultError{error=string}
+// @Param Authorization header string true "Bearer <FX_ADMIN_TOKEN>"
+// @Param FXRatesRequest body FXRatesRequest true "FX Rates Request"
+// @Router /api/v1/fx/rates [post]
+func (fc *FXController) SaveRates(c echo.Context) error {
+	if ok, err := authorizeAdmin(c, fc.AdminToken, "fx"); !ok {
+		return err
+	}
+
+	params := new(FXRatesRequest)
+	if err := c.Bind(params); err != nil {
+		return c.JSON(400, model.DefaultError{Error: fmt.Sprintf("invalid request body: %v", err)})
+	}
+
+	if len(params.Rates) == 0 {
+		return c.JSON(400, model.DefaultError{Error: "rates are required"})
+	}
+
+	err := fc.FXService.SaveRates(c.Request().Context(), params.Rates)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidFXRate) {
+			return c.JSON(400, model.DefaultError{Error: err.Error()})
+		}
+		return c.JSON(500, model.DefaultError{Error: err.Error()})
+	}
+
+	return c.JSON(200, model.DefaultResponse{Data: "success"})
+}
+
+// @BasePath /
+// Get FX Rate GET
+// @Summary API To get the current exchange rate of a currency pair
+// @Schemes
+// @Description Api will return status 200 with the rate valid now, 400 if a currency is invalid, 404 if there is no rate for the pair and 500 if there is an internal server error
+// @Tags FX
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.DefaultResponse{data=model.FXRate}
+// @Failure 400 {object} model.DefaultError{error=string}
+// @Failure 404 {object} model.DefaultError{error=string}
+// @Failure 500 {object} model.DefaultError{error=string}
+// @Param from query string true "ISO 4217 currency converted from"
+// @Param to query string true "ISO 4217 currency converted to"
+// @Router /api/v1/fx/rates [get]
+func (fc *FXController) GetRate(c echo.Context) error {
+	from, ok := model.ParseCurrency(c.QueryParam("from"))
+	if !ok {
+		return c.JSON(400, model.DefaultError{Error: fmt.Sprintf("invalid currency %q", c.QueryParam("from"))})
+	}
+	to, ok := model.ParseCurrency(c.QueryParam("to"))
+	if !ok {
+		return c.JSON(400, model.DefaultError{Error: fmt.Sprintf("invalid currency %q", c.QueryParam("to"))})
+	}
+
+	rate, err := fc.FXService.GetRate(c.Request().Context(), from, to)
+	if err != nil {
+		if errors.Is(err, service.ErrFXRateNotFound) {
+			return c.JSON(404, model.DefaultError{Error: err.Error()})
+		}
+		return c.JSON(500, model.DefaultError{Error: err.Error()})
+	}
+
+	return c.JSON(200, model.DefaultResponse{Data: rate})
+}
+
+// @BasePath /
+// Create FX Quote POST
+// @Summary API To lock an exchange rate
+// @Schemes
+// @Description Converts the amount at the current rate and locks that rate until the quote expires (FX_QUOTE_TTL, 30s by default). Pass the quote_id to /deposit or /withdraw to have the gateway process the converted amount, a quote can only be used once.
+// @Description Api will return status 200 with the quote, 400 if the request is invalid, 404 if there is no rate for the pair and 500 if there is an internal server error
+// @Tags FX
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.DefaultResponse{data=model.FXQuote}
+// @Failure 400 {object} model.DefaultError{error=string}
+// @Failure 404 {object} model.DefaultError{error=string}
+// @Failure 500 {object} model.DefaultError{error=string}
+// @Param FXQuoteRequest body FXQuoteRequest true "FX Quote Request"
+// @Router /api/v1/fx/quotes [post]
+func (fc *FXController) CreateQuote(c echo.Context) error {
+	params := new(FXQuoteRequest)
+	if err := c.Bind(params); err != nil {
+		return c.JSON(400, model.DefaultError{Error: fmt.Sprintf("invalid request body: %v", err)})
+	}
+
+	if !params.Amount.IsPositive() {
+		return c.JSON(400, model.DefaultError{Error: "amount must be positive"})
+	}
+
+	quote, err := fc.FXService.CreateQuote(c.Request().Context(), params.From, params.To, params.Amount)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnsupportedCurrency), errors.Is(err, service.ErrInvalidAmountPrecision):
+			return c.JSON(400, model.DefaultError{Error: err.Error()})
+		case errors.Is(err, service.ErrFXRateNotFound):
+			return c.JSON(404, model.DefaultError{Error: err.Error()})
+		}
+		return c.JSON(500, model.DefaultError{Error: err.Error()})
+	}
+
+	return c.JSON(200, model.DefaultResponse{Data: quote})
+}
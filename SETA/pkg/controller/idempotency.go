@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"seta/pkg/logger"
+	"seta/pkg/model"
+	"seta/pkg/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// IdempotencyKeyHeader is the header a client sends to make a deposit or withdrawal safe to retry
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on the responses that were replayed for an idempotency key
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength is the size of the key column
+	maxIdempotencyKeyLength = 255
+)
+
+// idempotent validates a transaction request and creates the transaction, at most once per Idempotency-Key: a retry
+// gets the first response replayed, a 409 while it is processed and a 422 for another request. A server error before
+// the transaction was recorded is not stored, so the request can be retried with the same key
+func (tc *TransactionController) idempotent(c echo.Context, create func(params *DepositRequest) (int, interface{}, error)) error {
+	key := c.Request().Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		params, err := tc.ValidateTransactionRequest(c)
+		if err != nil {
+			return c.JSON(400, model.DefaultError{Error: err.Error()})
+		}
+		statusCode, response, _ := create(params)
+		return c.JSON(statusCode, response)
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return c.JSON(400, model.DefaultError{Error: fmt.Sprintf("%s is longer than %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength)})
+	}
+
+	// the body is hashed as it was sent, so it is put back to be bound
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(400, model.DefaultError{Error: fmt.Sprintf("invalid request body: %v", err)})
+	}
+	c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+	// an invalid request does not use up the key
+	params, err := tc.ValidateTransactionRequest(c)
+	if err != nil {
+		return c.JSON(400, model.DefaultError{Error: err.Error()})
+	}
+
+	stored, err := tc.IdempotencyService.Begin(c.Request().Context(), key, requestHash(c.Path(), body))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrIdempotencyKeyInFlight):
+			return c.JSON(409, model.DefaultError{Error: err.Error()})
+		case errors.Is(err, service.ErrIdempotencyKeyMismatch):
+			return c.JSON(422, model.DefaultError{Error: err.Error(), Code: model.ErrorCodeIdempotencyKeyReused})
+		}
+		return c.JSON(500, model.DefaultError{Error: err.Error()})
+	}
+	if stored != nil {
+		c.Response().Header().Set(IdempotentReplayedHeader, "true")
+		return c.JSONBlob(stored.StatusCode, stored.Body)
+	}
+
+	statusCode, response, err := create(params)
+
+	// the outcome is stored even when the client went away, its retry is what the key is for. A transaction that was
+	// recorded may have been processed by a gateway, so its key is never released
+	ctx := context.Background()
+	var recordedErr *service.RecordedError
+	if statusCode >= 500 && !errors.As(err, &recordedErr) {
+		if err := tc.IdempotencyService.Release(ctx, key); err != nil {
+			logger.WithRequestID(c.Request().Context()).Errorf("failed to release idempotency key %s: %v", key, err)
+		}
+		return c.JSON(statusCode, response)
+	}
+
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		return c.JSON(500, model.DefaultError{Error: err.Error()})
+	}
+	// a key left in flight only answers 409 until it expires, which is safer than processing the request again
+	if err := tc.IdempotencyService.Complete(ctx, key, model.IdempotentResponse{StatusCode: statusCode, Body: responseBody}); err != nil {
+		logger.WithRequestID(c.Request().Context()).Errorf("failed to store the response of idempotency key %s: %v", key, err)
+	}
+	return c.JSONBlob(statusCode, responseBody)
+}
+
+// requestHash is the hex SHA-256 of the route and the body of a request, a key can only be reused for the same request
+func requestHash(path string, body []byte) string {
+	sum := sha256.Sum256(append([]byte(path+"\n"), body...))
+	return hex.EncodeToString(sum[:])
+}
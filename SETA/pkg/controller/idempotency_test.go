@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+	"seta/pkg/routing"
+	"seta/pkg/service"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func idempotencyTestServer() (*echo.Echo, *repository.MockTransactionRepository, *paymentgateway.MockClient) {
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	mockPaymentGatewayClient := &paymentgateway.MockClient{GatewayName: "gatewaya", StatusCode: 200}
+	gateways := []paymentgateway.IPaymentGateway{mockPaymentGatewayClient}
+	transactionService := service.TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider(gateways), service.WithPaymentGateways(gateways))
+	idempotencyService := service.IdempotencyServiceProvider(repository.MockIdempotencyRepositoryProvider(), 0)
+
+	e := echo.New()
+	TransactionControllerProvider(transactionService, idempotencyService, "").SetupRoutes(e.Group("/api/v1"))
+	return e, mockRepo, mockPaymentGatewayClient
+}
+
+func postDeposit(e *echo.Echo, key string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/deposit", strings.NewReader(`{"account_id": "acc123", "amount": 100}`))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	request.Header.Set(IdempotencyKeyHeader, key)
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestIdempotent_ServerErrorAfterGatewayCall(t *testing.T) {
+	e, _, mockPaymentGatewayClient := idempotencyTestServer()
+	mockPaymentGatewayClient.StatusCode = 402
+
+	first := postDeposit(e, "key1")
+	assert.Equal(t, 500, first.Code)
+	assert.NotEmpty(t, mockPaymentGatewayClient.ClientReference)
+
+	// the gateway was called, the retry gets the stored response instead of a second transaction
+	mockPaymentGatewayClient.StatusCode, mockPaymentGatewayClient.ClientReference = 200, ""
+	retry := postDeposit(e, "key1")
+
+	assert.Equal(t, 500, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Empty(t, mockPaymentGatewayClient.ClientReference)
+}
+
+func TestIdempotent_ServerErrorBeforeGatewayCall(t *testing.T) {
+	e, mockRepo, mockPaymentGatewayClient := idempotencyTestServer()
+	mockRepo.ShouldFail, mockRepo.ExpectedError = true, errors.New("connection refused")
+
+	first := postDeposit(e, "key1")
+	assert.Equal(t, 500, first.Code)
+	assert.Empty(t, mockPaymentGatewayClient.ClientReference)
+
+	// the key was released, the retry is processed
+	mockRepo.ShouldFail = false
+	mockPaymentGatewayClient.TransactionResponse = &model.TransactionResponse{Data: model.TransactionData{TransactionID: "gw123", AccountID: "acc123", Amount: decimal.NewFromInt(100), Status: model.TransactionStatusSuccess, Type: model.TransactionTypeDeposit}}
+	retry := postDeposit(e, "key1")
+
+	assert.Equal(t, 200, retry.Code)
+	assert.Empty(t, retry.Header().Get(IdempotentReplayedHeader))
+	assert.NotEmpty(t, mockPaymentGatewayClient.ClientReference)
+}
@@ -9,6 +9,25 @@ import (
 type DepositRequest struct {
 	AccountID string          `json:"account_id"`
 	Amount    decimal.Decimal `json:"amount"`
+	Currency  model.Currency  `json:"currency" example:"USD"` // ISO 4217 code, the default currency when omitted
+	QuoteID   string          `json:"quote_id,omitempty"`     // FX quote the amount is converted with, the amount and currency default to those of the quote
+}
+
+// FXQuoteRequest asks for the conversion of an amount in From to To
+type FXQuoteRequest struct {
+	From   model.Currency  `json:"from" example:"EUR"`
+	To     model.Currency  `json:"to" example:"USD"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// FXRatesRequest stores rates, a rate without valid_from is valid from now on
+type FXRatesRequest struct {
+	Rates []model.FXRate `json:"rates"`
+}
+
+// RefundRequest refunds the given amount, or the whole amount left to refund when it is omitted
+type RefundRequest struct {
+	Amount decimal.Decimal `json:"amount"`
 }
 
 type UpdateTransactionRequest struct {
@@ -16,3 +35,10 @@ type UpdateTransactionRequest struct {
 	TransactionID string                  `json:"transaction_id"`
 	Status        model.TransactionStatus `json:"status"`
 }
+
+type ExplainRouteRequest struct {
+	AccountID string
+	Amount    decimal.Decimal
+	Currency  model.Currency
+	Type      model.TransactionType
+}
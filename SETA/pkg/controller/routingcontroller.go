@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"fmt"
+	"seta/pkg/model"
+	"seta/pkg/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+)
+
+type RoutingController struct {
+	RoutingService service.IRoutingService
+}
+
+func RoutingControllerProvider(routingService service.IRoutingService) model.IController {
+	return &RoutingController{RoutingService: routingService}
+}
+
+func (rc *RoutingController) SetupRoutes(r *echo.Group) {
+	r.GET("/routing/explain", rc.ExplainRoute)
+}
+
+//------------------Controller Methods------------------//
+
+// @BasePath /
+// Explain Route GET
+// @Summary API To explain how a transaction would be routed
+// @Schemes
+// @Description Api will return status 200 with the routing rule the transaction matches and the gateways it would be sent to, 400 if the request is invalid and 500 if there is an internal server error
+// @Tags Routing
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.DefaultResponse{data=model.RoutingExplanation}
+// @Failure 400 {object} model.DefaultError{error=string}
+// @Failure 500 {object} model.DefaultError{error=string}
+// @Param account_id query string true "Account ID"
+// @Param amount query string true "Amount"
+// @Param currency query string false "ISO 4217 currency, the gateways that do not support it are left out"
+// @Param type query string true "Transaction type (deposit or withdraw)"
+// @Router /api/v1/routing/explain [get]
+func (rc *RoutingController) ExplainRoute(c echo.Context) error {
+	params, err := rc.ValidateExplainRouteRequest(c)
+	if err != nil {
+		return c.JSON(400, model.DefaultError{Error: err.Error()})
+	}
+
+	explanation, err := rc.RoutingService.ExplainRoute(c.Request().Context(), params.AccountID, params.Amount, params.Currency, params.Type)
+	if err != nil {
+		return c.JSON(500, model.DefaultError{Error: err.Error()})
+	}
+
+	return c.JSON(200, model.DefaultResponse{Data: explanation})
+}
+
+// ------------------Validation Methods------------------//
+func (rc *RoutingController) ValidateExplainRouteRequest(c echo.Context) (*ExplainRouteRequest, error) {
+	params := &ExplainRouteRequest{
+		AccountID: c.QueryParam("account_id"),
+		Type:      model.TransactionType(c.QueryParam("type")),
+	}
+
+	// validate the query parameters
+	if params.AccountID == "" {
+		return nil, fmt.Errorf("account_id is required")
+	}
+
+	if c.QueryParam("amount") == "" {
+		return nil, fmt.Errorf("amount is required")
+	}
+
+	amount, err := decimal.NewFromString(c.QueryParam("amount"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount: %v", err)
+	}
+	params.Amount = amount
+
+	if params.Amount.IsNegative() {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	if params.Type != model.TransactionTypeDeposit && params.Type != model.TransactionTypeWithdraw {
+		return nil, fmt.Errorf("invalid type value")
+	}
+
+	if c.QueryParam("currency") != "" {
+		currency, ok := model.ParseCurrency(c.QueryParam("currency"))
+		if !ok {
+			return nil, fmt.Errorf("invalid currency value")
+		}
+		params.Currency = currency
+	}
+
+	return params, nil
+}
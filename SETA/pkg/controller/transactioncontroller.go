@@ -1,26 +1,37 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
+	"seta/pkg/logger"
 	"seta/pkg/model"
 	"seta/pkg/service"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
 )
 
 type TransactionController struct {
 	TransactionService service.ITransactionService
+	IdempotencyService service.IIdempotencyService
+	AdminToken         string // bearer token of PUT /transaction and the refunds, which are disabled when it is empty
 }
 
-func TransactionControllerProvider(transactionService service.ITransactionService) model.IController {
-	return &TransactionController{TransactionService: transactionService}
+func TransactionControllerProvider(transactionService service.ITransactionService, idempotencyService service.IIdempotencyService, adminToken string) model.IController {
+	return &TransactionController{TransactionService: transactionService, IdempotencyService: idempotencyService, AdminToken: adminToken}
 }
 
 func (tc *TransactionController) SetupRoutes(r *echo.Group) {
 	r.POST("/deposit", tc.CreateDeposit)
 	r.POST("/withdraw", tc.CreateWithdraw)
 	r.PUT("/transaction", tc.UpdateTransaction)
+	r.GET("/transactions", tc.ListTransactions)
 	r.GET("/transaction/:transaction_id", tc.GetTransaction)
+	r.GET("/transaction/:transaction_id/events", tc.GetTransactionEvents)
+	r.GET("/transaction/:transaction_id/attempts", tc.GetTransactionAttempts)
+	r.POST("/transactions/:transaction_id/refund", tc.RefundTransaction)
 }
 
 //------------------Controller Methods------------------//
@@ -29,66 +40,107 @@ func (tc *TransactionController) SetupRoutes(r *echo.Group) {
 // Create Deposits POST
 // @Summary API To create a deposit transaction
 // @Schemes
-// @Description Api will return status 200 if the transaction is successful, 400 if the request is invalid and 500 if there is an internal server error
+// @Description The currency defaults to USD when omitted, the amount cannot have more decimals than the currency allows (none for JPY)
+// @Description With a quote_id the gateway is sent the amount converted at the rate of the quote, the amount and currency default to those of the quote
+// @Description With an Idempotency-Key the deposit is created at most once per key, a retry gets the response of the first request with the Idempotent-Replayed header
+// @Description Api will return status 200 if the transaction is successful, 202 if the risk rules sent it to pending_review or its outcome at the gateway is unknown, 400 if the request is invalid, the currency is not supported or the quote is unknown or does not match, 409 if the quote expired or was already used or the request of the idempotency key is still in progress, 422 with the code limit_exceeded if the deposit breaches a limit of the account, risk_denied if the risk rules deny it or idempotency_key_reused if the idempotency key was used for another request and 500 if there is an internal server error
 // @Tags Transaction
 // @Accept json
 // @Produce json
 // @Success 200 {object} model.TransactionResponse
+// @Success 202 {object} model.TransactionResponse
 // @Failure 400 {object} model.DefaultError{error=string}
+// @Failure 409 {object} model.DefaultError{error=string}
+// @Failure 422 {object} model.DefaultError{error=string,code=string}
 // @Failure 500 {object} model.DefaultError{error=string}
 // @Param TransactionRequest body DepositRequest true "Transaction Request"
+// @Param Idempotency-Key header string false "Makes the request safe to retry, up to 255 characters"
 // @Router /api/v1/deposit [post]
 func (tc *TransactionController) CreateDeposit(c echo.Context) error {
-	params, err := tc.ValidateTransactionRequest(c)
-	if err != nil {
-		return c.JSON(400, model.DefaultError{Error: err.Error()})
-	}
-
-	transactionResponse, err := tc.TransactionService.CreateTransaction(c.Request().Context(), params.AccountID, params.Amount, model.TransactionTypeDeposit)
-	if err != nil {
-		return c.JSON(500, model.DefaultError{Error: err.Error()})
-	}
+	return tc.idempotent(c, func(params *DepositRequest) (int, interface{}, error) {
+		transactionResponse, err := tc.TransactionService.CreateTransaction(c.Request().Context(), params.AccountID, params.Amount, params.Currency, params.QuoteID, model.TransactionTypeDeposit)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrUnsupportedCurrency), errors.Is(err, service.ErrInvalidAmountPrecision),
+				errors.Is(err, service.ErrQuoteNotFound), errors.Is(err, service.ErrQuoteMismatch):
+				return 400, model.DefaultError{Error: err.Error()}, err
+			case errors.Is(err, service.ErrQuoteUnavailable):
+				return 409, model.DefaultError{Error: err.Error()}, err
+			case errors.Is(err, service.ErrLimitExceeded):
+				return 422, model.DefaultError{Error: err.Error(), Code: model.ErrorCodeLimitExceeded}, err
+			case errors.Is(err, service.ErrRiskDenied):
+				return 422, model.DefaultError{Error: err.Error(), Code: model.ErrorCodeRiskDenied}, err
+			}
+			return 500, model.DefaultError{Error: err.Error()}, err
+		}
 
-	return c.JSON(200, transactionResponse)
+		// a transaction in review was accepted but not processed yet, an unknown one is left for the reconciler
+		if transactionResponse.Data.Status == model.TransactionStatusPendingReview || transactionResponse.Data.Status == model.TransactionStatusUnknown {
+			return 202, transactionResponse, nil
+		}
+		return 200, transactionResponse, nil
+	})
 }
 
 // @BasePath /
 // Create Withdraw POST
 // @Summary API To create a withdraw transaction
 // @Schemes
-// @Description Api will return status 200 if the transaction is successful, 400 if the request is invalid and 500 if there is an internal server error
+// @Description The amount is held on the account before any payment gateway is called, and captured or released once the withdrawal settles
+// @Description With a quote_id the gateway is sent the amount converted at the rate of the quote, the amount held is the one in the currency of the account
+// @Description With an Idempotency-Key the withdrawal is created at most once per key, a retry gets the response of the first request with the Idempotent-Replayed header
+// @Description Api will return status 200 if the transaction is successful, 202 if the risk rules sent it to pending_review or its outcome at the gateway is unknown, 400 if the request is invalid, the currency is not supported or the quote is unknown or does not match, 409 if the quote expired or was already used or the request of the idempotency key is still in progress, 422 if the available balance does not cover the amount (or with the code limit_exceeded if the withdrawal breaches a limit of the account, risk_denied if the risk rules deny it, idempotency_key_reused if the idempotency key was used for another request) and 500 if there is an internal server error
 // @Tags Transaction
 // @Accept json
 // @Produce json
 // @Success 200 {object} model.TransactionResponse
+// @Success 202 {object} model.TransactionResponse
 // @Failure 400 {object} model.DefaultError{error=string}
+// @Failure 409 {object} model.DefaultError{error=string}
+// @Failure 422 {object} model.DefaultError{error=string,code=string}
 // @Failure 500 {object} model.DefaultError{error=string}
 // @Param TransactionRequest body DepositRequest true "Transaction Request"
+// @Param Idempotency-Key header string false "Makes the request safe to retry, up to 255 characters"
 // @Router /api/v1/withdraw [post]
 func (tc *TransactionController) CreateWithdraw(c echo.Context) error {
-	params, err := tc.ValidateTransactionRequest(c)
-	if err != nil {
-		return c.JSON(400, model.DefaultError{Error: err.Error()})
-	}
-
-	transactionResponse, err := tc.TransactionService.CreateTransaction(c.Request().Context(), params.AccountID, params.Amount, model.TransactionTypeWithdraw)
-	if err != nil {
-		return c.JSON(500, model.DefaultError{Error: err.Error()})
-	}
+	return tc.idempotent(c, func(params *DepositRequest) (int, interface{}, error) {
+		transactionResponse, err := tc.TransactionService.CreateTransaction(c.Request().Context(), params.AccountID, params.Amount, params.Currency, params.QuoteID, model.TransactionTypeWithdraw)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrUnsupportedCurrency), errors.Is(err, service.ErrInvalidAmountPrecision),
+				errors.Is(err, service.ErrQuoteNotFound), errors.Is(err, service.ErrQuoteMismatch):
+				return 400, model.DefaultError{Error: err.Error()}, err
+			case errors.Is(err, service.ErrQuoteUnavailable):
+				return 409, model.DefaultError{Error: err.Error()}, err
+			case errors.Is(err, service.ErrInsufficientFunds):
+				return 422, model.DefaultError{Error: err.Error()}, err
+			case errors.Is(err, service.ErrLimitExceeded):
+				return 422, model.DefaultError{Error: err.Error(), Code: model.ErrorCodeLimitExceeded}, err
+			case errors.Is(err, service.ErrRiskDenied):
+				return 422, model.DefaultError{Error: err.Error(), Code: model.ErrorCodeRiskDenied}, err
+			}
+			return 500, model.DefaultError{Error: err.Error()}, err
+		}
 
-	return c.JSON(200, transactionResponse)
+		// a transaction in review was accepted but not processed yet, an unknown one is left for the reconciler
+		if transactionResponse.Data.Status == model.TransactionStatusPendingReview || transactionResponse.Data.Status == model.TransactionStatusUnknown {
+			return 202, transactionResponse, nil
+		}
+		return 200, transactionResponse, nil
+	})
 }
 
 // @BasePath /
 // Get Transaction GET
 // @Summary API To get a transaction
 // @Schemes
-// @Description Api will return status 200 if the transaction is found, 404 if the transaction is not found and 500 if there is an internal server error
+// @Description Api will return status 200 if the transaction is found, 404 if the transaction is not found, 409 if several accounts have a transaction with the ID and 500 if there is an internal server error
 // @Tags Transaction
 // @Accept json
 // @Produce json
 // @Success 200 {object} model.TransactionResponse
 // @Failure 404 {object} model.DefaultError{error=string}
+// @Failure 409 {object} model.DefaultError{error=string}
 // @Failure 500 {object} model.DefaultError{error=string}
 // @Param transaction_id path string true "Transaction ID"
 // @Router /api/v1/transaction/{transaction_id} [get]
@@ -96,6 +148,12 @@ func (tc *TransactionController) GetTransaction(c echo.Context) error {
 	transactionID := c.Param("transaction_id")
 	transactionResponse, err := tc.TransactionService.GetTransaction(c.Request().Context(), transactionID)
 	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTransactionNotFound):
+			return c.JSON(404, model.DefaultError{Error: err.Error()})
+		case errors.Is(err, service.ErrAmbiguousTransaction):
+			return c.JSON(409, model.DefaultError{Error: err.Error()})
+		}
 		return c.JSON(500, model.DefaultError{Error: err.Error()})
 	}
 
@@ -106,29 +164,149 @@ func (tc *TransactionController) GetTransaction(c echo.Context) error {
 	return c.JSON(200, transactionResponse)
 }
 
+// @BasePath /
+// List Transactions GET
+// @Summary API To list transactions
+// @Schemes
+// @Description Lists the transactions matching every filter given, newest first unless order is asc. A page has up to limit transactions (50 by default, at most 200), the next one is read by passing its next_cursor as the cursor with the same filters and order.
+// @Description Api will return status 200 with the page, 400 if a filter or the cursor is invalid and 500 if there is an internal server error
+// @Tags Transaction
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.DefaultResponse{data=model.TransactionPage}
+// @Failure 400 {object} model.DefaultError{error=string}
+// @Failure 500 {object} model.DefaultError{error=string}
+// @Param account_id query string false "Account ID"
+// @Param status query string false "Transaction status"
+// @Param type query string false "Transaction type (deposit, withdraw, refund or reversal)"
+// @Param gateway query string false "Name of the gateway that processed the transaction"
+// @Param min_amount query string false "Minimum amount, inclusive"
+// @Param max_amount query string false "Maximum amount, inclusive"
+// @Param created_from query string false "RFC 3339 time the transactions were created at or after"
+// @Param created_to query string false "RFC 3339 time the transactions were created before"
+// @Param order query string false "asc or desc (default) creation time"
+// @Param limit query int false "Page size"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Router /api/v1/transactions [get]
+func (tc *TransactionController) ListTransactions(c echo.Context) error {
+	filter, err := tc.ValidateListTransactionsRequest(c)
+	if err != nil {
+		return c.JSON(400, model.DefaultError{Error: err.Error()})
+	}
+
+	page, err := tc.TransactionService.ListTransactions(c.Request().Context(), *filter)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) {
+			return c.JSON(400, model.DefaultError{Error: err.Error()})
+		}
+		return c.JSON(500, model.DefaultError{Error: err.Error()})
+	}
+
+	return c.JSON(200, model.DefaultResponse{Data: page})
+}
+
+// @BasePath /
+// Get Transaction Events GET
+// @Summary API To get the history of a transaction
+// @Schemes
+// @Description Returns every event of the transaction, oldest first: its creation, the gateway attempts that led to it, its status changes and the gateway callbacks received for it
+// @Description Api will return status 200 if the transaction is found, 404 if the transaction is not found, 409 if several accounts have a transaction with the ID and 500 if there is an internal server error
+// @Tags Transaction
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.DefaultResponse{data=[]model.TransactionEvent}
+// @Failure 404 {object} model.DefaultError{error=string}
+// @Failure 409 {object} model.DefaultError{error=string}
+// @Failure 500 {object} model.DefaultError{error=string}
+// @Param transaction_id path string true "Transaction ID"
+// @Router /api/v1/transaction/{transaction_id}/events [get]
+func (tc *TransactionController) GetTransactionEvents(c echo.Context) error {
+	events, err := tc.TransactionService.GetTransactionEvents(c.Request().Context(), c.Param("transaction_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTransactionNotFound):
+			return c.JSON(404, model.DefaultError{Error: err.Error()})
+		case errors.Is(err, service.ErrAmbiguousTransaction):
+			return c.JSON(409, model.DefaultError{Error: err.Error()})
+		}
+		return c.JSON(500, model.DefaultError{Error: err.Error()})
+	}
+
+	return c.JSON(200, model.DefaultResponse{Data: events})
+}
+
+// @BasePath /
+// Get Transaction Attempts GET
+// @Summary API To get the payment gateway attempts of a transaction
+// @Schemes
+// @Description Returns every call made to a payment gateway for the transaction, in the order they were made, with its timing, status code, error category and the fingerprints of the request and response
+// @Description Api will return status 200 if the transaction is found, 404 if the transaction is not found, 409 if several accounts have a transaction with the ID and 500 if there is an internal server error
+// @Tags Transaction
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.DefaultResponse{data=[]model.TransactionAttempt}
+// @Failure 404 {object} model.DefaultError{error=string}
+// @Failure 409 {object} model.DefaultError{error=string}
+// @Failure 500 {object} model.DefaultError{error=string}
+// @Param transaction_id path string true "Transaction ID"
+// @Router /api/v1/transaction/{transaction_id}/attempts [get]
+func (tc *TransactionController) GetTransactionAttempts(c echo.Context) error {
+	attempts, err := tc.TransactionService.GetTransactionAttempts(c.Request().Context(), c.Param("transaction_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTransactionNotFound):
+			return c.JSON(404, model.DefaultError{Error: err.Error()})
+		case errors.Is(err, service.ErrAmbiguousTransaction):
+			return c.JSON(409, model.DefaultError{Error: err.Error()})
+		}
+		return c.JSON(500, model.DefaultError{Error: err.Error()})
+	}
+
+	return c.JSON(200, model.DefaultResponse{Data: attempts})
+}
+
 // @BasePath /
 // Update Transaction PUT
 // @Summary API To update a transaction
 // @Schemes
-// @Description Api will return status 200 if the transaction is updated, 400 if the request is invalid and 500 if there is an internal server error
+// @Description A pending transaction can move to success or failed, refunded and reversed transactions are only updated by refunds. A pending_review transaction is approved with initiated, which sends it to the payment gateways, or rejected with failed. Setting the status the transaction already has is a no-op. Requires the TRANSACTION_ADMIN_TOKEN as a bearer token.
+// @Description Api will return status 200 if the transaction is updated, 400 if the request is invalid, 401 if the token is missing or wrong, 403 if the admin API is disabled, 404 if the transaction is not found, 409 if the transaction cannot move to the status, was updated concurrently or no payment gateway accepts an approved transaction and 500 if there is an internal server error
 // @Tags Transaction
 // @Accept json
 // @Produce json
 // @Success 200 {object} model.DefaultResponse{data=string}
+// @Failure 400 {object} model.DefaultError{error=string}
+// @Failure 401 {object} model.DefaultError{error=string}
+// @Failure 403 {object} model.DefaultError{error=string}
 // @Failure 404 {object} model.DefaultError{error=string}
+// @Failure 409 {object} model.DefaultError{error=string}
 // @Failure 500 {object} model.DefaultError{error=string}
+// @Param Authorization header string true "Bearer <TRANSACTION_ADMIN_TOKEN>"
 // @Param TransactionRequest body UpdateTransactionRequest true "Transaction Request"
 // @Router /api/v1/transaction [put]
 func (tc *TransactionController) UpdateTransaction(c echo.Context) error {
+	// settling a transaction moves money on the ledger, only support can do it by hand
+	if ok, err := authorizeAdmin(c, tc.AdminToken, "transaction"); !ok {
+		return err
+	}
+
 	params, err := tc.ValidateTransactionUpdateRequest(c)
 	if err != nil {
 		return c.JSON(400, model.DefaultError{Error: err.Error()})
 	}
 
-	err = tc.TransactionService.UpdateTransaction(c.Request().Context(), params.AccountID, params.TransactionID, params.Status)
+	event := model.TransactionEvent{
+		Type:             model.TransactionEventStatusChanged,
+		Source:           model.TransactionEventSourceAPI,
+		PayloadReference: logger.RequestID(c.Request().Context()),
+	}
+	err = tc.TransactionService.UpdateTransaction(c.Request().Context(), params.AccountID, params.TransactionID, params.Status, event)
 	if err != nil {
-		if err.Error() == "no rows in result set" {
-			return c.JSON(404, model.DefaultError{Error: "transaction not found"})
+		switch {
+		case errors.Is(err, service.ErrTransactionNotFound):
+			return c.JSON(404, model.DefaultError{Error: err.Error()})
+		case errors.Is(err, service.ErrInvalidStatusTransition), errors.Is(err, service.ErrTransactionStatusChanged), errors.Is(err, service.ErrUnsupportedCurrency):
+			return c.JSON(409, model.DefaultError{Error: err.Error()})
 		}
 		return c.JSON(500, model.DefaultError{Error: err.Error()})
 	}
@@ -136,6 +314,61 @@ func (tc *TransactionController) UpdateTransaction(c echo.Context) error {
 	return c.JSON(200, model.DefaultResponse{Data: "success"})
 }
 
+// @BasePath /
+// Refund Transaction POST
+// @Summary API To refund a transaction
+// @Schemes
+// @Description Refunds all or part of a transaction on the payment gateway that processed it, the refund is recorded as a new transaction linked to the original one. A pending transaction is reversed instead, in full only. Omit the amount to refund everything that is left. Requires the TRANSACTION_ADMIN_TOKEN as a bearer token.
+// @Description Api will return status 200 if the refund is successful, 202 if its outcome at the gateway is unknown, 400 if the request is invalid or the amount exceeds what is left to refund, 401 if the token is missing or wrong, 403 if the admin API is disabled, 404 if the transaction is not found, 409 if the transaction cannot be refunded or several accounts have a transaction with the ID, 422 if the balance does not cover the refund of a deposit and 500 if there is an internal server error
+// @Tags Transaction
+// @Accept json
+// @Produce json
+// @Success 200 {object} model.TransactionResponse
+// @Success 202 {object} model.TransactionResponse
+// @Failure 400 {object} model.DefaultError{error=string}
+// @Failure 401 {object} model.DefaultError{error=string}
+// @Failure 403 {object} model.DefaultError{error=string}
+// @Failure 404 {object} model.DefaultError{error=string}
+// @Failure 409 {object} model.DefaultError{error=string}
+// @Failure 422 {object} model.DefaultError{error=string}
+// @Failure 500 {object} model.DefaultError{error=string}
+// @Param Authorization header string true "Bearer <TRANSACTION_ADMIN_TOKEN>"
+// @Param transaction_id path string true "Transaction ID"
+// @Param RefundRequest body RefundRequest false "Refund Request"
+// @Router /api/v1/transactions/{transaction_id}/refund [post]
+func (tc *TransactionController) RefundTransaction(c echo.Context) error {
+	// a refund sends the money back, only support can make it
+	if ok, err := authorizeAdmin(c, tc.AdminToken, "transaction"); !ok {
+		return err
+	}
+
+	params, err := tc.ValidateRefundRequest(c)
+	if err != nil {
+		return c.JSON(400, model.DefaultError{Error: err.Error()})
+	}
+
+	transactionResponse, err := tc.TransactionService.RefundTransaction(c.Request().Context(), c.Param("transaction_id"), params.Amount)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTransactionNotFound):
+			return c.JSON(404, model.DefaultError{Error: err.Error()})
+		case errors.Is(err, service.ErrRefundExceedsAmount), errors.Is(err, service.ErrInvalidAmountPrecision):
+			return c.JSON(400, model.DefaultError{Error: err.Error()})
+		case errors.Is(err, service.ErrTransactionNotRefundable), errors.Is(err, service.ErrAmbiguousTransaction):
+			return c.JSON(409, model.DefaultError{Error: err.Error()})
+		case errors.Is(err, service.ErrInsufficientFunds):
+			return c.JSON(422, model.DefaultError{Error: err.Error()})
+		}
+		return c.JSON(500, model.DefaultError{Error: err.Error()})
+	}
+
+	// the reconciler looks an unknown refund up on the gateway
+	if transactionResponse.Data.Status == model.TransactionStatusUnknown {
+		return c.JSON(202, transactionResponse)
+	}
+	return c.JSON(200, transactionResponse)
+}
+
 // ------------------Validation Methods------------------//
 func (tc *TransactionController) ValidateTransactionRequest(c echo.Context) (*DepositRequest, error) {
 	// use echo.Bind to bind the request body to the DepositRequest struct
@@ -149,7 +382,8 @@ func (tc *TransactionController) ValidateTransactionRequest(c echo.Context) (*De
 		return nil, fmt.Errorf("account_id is required")
 	}
 
-	if params.Amount.IsZero() {
+	// the amount of a quote is used when it is omitted
+	if params.Amount.IsZero() && params.QuoteID == "" {
 		return nil, fmt.Errorf("amount is required")
 	}
 
@@ -180,9 +414,82 @@ func (tc *TransactionController) ValidateTransactionUpdateRequest(c echo.Context
 		return nil, fmt.Errorf("status is required")
 	}
 
-	if params.Status != model.TransactionStatusSuccess && params.Status != model.TransactionStatusFailed && params.Status != model.TransactionStatusPending {
+	// initiated approves a transaction in review
+	if params.Status != model.TransactionStatusSuccess && params.Status != model.TransactionStatusFailed && params.Status != model.TransactionStatusPending && params.Status != model.TransactionStatusInitiated {
 		return nil, fmt.Errorf("invalid status value")
 	}
 
 	return params, nil
 }
+
+func (tc *TransactionController) ValidateListTransactionsRequest(c echo.Context) (*model.TransactionFilter, error) {
+	filter := &model.TransactionFilter{
+		AccountID: c.QueryParam("account_id"),
+		Status:    model.TransactionStatus(c.QueryParam("status")),
+		Type:      model.TransactionType(c.QueryParam("type")),
+		Gateway:   c.QueryParam("gateway"),
+		Order:     model.SortOrder(c.QueryParam("order")),
+		Cursor:    c.QueryParam("cursor"),
+	}
+
+	// validate the query parameters
+	if filter.Status != "" && !filter.Status.IsValid() {
+		return nil, fmt.Errorf("invalid status value")
+	}
+
+	if filter.Type != "" && !filter.Type.IsValid() {
+		return nil, fmt.Errorf("invalid type value")
+	}
+
+	for name, amount := range map[string]**decimal.Decimal{"min_amount": &filter.MinAmount, "max_amount": &filter.MaxAmount} {
+		if c.QueryParam(name) == "" {
+			continue
+		}
+		value, err := decimal.NewFromString(c.QueryParam(name))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		*amount = &value
+	}
+
+	for name, createdAt := range map[string]**time.Time{"created_from": &filter.CreatedFrom, "created_to": &filter.CreatedTo} {
+		if c.QueryParam(name) == "" {
+			continue
+		}
+		value, err := time.Parse(time.RFC3339, c.QueryParam(name))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s, expected an RFC 3339 time: %v", name, err)
+		}
+		// created_at is stored in UTC, without a time zone
+		value = value.UTC()
+		*createdAt = &value
+	}
+
+	if filter.Order != "" && filter.Order != model.SortOrderAsc && filter.Order != model.SortOrderDesc {
+		return nil, fmt.Errorf("invalid order value, expected asc or desc")
+	}
+
+	if c.QueryParam("limit") != "" {
+		limit, err := strconv.Atoi(c.QueryParam("limit"))
+		if err != nil || limit < 1 || limit > service.MaxListLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", service.MaxListLimit)
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+func (tc *TransactionController) ValidateRefundRequest(c echo.Context) (*RefundRequest, error) {
+	// the body is optional, without one the whole amount left is refunded
+	params := new(RefundRequest)
+	if err := c.Bind(params); err != nil {
+		return nil, fmt.Errorf("invalid request body: %v", err)
+	}
+
+	if params.Amount.IsNegative() {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	return params, nil
+}
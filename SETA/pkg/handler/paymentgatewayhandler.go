@@ -2,50 +2,257 @@ package handler
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"seta/pkg/clients/paymentgateway"
 	"seta/pkg/logger"
 	"seta/pkg/model"
+	"strings"
+	"time"
 
 	"github.com/shopspring/decimal"
 )
 
-func CreateTransactionFromPaymentGateways(ctx context.Context, paymentGateways []paymentgateway.IPaymentGateway, accountID string, amount decimal.Decimal, transactionType model.TransactionType) (*model.TransactionResponse, error) {
+// ErrAllPaymentGatewaysFailed is returned when every payment gateway failed with a retryable error
+var ErrAllPaymentGatewaysFailed = errors.New("all payment gateways failed")
+
+// ErrNotProcessedByPaymentGateways is returned when none of the payment gateways has a transaction with the client reference
+var ErrNotProcessedByPaymentGateways = errors.New("no payment gateway processed the transaction")
+
+// CreateTransactionFromPaymentGateways tries the payment gateways in order until one processes the transaction, with
+// transactionID as the client reference. A gateway that failed ambiguously is asked for it by that reference before
+// the next one is tried, the transaction is returned unknown when it cannot tell rather than risk executing it twice
+func CreateTransactionFromPaymentGateways(ctx context.Context, paymentGateways []paymentgateway.IPaymentGateway, transactionID string, accountID string, amount decimal.Decimal, currency model.Currency, transactionType model.TransactionType) (*model.TransactionResponse, []model.GatewayAttempt, error) {
+	if transactionType != model.TransactionTypeDeposit && transactionType != model.TransactionTypeWithdraw {
+		return nil, nil, errors.New("invalid transaction type")
+	}
+
+	var attempts []model.GatewayAttempt
+	ctx = paymentgateway.WithClientReference(paymentgateway.WithIdempotencyKey(ctx, transactionID), transactionID)
+
 	// loop through the payment gateways to create a transaction
-	for _, paymentGateway := range paymentGateways {
-		switch transactionType {
-		case model.TransactionTypeDeposit:
-			transactionResponse, statusCode, err := paymentGateway.Deposit(accountID, amount)
-			// if the error is a server error, retry with the next payment gateway by not returning the error or breaking the loop
-			if statusCode != nil && (*statusCode > 400 || *statusCode == 0) {
-				logger.WithRequestID(ctx).Errorf("payment gateway failed with status code %d", *statusCode)
-				transactionResponse = nil
-				// if the error is not a server error, then there is no need to retry with the next payment gateway as there is a bad request
-			} else if err != nil {
-				logger.WithRequestID(ctx).Errorf("payment gateway failed with status code %d . error: %d", *statusCode, err)
-				return nil, err
-			} else { // success
-				logger.WithRequestID(ctx).Infof("payment gateway succeeded with status code %d", *statusCode)
-				return transactionResponse, nil
+	for i, paymentGateway := range paymentGateways {
+		// the caller gave up (client disconnected or the transaction deadline passed), there is no point in trying the next gateway
+		if err := ctx.Err(); err != nil {
+			logger.WithRequestID(ctx).Errorf("stopping payment gateway failover: %v", err)
+			return nil, attempts, err
+		}
+
+		gatewayCtx, cancel := gatewayContext(ctx, len(paymentGateways)-i)
+		startedAt := time.Now()
+		transactionResponse, err := callPaymentGateway(gatewayCtx, paymentGateway, accountID, amount, currency, transactionType)
+		cancel()
+		attempts = append(attempts, newAttempt(paymentGateway.Name(), startedAt, transactionResponse, err,
+			paymentGateway.Name(), string(transactionType), accountID, amount.String(), string(currency)))
+
+		if err == nil {
+			logger.WithRequestID(ctx).Infof("payment gateway %s succeeded", paymentGateway.Name())
+			fromGateway(transactionResponse, paymentGateway.Name(), transactionID, currency)
+			return transactionResponse, attempts, nil
+		}
+
+		// if the gateway itself failed (network, timeout or server error), retry with the next payment gateway
+		var gatewayError *paymentgateway.GatewayError
+		if errors.Is(err, paymentgateway.ErrCircuitOpen) {
+			logger.WithRequestID(ctx).Warnf("payment gateway %s skipped, its circuit breaker is open", paymentGateway.Name())
+			continue
+		} else if errors.As(err, &gatewayError) && gatewayError.Retryable() {
+			if gatewayError.Ambiguous() {
+				// the gateway may have processed the transaction all the same, it is only safe to move on if it did not
+				gatewayCtx, cancel := gatewayContext(ctx, len(paymentGateways)-i)
+				transactionResponse, attempt, err := lookupTransaction(gatewayCtx, paymentGateway, transactionID)
+				cancel()
+				attempts = append(attempts, attempt)
+
+				switch {
+				case err == nil:
+					logger.WithRequestID(ctx).Infof("payment gateway %s failed but processed the transaction", paymentGateway.Name())
+					fromGateway(transactionResponse, paymentGateway.Name(), transactionID, currency)
+					return transactionResponse, attempts, nil
+				case !errors.Is(err, paymentgateway.ErrReferenceNotFound):
+					logger.WithRequestID(ctx).Errorf("payment gateway %s failed and could not tell whether it processed the transaction, leaving it unknown. error: %v", paymentGateway.Name(), err)
+					return unknownTransaction(paymentGateway.Name(), transactionID, accountID, amount, currency, transactionType), attempts, nil
+				}
 			}
-		case model.TransactionTypeWithdraw:
-			transactionResponse, statusCode, err := paymentGateway.Withdraw(accountID, amount)
-			// if the error is a server error, retry with the next payment gateway
-			if statusCode != nil && (*statusCode > 400 || *statusCode == 0) {
-				logger.WithRequestID(ctx).Errorf("payment gateway failed with status code %d", *statusCode)
-				transactionResponse = nil
-				// if the error is not a server error, then there is no need to retry with the next payment gateway as there is a bad request
-			} else if err != nil {
-				logger.WithRequestID(ctx).Errorf("payment gateway failed with status code %d . error: %d", *statusCode, err)
-				return nil, err
-			} else { // success
-				logger.WithRequestID(ctx).Infof("payment gateway succeeded with status code %d", *statusCode)
-				return transactionResponse, nil
+			logger.WithRequestID(ctx).Errorf("payment gateway %s failed, trying the next one. error: %v", paymentGateway.Name(), err)
+			continue
+		}
+
+		// the request was declined or rejected, there is no need to retry with the next payment gateway
+		logger.WithRequestID(ctx).Errorf("payment gateway %s failed. error: %v", paymentGateway.Name(), err)
+		return nil, attempts, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, attempts, err
+	}
+
+	return nil, attempts, ErrAllPaymentGatewaysFailed
+}
+
+// FindTransactionInPaymentGateways asks the payment gateways in turn for a transaction by its client reference. When
+// none has it ErrNotProcessedByPaymentGateways is returned, or the transaction unknown if a gateway could not tell
+func FindTransactionInPaymentGateways(ctx context.Context, paymentGateways []paymentgateway.IPaymentGateway, transactionID string, accountID string, amount decimal.Decimal, currency model.Currency, transactionType model.TransactionType) (*model.TransactionResponse, []model.GatewayAttempt, error) {
+	var attempts []model.GatewayAttempt
+	var undecided paymentgateway.IPaymentGateway
+
+	for _, paymentGateway := range paymentGateways {
+		transactionResponse, attempt, err := lookupTransaction(ctx, paymentGateway, transactionID)
+		attempts = append(attempts, attempt)
+
+		if err == nil {
+			logger.WithRequestID(ctx).Infof("payment gateway %s processed transaction %s", paymentGateway.Name(), transactionID)
+			fromGateway(transactionResponse, paymentGateway.Name(), transactionID, currency)
+			return transactionResponse, attempts, nil
+		}
+		if !errors.Is(err, paymentgateway.ErrReferenceNotFound) {
+			logger.WithRequestID(ctx).Errorf("payment gateway %s could not tell whether it processed transaction %s. error: %v", paymentGateway.Name(), transactionID, err)
+			if undecided == nil {
+				undecided = paymentGateway
 			}
-		default:
-			return nil, errors.New("invalid transaction type")
 		}
 	}
 
-	return nil, errors.New("all payment gateways failed")
+	if undecided != nil {
+		return unknownTransaction(undecided.Name(), transactionID, accountID, amount, currency, transactionType), attempts, nil
+	}
+	return nil, attempts, ErrNotProcessedByPaymentGateways
+}
+
+// RefundTransactionFromPaymentGateway refunds or reverses a transaction on the gateway that processed it, without
+// failover, with transactionID as the idempotency key and client reference. An ambiguous failure is looked up like
+// for a transaction
+func RefundTransactionFromPaymentGateway(ctx context.Context, paymentGateway paymentgateway.IPaymentGateway, transactionID string, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency, transactionType model.TransactionType) (*model.TransactionResponse, []model.GatewayAttempt, error) {
+	var transactionResponse *model.TransactionResponse
+	var err error
+
+	ctx = paymentgateway.WithClientReference(paymentgateway.WithIdempotencyKey(ctx, transactionID), transactionID)
+	startedAt := time.Now()
+	switch transactionType {
+	case model.TransactionTypeRefund:
+		transactionResponse, err = paymentGateway.Refund(ctx, gatewayTransactionID, amount, currency)
+	case model.TransactionTypeReversal:
+		transactionResponse, err = paymentGateway.Reverse(ctx, gatewayTransactionID, amount, currency)
+	default:
+		return nil, nil, errors.New("invalid transaction type")
+	}
+	attempts := []model.GatewayAttempt{newAttempt(paymentGateway.Name(), startedAt, transactionResponse, err,
+		paymentGateway.Name(), string(transactionType), gatewayTransactionID, amount.String(), string(currency))}
+
+	var gatewayError *paymentgateway.GatewayError
+	if errors.As(err, &gatewayError) && gatewayError.Ambiguous() {
+		var attempt model.GatewayAttempt
+		var lookupErr error
+		transactionResponse, attempt, lookupErr = lookupTransaction(ctx, paymentGateway, transactionID)
+		attempts = append(attempts, attempt)
+
+		switch {
+		case lookupErr == nil:
+			err = nil
+		case !errors.Is(lookupErr, paymentgateway.ErrReferenceNotFound):
+			logger.WithRequestID(ctx).Errorf("payment gateway %s failed to %s transaction %s and could not tell whether it did, leaving it unknown. error: %v", paymentGateway.Name(), transactionType, gatewayTransactionID, lookupErr)
+			return unknownTransaction(paymentGateway.Name(), transactionID, "", amount, currency, transactionType), attempts, nil
+		}
+	}
+
+	if err != nil {
+		logger.WithRequestID(ctx).Errorf("payment gateway %s failed to %s transaction %s. error: %v", paymentGateway.Name(), transactionType, gatewayTransactionID, err)
+		return nil, attempts, err
+	}
+
+	logger.WithRequestID(ctx).Infof("payment gateway %s succeeded", paymentGateway.Name())
+	fromGateway(transactionResponse, paymentGateway.Name(), transactionID, currency)
+	return transactionResponse, attempts, nil
+}
+
+// lookupTransaction asks the gateway for the transaction with the client reference, the error wraps
+// paymentgateway.ErrReferenceNotFound when the gateway never processed it
+func lookupTransaction(ctx context.Context, paymentGateway paymentgateway.IPaymentGateway, transactionID string) (*model.TransactionResponse, model.GatewayAttempt, error) {
+	startedAt := time.Now()
+	transactionResponse, err := paymentGateway.GetTransactionStatusByReference(ctx, transactionID)
+	return transactionResponse, newAttempt(paymentGateway.Name(), startedAt, transactionResponse, err, paymentGateway.Name(), "lookup", transactionID), err
+}
+
+func callPaymentGateway(ctx context.Context, paymentGateway paymentgateway.IPaymentGateway, accountID string, amount decimal.Decimal, currency model.Currency, transactionType model.TransactionType) (*model.TransactionResponse, error) {
+	if transactionType == model.TransactionTypeWithdraw {
+		return paymentGateway.Withdraw(ctx, accountID, amount, currency)
+	}
+	return paymentGateway.Deposit(ctx, accountID, amount, currency)
+}
+
+// newAttempt records a call to a gateway that started at startedAt and just returned. The request is fingerprinted from
+// what was sent to the gateway and the response from its raw body, before fromGateway redacts it
+func newAttempt(gatewayName string, startedAt time.Time, transactionResponse *model.TransactionResponse, err error, request ...string) model.GatewayAttempt {
+	attempt := model.GatewayAttempt{
+		Gateway:            gatewayName,
+		Err:                err,
+		StartedAt:          startedAt,
+		EndedAt:            time.Now(),
+		RequestFingerprint: fingerprint(strings.Join(request, "\n")),
+	}
+
+	var gatewayError *paymentgateway.GatewayError
+	if errors.As(err, &gatewayError) {
+		attempt.ErrorCategory = string(gatewayError.Category)
+		attempt.StatusCode = gatewayError.StatusCode
+	} else if err == nil && transactionResponse != nil {
+		attempt.StatusCode = transactionResponse.Data.GatewayStatusCode
+		if len(transactionResponse.Data.GatewayResponse) > 0 {
+			attempt.ResponseFingerprint = fingerprint(string(transactionResponse.Data.GatewayResponse))
+		}
+	}
+	return attempt
+}
+
+// fingerprint is the hex SHA-256 of the value, it identifies a payload without storing it
+func fingerprint(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// fromGateway makes the response of a gateway the transaction SETA records: the ID the gateway gave it is kept as its
+// gateway reference, as two gateways can give the same one, and its raw response is redacted
+func fromGateway(transactionResponse *model.TransactionResponse, gatewayName string, transactionID string, currency model.Currency) {
+	transactionResponse.Data.Gateway = gatewayName
+	transactionResponse.Data.GatewayReference = transactionResponse.Data.TransactionID
+	transactionResponse.Data.TransactionID = transactionID
+	transactionResponse.Data.GatewayResponse = paymentgateway.RedactResponse(transactionResponse.Data.GatewayResponse)
+	defaultCurrency(transactionResponse, currency)
+}
+
+// unknownTransaction is the transaction SETA records when the gateway may or may not have processed it, it has no
+// gateway reference until the reconciler finds it by its client reference
+func unknownTransaction(gatewayName string, transactionID string, accountID string, amount decimal.Decimal, currency model.Currency, transactionType model.TransactionType) *model.TransactionResponse {
+	return &model.TransactionResponse{
+		Data: model.TransactionData{
+			TransactionID: transactionID,
+			AccountID:     accountID,
+			Amount:        amount,
+			Currency:      currency,
+			Type:          transactionType,
+			Status:        model.TransactionStatusUnknown,
+			Gateway:       gatewayName,
+		},
+	}
+}
+
+// defaultCurrency sets the currency of the request on a response that does not give one, gateways that only support
+// a single currency usually leave it out
+func defaultCurrency(transactionResponse *model.TransactionResponse, currency model.Currency) {
+	if transactionResponse.Data.Currency == "" {
+		transactionResponse.Data.Currency = currency
+	}
+}
+
+// gatewayContext gives the next gateway an equal share of the time left on ctx, so that a slow gateway cannot use up
+// the whole budget before the remaining gateways in the failover chain get a chance
+func gatewayContext(ctx context.Context, remainingGateways int) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok || remainingGateways <= 1 {
+		return context.WithCancel(ctx)
+	}
+
+	share := time.Until(deadline) / time.Duration(remainingGateways)
+	return context.WithTimeout(ctx, share)
 }
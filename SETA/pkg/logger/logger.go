@@ -128,6 +128,12 @@ func WithRequestID(ctx interface{}) *logrus.Entry {
 	return Logger.WithField("request_id", requestID)
 }
 
+// RequestID returns the request ID carried by the context, empty outside of a request
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(RequestIDKey).(string)
+	return requestID
+}
+
 func SetRequestID(ctx context.Context, requestID string) context.Context {
 	return context.WithValue(ctx, RequestIDKey, requestID)
 }
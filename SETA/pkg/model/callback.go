@@ -0,0 +1,8 @@
+package model
+
+// CallbackSignature is what a gateway sends along a callback to prove it comes from the gateway and is not replayed
+type CallbackSignature struct {
+	Timestamp string // unix seconds
+	Nonce     string // unique per callback
+	Signature string // hex HMAC-SHA256 of "<timestamp>.<nonce>.<body>"
+}
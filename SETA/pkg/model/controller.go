@@ -8,8 +8,18 @@ type DefaultResponse struct {
 
 type DefaultError struct {
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"` // set for the errors a client may need to tell apart from others with the same status
 }
 
+// ErrorCodeLimitExceeded is the code of the transactions rejected because they breach a limit of their account
+const ErrorCodeLimitExceeded = "limit_exceeded"
+
+// ErrorCodeRiskDenied is the code of the transactions the risk rules denied
+const ErrorCodeRiskDenied = "risk_denied"
+
+// ErrorCodeIdempotencyKeyReused is the code of the requests whose Idempotency-Key was already used for another request
+const ErrorCodeIdempotencyKeyReused = "idempotency_key_reused"
+
 type IController interface {
 	SetupRoutes(r *echo.Group)
 }
@@ -3,6 +3,8 @@ package model
 import "github.com/shopspring/decimal"
 
 type DepositRequest struct {
-	AccountID string          `json:"account_id" xml:"AccountID"`
-	Amount    decimal.Decimal `json:"amount" xml:"Amount"`
+	AccountID       string          `json:"account_id" xml:"AccountID"`
+	Amount          decimal.Decimal `json:"amount" xml:"Amount"`
+	Currency        Currency        `json:"currency" xml:"Currency"`
+	ClientReference string          `json:"client_reference,omitempty" xml:"ClientReference,omitempty"` // the ID SETA gives the transaction, the gateway can be asked for it
 }
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+//---------------- API Data models ---------------- //
+
+// FXRate converts an amount in From to To (amount * rate) from ValidFrom until ValidTo, the latest rate whose window
+// includes a time is the one used at that time
+type FXRate struct {
+	From      Currency        `json:"from"`
+	To        Currency        `json:"to"`
+	Rate      decimal.Decimal `json:"rate"`
+	ValidFrom time.Time       `json:"valid_from"`
+	ValidTo   *time.Time      `json:"valid_to,omitempty"` // open-ended when omitted
+}
+
+// FXQuote locks a rate for the conversion of an amount until it expires, a transaction given its ID is converted at
+// that rate. A quote can only be used once
+type FXQuote struct {
+	QuoteID         string          `json:"quote_id"`
+	From            Currency        `json:"from"`
+	To              Currency        `json:"to"`
+	Rate            decimal.Decimal `json:"rate"`
+	Amount          decimal.Decimal `json:"amount"`           // in From
+	ConvertedAmount decimal.Decimal `json:"converted_amount"` // in To, rounded to its minor units
+	ExpiresAt       time.Time       `json:"expires_at"`
+}
+
+// FXConversion is how a transaction was converted: the gateway processed Amount in Currency, while the transaction
+// amount is in the currency of the account
+type FXConversion struct {
+	QuoteID  string          `json:"quote_id"`
+	Rate     decimal.Decimal `json:"rate"`
+	Amount   decimal.Decimal `json:"amount"`
+	Currency Currency        `json:"currency"`
+}
+
+// Convert returns the amount converted at the rate, rounded to the minor units of the target currency
+func Convert(amount decimal.Decimal, rate decimal.Decimal, to Currency) decimal.Decimal {
+	return amount.Mul(rate).Round(to.MinorUnits())
+}
+
+//---------------- Database models ---------------- //
+
+type FXRateDAO struct {
+	FromCurrency string
+	ToCurrency   string
+	Rate         string
+	ValidFrom    time.Time
+	ValidTo      *time.Time
+}
+
+type FXQuoteDAO struct {
+	QuoteID         string
+	FromCurrency    string
+	ToCurrency      string
+	Rate            string
+	Amount          string
+	ConvertedAmount string
+	ExpiresAt       time.Time
+	UsedAt          *time.Time // set once a transaction used the quote
+}
+
+//---------------- Mapping functions ---------------- //
+
+func MapFXRateToFXRateDAO(rate *FXRate) FXRateDAO {
+	return FXRateDAO{
+		FromCurrency: string(rate.From),
+		ToCurrency:   string(rate.To),
+		Rate:         rate.Rate.String(),
+		ValidFrom:    rate.ValidFrom,
+		ValidTo:      rate.ValidTo,
+	}
+}
+
+func MapFXRateDAOToFXRate(rateDAO *FXRateDAO) FXRate {
+	return FXRate{
+		From:      Currency(rateDAO.FromCurrency),
+		To:        Currency(rateDAO.ToCurrency),
+		Rate:      decimal.RequireFromString(rateDAO.Rate),
+		ValidFrom: rateDAO.ValidFrom,
+		ValidTo:   rateDAO.ValidTo,
+	}
+}
+
+func MapFXQuoteToFXQuoteDAO(quote *FXQuote) FXQuoteDAO {
+	return FXQuoteDAO{
+		QuoteID:         quote.QuoteID,
+		FromCurrency:    string(quote.From),
+		ToCurrency:      string(quote.To),
+		Rate:            quote.Rate.String(),
+		Amount:          quote.Amount.String(),
+		ConvertedAmount: quote.ConvertedAmount.String(),
+		ExpiresAt:       quote.ExpiresAt,
+	}
+}
+
+func MapFXQuoteDAOToFXQuote(quoteDAO *FXQuoteDAO) FXQuote {
+	return FXQuote{
+		QuoteID:         quoteDAO.QuoteID,
+		From:            Currency(quoteDAO.FromCurrency),
+		To:              Currency(quoteDAO.ToCurrency),
+		Rate:            decimal.RequireFromString(quoteDAO.Rate),
+		Amount:          decimal.RequireFromString(quoteDAO.Amount),
+		ConvertedAmount: decimal.RequireFromString(quoteDAO.ConvertedAmount),
+		ExpiresAt:       quoteDAO.ExpiresAt,
+	}
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+//---------------- Domain models ---------------- //
+
+// IdempotentResponse is the final response of a request made with an Idempotency-Key, replayed as is when the request
+// is retried with the same key
+type IdempotentResponse struct {
+	StatusCode int
+	Body       []byte // JSON
+}
+
+//---------------- Database models ---------------- //
+
+type IdempotencyKeyDAO struct {
+	Key         string
+	RequestHash string
+	StatusCode  int    // 0 while the request is in flight
+	Response    []byte // nil while the request is in flight
+	ExpiresAt   time.Time
+}
+
+//---------------- Mapping functions ---------------- //
+
+func MapIdempotencyKeyDAOToIdempotentResponse(keyDAO *IdempotencyKeyDAO) IdempotentResponse {
+	return IdempotentResponse{
+		StatusCode: keyDAO.StatusCode,
+		Body:       keyDAO.Response,
+	}
+}
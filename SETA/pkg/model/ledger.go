@@ -0,0 +1,72 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+//---------------- API Data models ---------------- //
+
+// AccountBalance is what an account holds in the ledger in one currency, the held amount is reserved for withdrawals
+// that have not settled yet and cannot be withdrawn again
+type AccountBalance struct {
+	AccountID string          `json:"account_id"`
+	Currency  Currency        `json:"currency"`
+	Available decimal.Decimal `json:"available"`
+	Held      decimal.Decimal `json:"held"`
+}
+
+// Ledger accounts: every account has an available and a held balance per currency, every gateway a settlement balance
+// per currency that is the counterpart of the money moved through it, and the fx account of a currency is the
+// counterpart of the conversions to and from it. The balances of the ledger accounts of a currency always add up to zero
+
+func AvailableLedgerAccount(accountID string, currency Currency) string {
+	return "account:" + accountID + ":" + string(currency) + ":available"
+}
+
+func HeldLedgerAccount(accountID string, currency Currency) string {
+	return "account:" + accountID + ":" + string(currency) + ":held"
+}
+
+func GatewayLedgerAccount(gatewayName string, currency Currency) string {
+	return "gateway:" + gatewayName + ":" + string(currency)
+}
+
+func FXLedgerAccount(currency Currency) string {
+	return "fx:" + string(currency)
+}
+
+//---------------- Database models ---------------- //
+
+// LedgerEntryDAO is a balanced set of postings, its reference makes posting it idempotent
+type LedgerEntryDAO struct {
+	Reference     string // eg. deposit:<transaction ID>
+	TransactionID string
+	Postings      []LedgerPostingDAO
+}
+
+type LedgerPostingDAO struct {
+	LedgerAccountID string
+	Amount          string // a credit is positive, a debit negative
+}
+
+type LedgerHoldStatusDAO string
+
+const (
+	LedgerHoldStatusHeldDAO     LedgerHoldStatusDAO = "held"
+	LedgerHoldStatusCapturedDAO LedgerHoldStatusDAO = "captured" // the withdrawal or refund succeeded, the amount left through the gateway
+	LedgerHoldStatusReleasedDAO LedgerHoldStatusDAO = "released" // the withdrawal or refund failed, or the withdrawal was reversed, the amount is available again
+)
+
+// LedgerHoldDAO reserves the amount of a withdrawal, it is created before any gateway is called so it only gets its
+// transaction ID once a gateway accepted the withdrawal
+type LedgerHoldDAO struct {
+	HoldID        string
+	AccountID     string
+	Amount        string
+	Currency      string
+	TransactionID string
+	Status        LedgerHoldStatusDAO
+	CreatedAt     time.Time
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+//---------------- Domain models ---------------- //
+
+// TransactionLimits bound the transactions of an account of one type, a limit that is nil is not enforced
+type TransactionLimits struct {
+	MinAmount     *decimal.Decimal // of a single transaction, inclusive
+	MaxAmount     *decimal.Decimal // of a single transaction, inclusive
+	DailyAmount   *decimal.Decimal // cumulative amount per UTC calendar day, the transaction included
+	MonthlyAmount *decimal.Decimal // cumulative amount per UTC calendar month, the transaction included
+	MaxCount      *int             // number of transactions per CountWindow, the transaction included
+	CountWindow   time.Duration    // rolling window MaxCount applies to
+}
+
+// Override returns the limits with those set in the override replacing them
+func (l TransactionLimits) Override(override TransactionLimits) TransactionLimits {
+	if override.MinAmount != nil {
+		l.MinAmount = override.MinAmount
+	}
+	if override.MaxAmount != nil {
+		l.MaxAmount = override.MaxAmount
+	}
+	if override.DailyAmount != nil {
+		l.DailyAmount = override.DailyAmount
+	}
+	if override.MonthlyAmount != nil {
+		l.MonthlyAmount = override.MonthlyAmount
+	}
+	if override.MaxCount != nil {
+		l.MaxCount = override.MaxCount
+	}
+	if override.CountWindow > 0 {
+		l.CountWindow = override.CountWindow
+	}
+	return l
+}
+
+// LimitRule gives the limits of a transaction type in a currency, or in every currency when Currency is empty. The
+// amounts of a rule for every currency are in the currency of the transaction
+type LimitRule struct {
+	Type     TransactionType
+	Currency Currency
+	Limits   TransactionLimits
+}
+
+// LimitUsage is what an account already used of its cumulative limits, for one transaction type and currency
+type LimitUsage struct {
+	DailyAmount   decimal.Decimal
+	MonthlyAmount decimal.Decimal
+	Count         int // transactions within the count window
+}
+
+//---------------- Database models ---------------- //
+
+// AccountLimitDAO overrides the configured limits of one account, the columns that are null are not overridden
+type AccountLimitDAO struct {
+	AccountID          string
+	Type               TransactionTypeDAO
+	Currency           string // every currency when empty
+	MinAmount          *string
+	MaxAmount          *string
+	DailyAmount        *string
+	MonthlyAmount      *string
+	MaxCount           *int
+	CountWindowSeconds *int
+}
+
+type LimitUsageDAO struct {
+	DailyAmount   string
+	MonthlyAmount string
+	Count         int
+}
+
+//---------------- Mapping functions ---------------- //
+
+func MapAccountLimitDAOToLimitRule(accountLimitDAO *AccountLimitDAO) LimitRule {
+	limits := TransactionLimits{
+		MinAmount:     decimalOrNil(accountLimitDAO.MinAmount),
+		MaxAmount:     decimalOrNil(accountLimitDAO.MaxAmount),
+		DailyAmount:   decimalOrNil(accountLimitDAO.DailyAmount),
+		MonthlyAmount: decimalOrNil(accountLimitDAO.MonthlyAmount),
+		MaxCount:      accountLimitDAO.MaxCount,
+	}
+	if accountLimitDAO.CountWindowSeconds != nil {
+		limits.CountWindow = time.Duration(*accountLimitDAO.CountWindowSeconds) * time.Second
+	}
+
+	return LimitRule{
+		Type:     TransactionType(accountLimitDAO.Type),
+		Currency: Currency(accountLimitDAO.Currency),
+		Limits:   limits,
+	}
+}
+
+func MapLimitUsageDAOToLimitUsage(limitUsageDAO *LimitUsageDAO) LimitUsage {
+	return LimitUsage{
+		DailyAmount:   decimal.RequireFromString(limitUsageDAO.DailyAmount),
+		MonthlyAmount: decimal.RequireFromString(limitUsageDAO.MonthlyAmount),
+		Count:         limitUsageDAO.Count,
+	}
+}
+
+func decimalOrNil(value *string) *decimal.Decimal {
+	if value == nil {
+		return nil
+	}
+	amount := decimal.RequireFromString(*value)
+	return &amount
+}
@@ -0,0 +1,12 @@
+package model
+
+import "github.com/shopspring/decimal"
+
+// RefundRequest is sent to refund or reverse a transaction, TransactionID is the ID the gateway gave the original transaction
+type RefundRequest struct {
+	TransactionID string          `json:"transaction_id" xml:"TransactionID"`
+	Amount        decimal.Decimal `json:"amount" xml:"Amount"`
+	Currency      Currency        `json:"currency" xml:"Currency"`
+	// the ID SETA gives the refund, the gateway can be asked for the refund by it
+	ClientReference string `json:"client_reference,omitempty" xml:"ClientReference,omitempty"`
+}
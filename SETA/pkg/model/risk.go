@@ -0,0 +1,95 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+//---------------- API Data models ---------------- //
+
+// RiskDecision is the outcome of a risk rule, or of the assessment of a transaction by all of them
+type RiskDecision string
+
+const (
+	RiskDecisionAllow  RiskDecision = "allow"
+	RiskDecisionReview RiskDecision = "review" // the transaction waits in pending_review for an analyst
+	RiskDecisionDeny   RiskDecision = "deny"   // the transaction is rejected before any gateway is called
+)
+
+// Severity orders the decisions, the assessment of a transaction is the most severe decision of its rules
+func (d RiskDecision) Severity() int {
+	switch d {
+	case RiskDecisionReview:
+		return 1
+	case RiskDecisionDeny:
+		return 2
+	}
+	return 0
+}
+
+// RiskHit is a risk rule that did not allow a transaction, and why
+type RiskHit struct {
+	Rule     string       `json:"rule"`
+	Decision RiskDecision `json:"decision"`
+	Reason   string       `json:"reason"`
+}
+
+//---------------- Domain models ---------------- //
+
+// AccountActivity is the history of an account in one currency the risk rules are evaluated against
+type AccountActivity struct {
+	Withdrawals   int             // withdrawals that did not fail
+	LastDepositAt *time.Time      // the latest deposit that did not fail, nil when there is none
+	SettledCount  int             // settled transactions of the type being assessed
+	AverageAmount decimal.Decimal // of the settled transactions of the type being assessed
+	Failures      int             // failed transactions created since the time asked for
+}
+
+//---------------- Database models ---------------- //
+
+type RiskHitDAO struct {
+	TransactionID string
+	AccountID     string
+	Rule          string
+	Decision      string
+	Reason        string
+}
+
+type AccountActivityDAO struct {
+	Withdrawals   int
+	LastDepositAt *time.Time
+	SettledCount  int
+	AverageAmount string
+	Failures      int
+}
+
+//---------------- Mapping functions ---------------- //
+
+func MapRiskHitToRiskHitDAO(transactionID string, accountID string, hit *RiskHit) RiskHitDAO {
+	return RiskHitDAO{
+		TransactionID: transactionID,
+		AccountID:     accountID,
+		Rule:          hit.Rule,
+		Decision:      string(hit.Decision),
+		Reason:        hit.Reason,
+	}
+}
+
+func MapRiskHitDAOToRiskHit(hitDAO *RiskHitDAO) RiskHit {
+	return RiskHit{
+		Rule:     hitDAO.Rule,
+		Decision: RiskDecision(hitDAO.Decision),
+		Reason:   hitDAO.Reason,
+	}
+}
+
+func MapAccountActivityDAOToAccountActivity(activityDAO *AccountActivityDAO) AccountActivity {
+	return AccountActivity{
+		Withdrawals:   activityDAO.Withdrawals,
+		LastDepositAt: activityDAO.LastDepositAt,
+		SettledCount:  activityDAO.SettledCount,
+		AverageAmount: decimal.RequireFromString(activityDAO.AverageAmount),
+		Failures:      activityDAO.Failures,
+	}
+}
@@ -0,0 +1,8 @@
+package model
+
+// RoutingExplanation tells which routing rule a transaction matches and which gateways it would be sent to
+type RoutingExplanation struct {
+	Rule     string   `json:"rule"`     // name of the matched rule, empty when no rule matched
+	Strategy string   `json:"strategy"` // "rule" when a rule matched, otherwise the strategy that orders the gateways
+	Gateways []string `json:"gateways"` // gateway names, in the order they are tried when a rule matched
+}
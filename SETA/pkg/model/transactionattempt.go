@@ -0,0 +1,84 @@
+package model
+
+import "time"
+
+//---------------- API Data models ---------------- //
+
+// TransactionAttempt is a call made to a payment gateway for a transaction, the retries of the gateway included
+type TransactionAttempt struct {
+	Gateway             string    `json:"gateway"`
+	StartedAt           time.Time `json:"started_at"`
+	EndedAt             time.Time `json:"ended_at"`
+	LatencyMs           int64     `json:"latency_ms"`
+	StatusCode          int       `json:"status_code,omitempty"`          // 0 when no response was received
+	ErrorCategory       string    `json:"error_category,omitempty"`       // the category of the gateway error, empty for the attempt that succeeded
+	Error               string    `json:"error,omitempty"`                // the error of a failed attempt
+	RequestFingerprint  string    `json:"request_fingerprint"`            // SHA-256 of what was sent to the gateway, the same for two identical requests
+	ResponseFingerprint string    `json:"response_fingerprint,omitempty"` // SHA-256 of the raw response, before redaction
+}
+
+//---------------- Domain models ---------------- //
+
+// GatewayAttempt is a call made to a payment gateway while creating a transaction, Err is nil for the call that succeeded
+type GatewayAttempt struct {
+	Gateway             string
+	Err                 error
+	ErrorCategory       string
+	StatusCode          int
+	StartedAt           time.Time
+	EndedAt             time.Time
+	RequestFingerprint  string
+	ResponseFingerprint string
+}
+
+//---------------- Database models ---------------- //
+
+type TransactionAttemptDAO struct {
+	TransactionID       string
+	AccountID           string
+	Gateway             string
+	StartedAt           time.Time
+	EndedAt             time.Time
+	LatencyMs           int64
+	StatusCode          int
+	ErrorCategory       string
+	Error               string
+	RequestFingerprint  string
+	ResponseFingerprint string
+}
+
+//---------------- Mapping functions ---------------- //
+
+func MapGatewayAttemptToTransactionAttemptDAO(transactionID string, accountID string, attempt *GatewayAttempt) TransactionAttemptDAO {
+	attemptDAO := TransactionAttemptDAO{
+		TransactionID: transactionID,
+		AccountID:     accountID,
+		Gateway:       attempt.Gateway,
+		// the columns have no time zone, the times are stored in UTC
+		StartedAt:           attempt.StartedAt.UTC(),
+		EndedAt:             attempt.EndedAt.UTC(),
+		LatencyMs:           attempt.EndedAt.Sub(attempt.StartedAt).Milliseconds(),
+		StatusCode:          attempt.StatusCode,
+		ErrorCategory:       attempt.ErrorCategory,
+		RequestFingerprint:  attempt.RequestFingerprint,
+		ResponseFingerprint: attempt.ResponseFingerprint,
+	}
+	if attempt.Err != nil {
+		attemptDAO.Error = attempt.Err.Error()
+	}
+	return attemptDAO
+}
+
+func MapTransactionAttemptDAOToTransactionAttempt(attemptDAO *TransactionAttemptDAO) TransactionAttempt {
+	return TransactionAttempt{
+		Gateway:             attemptDAO.Gateway,
+		StartedAt:           attemptDAO.StartedAt,
+		EndedAt:             attemptDAO.EndedAt,
+		LatencyMs:           attemptDAO.LatencyMs,
+		StatusCode:          attemptDAO.StatusCode,
+		ErrorCategory:       attemptDAO.ErrorCategory,
+		Error:               attemptDAO.Error,
+		RequestFingerprint:  attemptDAO.RequestFingerprint,
+		ResponseFingerprint: attemptDAO.ResponseFingerprint,
+	}
+}
@@ -0,0 +1,74 @@
+package model
+
+import "time"
+
+//---------------- API Data models ---------------- //
+
+type TransactionEventType string
+
+const (
+	TransactionEventCreated        TransactionEventType = "created"         // the transaction was recorded
+	TransactionEventGatewayAttempt TransactionEventType = "gateway_attempt" // a payment gateway was called, or skipped as its circuit was open
+	TransactionEventStatusChanged  TransactionEventType = "status_changed"  // the status was updated through the API, the reconciler, the recovery or a refund
+	TransactionEventCallback       TransactionEventType = "callback"        // a gateway callback was applied, also recorded when it did not change the status
+)
+
+// Sources of the events that are not caused by a gateway, gateway attempts and callbacks have the gateway name as source
+const (
+	TransactionEventSourceAPI        = "api"
+	TransactionEventSourceReconciler = "reconciler"
+	TransactionEventSourceRefund     = "refund"
+	TransactionEventSourceRecovery   = "recovery"
+)
+
+// TransactionEvent is an entry of the history of a transaction
+type TransactionEvent struct {
+	Type             TransactionEventType `json:"type"`
+	Source           string               `json:"source"`                      // who caused the event
+	PreviousStatus   TransactionStatus    `json:"previous_status,omitempty"`   // empty for creations and gateway attempts
+	Status           TransactionStatus    `json:"status,omitempty"`            // the status after the event
+	Detail           string               `json:"detail,omitempty"`            // eg. the error of a failed gateway attempt
+	PayloadReference string               `json:"payload_reference,omitempty"` // where the raw payload can be found: the request ID, the callback nonce or the refund transaction ID
+	CreatedAt        time.Time            `json:"created_at"`
+}
+
+//---------------- Database models ---------------- //
+
+type TransactionEventDAO struct {
+	TransactionID    string
+	AccountID        string
+	Type             string
+	Source           string
+	PreviousStatus   string
+	Status           string
+	Detail           string
+	PayloadReference string
+	CreatedAt        time.Time
+}
+
+//---------------- Mapping functions ---------------- //
+
+func MapTransactionEventToTransactionEventDAO(transactionID string, accountID string, event *TransactionEvent) TransactionEventDAO {
+	return TransactionEventDAO{
+		TransactionID:    transactionID,
+		AccountID:        accountID,
+		Type:             string(event.Type),
+		Source:           event.Source,
+		PreviousStatus:   string(event.PreviousStatus),
+		Status:           string(event.Status),
+		Detail:           event.Detail,
+		PayloadReference: event.PayloadReference,
+	}
+}
+
+func MapTransactionEventDAOToTransactionEvent(eventDAO *TransactionEventDAO) TransactionEvent {
+	return TransactionEvent{
+		Type:             TransactionEventType(eventDAO.Type),
+		Source:           eventDAO.Source,
+		PreviousStatus:   TransactionStatus(eventDAO.PreviousStatus),
+		Status:           TransactionStatus(eventDAO.Status),
+		Detail:           eventDAO.Detail,
+		PayloadReference: eventDAO.PayloadReference,
+		CreatedAt:        eventDAO.CreatedAt,
+	}
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+//---------------- API Data models ---------------- //
+
+// SortOrder orders a listing of transactions by their creation time
+type SortOrder string
+
+const (
+	SortOrderAsc  SortOrder = "asc"
+	SortOrderDesc SortOrder = "desc" // newest first, the default
+)
+
+// TransactionPage is a page of a listing of transactions
+type TransactionPage struct {
+	Transactions []TransactionData `json:"transactions"`
+	NextCursor   string            `json:"next_cursor,omitempty"` // the cursor of the next page, empty on the last one
+}
+
+//---------------- Domain models ---------------- //
+
+// TransactionFilter selects the transactions of a listing, a field left empty does not filter
+type TransactionFilter struct {
+	AccountID   string
+	Status      TransactionStatus
+	Type        TransactionType
+	Gateway     string
+	MinAmount   *decimal.Decimal // inclusive
+	MaxAmount   *decimal.Decimal // inclusive
+	CreatedFrom *time.Time       // inclusive
+	CreatedTo   *time.Time       // exclusive
+	Order       SortOrder
+	Limit       int
+	Cursor      string // the next_cursor of the previous page
+}
+
+//---------------- Database models ---------------- //
+
+type TransactionFilterDAO struct {
+	AccountID   string
+	Status      TransactionStatusDAO
+	Type        TransactionTypeDAO
+	GatewayName string
+	MinAmount   string // empty when not filtered
+	MaxAmount   string // empty when not filtered
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Descending  bool
+	Limit       int
+	After       *TransactionCursorDAO // the page starts after this transaction, in the order of the listing
+}
+
+// TransactionCursorDAO is the position of a transaction in a listing, ordered by creation time then row ID
+type TransactionCursorDAO struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+//---------------- Mapping functions ---------------- //
+
+// MapTransactionFilterToTransactionFilterDAO maps everything but the cursor, which the service decodes
+func MapTransactionFilterToTransactionFilterDAO(filter *TransactionFilter) TransactionFilterDAO {
+	filterDAO := TransactionFilterDAO{
+		AccountID:   filter.AccountID,
+		Status:      TransactionStatusDAO(filter.Status),
+		Type:        TransactionTypeDAO(filter.Type),
+		GatewayName: filter.Gateway,
+		CreatedFrom: filter.CreatedFrom,
+		CreatedTo:   filter.CreatedTo,
+		Descending:  filter.Order != SortOrderAsc,
+		Limit:       filter.Limit,
+	}
+
+	if filter.MinAmount != nil {
+		filterDAO.MinAmount = filter.MinAmount.String()
+	}
+	if filter.MaxAmount != nil {
+		filterDAO.MaxAmount = filter.MaxAmount.String()
+	}
+
+	return filterDAO
+}
@@ -1,6 +1,12 @@
 package model
 
-import "github.com/shopspring/decimal"
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
 
 //---------------- API Data models ---------------- //
 
@@ -20,11 +26,20 @@ type TransactionResponse struct { // Common TransactionModel
 }
 
 type TransactionData struct { // Data model for transaction
-	AccountID     string            `json:"account_id" xml:"AccountID"`
-	TransactionID string            `json:"transaction_id" xml:"TransactionID"`
-	Status        TransactionStatus `json:"status" xml:"Status"`
-	Type          TransactionType   `json:"type" xml:"Type"`
-	Amount        decimal.Decimal   `json:"amount" xml:"Amount"`
+	AccountID           string            `json:"account_id" xml:"AccountID"`
+	TransactionID       string            `json:"transaction_id" xml:"TransactionID"`
+	Status              TransactionStatus `json:"status" xml:"Status"`
+	Type                TransactionType   `json:"type" xml:"Type"`
+	Amount              decimal.Decimal   `json:"amount" xml:"Amount"`
+	Currency            Currency          `json:"currency" xml:"Currency"`
+	Gateway             string            `json:"gateway,omitempty" xml:"-"`                               // name of the gateway that processed the transaction, set by SETA
+	GatewayReference    string            `json:"gateway_reference,omitempty" xml:"-"`                     // the ID the gateway gave the transaction, set by SETA
+	GatewayResponse     json.RawMessage   `json:"gateway_response,omitempty" xml:"-" swaggertype:"object"` // the response of the gateway as JSON, redacted
+	GatewayStatusCode   int               `json:"-" xml:"-"`                                               // the status code of the gateway's response, set by the clients
+	ParentTransactionID string            `json:"parent_transaction_id,omitempty" xml:"-"`                 // the transaction a refund or reversal undoes
+	RiskHits            []RiskHit         `json:"risk_hits,omitempty" xml:"-"`                             // the risk rules that did not allow the transaction
+	Conversion          *FXConversion     `json:"conversion,omitempty" xml:"-"`                            // set when the gateway processed the transaction in another currency
+	CreatedAt           *time.Time        `json:"created_at,omitempty" xml:"-"`                            // set once the transaction is stored
 }
 
 type TransactionStatus string
@@ -33,32 +48,85 @@ const (
 	TransactionStatusSuccess TransactionStatus = "success"
 	TransactionStatusFailed  TransactionStatus = "failed"
 	TransactionStatusPending TransactionStatus = "pending"
+	// set by SETA when a transaction is refunded or reversed, gateways never report them
+	TransactionStatusPartiallyRefunded TransactionStatus = "partially_refunded"
+	TransactionStatusRefunded          TransactionStatus = "refunded"
+	TransactionStatusReversed          TransactionStatus = "reversed"
+	// set by SETA when the risk rules hold a transaction back for an analyst, no gateway was called yet
+	TransactionStatusPendingReview TransactionStatus = "pending_review"
+	// set by SETA when a gateway may have processed a transaction but could not be asked whether it did, the
+	// reconciler resolves it by its client reference
+	TransactionStatusUnknown TransactionStatus = "unknown"
+	// set by SETA when it records a transaction before calling the gateways, it is updated with their outcome
+	TransactionStatusInitiated TransactionStatus = "initiated"
 )
 
-const TransactionStatuses = "success,failed,pending"
+const TransactionStatuses = "success,failed,pending,partially_refunded,refunded,reversed,pending_review,unknown,initiated"
+
+// IsValid reports whether the status is one of TransactionStatuses
+func (s TransactionStatus) IsValid() bool {
+	for _, status := range strings.Split(TransactionStatuses, ",") {
+		if string(s) == status {
+			return true
+		}
+	}
+	return false
+}
 
 type TransactionType string
 
 const (
 	TransactionTypeDeposit  TransactionType = "deposit"
 	TransactionTypeWithdraw TransactionType = "withdraw"
+	TransactionTypeRefund   TransactionType = "refund"   // returns all or part of a settled transaction
+	TransactionTypeReversal TransactionType = "reversal" // cancels a transaction before it settled
 )
 
+// IsValid reports whether the type is one of the transaction types
+func (t TransactionType) IsValid() bool {
+	switch t {
+	case TransactionTypeDeposit, TransactionTypeWithdraw, TransactionTypeRefund, TransactionTypeReversal:
+		return true
+	}
+	return false
+}
+
 //---------------- Database models ---------------- //
 
 type TransactionDAO struct { // Data Access Object, used to interact with the database
-	TransactionID string
-	AccountID     string
-	Amount        string
-	Status        TransactionStatusDAO
-	Type          TransactionTypeDAO
+	ID                  string // the row ID, set when read
+	TransactionID       string
+	AccountID           string
+	Amount              string
+	Currency            string
+	Status              TransactionStatusDAO
+	Type                TransactionTypeDAO
+	GatewayName         string
+	GatewayReference    string
+	GatewayResponse     []byte // JSON, nil when there is none
+	ParentTransactionID string
+	// set when the transaction was converted, empty otherwise
+	ConvertedAmount   string
+	ConvertedCurrency string
+	FXRate            string
+	FXQuoteID         string
+	RiskHits          []RiskHitDAO            // stored with the transaction, read separately
+	Attempts          []TransactionAttemptDAO // stored with the transaction, read separately
+	CreatedAt         time.Time               // set when read
 }
 
 type TransactionStatusDAO string
 
 const (
-	TransactionStatusSuccessDAO TransactionStatusDAO = "success"
-	TransactionStatusFailedDAO  TransactionStatusDAO = "failed"
+	TransactionStatusSuccessDAO           TransactionStatusDAO = "success"
+	TransactionStatusFailedDAO            TransactionStatusDAO = "failed"
+	TransactionStatusPendingDAO           TransactionStatusDAO = "pending"
+	TransactionStatusPartiallyRefundedDAO TransactionStatusDAO = "partially_refunded"
+	TransactionStatusRefundedDAO          TransactionStatusDAO = "refunded"
+	TransactionStatusReversedDAO          TransactionStatusDAO = "reversed"
+	TransactionStatusPendingReviewDAO     TransactionStatusDAO = "pending_review"
+	TransactionStatusUnknownDAO           TransactionStatusDAO = "unknown"
+	TransactionStatusInitiatedDAO         TransactionStatusDAO = "initiated"
 )
 
 type TransactionTypeDAO string
@@ -66,6 +134,8 @@ type TransactionTypeDAO string
 const (
 	TransactionTypeDepositDAO  TransactionTypeDAO = "deposit"
 	TransactionTypeWithdrawDAO TransactionTypeDAO = "withdraw"
+	TransactionTypeRefundDAO   TransactionTypeDAO = "refund"
+	TransactionTypeReversalDAO TransactionTypeDAO = "reversal"
 )
 
 //---------------- Mapping functions ---------------- //
@@ -78,6 +148,7 @@ func MapGatewayATransactionResponse(transactionResponse *GatewayATransactionResp
 			Status:        transactionResponse.Data.Status,
 			Type:          transactionResponse.Data.Type,
 			Amount:        transactionResponse.Data.Amount,
+			Currency:      transactionResponse.Data.Currency,
 		},
 	}
 }
@@ -90,28 +161,72 @@ func MapGatewayBTransactionResponse(transactionResponse *GatewayBTransactionResp
 			Status:        transactionResponse.Status,
 			Type:          transactionResponse.Type,
 			Amount:        transactionResponse.Amount,
+			Currency:      transactionResponse.Currency,
 		},
 	}
 }
 
 func MapTransactionResponseToTransactionDAO(transactionResponse *TransactionResponse) TransactionDAO {
-	return TransactionDAO{
-		AccountID:     transactionResponse.Data.AccountID,
-		Amount:        transactionResponse.Data.Amount.String(),
-		TransactionID: transactionResponse.Data.TransactionID,
-		Status:        TransactionStatusDAO(transactionResponse.Data.Status),
-		Type:          TransactionTypeDAO(transactionResponse.Data.Type),
+	transactionDAO := TransactionDAO{
+		AccountID:           transactionResponse.Data.AccountID,
+		Amount:              transactionResponse.Data.Amount.String(),
+		Currency:            string(transactionResponse.Data.Currency),
+		TransactionID:       transactionResponse.Data.TransactionID,
+		Status:              TransactionStatusDAO(transactionResponse.Data.Status),
+		Type:                TransactionTypeDAO(transactionResponse.Data.Type),
+		GatewayName:         transactionResponse.Data.Gateway,
+		GatewayReference:    transactionResponse.Data.GatewayReference,
+		GatewayResponse:     transactionResponse.Data.GatewayResponse,
+		ParentTransactionID: transactionResponse.Data.ParentTransactionID,
 	}
+
+	if conversion := transactionResponse.Data.Conversion; conversion != nil {
+		transactionDAO.ConvertedAmount = conversion.Amount.String()
+		transactionDAO.ConvertedCurrency = string(conversion.Currency)
+		transactionDAO.FXRate = conversion.Rate.String()
+		transactionDAO.FXQuoteID = conversion.QuoteID
+	}
+
+	for i := range transactionResponse.Data.RiskHits {
+		transactionDAO.RiskHits = append(transactionDAO.RiskHits, MapRiskHitToRiskHitDAO(transactionDAO.TransactionID, transactionDAO.AccountID, &transactionResponse.Data.RiskHits[i]))
+	}
+
+	return transactionDAO
 }
 
 func MapTransactionDAOToTransactionResponse(transactionDAO *TransactionDAO) TransactionResponse {
-	return TransactionResponse{
+	transactionResponse := TransactionResponse{
 		Data: TransactionData{
-			AccountID:     transactionDAO.AccountID,
-			TransactionID: transactionDAO.TransactionID,
-			Status:        TransactionStatus(transactionDAO.Status),
-			Type:          TransactionType(transactionDAO.Type),
-			Amount:        decimal.RequireFromString(transactionDAO.Amount),
+			AccountID:           transactionDAO.AccountID,
+			TransactionID:       transactionDAO.TransactionID,
+			Status:              TransactionStatus(transactionDAO.Status),
+			Type:                TransactionType(transactionDAO.Type),
+			Amount:              decimal.RequireFromString(transactionDAO.Amount),
+			Currency:            Currency(transactionDAO.Currency),
+			Gateway:             transactionDAO.GatewayName,
+			GatewayReference:    transactionDAO.GatewayReference,
+			GatewayResponse:     transactionDAO.GatewayResponse,
+			ParentTransactionID: transactionDAO.ParentTransactionID,
 		},
 	}
+
+	if transactionDAO.ConvertedCurrency != "" {
+		transactionResponse.Data.Conversion = &FXConversion{
+			QuoteID:  transactionDAO.FXQuoteID,
+			Rate:     decimal.RequireFromString(transactionDAO.FXRate),
+			Amount:   decimal.RequireFromString(transactionDAO.ConvertedAmount),
+			Currency: Currency(transactionDAO.ConvertedCurrency),
+		}
+	}
+
+	if !transactionDAO.CreatedAt.IsZero() {
+		createdAt := transactionDAO.CreatedAt
+		transactionResponse.Data.CreatedAt = &createdAt
+	}
+
+	for i := range transactionDAO.RiskHits {
+		transactionResponse.Data.RiskHits = append(transactionResponse.Data.RiskHits, MapRiskHitDAOToRiskHit(&transactionDAO.RiskHits[i]))
+	}
+
+	return transactionResponse
 }
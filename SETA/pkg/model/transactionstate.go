@@ -0,0 +1,24 @@
+package model
+
+// transactionTransitions lists the statuses a transaction can move to from each status, the missing ones are final. A
+// settled transaction can only be refunded, one in review was not sent to any gateway and is approved (back to
+// initiated) or rejected, an unknown or initiated one gets the outcome of the gateways that may have processed it
+var transactionTransitions = map[TransactionStatus][]TransactionStatus{
+	TransactionStatusPending:           {TransactionStatusSuccess, TransactionStatusFailed, TransactionStatusReversed},
+	TransactionStatusSuccess:           {TransactionStatusPartiallyRefunded, TransactionStatusRefunded},
+	TransactionStatusPartiallyRefunded: {TransactionStatusRefunded},
+	TransactionStatusPendingReview:     {TransactionStatusInitiated, TransactionStatusFailed},
+	TransactionStatusUnknown:           {TransactionStatusPending, TransactionStatusSuccess, TransactionStatusFailed},
+	TransactionStatusInitiated:         {TransactionStatusPending, TransactionStatusSuccess, TransactionStatusFailed, TransactionStatusUnknown},
+}
+
+// CanTransitionTo reports whether a transaction in this status may move to the next one. Staying in the same status
+// is not a transition, callers treat it as a no-op
+func (s TransactionStatus) CanTransitionTo(next TransactionStatus) bool {
+	for _, allowed := range transactionTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,8 @@
+package repository
+
+const (
+	InsertCallbackNonceQuery = `INSERT INTO callback_nonces (gateway_name, nonce, received_at) VALUES ($1, $2, $3)
+	ON CONFLICT (gateway_name, nonce) DO NOTHING`
+	DeleteCallbackNoncesQuery = "DELETE FROM callback_nonces WHERE received_at < $1"
+	DeleteCallbackNonceQuery  = "DELETE FROM callback_nonces WHERE gateway_name = $1 AND nonce = $2"
+)
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type ICallbackRepository interface {
+	// SaveNonce records the nonce of a gateway callback, it returns false if the nonce was already used
+	SaveNonce(ctx context.Context, gatewayName string, nonce string, receivedAt time.Time) (bool, error)
+	// DeleteNonces forgets the nonces received before the given time, callbacks that old are rejected by their timestamp anyway
+	DeleteNonces(ctx context.Context, receivedBefore time.Time) error
+	// DeleteNonce forgets the nonce of a callback that could not be handled, so that the gateway can retry it
+	DeleteNonce(ctx context.Context, gatewayName string, nonce string) error
+}
+
+type CallbackRepository struct {
+	DB *pgxpool.Pool
+}
+
+func CallbackRepositoryProvider(db *pgxpool.Pool) ICallbackRepository {
+	return &CallbackRepository{DB: db}
+}
+
+func (cr *CallbackRepository) SaveNonce(ctx context.Context, gatewayName string, nonce string, receivedAt time.Time) (bool, error) {
+	tag, err := cr.DB.Exec(ctx, InsertCallbackNonceQuery, gatewayName, nonce, receivedAt)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (cr *CallbackRepository) DeleteNonce(ctx context.Context, gatewayName string, nonce string) error {
+	_, err := cr.DB.Exec(ctx, DeleteCallbackNonceQuery, gatewayName, nonce)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cr *CallbackRepository) DeleteNonces(ctx context.Context, receivedBefore time.Time) error {
+	_, err := cr.DB.Exec(ctx, DeleteCallbackNoncesQuery, receivedBefore)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package repository
+
+const (
+	// a rate loaded again for the same window replaces the previous one, so reloading the rates file is idempotent
+	InsertFXRateQuery = `INSERT INTO fx_rates (from_currency, to_currency, rate, valid_from, valid_to) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (from_currency, to_currency, valid_from) DO UPDATE SET rate = $3, valid_to = $5`
+	// the latest rate whose validity window includes the time
+	GetFXRateQuery = `SELECT from_currency, to_currency, rate::text, valid_from, valid_to FROM fx_rates
+	WHERE from_currency = $1 AND to_currency = $2 AND valid_from <= $3 AND (valid_to IS NULL OR valid_to > $3)
+	ORDER BY valid_from DESC LIMIT 1`
+	InsertFXQuoteQuery = `INSERT INTO fx_quotes (id, from_currency, to_currency, rate, amount, converted_amount, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	GetFXQuoteQuery = `SELECT id, from_currency, to_currency, rate::text, amount::text, converted_amount::text, expires_at, used_at
+	FROM fx_quotes WHERE id = $1`
+	// compare-and-set, only one transaction can use a quote and only before it expires
+	UseFXQuoteQuery     = "UPDATE fx_quotes SET used_at = $2 WHERE id = $1 AND used_at IS NULL AND expires_at > $2"
+	ReleaseFXQuoteQuery = "UPDATE fx_quotes SET used_at = NULL WHERE id = $1"
+)
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"seta/pkg/model"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type IFXRepository interface {
+	// SaveRates stores the rates in one database transaction
+	SaveRates(ctx context.Context, rates []model.FXRateDAO) error
+	// GetRate returns the rate valid at the given time, pgx.ErrNoRows when there is none
+	GetRate(ctx context.Context, fromCurrency string, toCurrency string, at time.Time) (model.FXRateDAO, error)
+	CreateQuote(ctx context.Context, quote model.FXQuoteDAO) error
+	// GetQuote returns the quote, pgx.ErrNoRows when there is none
+	GetQuote(ctx context.Context, quoteID string) (model.FXQuoteDAO, error)
+	// UseQuote marks the quote as used if it was not used yet and has not expired at the given time, it returns false otherwise
+	UseQuote(ctx context.Context, quoteID string, at time.Time) (bool, error)
+	// ReleaseQuote makes a quote usable again, for a transaction that no gateway accepted
+	ReleaseQuote(ctx context.Context, quoteID string) error
+}
+
+type FXRepository struct {
+	DB *pgxpool.Pool
+}
+
+func FXRepositoryProvider(db *pgxpool.Pool) IFXRepository {
+	return &FXRepository{DB: db}
+}
+
+func (fr *FXRepository) SaveRates(ctx context.Context, rates []model.FXRateDAO) error {
+	return inTransaction(ctx, fr.DB, func(tx pgx.Tx) error {
+		for _, rate := range rates {
+			if _, err := tx.Exec(ctx, InsertFXRateQuery, rate.FromCurrency, rate.ToCurrency, rate.Rate, rate.ValidFrom, rate.ValidTo); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (fr *FXRepository) GetRate(ctx context.Context, fromCurrency string, toCurrency string, at time.Time) (model.FXRateDAO, error) {
+	var rate model.FXRateDAO
+	err := fr.DB.QueryRow(ctx, GetFXRateQuery, fromCurrency, toCurrency, at).Scan(&rate.FromCurrency, &rate.ToCurrency, &rate.Rate, &rate.ValidFrom, &rate.ValidTo)
+	if err != nil {
+		return model.FXRateDAO{}, err
+	}
+	return rate, nil
+}
+
+func (fr *FXRepository) CreateQuote(ctx context.Context, quote model.FXQuoteDAO) error {
+	_, err := fr.DB.Exec(ctx, InsertFXQuoteQuery, quote.QuoteID, quote.FromCurrency, quote.ToCurrency, quote.Rate, quote.Amount, quote.ConvertedAmount, quote.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (fr *FXRepository) GetQuote(ctx context.Context, quoteID string) (model.FXQuoteDAO, error) {
+	var quote model.FXQuoteDAO
+	err := fr.DB.QueryRow(ctx, GetFXQuoteQuery, quoteID).Scan(&quote.QuoteID, &quote.FromCurrency, &quote.ToCurrency, &quote.Rate, &quote.Amount, &quote.ConvertedAmount, &quote.ExpiresAt, &quote.UsedAt)
+	if err != nil {
+		return model.FXQuoteDAO{}, err
+	}
+	return quote, nil
+}
+
+func (fr *FXRepository) UseQuote(ctx context.Context, quoteID string, at time.Time) (bool, error) {
+	tag, err := fr.DB.Exec(ctx, UseFXQuoteQuery, quoteID, at)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (fr *FXRepository) ReleaseQuote(ctx context.Context, quoteID string) error {
+	_, err := fr.DB.Exec(ctx, ReleaseFXQuoteQuery, quoteID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
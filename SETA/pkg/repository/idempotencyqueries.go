@@ -0,0 +1,14 @@
+package repository
+
+const (
+	// an expired key is claimed again as if it was new, a live one is left untouched
+	ClaimIdempotencyKeyQuery = `INSERT INTO idempotency_keys (key, request_hash, created_at, expires_at) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (key) DO UPDATE SET request_hash = $2, status_code = NULL, response = NULL, created_at = $3, expires_at = $4
+	WHERE idempotency_keys.expires_at <= $3`
+	GetIdempotencyKeyQuery = `SELECT key, request_hash, COALESCE(status_code, 0), response, expires_at FROM idempotency_keys
+	WHERE key = $1`
+	CompleteIdempotencyKeyQuery = "UPDATE idempotency_keys SET status_code = $2, response = $3 WHERE key = $1"
+	// only a key whose request is still in flight can be released, a completed one keeps its response until it expires
+	ReleaseIdempotencyKeyQuery        = "DELETE FROM idempotency_keys WHERE key = $1 AND status_code IS NULL"
+	DeleteExpiredIdempotencyKeysQuery = "DELETE FROM idempotency_keys WHERE expires_at <= $1"
+)
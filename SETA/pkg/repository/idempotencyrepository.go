@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"seta/pkg/model"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type IIdempotencyRepository interface {
+	// ClaimKey records the key for a request in flight, it returns false if the key is already used and has not expired
+	ClaimKey(ctx context.Context, key string, requestHash string, at time.Time, expiresAt time.Time) (bool, error)
+	// GetKey returns the key, pgx.ErrNoRows when there is none
+	GetKey(ctx context.Context, key string) (model.IdempotencyKeyDAO, error)
+	// CompleteKey stores the final response of the request of the key
+	CompleteKey(ctx context.Context, key string, statusCode int, response []byte) error
+	// ReleaseKey forgets a key whose request is still in flight, so that the request can be made again
+	ReleaseKey(ctx context.Context, key string) error
+	// DeleteExpiredKeys forgets the keys that expired at the given time
+	DeleteExpiredKeys(ctx context.Context, at time.Time) error
+}
+
+type IdempotencyRepository struct {
+	DB *pgxpool.Pool
+}
+
+func IdempotencyRepositoryProvider(db *pgxpool.Pool) IIdempotencyRepository {
+	return &IdempotencyRepository{DB: db}
+}
+
+func (ir *IdempotencyRepository) ClaimKey(ctx context.Context, key string, requestHash string, at time.Time, expiresAt time.Time) (bool, error) {
+	tag, err := ir.DB.Exec(ctx, ClaimIdempotencyKeyQuery, key, requestHash, at, expiresAt)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (ir *IdempotencyRepository) GetKey(ctx context.Context, key string) (model.IdempotencyKeyDAO, error) {
+	var keyDAO model.IdempotencyKeyDAO
+	err := ir.DB.QueryRow(ctx, GetIdempotencyKeyQuery, key).Scan(&keyDAO.Key, &keyDAO.RequestHash, &keyDAO.StatusCode, &keyDAO.Response, &keyDAO.ExpiresAt)
+	if err != nil {
+		return model.IdempotencyKeyDAO{}, err
+	}
+	return keyDAO, nil
+}
+
+func (ir *IdempotencyRepository) CompleteKey(ctx context.Context, key string, statusCode int, response []byte) error {
+	_, err := ir.DB.Exec(ctx, CompleteIdempotencyKeyQuery, key, statusCode, response)
+	return err
+}
+
+func (ir *IdempotencyRepository) ReleaseKey(ctx context.Context, key string) error {
+	_, err := ir.DB.Exec(ctx, ReleaseIdempotencyKeyQuery, key)
+	return err
+}
+
+func (ir *IdempotencyRepository) DeleteExpiredKeys(ctx context.Context, at time.Time) error {
+	_, err := ir.DB.Exec(ctx, DeleteExpiredIdempotencyKeysQuery, at)
+	return err
+}
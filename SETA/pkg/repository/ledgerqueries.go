@@ -0,0 +1,20 @@
+package repository
+
+const (
+	// an entry that was already posted is skipped
+	InsertLedgerEntryQuery = `INSERT INTO ledger_entries (reference, transaction_id) VALUES ($1, $2)
+	ON CONFLICT (reference) DO NOTHING`
+	InsertLedgerPostingQuery = "INSERT INTO ledger_postings (reference, ledger_account_id, amount) VALUES ($1, $2, $3)"
+	UpdateLedgerBalanceQuery = `INSERT INTO ledger_accounts (id, balance) VALUES ($1, $2)
+	ON CONFLICT (id) DO UPDATE SET balance = ledger_accounts.balance + $2, updated_at = now()`
+	// locks the balance until the end of the database transaction, so that concurrent holds are checked one at a time
+	LockLedgerBalanceQuery        = "SELECT balance::text FROM ledger_accounts WHERE id = $1 FOR UPDATE"
+	GetLedgerBalancesQuery        = "SELECT id, balance::text FROM ledger_accounts WHERE id = ANY($1)"
+	InsertLedgerHoldQuery         = "INSERT INTO ledger_holds (id, account_id, amount, currency, status) VALUES ($1, $2, $3, $4, $5)"
+	AttachLedgerHoldQuery         = "UPDATE ledger_holds SET transaction_id = $2, updated_at = now() WHERE id = $1"
+	GetLedgerHoldQuery            = `SELECT id, account_id, amount::text, currency, COALESCE(transaction_id, ''), status, created_at FROM ledger_holds WHERE id = $1`
+	GetTransactionLedgerHoldQuery = `SELECT id, account_id, amount::text, currency, COALESCE(transaction_id, ''), status, created_at FROM ledger_holds
+	WHERE transaction_id = $1`
+	// only an open hold can be closed, so a hold is captured or released once
+	CloseLedgerHoldQuery = "UPDATE ledger_holds SET status = $2, updated_at = now() WHERE id = $1 AND status = 'held'"
+)
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"seta/pkg/model"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shopspring/decimal"
+)
+
+// ErrInsufficientFunds is returned by CreateHold when the available balance of the account is lower than the amount
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+type ILedgerRepository interface {
+	// Post records a balanced entry and updates the balances of its ledger accounts in one database transaction. An
+	// entry whose reference was already posted is skipped, so posting is idempotent
+	Post(ctx context.Context, entry model.LedgerEntryDAO) error
+	// CreateHold records the hold and posts its entry, which moves the amount from the available to the held balance, if
+	// the available balance covers it. ErrInsufficientFunds otherwise
+	CreateHold(ctx context.Context, hold model.LedgerHoldDAO, entry model.LedgerEntryDAO) error
+	AttachHold(ctx context.Context, holdID string, transactionID string) error
+	GetHold(ctx context.Context, holdID string) (model.LedgerHoldDAO, error)
+	GetTransactionHold(ctx context.Context, transactionID string) (model.LedgerHoldDAO, error)
+	// CloseHold captures or releases an open hold and posts the entry that settles it, a hold that is already closed
+	// is left as is
+	CloseHold(ctx context.Context, hold model.LedgerHoldDAO, status model.LedgerHoldStatusDAO, entry model.LedgerEntryDAO) error
+	// GetBalances returns the balances of the ledger accounts by ID, the accounts without postings are left out
+	GetBalances(ctx context.Context, ledgerAccountIDs []string) (map[string]string, error)
+}
+
+type LedgerRepository struct {
+	DB *pgxpool.Pool
+}
+
+func LedgerRepositoryProvider(db *pgxpool.Pool) ILedgerRepository {
+	return &LedgerRepository{DB: db}
+}
+
+func (lr *LedgerRepository) Post(ctx context.Context, entry model.LedgerEntryDAO) error {
+	return inTransaction(ctx, lr.DB, func(tx pgx.Tx) error {
+		return postLedgerEntry(ctx, tx, entry)
+	})
+}
+
+func (lr *LedgerRepository) CreateHold(ctx context.Context, hold model.LedgerHoldDAO, entry model.LedgerEntryDAO) error {
+	return inTransaction(ctx, lr.DB, func(tx pgx.Tx) error {
+		var available string
+		err := tx.QueryRow(ctx, LockLedgerBalanceQuery, model.AvailableLedgerAccount(hold.AccountID, model.Currency(hold.Currency))).Scan(&available)
+		if errors.Is(err, pgx.ErrNoRows) {
+			available = "0"
+		} else if err != nil {
+			return err
+		}
+
+		if decimal.RequireFromString(available).LessThan(decimal.RequireFromString(hold.Amount)) {
+			return ErrInsufficientFunds
+		}
+
+		_, err = tx.Exec(ctx, InsertLedgerHoldQuery, hold.HoldID, hold.AccountID, hold.Amount, hold.Currency, model.LedgerHoldStatusHeldDAO)
+		if err != nil {
+			return err
+		}
+
+		return postLedgerEntry(ctx, tx, entry)
+	})
+}
+
+func (lr *LedgerRepository) AttachHold(ctx context.Context, holdID string, transactionID string) error {
+	_, err := lr.DB.Exec(ctx, AttachLedgerHoldQuery, holdID, transactionID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (lr *LedgerRepository) GetHold(ctx context.Context, holdID string) (model.LedgerHoldDAO, error) {
+	var hold model.LedgerHoldDAO
+	err := lr.DB.QueryRow(ctx, GetLedgerHoldQuery, holdID).Scan(&hold.HoldID, &hold.AccountID, &hold.Amount, &hold.Currency, &hold.TransactionID, &hold.Status, &hold.CreatedAt)
+	if err != nil {
+		return hold, err
+	}
+	return hold, nil
+}
+
+func (lr *LedgerRepository) GetTransactionHold(ctx context.Context, transactionID string) (model.LedgerHoldDAO, error) {
+	var hold model.LedgerHoldDAO
+	err := lr.DB.QueryRow(ctx, GetTransactionLedgerHoldQuery, transactionID).Scan(&hold.HoldID, &hold.AccountID, &hold.Amount, &hold.Currency, &hold.TransactionID, &hold.Status, &hold.CreatedAt)
+	if err != nil {
+		return hold, err
+	}
+	return hold, nil
+}
+
+func (lr *LedgerRepository) CloseHold(ctx context.Context, hold model.LedgerHoldDAO, status model.LedgerHoldStatusDAO, entry model.LedgerEntryDAO) error {
+	return inTransaction(ctx, lr.DB, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, CloseLedgerHoldQuery, hold.HoldID, status)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return nil
+		}
+
+		return postLedgerEntry(ctx, tx, entry)
+	})
+}
+
+func (lr *LedgerRepository) GetBalances(ctx context.Context, ledgerAccountIDs []string) (map[string]string, error) {
+	rows, err := lr.DB.Query(ctx, GetLedgerBalancesQuery, ledgerAccountIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := make(map[string]string, len(ledgerAccountIDs))
+	for rows.Next() {
+		var ledgerAccountID, balance string
+		if err := rows.Scan(&ledgerAccountID, &balance); err != nil {
+			return nil, err
+		}
+		balances[ledgerAccountID] = balance
+	}
+
+	return balances, rows.Err()
+}
+
+func postLedgerEntry(ctx context.Context, tx pgx.Tx, entry model.LedgerEntryDAO) error {
+	result, err := tx.Exec(ctx, InsertLedgerEntryQuery, entry.Reference, entry.TransactionID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		// already posted
+		return nil
+	}
+
+	for _, posting := range entry.Postings {
+		// the balance first, it creates the ledger account the posting refers to
+		if _, err := tx.Exec(ctx, UpdateLedgerBalanceQuery, posting.LedgerAccountID, posting.Amount); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, InsertLedgerPostingQuery, entry.Reference, posting.LedgerAccountID, posting.Amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package repository
+
+const (
+	GetAccountLimitsQuery = `SELECT account_id, type, currency, min_amount::text, max_amount::text, daily_amount::text, monthly_amount::text,
+	max_count, count_window_seconds FROM account_limits WHERE account_id = $1 AND type = $2`
+	// failed and reversed transactions moved no money, they only count towards the number of transactions
+	GetLimitUsageQuery = `SELECT
+	COALESCE(SUM(amount) FILTER (WHERE created_at >= $4 AND status NOT IN ('failed', 'reversed')), 0)::text,
+	COALESCE(SUM(amount) FILTER (WHERE created_at >= $5 AND status NOT IN ('failed', 'reversed')), 0)::text,
+	COUNT(*) FILTER (WHERE created_at >= $6)
+	FROM transactions WHERE account_id = $1 AND type = $2 AND currency = $3 AND created_at >= LEAST($4, $5, $6)`
+)
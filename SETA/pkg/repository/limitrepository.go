@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"seta/pkg/model"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type ILimitRepository interface {
+	// GetAccountLimits returns the limit overrides of the account for the transaction type, of every currency
+	GetAccountLimits(ctx context.Context, accountID string, transactionType model.TransactionTypeDAO) ([]model.AccountLimitDAO, error)
+	// GetUsage sums the transactions of the account of the type and currency created since dayStart and monthStart,
+	// and counts those created since countSince
+	GetUsage(ctx context.Context, accountID string, transactionType model.TransactionTypeDAO, currency string, dayStart time.Time, monthStart time.Time, countSince time.Time) (model.LimitUsageDAO, error)
+}
+
+type LimitRepository struct {
+	DB *pgxpool.Pool
+}
+
+func LimitRepositoryProvider(db *pgxpool.Pool) ILimitRepository {
+	return &LimitRepository{DB: db}
+}
+
+func (lr *LimitRepository) GetAccountLimits(ctx context.Context, accountID string, transactionType model.TransactionTypeDAO) ([]model.AccountLimitDAO, error) {
+	rows, err := lr.DB.Query(ctx, GetAccountLimitsQuery, accountID, transactionType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accountLimits []model.AccountLimitDAO
+	for rows.Next() {
+		var accountLimit model.AccountLimitDAO
+		err := rows.Scan(&accountLimit.AccountID, &accountLimit.Type, &accountLimit.Currency, &accountLimit.MinAmount, &accountLimit.MaxAmount,
+			&accountLimit.DailyAmount, &accountLimit.MonthlyAmount, &accountLimit.MaxCount, &accountLimit.CountWindowSeconds)
+		if err != nil {
+			return nil, err
+		}
+		accountLimits = append(accountLimits, accountLimit)
+	}
+	return accountLimits, rows.Err()
+}
+
+func (lr *LimitRepository) GetUsage(ctx context.Context, accountID string, transactionType model.TransactionTypeDAO, currency string, dayStart time.Time, monthStart time.Time, countSince time.Time) (model.LimitUsageDAO, error) {
+	var usage model.LimitUsageDAO
+	err := lr.DB.QueryRow(ctx, GetLimitUsageQuery, accountID, transactionType, currency, dayStart, monthStart, countSince).Scan(&usage.DailyAmount, &usage.MonthlyAmount, &usage.Count)
+	if err != nil {
+		return model.LimitUsageDAO{}, err
+	}
+	return usage, nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// MockCallbackRepository simulates a CallbackRepository for testing purposes
+type MockCallbackRepository struct {
+	Nonces        map[string]time.Time // by gateway name and nonce
+	ShouldFail    bool
+	ExpectedError error
+}
+
+func MockCallbackRepositoryProvider() *MockCallbackRepository {
+	return &MockCallbackRepository{Nonces: map[string]time.Time{}}
+}
+
+// SaveNonce simulates recording a nonce, returning false if it was already recorded
+func (m *MockCallbackRepository) SaveNonce(ctx context.Context, gatewayName string, nonce string, receivedAt time.Time) (bool, error) {
+	if m.ShouldFail {
+		return false, m.ExpectedError
+	}
+
+	key := gatewayName + "/" + nonce
+	if _, exists := m.Nonces[key]; exists {
+		return false, nil
+	}
+	m.Nonces[key] = receivedAt
+	return true, nil
+}
+
+// DeleteNonce simulates forgetting the nonce of a callback
+func (m *MockCallbackRepository) DeleteNonce(ctx context.Context, gatewayName string, nonce string) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+
+	delete(m.Nonces, gatewayName+"/"+nonce)
+	return nil
+}
+
+// DeleteNonces simulates forgetting old nonces
+func (m *MockCallbackRepository) DeleteNonces(ctx context.Context, receivedBefore time.Time) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+
+	for key, receivedAt := range m.Nonces {
+		if receivedAt.Before(receivedBefore) {
+			delete(m.Nonces, key)
+		}
+	}
+	return nil
+}
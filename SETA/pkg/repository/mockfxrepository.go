@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"seta/pkg/model"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// MockFXRepository simulates an FXRepository in memory for testing purposes
+type MockFXRepository struct {
+	Rates         []model.FXRateDAO
+	Quotes        map[string]model.FXQuoteDAO // by quote ID
+	ShouldFail    bool
+	ExpectedError error
+}
+
+func MockFXRepositoryProvider() *MockFXRepository {
+	return &MockFXRepository{Quotes: map[string]model.FXQuoteDAO{}}
+}
+
+// SaveRates simulates storing rates, a rate for the same pair and start replaces the previous one
+func (m *MockFXRepository) SaveRates(ctx context.Context, rates []model.FXRateDAO) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+
+	for _, rate := range rates {
+		replaced := false
+		for i, existing := range m.Rates {
+			if existing.FromCurrency == rate.FromCurrency && existing.ToCurrency == rate.ToCurrency && existing.ValidFrom.Equal(rate.ValidFrom) {
+				m.Rates[i] = rate
+				replaced = true
+			}
+		}
+		if !replaced {
+			m.Rates = append(m.Rates, rate)
+		}
+	}
+	return nil
+}
+
+// GetRate simulates reading the latest rate valid at the time, pgx.ErrNoRows when there is none
+func (m *MockFXRepository) GetRate(ctx context.Context, fromCurrency string, toCurrency string, at time.Time) (model.FXRateDAO, error) {
+	if m.ShouldFail {
+		return model.FXRateDAO{}, m.ExpectedError
+	}
+
+	var found *model.FXRateDAO
+	for i, rate := range m.Rates {
+		if rate.FromCurrency != fromCurrency || rate.ToCurrency != toCurrency || rate.ValidFrom.After(at) {
+			continue
+		}
+		if rate.ValidTo != nil && !rate.ValidTo.After(at) {
+			continue
+		}
+		if found == nil || rate.ValidFrom.After(found.ValidFrom) {
+			found = &m.Rates[i]
+		}
+	}
+
+	if found == nil {
+		return model.FXRateDAO{}, pgx.ErrNoRows
+	}
+	return *found, nil
+}
+
+// CreateQuote simulates storing a quote
+func (m *MockFXRepository) CreateQuote(ctx context.Context, quote model.FXQuoteDAO) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+
+	m.Quotes[quote.QuoteID] = quote
+	return nil
+}
+
+// GetQuote simulates reading a quote, pgx.ErrNoRows when there is none
+func (m *MockFXRepository) GetQuote(ctx context.Context, quoteID string) (model.FXQuoteDAO, error) {
+	if m.ShouldFail {
+		return model.FXQuoteDAO{}, m.ExpectedError
+	}
+
+	quote, ok := m.Quotes[quoteID]
+	if !ok {
+		return model.FXQuoteDAO{}, pgx.ErrNoRows
+	}
+	return quote, nil
+}
+
+// UseQuote simulates the compare-and-set on an unused quote that has not expired
+func (m *MockFXRepository) UseQuote(ctx context.Context, quoteID string, at time.Time) (bool, error) {
+	if m.ShouldFail {
+		return false, m.ExpectedError
+	}
+
+	quote, ok := m.Quotes[quoteID]
+	if !ok || quote.UsedAt != nil || !quote.ExpiresAt.After(at) {
+		return false, nil
+	}
+
+	quote.UsedAt = &at
+	m.Quotes[quoteID] = quote
+	return true, nil
+}
+
+// ReleaseQuote simulates making a quote usable again
+func (m *MockFXRepository) ReleaseQuote(ctx context.Context, quoteID string) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+
+	if quote, ok := m.Quotes[quoteID]; ok {
+		quote.UsedAt = nil
+		m.Quotes[quoteID] = quote
+	}
+	return nil
+}
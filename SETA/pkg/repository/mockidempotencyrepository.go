@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"seta/pkg/model"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// MockIdempotencyRepository simulates an IdempotencyRepository in memory for testing purposes
+type MockIdempotencyRepository struct {
+	Keys          map[string]model.IdempotencyKeyDAO // by key
+	ShouldFail    bool
+	ExpectedError error
+}
+
+func MockIdempotencyRepositoryProvider() *MockIdempotencyRepository {
+	return &MockIdempotencyRepository{Keys: map[string]model.IdempotencyKeyDAO{}}
+}
+
+// ClaimKey simulates recording a key, an expired key is claimed again
+func (m *MockIdempotencyRepository) ClaimKey(ctx context.Context, key string, requestHash string, at time.Time, expiresAt time.Time) (bool, error) {
+	if m.ShouldFail {
+		return false, m.ExpectedError
+	}
+
+	if existing, ok := m.Keys[key]; ok && existing.ExpiresAt.After(at) {
+		return false, nil
+	}
+	m.Keys[key] = model.IdempotencyKeyDAO{Key: key, RequestHash: requestHash, ExpiresAt: expiresAt}
+	return true, nil
+}
+
+// GetKey simulates reading a key, returning pgx.ErrNoRows when there is none
+func (m *MockIdempotencyRepository) GetKey(ctx context.Context, key string) (model.IdempotencyKeyDAO, error) {
+	if m.ShouldFail {
+		return model.IdempotencyKeyDAO{}, m.ExpectedError
+	}
+
+	keyDAO, ok := m.Keys[key]
+	if !ok {
+		return model.IdempotencyKeyDAO{}, pgx.ErrNoRows
+	}
+	return keyDAO, nil
+}
+
+// CompleteKey simulates storing the response of a key
+func (m *MockIdempotencyRepository) CompleteKey(ctx context.Context, key string, statusCode int, response []byte) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+
+	if keyDAO, ok := m.Keys[key]; ok {
+		keyDAO.StatusCode = statusCode
+		keyDAO.Response = response
+		m.Keys[key] = keyDAO
+	}
+	return nil
+}
+
+// ReleaseKey simulates forgetting a key whose request is still in flight
+func (m *MockIdempotencyRepository) ReleaseKey(ctx context.Context, key string) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+
+	if keyDAO, ok := m.Keys[key]; ok && keyDAO.StatusCode == 0 {
+		delete(m.Keys, key)
+	}
+	return nil
+}
+
+// DeleteExpiredKeys simulates forgetting the expired keys
+func (m *MockIdempotencyRepository) DeleteExpiredKeys(ctx context.Context, at time.Time) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+
+	for key, keyDAO := range m.Keys {
+		if !keyDAO.ExpiresAt.After(at) {
+			delete(m.Keys, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"seta/pkg/model"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shopspring/decimal"
+)
+
+// MockLedgerRepository simulates a LedgerRepository in memory for testing purposes
+type MockLedgerRepository struct {
+	Balances      map[string]decimal.Decimal      // by ledger account ID
+	Entries       map[string]model.LedgerEntryDAO // by reference
+	Holds         map[string]model.LedgerHoldDAO  // by hold ID
+	ShouldFail    bool
+	ExpectedError error
+}
+
+func MockLedgerRepositoryProvider() *MockLedgerRepository {
+	return &MockLedgerRepository{
+		Balances: map[string]decimal.Decimal{},
+		Entries:  map[string]model.LedgerEntryDAO{},
+		Holds:    map[string]model.LedgerHoldDAO{},
+	}
+}
+
+// Post simulates posting an entry, an entry whose reference was already posted is skipped
+func (m *MockLedgerRepository) Post(ctx context.Context, entry model.LedgerEntryDAO) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+
+	m.post(entry)
+	return nil
+}
+
+// CreateHold simulates holding an amount, failing with ErrInsufficientFunds when the available balance is lower
+func (m *MockLedgerRepository) CreateHold(ctx context.Context, hold model.LedgerHoldDAO, entry model.LedgerEntryDAO) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+	if m.Balances[model.AvailableLedgerAccount(hold.AccountID, model.Currency(hold.Currency))].LessThan(decimal.RequireFromString(hold.Amount)) {
+		return ErrInsufficientFunds
+	}
+
+	hold.Status = model.LedgerHoldStatusHeldDAO
+	m.Holds[hold.HoldID] = hold
+	m.post(entry)
+	return nil
+}
+
+// AttachHold simulates linking a hold to its transaction
+func (m *MockLedgerRepository) AttachHold(ctx context.Context, holdID string, transactionID string) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+
+	if hold, ok := m.Holds[holdID]; ok {
+		hold.TransactionID = transactionID
+		m.Holds[holdID] = hold
+	}
+	return nil
+}
+
+// GetHold simulates reading a hold, pgx.ErrNoRows when there is none
+func (m *MockLedgerRepository) GetHold(ctx context.Context, holdID string) (model.LedgerHoldDAO, error) {
+	if m.ShouldFail {
+		return model.LedgerHoldDAO{}, m.ExpectedError
+	}
+
+	hold, ok := m.Holds[holdID]
+	if !ok {
+		return model.LedgerHoldDAO{}, pgx.ErrNoRows
+	}
+	return hold, nil
+}
+
+// GetTransactionHold simulates reading the hold of a transaction, pgx.ErrNoRows when there is none
+func (m *MockLedgerRepository) GetTransactionHold(ctx context.Context, transactionID string) (model.LedgerHoldDAO, error) {
+	if m.ShouldFail {
+		return model.LedgerHoldDAO{}, m.ExpectedError
+	}
+
+	for _, hold := range m.Holds {
+		if hold.TransactionID == transactionID {
+			return hold, nil
+		}
+	}
+	return model.LedgerHoldDAO{}, pgx.ErrNoRows
+}
+
+// CloseHold simulates capturing or releasing a hold, a hold that is already closed is left as is
+func (m *MockLedgerRepository) CloseHold(ctx context.Context, hold model.LedgerHoldDAO, status model.LedgerHoldStatusDAO, entry model.LedgerEntryDAO) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+
+	current, ok := m.Holds[hold.HoldID]
+	if !ok || current.Status != model.LedgerHoldStatusHeldDAO {
+		return nil
+	}
+
+	current.Status = status
+	m.Holds[hold.HoldID] = current
+	m.post(entry)
+	return nil
+}
+
+// GetBalances simulates reading balances, the ledger accounts without postings are left out
+func (m *MockLedgerRepository) GetBalances(ctx context.Context, ledgerAccountIDs []string) (map[string]string, error) {
+	if m.ShouldFail {
+		return nil, m.ExpectedError
+	}
+
+	balances := map[string]string{}
+	for _, ledgerAccountID := range ledgerAccountIDs {
+		if balance, ok := m.Balances[ledgerAccountID]; ok {
+			balances[ledgerAccountID] = balance.String()
+		}
+	}
+	return balances, nil
+}
+
+func (m *MockLedgerRepository) post(entry model.LedgerEntryDAO) {
+	if _, posted := m.Entries[entry.Reference]; posted {
+		return
+	}
+
+	m.Entries[entry.Reference] = entry
+	for _, posting := range entry.Postings {
+		m.Balances[posting.LedgerAccountID] = m.Balances[posting.LedgerAccountID].Add(decimal.RequireFromString(posting.Amount))
+	}
+}
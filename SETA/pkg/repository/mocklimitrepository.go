@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"seta/pkg/model"
+	"time"
+)
+
+// MockLimitRepository simulates a LimitRepository for testing purposes
+type MockLimitRepository struct {
+	AccountLimits []model.AccountLimitDAO
+	Usage         model.LimitUsageDAO // returned by GetUsage, no usage when empty
+	ShouldFail    bool
+	ExpectedError error
+}
+
+func MockLimitRepositoryProvider() *MockLimitRepository {
+	return &MockLimitRepository{}
+}
+
+// GetAccountLimits simulates reading the overrides of an account for a transaction type
+func (m *MockLimitRepository) GetAccountLimits(ctx context.Context, accountID string, transactionType model.TransactionTypeDAO) ([]model.AccountLimitDAO, error) {
+	if m.ShouldFail {
+		return nil, m.ExpectedError
+	}
+
+	var accountLimits []model.AccountLimitDAO
+	for _, accountLimit := range m.AccountLimits {
+		if accountLimit.AccountID == accountID && accountLimit.Type == transactionType {
+			accountLimits = append(accountLimits, accountLimit)
+		}
+	}
+	return accountLimits, nil
+}
+
+// GetUsage simulates summing the transactions of an account, it returns Usage whatever the windows
+func (m *MockLimitRepository) GetUsage(ctx context.Context, accountID string, transactionType model.TransactionTypeDAO, currency string, dayStart time.Time, monthStart time.Time, countSince time.Time) (model.LimitUsageDAO, error) {
+	if m.ShouldFail {
+		return model.LimitUsageDAO{}, m.ExpectedError
+	}
+
+	usage := m.Usage
+	if usage.DailyAmount == "" {
+		usage.DailyAmount = "0"
+	}
+	if usage.MonthlyAmount == "" {
+		usage.MonthlyAmount = "0"
+	}
+	return usage, nil
+}
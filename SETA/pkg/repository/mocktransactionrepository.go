@@ -4,13 +4,22 @@ import (
 	"context"
 	"errors"
 	"seta/pkg/model"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/shopspring/decimal"
 )
 
 // MockTransactionRepository simulates a TransactionRepository for testing purposes
 type MockTransactionRepository struct {
-	Transaction   *model.TransactionDAO
-	ShouldFail    bool
-	ExpectedError error
+	Transaction    *model.TransactionDAO
+	ShouldFail     bool
+	ExpectedError  error
+	RefundedAmount string                          // returned by GetRefundedAmount, "0" when empty
+	Transactions   map[string]model.TransactionDAO // the transactions created before the current one, by ID
+	Events         []model.TransactionEventDAO     // the events recorded, of every transaction
+	Activity       model.AccountActivityDAO        // returned by GetAccountActivity, no activity when empty
 }
 
 // NewMockTransactionRepository initializes the mock with an empty transactions map
@@ -23,32 +32,318 @@ func MockTransactionRepositoryProvider(transaction *model.TransactionDAO, should
 }
 
 // CreateTransaction simulates creating a transaction, optionally failing based on configuration
-func (m *MockTransactionRepository) CreateTransaction(ctx context.Context, transaction model.TransactionDAO) error {
+func (m *MockTransactionRepository) CreateTransaction(ctx context.Context, transaction model.TransactionDAO, events ...model.TransactionEventDAO) error {
 	if m.ShouldFail {
 		return m.ExpectedError
 	}
+	m.Events = append(m.Events, events...)
+	if m.Transaction != nil {
+		if m.Transactions == nil {
+			m.Transactions = map[string]model.TransactionDAO{}
+		}
+		m.Transactions[m.Transaction.TransactionID] = *m.Transaction
+	}
 	m.Transaction = &transaction
 	return nil
 }
 
+// ReserveRefund simulates reserving a refund against the mock transaction, the refund then counts in RefundedAmount
+func (m *MockTransactionRepository) ReserveRefund(ctx context.Context, refund model.TransactionDAO, events ...model.TransactionEventDAO) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+	parent, err := m.GetTransaction(ctx, refund.ParentTransactionID)
+	if err != nil {
+		return err
+	}
+
+	refunded := decimal.Zero
+	if m.RefundedAmount != "" {
+		refunded = decimal.RequireFromString(m.RefundedAmount)
+	}
+	amount := decimal.RequireFromString(refund.Amount)
+	if amount.GreaterThan(decimal.RequireFromString(parent.Amount).Sub(refunded)) {
+		return ErrRefundExceedsRemaining
+	}
+
+	m.RefundedAmount = refunded.Add(amount).String()
+	return m.CreateTransaction(ctx, refund, events...)
+}
+
+// CompleteTransaction simulates recording the outcome of an initiated transaction, its attempts are kept with it
+func (m *MockTransactionRepository) CompleteTransaction(ctx context.Context, transaction model.TransactionDAO, events ...model.TransactionEventDAO) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+	if m.Transaction != nil && m.Transaction.TransactionID == transaction.TransactionID && m.Transaction.Status == model.TransactionStatusInitiatedDAO {
+		m.Transaction = &transaction
+		m.Events = append(m.Events, events...)
+		return nil
+	}
+	if previous, ok := m.Transactions[transaction.TransactionID]; ok && previous.Status == model.TransactionStatusInitiatedDAO {
+		m.Transactions[transaction.TransactionID] = transaction
+		m.Events = append(m.Events, events...)
+		return nil
+	}
+
+	return ErrTransactionStatusChanged
+}
+
 // GetTransaction simulates retrieving a transaction, returning an error if ShouldFail is set
 func (m *MockTransactionRepository) GetTransaction(ctx context.Context, transactionID string) (model.TransactionDAO, error) {
 	if m.ShouldFail {
 		return model.TransactionDAO{}, m.ExpectedError
 	}
-	if m.Transaction == nil || m.Transaction.TransactionID != transactionID {
-		return model.TransactionDAO{}, errors.New("transaction not found")
+	if m.Transaction != nil && m.Transaction.TransactionID == transactionID {
+		return *m.Transaction, nil
+	}
+	if transaction, ok := m.Transactions[transactionID]; ok {
+		return transaction, nil
+	}
+
+	return model.TransactionDAO{}, errors.New("transaction not found")
+}
+
+// GetAccountTransaction simulates retrieving a transaction of the account
+func (m *MockTransactionRepository) GetAccountTransaction(ctx context.Context, accountID string, transactionID string) (model.TransactionDAO, error) {
+	transaction, err := m.GetTransaction(ctx, transactionID)
+	if err != nil {
+		return model.TransactionDAO{}, err
+	}
+	if transaction.AccountID != accountID {
+		return model.TransactionDAO{}, pgx.ErrNoRows
 	}
 
-	return *m.Transaction, nil
+	return transaction, nil
 }
 
-// UpdateTransaction simulates updating a transaction, returning an error if ShouldFail is set
-func (m *MockTransactionRepository) UpdateTransaction(ctx context.Context, transaction model.TransactionDAO) error {
+// GetTransactionByGatewayReference simulates looking a transaction up by the gateway that processed it and its reference
+func (m *MockTransactionRepository) GetTransactionByGatewayReference(ctx context.Context, gatewayName string, gatewayReference string) (model.TransactionDAO, error) {
+	if m.ShouldFail {
+		return model.TransactionDAO{}, m.ExpectedError
+	}
+	if m.Transaction != nil && m.Transaction.GatewayName == gatewayName && m.Transaction.GatewayReference == gatewayReference {
+		return *m.Transaction, nil
+	}
+	for _, transaction := range m.Transactions {
+		if transaction.GatewayName == gatewayName && transaction.GatewayReference == gatewayReference {
+			return transaction, nil
+		}
+	}
+
+	return model.TransactionDAO{}, pgx.ErrNoRows
+}
+
+// UpdateTransaction simulates the compare-and-set of a transaction status, returning an error if ShouldFail is set
+func (m *MockTransactionRepository) UpdateTransaction(ctx context.Context, transaction model.TransactionDAO, currentStatus model.TransactionStatusDAO, event model.TransactionEventDAO) error {
 	if m.ShouldFail {
 		return m.ExpectedError
 	}
+	if m.Transaction != nil && m.Transaction.TransactionID == transaction.TransactionID {
+		if m.Transaction.Status != currentStatus {
+			return ErrTransactionStatusChanged
+		}
+		m.Transaction = &transaction
+		m.Events = append(m.Events, event)
+		return nil
+	}
+	if previous, ok := m.Transactions[transaction.TransactionID]; ok && previous.Status == currentStatus {
+		m.Transactions[transaction.TransactionID] = transaction
+		m.Events = append(m.Events, event)
+		return nil
+	}
 
-	m.Transaction = &transaction
+	return ErrTransactionStatusChanged
+}
+
+// GetRefundedAmount simulates summing the refunds of a transaction, returning an error if ShouldFail is set
+func (m *MockTransactionRepository) GetRefundedAmount(ctx context.Context, transactionID string) (string, error) {
+	if m.ShouldFail {
+		return "", m.ExpectedError
+	}
+	if m.RefundedAmount == "" {
+		return "0", nil
+	}
+
+	return m.RefundedAmount, nil
+}
+
+// GetSettledRefundedAmount simulates summing the refunds of a transaction that succeeded: RefundedAmount less the
+// recorded refunds of the transaction that did not succeed
+func (m *MockTransactionRepository) GetSettledRefundedAmount(ctx context.Context, transactionID string) (string, error) {
+	refunded, err := m.GetRefundedAmount(ctx, transactionID)
+	if err != nil {
+		return "", err
+	}
+
+	transactions := make([]model.TransactionDAO, 0, len(m.Transactions)+1)
+	for _, transaction := range m.Transactions {
+		transactions = append(transactions, transaction)
+	}
+	if m.Transaction != nil {
+		transactions = append(transactions, *m.Transaction)
+	}
+
+	settled := decimal.RequireFromString(refunded)
+	for _, transaction := range transactions {
+		if transaction.ParentTransactionID == transactionID && transaction.Status != model.TransactionStatusSuccessDAO {
+			settled = settled.Sub(decimal.RequireFromString(transaction.Amount))
+		}
+	}
+	return settled.String(), nil
+}
+
+// GetPendingTransactions simulates listing pending transactions, the mock transaction is returned while it is pending or unknown
+func (m *MockTransactionRepository) GetPendingTransactions(ctx context.Context, createdAfter time.Time, createdBefore time.Time, limit int) ([]model.TransactionDAO, error) {
+	if m.ShouldFail {
+		return nil, m.ExpectedError
+	}
+	if m.Transaction == nil || (m.Transaction.Status != model.TransactionStatusPendingDAO && m.Transaction.Status != model.TransactionStatusUnknownDAO) {
+		return nil, nil
+	}
+
+	return []model.TransactionDAO{*m.Transaction}, nil
+}
+
+// GetInitiatedTransactions simulates listing the intents, the mock transaction is returned while it is initiated
+func (m *MockTransactionRepository) GetInitiatedTransactions(ctx context.Context, createdBefore time.Time, limit int) ([]model.TransactionDAO, error) {
+	if m.ShouldFail {
+		return nil, m.ExpectedError
+	}
+	if m.Transaction == nil || m.Transaction.Status != model.TransactionStatusInitiatedDAO {
+		return nil, nil
+	}
+
+	return []model.TransactionDAO{*m.Transaction}, nil
+}
+
+// GetUnpostedTransactions simulates listing the transactions to post, the mock has no ledger so the mock transaction is
+// returned once it settled or failed
+func (m *MockTransactionRepository) GetUnpostedTransactions(ctx context.Context, updatedAfter time.Time, updatedBefore time.Time, limit int) ([]model.TransactionDAO, error) {
+	if m.ShouldFail {
+		return nil, m.ExpectedError
+	}
+	if m.Transaction == nil {
+		return nil, nil
+	}
+
+	switch m.Transaction.Status {
+	case model.TransactionStatusSuccessDAO, model.TransactionStatusPartiallyRefundedDAO, model.TransactionStatusRefundedDAO, model.TransactionStatusFailedDAO, model.TransactionStatusReversedDAO:
+		return []model.TransactionDAO{*m.Transaction}, nil
+	}
+	return nil, nil
+}
+
+// ListTransactions simulates the listing over the mock transaction and the transactions created before it
+func (m *MockTransactionRepository) ListTransactions(ctx context.Context, filter model.TransactionFilterDAO) ([]model.TransactionDAO, error) {
+	if m.ShouldFail {
+		return nil, m.ExpectedError
+	}
+
+	transactions := make([]model.TransactionDAO, 0, len(m.Transactions)+1)
+	for _, transaction := range m.Transactions {
+		transactions = append(transactions, transaction)
+	}
+	if m.Transaction != nil {
+		transactions = append(transactions, *m.Transaction)
+	}
+
+	// before reports whether a comes before b in the order of the listing
+	before := func(a model.TransactionCursorDAO, b model.TransactionCursorDAO) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt) != filter.Descending
+		}
+		return a.ID != b.ID && (a.ID < b.ID) != filter.Descending
+	}
+	position := func(transaction model.TransactionDAO) model.TransactionCursorDAO {
+		return model.TransactionCursorDAO{CreatedAt: transaction.CreatedAt, ID: transaction.ID}
+	}
+	sort.Slice(transactions, func(i, j int) bool { return before(position(transactions[i]), position(transactions[j])) })
+
+	var listed []model.TransactionDAO
+	for _, transaction := range transactions {
+		amount := decimal.RequireFromString(transaction.Amount)
+		switch {
+		case filter.AccountID != "" && transaction.AccountID != filter.AccountID,
+			filter.Status != "" && transaction.Status != filter.Status,
+			filter.Type != "" && transaction.Type != filter.Type,
+			filter.GatewayName != "" && transaction.GatewayName != filter.GatewayName,
+			filter.MinAmount != "" && amount.LessThan(decimal.RequireFromString(filter.MinAmount)),
+			filter.MaxAmount != "" && amount.GreaterThan(decimal.RequireFromString(filter.MaxAmount)),
+			filter.CreatedFrom != nil && transaction.CreatedAt.Before(*filter.CreatedFrom),
+			filter.CreatedTo != nil && !transaction.CreatedAt.Before(*filter.CreatedTo),
+			filter.After != nil && !before(*filter.After, position(transaction)):
+			continue
+		}
+		if len(listed) == filter.Limit {
+			break
+		}
+		listed = append(listed, transaction)
+	}
+
+	return listed, nil
+}
+
+// CreateTransactionEvent simulates recording an event, returning an error if ShouldFail is set
+func (m *MockTransactionRepository) CreateTransactionEvent(ctx context.Context, event model.TransactionEventDAO) error {
+	if m.ShouldFail {
+		return m.ExpectedError
+	}
+
+	m.Events = append(m.Events, event)
 	return nil
 }
+
+// GetTransactionEvents simulates reading the history of a transaction from the recorded events
+func (m *MockTransactionRepository) GetTransactionEvents(ctx context.Context, transactionID string) ([]model.TransactionEventDAO, error) {
+	if m.ShouldFail {
+		return nil, m.ExpectedError
+	}
+
+	var events []model.TransactionEventDAO
+	for _, event := range m.Events {
+		if event.TransactionID == transactionID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// GetRiskHits simulates reading the risk hits stored with a transaction
+func (m *MockTransactionRepository) GetRiskHits(ctx context.Context, transactionID string) ([]model.RiskHitDAO, error) {
+	if m.ShouldFail {
+		return nil, m.ExpectedError
+	}
+
+	transaction, err := m.GetTransaction(ctx, transactionID)
+	if err != nil {
+		return nil, nil
+	}
+	return transaction.RiskHits, nil
+}
+
+// GetTransactionAttempts simulates reading the gateway attempts stored with a transaction
+func (m *MockTransactionRepository) GetTransactionAttempts(ctx context.Context, transactionID string) ([]model.TransactionAttemptDAO, error) {
+	if m.ShouldFail {
+		return nil, m.ExpectedError
+	}
+
+	transaction, err := m.GetTransaction(ctx, transactionID)
+	if err != nil {
+		return nil, nil
+	}
+	return transaction.Attempts, nil
+}
+
+// GetAccountActivity simulates reading the activity of an account, it returns Activity whatever the account
+func (m *MockTransactionRepository) GetAccountActivity(ctx context.Context, accountID string, currency string, transactionType model.TransactionTypeDAO, failuresSince time.Time) (model.AccountActivityDAO, error) {
+	if m.ShouldFail {
+		return model.AccountActivityDAO{}, m.ExpectedError
+	}
+
+	activity := m.Activity
+	if activity.AverageAmount == "" {
+		activity.AverageAmount = "0"
+	}
+	return activity, nil
+}
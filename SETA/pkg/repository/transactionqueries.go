@@ -1,9 +1,146 @@
 package repository
 
+import (
+	"fmt"
+	"seta/pkg/model"
+	"strings"
+)
+
+// transactionColumns are the columns scanned by scanTransaction, in order. The transactions stored before SETA gave
+// them IDs of their own have the ID their gateway gave them
+const transactionColumns = `account_id, transaction_id, amount, currency, status, type, gateway_name,
+	COALESCE(gateway_reference, CASE WHEN gateway_name <> '' THEN transaction_id END, ''), gateway_response, COALESCE(parent_transaction_id, ''),
+	COALESCE(converted_amount::text, ''), COALESCE(converted_currency, ''), COALESCE(fx_rate::text, ''), COALESCE(fx_quote_id::text, ''),
+	id::text, created_at`
+
 const (
-	InsertTransactionQuery = `INSERT INTO transactions (account_id, transaction_id, amount, status, type)
-	VALUES ($1, $2, $3, $4, $5)
-	ON CONFLICT (account_id, transaction_id) DO UPDATE SET status = $4`
-	GetTransactionQuery    = "SELECT account_id, transaction_id, amount, status, type FROM transactions WHERE transaction_id = $1"
-	UpdateTransactionQuery = "UPDATE transactions SET status = $3 WHERE account_id = $1 AND transaction_id = $2"
+	InsertTransactionQuery = `INSERT INTO transactions (account_id, transaction_id, amount, currency, status, type, gateway_name, parent_transaction_id,
+	converted_amount, converted_currency, fx_rate, fx_quote_id, gateway_reference, gateway_response)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, '')::numeric, NULLIF($10, ''), NULLIF($11, '')::numeric, NULLIF($12, '')::uuid,
+	NULLIF($13, ''), $14::jsonb)
+	ON CONFLICT (account_id, transaction_id) DO UPDATE SET status = $5`
+	// transaction IDs are only unique per account, the IDs gateways gave legacy rows can be shared by accounts
+	GetTransactionQuery = `SELECT ` + transactionColumns + `
+	FROM transactions WHERE transaction_id = $1 LIMIT 2`
+	GetAccountTransactionQuery = `SELECT ` + transactionColumns + `
+	FROM transactions WHERE account_id = $1 AND transaction_id = $2`
+	GetTransactionByGatewayReferenceQuery = `SELECT ` + transactionColumns + `
+	FROM transactions WHERE gateway_name = $1 AND COALESCE(gateway_reference, transaction_id) = $2
+	ORDER BY created_at DESC LIMIT 1`
+	// oldest first, so that a backlog is worked through in order
+	GetPendingTransactionsQuery = `SELECT ` + transactionColumns + `
+	FROM transactions WHERE status IN ('pending', 'unknown') AND gateway_name <> '' AND created_at BETWEEN $1 AND $2
+	ORDER BY created_at LIMIT $3`
+	// the intents no outcome was recorded for, oldest first
+	GetInitiatedTransactionsQuery = `SELECT ` + transactionColumns + `
+	FROM transactions WHERE status = 'initiated' AND created_at < $1
+	ORDER BY created_at LIMIT $2`
+	// the settled transactions whose posting is missing: a deposit or a refund without its entry, or a transaction
+	// whose hold is still open
+	GetUnpostedTransactionsQuery = `SELECT ` + transactionColumns + `
+	FROM transactions t WHERE updated_at BETWEEN $1 AND $2 AND (
+		(type = 'deposit' AND status IN ('success', 'partially_refunded', 'refunded')
+			AND NOT EXISTS (SELECT 1 FROM ledger_entries WHERE reference = 'deposit:' || t.transaction_id))
+		OR (type = 'refund' AND status = 'success'
+			AND NOT EXISTS (SELECT 1 FROM ledger_entries WHERE reference = 'refund:' || t.transaction_id)
+			AND NOT EXISTS (SELECT 1 FROM ledger_holds WHERE transaction_id = t.transaction_id))
+		OR (status IN ('success', 'partially_refunded', 'refunded', 'failed', 'reversed')
+			AND EXISTS (SELECT 1 FROM ledger_holds WHERE transaction_id = t.transaction_id AND status = 'held')))
+	ORDER BY updated_at LIMIT $3`
+	// completed by listTransactionsQuery with the conditions of the filter
+	ListTransactionsQuery = `SELECT ` + transactionColumns + `
+	FROM transactions`
+	// compare-and-set, the status only changes if it is still the one the update was decided on
+	UpdateTransactionQuery = `UPDATE transactions SET status = $4, gateway_reference = COALESCE(NULLIF($5, ''), gateway_reference), updated_at = now()
+	WHERE account_id = $1 AND transaction_id = $2 AND status = $3`
+	// only applies to an intent, whose outcome is recorded once
+	CompleteTransactionQuery = `UPDATE transactions SET status = $3, gateway_name = $4, gateway_reference = NULLIF($5, ''), gateway_response = $6::jsonb,
+	updated_at = now()
+	WHERE account_id = $1 AND transaction_id = $2 AND status = 'initiated'`
+	// locks the refunded transaction, its refunds are reserved one after the other
+	LockTransactionAmountQuery = `SELECT amount::text FROM transactions WHERE account_id = $1 AND transaction_id = $2 FOR UPDATE`
+	// refunds and reversals that have not failed count against the amount left to refund
+	GetRefundedAmountQuery = `SELECT COALESCE(SUM(amount), 0)::text FROM transactions
+	WHERE parent_transaction_id = $1 AND type IN ('refund', 'reversal') AND status <> 'failed'`
+	// only the refunds and reversals that succeeded are taken off the transaction
+	GetSettledRefundedAmountQuery = `SELECT COALESCE(SUM(amount), 0)::text FROM transactions
+	WHERE parent_transaction_id = $1 AND type IN ('refund', 'reversal') AND status = 'success'`
+	InsertTransactionEventQuery = `INSERT INTO transaction_events (transaction_id, account_id, type, source, previous_status, status, detail, payload_reference)
+	VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''))`
+	InsertRiskHitQuery = `INSERT INTO transaction_risk_hits (transaction_id, account_id, rule, decision, reason) VALUES ($1, $2, $3, $4, $5)`
+	GetRiskHitsQuery   = `SELECT transaction_id, account_id, rule, decision, reason FROM transaction_risk_hits WHERE transaction_id = $1 ORDER BY created_at`
+	// the activity of an account in a currency the risk rules are evaluated against, $3 is the type being assessed
+	GetAccountActivityQuery = `SELECT
+	COUNT(*) FILTER (WHERE type = 'withdraw' AND status <> 'failed'),
+	MAX(created_at) FILTER (WHERE type = 'deposit' AND status <> 'failed'),
+	COUNT(*) FILTER (WHERE type = $3 AND status IN ('success', 'partially_refunded', 'refunded')),
+	COALESCE(AVG(amount) FILTER (WHERE type = $3 AND status IN ('success', 'partially_refunded', 'refunded')), 0)::text,
+	COUNT(*) FILTER (WHERE status = 'failed' AND created_at >= $4)
+	FROM transactions WHERE account_id = $1 AND currency = $2`
+	// in the order they happened, clock_timestamp keeps the events written in one database transaction apart
+	GetTransactionEventsQuery = `SELECT transaction_id, account_id, type, source, COALESCE(previous_status, ''), COALESCE(status, ''),
+	COALESCE(detail, ''), COALESCE(payload_reference, ''), created_at
+	FROM transaction_events WHERE transaction_id = $1 ORDER BY created_at`
+	InsertTransactionAttemptQuery = `INSERT INTO transaction_attempts (transaction_id, account_id, gateway_name, started_at, ended_at, latency_ms,
+	status_code, error_category, error, request_fingerprint, response_fingerprint)
+	VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NULLIF($8, ''), NULLIF($9, ''), $10, NULLIF($11, ''))`
+	// in the order the gateways were called
+	GetTransactionAttemptsQuery = `SELECT transaction_id, account_id, gateway_name, started_at, ended_at, latency_ms,
+	COALESCE(status_code, 0), COALESCE(error_category, ''), COALESCE(error, ''), request_fingerprint, COALESCE(response_fingerprint, '')
+	FROM transaction_attempts WHERE transaction_id = $1 ORDER BY started_at`
 )
+
+// listTransactionsQuery adds the conditions of the filter to ListTransactionsQuery. The transactions are ordered by
+// (created_at, id), which the indexes of the listing cover, so a page starts right after the last row of the previous
+// one however many rows were inserted meanwhile
+func listTransactionsQuery(filter model.TransactionFilterDAO) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.AccountID != "" {
+		where("account_id = $%d", filter.AccountID)
+	}
+	if filter.Status != "" {
+		where("status = $%d", filter.Status)
+	}
+	if filter.Type != "" {
+		where("type = $%d", filter.Type)
+	}
+	if filter.GatewayName != "" {
+		where("gateway_name = $%d", filter.GatewayName)
+	}
+	if filter.MinAmount != "" {
+		where("amount >= $%d::numeric", filter.MinAmount)
+	}
+	if filter.MaxAmount != "" {
+		where("amount <= $%d::numeric", filter.MaxAmount)
+	}
+	if filter.CreatedFrom != nil {
+		where("created_at >= $%d", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		where("created_at < $%d", *filter.CreatedTo)
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.After != nil {
+		args = append(args, filter.After.CreatedAt, filter.After.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) %s ($%d::timestamp, $%d::uuid)", comparison, len(args)-1, len(args)))
+	}
+
+	query := ListTransactionsQuery
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY created_at %s, id %s LIMIT $%d", direction, direction, len(args))
+
+	return query, args
+}
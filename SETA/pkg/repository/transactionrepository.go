@@ -2,15 +2,66 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"seta/pkg/model"
+	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/shopspring/decimal"
 )
 
+// ErrTransactionStatusChanged is returned by UpdateTransaction when the transaction is no longer in the expected status
+var ErrTransactionStatusChanged = errors.New("transaction status changed concurrently")
+
+// ErrRefundExceedsRemaining is returned by ReserveRefund when the refund is more than what is left to refund
+var ErrRefundExceedsRemaining = errors.New("refund exceeds the amount left to refund")
+
+// ErrAmbiguousTransaction is returned by GetTransaction when several accounts have a transaction with the ID
+var ErrAmbiguousTransaction = errors.New("transaction ID is used by several accounts")
+
 type ITransactionRepository interface {
-	CreateTransaction(ctx context.Context, transaction model.TransactionDAO) error
+	// CreateTransaction records the transaction, its risk hits, its gateway attempts and its events in a single database
+	// transaction
+	CreateTransaction(ctx context.Context, transaction model.TransactionDAO, events ...model.TransactionEventDAO) error
+	// CompleteTransaction records the outcome of an initiated transaction: its status, gateway and gateway response, with
+	// its gateway attempts and events. ErrTransactionStatusChanged when it is no longer initiated
+	CompleteTransaction(ctx context.Context, transaction model.TransactionDAO, events ...model.TransactionEventDAO) error
+	// ReserveRefund records an initiated refund if its amount is left to refund of its parent transaction, which is
+	// locked meanwhile. ErrRefundExceedsRemaining otherwise
+	ReserveRefund(ctx context.Context, refund model.TransactionDAO, events ...model.TransactionEventDAO) error
+	// GetTransaction returns the transaction with the ID, ErrAmbiguousTransaction when several accounts have one
 	GetTransaction(ctx context.Context, transactionID string) (model.TransactionDAO, error)
-	UpdateTransaction(ctx context.Context, transaction model.TransactionDAO) error
+	GetAccountTransaction(ctx context.Context, accountID string, transactionID string) (model.TransactionDAO, error)
+	// GetTransactionByGatewayReference returns the transaction the gateway gave the reference to
+	GetTransactionByGatewayReference(ctx context.Context, gatewayName string, gatewayReference string) (model.TransactionDAO, error)
+	// UpdateTransaction sets the status of the transaction, and its gateway reference when it has one, if it is still
+	// currentStatus, ErrTransactionStatusChanged otherwise. The event is recorded in the same database transaction, so
+	// only when the status changed
+	UpdateTransaction(ctx context.Context, transaction model.TransactionDAO, currentStatus model.TransactionStatusDAO, event model.TransactionEventDAO) error
+	CreateTransactionEvent(ctx context.Context, event model.TransactionEventDAO) error
+	// GetTransactionEvents returns the history of a transaction, oldest first
+	GetTransactionEvents(ctx context.Context, transactionID string) ([]model.TransactionEventDAO, error)
+	// GetTransactionAttempts returns the gateway attempts stored with a transaction, in the order they were made
+	GetTransactionAttempts(ctx context.Context, transactionID string) ([]model.TransactionAttemptDAO, error)
+	GetRefundedAmount(ctx context.Context, transactionID string) (string, error)
+	// GetSettledRefundedAmount returns the total amount of the refunds or reversals of a transaction that succeeded
+	GetSettledRefundedAmount(ctx context.Context, transactionID string) (string, error)
+	// GetPendingTransactions returns up to limit pending or unknown transactions created between createdAfter and createdBefore, oldest first
+	GetPendingTransactions(ctx context.Context, createdAfter time.Time, createdBefore time.Time, limit int) ([]model.TransactionDAO, error)
+	// GetInitiatedTransactions returns up to limit initiated transactions created before createdBefore, oldest first
+	GetInitiatedTransactions(ctx context.Context, createdBefore time.Time, limit int) ([]model.TransactionDAO, error)
+	// GetUnpostedTransactions returns up to limit transactions updated between updatedAfter and updatedBefore whose
+	// ledger posting is missing, oldest first
+	GetUnpostedTransactions(ctx context.Context, updatedAfter time.Time, updatedBefore time.Time, limit int) ([]model.TransactionDAO, error)
+	// ListTransactions returns up to filter.Limit transactions matching the filter, after filter.After in the order of
+	// the listing
+	ListTransactions(ctx context.Context, filter model.TransactionFilterDAO) ([]model.TransactionDAO, error)
+	// GetRiskHits returns the risk rules that did not allow the transaction, in the order they were evaluated
+	GetRiskHits(ctx context.Context, transactionID string) ([]model.RiskHitDAO, error)
+	// GetAccountActivity returns the activity of the account in the currency, transactionType is the type being assessed
+	// and failures are counted from failuresSince
+	GetAccountActivity(ctx context.Context, accountID string, currency string, transactionType model.TransactionTypeDAO, failuresSince time.Time) (model.AccountActivityDAO, error)
 }
 
 type TransactionRepository struct {
@@ -21,28 +72,336 @@ func TransactionRepositoryProvider(db *pgxpool.Pool) ITransactionRepository {
 	return &TransactionRepository{DB: db}
 }
 
-func (tr *TransactionRepository) CreateTransaction(ctx context.Context, transaction model.TransactionDAO) error {
-	//account_id transaction_id amount status transaction_type
-	_, err := tr.DB.Exec(ctx, InsertTransactionQuery, transaction.AccountID, transaction.TransactionID, transaction.Amount, transaction.Status, transaction.Type)
+func (tr *TransactionRepository) CreateTransaction(ctx context.Context, transaction model.TransactionDAO, events ...model.TransactionEventDAO) error {
+	return inTransaction(ctx, tr.DB, func(tx pgx.Tx) error {
+		return insertTransaction(ctx, tx, transaction, events)
+	})
+}
+
+func (tr *TransactionRepository) ReserveRefund(ctx context.Context, refund model.TransactionDAO, events ...model.TransactionEventDAO) error {
+	return inTransaction(ctx, tr.DB, func(tx pgx.Tx) error {
+		var amount, refunded string
+		if err := tx.QueryRow(ctx, LockTransactionAmountQuery, refund.AccountID, refund.ParentTransactionID).Scan(&amount); err != nil {
+			return err
+		}
+		if err := tx.QueryRow(ctx, GetRefundedAmountQuery, refund.ParentTransactionID).Scan(&refunded); err != nil {
+			return err
+		}
+
+		remaining := decimal.RequireFromString(amount).Sub(decimal.RequireFromString(refunded))
+		if decimal.RequireFromString(refund.Amount).GreaterThan(remaining) {
+			return ErrRefundExceedsRemaining
+		}
+
+		return insertTransaction(ctx, tx, refund, events)
+	})
+}
+
+func (tr *TransactionRepository) CompleteTransaction(ctx context.Context, transaction model.TransactionDAO, events ...model.TransactionEventDAO) error {
+	return inTransaction(ctx, tr.DB, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, CompleteTransactionQuery, transaction.AccountID, transaction.TransactionID, transaction.Status, transaction.GatewayName, transaction.GatewayReference, transaction.GatewayResponse)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return ErrTransactionStatusChanged
+		}
+
+		for _, attempt := range transaction.Attempts {
+			if err := insertTransactionAttempt(ctx, tx, attempt); err != nil {
+				return err
+			}
+		}
+
+		for _, event := range events {
+			if err := insertTransactionEvent(ctx, tx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (tr *TransactionRepository) GetTransaction(ctx context.Context, transactionID string) (model.TransactionDAO, error) {
+	rows, err := tr.DB.Query(ctx, GetTransactionQuery, transactionID)
 	if err != nil {
-		return err
+		return model.TransactionDAO{}, err
 	}
-	return nil
+	defer rows.Close()
+
+	var transactions []model.TransactionDAO
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return model.TransactionDAO{}, err
+		}
+		transactions = append(transactions, transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return model.TransactionDAO{}, err
+	}
+
+	switch len(transactions) {
+	case 0:
+		return model.TransactionDAO{}, pgx.ErrNoRows
+	case 1:
+		return transactions[0], nil
+	}
+	return model.TransactionDAO{}, ErrAmbiguousTransaction
 }
 
-func (tr *TransactionRepository) GetTransaction(ctx context.Context, transactionID string) (model.TransactionDAO, error) {
+func (tr *TransactionRepository) GetAccountTransaction(ctx context.Context, accountID string, transactionID string) (model.TransactionDAO, error) {
+	return scanTransaction(tr.DB.QueryRow(ctx, GetAccountTransactionQuery, accountID, transactionID))
+}
+
+func (tr *TransactionRepository) GetTransactionByGatewayReference(ctx context.Context, gatewayName string, gatewayReference string) (model.TransactionDAO, error) {
+	return scanTransaction(tr.DB.QueryRow(ctx, GetTransactionByGatewayReferenceQuery, gatewayName, gatewayReference))
+}
+
+func (tr *TransactionRepository) UpdateTransaction(ctx context.Context, transaction model.TransactionDAO, currentStatus model.TransactionStatusDAO, event model.TransactionEventDAO) error {
+	return inTransaction(ctx, tr.DB, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, UpdateTransactionQuery, transaction.AccountID, transaction.TransactionID, currentStatus, transaction.Status, transaction.GatewayReference)
+		if err != nil {
+			return err
+		}
+		if result.RowsAffected() == 0 {
+			return ErrTransactionStatusChanged
+		}
+
+		return insertTransactionEvent(ctx, tx, event)
+	})
+}
+
+func (tr *TransactionRepository) CreateTransactionEvent(ctx context.Context, event model.TransactionEventDAO) error {
+	return inTransaction(ctx, tr.DB, func(tx pgx.Tx) error {
+		return insertTransactionEvent(ctx, tx, event)
+	})
+}
+
+func (tr *TransactionRepository) GetTransactionEvents(ctx context.Context, transactionID string) ([]model.TransactionEventDAO, error) {
+	rows, err := tr.DB.Query(ctx, GetTransactionEventsQuery, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.TransactionEventDAO
+	for rows.Next() {
+		var event model.TransactionEventDAO
+		err := rows.Scan(&event.TransactionID, &event.AccountID, &event.Type, &event.Source, &event.PreviousStatus, &event.Status, &event.Detail, &event.PayloadReference, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (tr *TransactionRepository) GetTransactionAttempts(ctx context.Context, transactionID string) ([]model.TransactionAttemptDAO, error) {
+	rows, err := tr.DB.Query(ctx, GetTransactionAttemptsQuery, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []model.TransactionAttemptDAO
+	for rows.Next() {
+		var attempt model.TransactionAttemptDAO
+		err := rows.Scan(&attempt.TransactionID, &attempt.AccountID, &attempt.Gateway, &attempt.StartedAt, &attempt.EndedAt, &attempt.LatencyMs,
+			&attempt.StatusCode, &attempt.ErrorCategory, &attempt.Error, &attempt.RequestFingerprint, &attempt.ResponseFingerprint)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts, rows.Err()
+}
+
+// GetRefundedAmount returns the total amount already refunded or reversed on a transaction, as a decimal string
+func (tr *TransactionRepository) GetRefundedAmount(ctx context.Context, transactionID string) (string, error) {
+	var amount string
+	err := tr.DB.QueryRow(ctx, GetRefundedAmountQuery, transactionID).Scan(&amount)
+	if err != nil {
+		return "", err
+	}
+	return amount, nil
+}
+
+func (tr *TransactionRepository) GetSettledRefundedAmount(ctx context.Context, transactionID string) (string, error) {
+	var amount string
+	err := tr.DB.QueryRow(ctx, GetSettledRefundedAmountQuery, transactionID).Scan(&amount)
+	if err != nil {
+		return "", err
+	}
+	return amount, nil
+}
+
+func (tr *TransactionRepository) GetPendingTransactions(ctx context.Context, createdAfter time.Time, createdBefore time.Time, limit int) ([]model.TransactionDAO, error) {
+	rows, err := tr.DB.Query(ctx, GetPendingTransactionsQuery, createdAfter, createdBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []model.TransactionDAO
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, rows.Err()
+}
+
+func (tr *TransactionRepository) GetInitiatedTransactions(ctx context.Context, createdBefore time.Time, limit int) ([]model.TransactionDAO, error) {
+	rows, err := tr.DB.Query(ctx, GetInitiatedTransactionsQuery, createdBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []model.TransactionDAO
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, rows.Err()
+}
+
+func (tr *TransactionRepository) GetUnpostedTransactions(ctx context.Context, updatedAfter time.Time, updatedBefore time.Time, limit int) ([]model.TransactionDAO, error) {
+	rows, err := tr.DB.Query(ctx, GetUnpostedTransactionsQuery, updatedAfter, updatedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []model.TransactionDAO
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, rows.Err()
+}
+
+func (tr *TransactionRepository) ListTransactions(ctx context.Context, filter model.TransactionFilterDAO) ([]model.TransactionDAO, error) {
+	query, args := listTransactionsQuery(filter)
+	rows, err := tr.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []model.TransactionDAO
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, rows.Err()
+}
+
+func (tr *TransactionRepository) GetRiskHits(ctx context.Context, transactionID string) ([]model.RiskHitDAO, error) {
+	rows, err := tr.DB.Query(ctx, GetRiskHitsQuery, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []model.RiskHitDAO
+	for rows.Next() {
+		var hit model.RiskHitDAO
+		if err := rows.Scan(&hit.TransactionID, &hit.AccountID, &hit.Rule, &hit.Decision, &hit.Reason); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+
+	return hits, rows.Err()
+}
+
+func (tr *TransactionRepository) GetAccountActivity(ctx context.Context, accountID string, currency string, transactionType model.TransactionTypeDAO, failuresSince time.Time) (model.AccountActivityDAO, error) {
+	var activity model.AccountActivityDAO
+	err := tr.DB.QueryRow(ctx, GetAccountActivityQuery, accountID, currency, transactionType, failuresSince).Scan(&activity.Withdrawals, &activity.LastDepositAt, &activity.SettledCount, &activity.AverageAmount, &activity.Failures)
+	if err != nil {
+		return model.AccountActivityDAO{}, err
+	}
+	return activity, nil
+}
+
+// scanTransaction reads a row of transactionColumns
+func scanTransaction(row pgx.Row) (model.TransactionDAO, error) {
 	var transaction model.TransactionDAO
-	err := tr.DB.QueryRow(ctx, GetTransactionQuery, transactionID).Scan(&transaction.AccountID, &transaction.TransactionID, &transaction.Amount, &transaction.Status, &transaction.Type)
+	err := row.Scan(&transaction.AccountID, &transaction.TransactionID, &transaction.Amount, &transaction.Currency, &transaction.Status, &transaction.Type, &transaction.GatewayName,
+		&transaction.GatewayReference, &transaction.GatewayResponse, &transaction.ParentTransactionID,
+		&transaction.ConvertedAmount, &transaction.ConvertedCurrency, &transaction.FXRate, &transaction.FXQuoteID,
+		&transaction.ID, &transaction.CreatedAt)
+	return transaction, err
+}
+
+// inTransaction runs fn in a database transaction, committed if fn succeeds and rolled back otherwise
+func inTransaction(ctx context.Context, db *pgxpool.Pool, fn func(tx pgx.Tx) error) error {
+	tx, err := db.Begin(ctx)
 	if err != nil {
-		return transaction, err
+		return err
 	}
-	return transaction, nil
+	// a no-op once the transaction is committed
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-func (tr *TransactionRepository) UpdateTransaction(ctx context.Context, transaction model.TransactionDAO) error {
-	_, err := tr.DB.Exec(ctx, UpdateTransactionQuery, transaction.AccountID, transaction.TransactionID, transaction.Status)
+func insertTransaction(ctx context.Context, tx pgx.Tx, transaction model.TransactionDAO, events []model.TransactionEventDAO) error {
+	_, err := tx.Exec(ctx, InsertTransactionQuery, transaction.AccountID, transaction.TransactionID, transaction.Amount, transaction.Currency, transaction.Status, transaction.Type, transaction.GatewayName, transaction.ParentTransactionID,
+		transaction.ConvertedAmount, transaction.ConvertedCurrency, transaction.FXRate, transaction.FXQuoteID, transaction.GatewayReference, transaction.GatewayResponse)
 	if err != nil {
 		return err
 	}
+
+	for _, hit := range transaction.RiskHits {
+		if _, err := tx.Exec(ctx, InsertRiskHitQuery, hit.TransactionID, hit.AccountID, hit.Rule, hit.Decision, hit.Reason); err != nil {
+			return err
+		}
+	}
+
+	for _, attempt := range transaction.Attempts {
+		if err := insertTransactionAttempt(ctx, tx, attempt); err != nil {
+			return err
+		}
+	}
+
+	for _, event := range events {
+		if err := insertTransactionEvent(ctx, tx, event); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+func insertTransactionEvent(ctx context.Context, tx pgx.Tx, event model.TransactionEventDAO) error {
+	_, err := tx.Exec(ctx, InsertTransactionEventQuery, event.TransactionID, event.AccountID, event.Type, event.Source, event.PreviousStatus, event.Status, event.Detail, event.PayloadReference)
+	return err
+}
+
+func insertTransactionAttempt(ctx context.Context, tx pgx.Tx, attempt model.TransactionAttemptDAO) error {
+	_, err := tx.Exec(ctx, InsertTransactionAttemptQuery, attempt.TransactionID, attempt.AccountID, attempt.Gateway, attempt.StartedAt, attempt.EndedAt, attempt.LatencyMs,
+		attempt.StatusCode, attempt.ErrorCategory, attempt.Error, attempt.RequestFingerprint, attempt.ResponseFingerprint)
+	return err
+}
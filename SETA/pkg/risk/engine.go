@@ -0,0 +1,165 @@
+package risk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"seta/pkg/model"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Request is the transaction being assessed
+type Request struct {
+	AccountID string
+	Amount    decimal.Decimal
+	Currency  model.Currency
+	Type      model.TransactionType
+}
+
+// History gives the rules the past activity of the account being assessed
+type History interface {
+	// GetAccountActivity returns the activity of the account in the currency, failures are those created since the time
+	GetAccountActivity(ctx context.Context, request Request, failuresSince time.Time) (model.AccountActivity, error)
+}
+
+// Rule assesses a transaction. It returns RiskDecisionAllow when it does not apply, the decision it is configured
+// with and the reason otherwise
+type Rule interface {
+	Name() string
+	Evaluate(ctx context.Context, request Request, history History) (model.RiskDecision, string, error)
+}
+
+// RuleConfig configures a rule of the rules file, the settings a rule type does not use are ignored
+type RuleConfig struct {
+	Name            string             `json:"name"`
+	Type            string             `json:"type"`     // registered rule type, eg. blocklist
+	Decision        model.RiskDecision `json:"decision"` // review or deny, when the rule applies
+	Accounts        []string           `json:"accounts,omitempty"`
+	Window          string             `json:"window,omitempty"` // Go duration
+	Factor          *decimal.Decimal   `json:"factor,omitempty"`
+	MinTransactions int                `json:"min_transactions,omitempty"`
+	Count           int                `json:"count,omitempty"`
+}
+
+// Factory builds a rule from its configuration
+type Factory func(ruleConfig RuleConfig) (Rule, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// Register makes a rule implementation available under the given type name in the rules file
+func Register(ruleType string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("risk: Register factory is nil for " + ruleType)
+	}
+	if _, exists := factories[ruleType]; exists {
+		panic("risk: Register called twice for " + ruleType)
+	}
+
+	factories[ruleType] = factory
+}
+
+// Types returns the registered rule types, sorted
+func Types() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	types := make([]string, 0, len(factories))
+	for ruleType := range factories {
+		types = append(types, ruleType)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+type rulesFile struct {
+	Rules []RuleConfig `json:"rules"`
+}
+
+// LoadRules reads the risk rules from a JSON file of the form {"rules": [...]} and builds them, in file order
+func LoadRules(filePath string) ([]Rule, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read risk rules: %w", err)
+	}
+
+	var file rulesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse risk rules: %w", err)
+	}
+
+	return BuildAll(file.Rules)
+}
+
+// BuildAll builds the rules with the factories registered for their types
+func BuildAll(ruleConfigs []RuleConfig) ([]Rule, error) {
+	rules := make([]Rule, 0, len(ruleConfigs))
+	for _, ruleConfig := range ruleConfigs {
+		if ruleConfig.Name == "" {
+			ruleConfig.Name = ruleConfig.Type
+		}
+		if ruleConfig.Decision != model.RiskDecisionReview && ruleConfig.Decision != model.RiskDecisionDeny {
+			return nil, fmt.Errorf("risk rule %q: decision must be review or deny, got %q", ruleConfig.Name, ruleConfig.Decision)
+		}
+
+		factoriesMu.RLock()
+		factory, ok := factories[ruleConfig.Type]
+		factoriesMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("risk rule %q has unknown type %q (registered types: %v)", ruleConfig.Name, ruleConfig.Type, Types())
+		}
+
+		rule, err := factory(ruleConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build risk rule %q: %w", ruleConfig.Name, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Engine evaluates the rules in order, the first rule that denies a transaction ends the assessment
+type Engine struct {
+	Rules []Rule
+}
+
+func EngineProvider(rules []Rule) *Engine {
+	return &Engine{Rules: rules}
+}
+
+// Assess returns the most severe decision of the rules and every rule that did not allow the transaction
+func (e *Engine) Assess(ctx context.Context, request Request, history History) (model.RiskDecision, []model.RiskHit, error) {
+	decision := model.RiskDecisionAllow
+	var hits []model.RiskHit
+
+	for _, rule := range e.Rules {
+		ruleDecision, reason, err := rule.Evaluate(ctx, request, history)
+		if err != nil {
+			return "", nil, fmt.Errorf("risk rule %q: %w", rule.Name(), err)
+		}
+		if ruleDecision == model.RiskDecisionAllow {
+			continue
+		}
+
+		hits = append(hits, model.RiskHit{Rule: rule.Name(), Decision: ruleDecision, Reason: reason})
+		if ruleDecision.Severity() > decision.Severity() {
+			decision = ruleDecision
+		}
+		if decision == model.RiskDecisionDeny {
+			break
+		}
+	}
+
+	return decision, hits, nil
+}
@@ -0,0 +1,134 @@
+package risk
+
+import (
+	"context"
+	"seta/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeHistory returns the same activity for every account
+type fakeHistory struct {
+	activity model.AccountActivity
+}
+
+func (h fakeHistory) GetAccountActivity(ctx context.Context, request Request, failuresSince time.Time) (model.AccountActivity, error) {
+	return h.activity, nil
+}
+
+func testRules(t *testing.T) []Rule {
+	factor := decimal.NewFromInt(5)
+	rules, err := BuildAll([]RuleConfig{
+		{Name: "blocked", Type: "blocklist", Decision: model.RiskDecisionDeny, Accounts: []string{"blocked"}},
+		{Type: "withdrawal_after_deposit", Decision: model.RiskDecisionReview, Window: "1h"},
+		{Type: "amount_spike", Decision: model.RiskDecisionReview, Factor: &factor, MinTransactions: 3},
+		{Type: "repeated_failures", Decision: model.RiskDecisionDeny, Count: 3, Window: "10m"},
+	})
+	assert.NoError(t, err)
+	return rules
+}
+
+func TestLoadRules(t *testing.T) {
+	rules, err := LoadRules("../../../config/risk_rules.example.json")
+
+	assert.NoError(t, err)
+	assert.Len(t, rules, 4)
+	assert.Equal(t, "blocked_accounts", rules[0].Name())
+}
+
+func TestBuildAll_Invalid(t *testing.T) {
+	factor := decimal.NewFromInt(1)
+	testCases := map[string]RuleConfig{
+		"unknown type":     {Type: "velocity", Decision: model.RiskDecisionDeny},
+		"allow decision":   {Type: "blocklist", Decision: model.RiskDecisionAllow, Accounts: []string{"acc123"}},
+		"no accounts":      {Type: "blocklist", Decision: model.RiskDecisionDeny},
+		"no window":        {Type: "withdrawal_after_deposit", Decision: model.RiskDecisionReview},
+		"factor of 1":      {Type: "amount_spike", Decision: model.RiskDecisionReview, Factor: &factor},
+		"no failure count": {Type: "repeated_failures", Decision: model.RiskDecisionDeny, Window: "1m"},
+		"negative window":  {Type: "repeated_failures", Decision: model.RiskDecisionDeny, Count: 1, Window: "-1m"},
+	}
+
+	for name, ruleConfig := range testCases {
+		_, err := BuildAll([]RuleConfig{ruleConfig})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestEngine_Assess(t *testing.T) {
+	justNow := time.Now().Add(-time.Minute)
+	longAgo := time.Now().Add(-2 * time.Hour)
+
+	testCases := map[string]struct {
+		request  Request
+		activity model.AccountActivity
+		decision model.RiskDecision
+		rules    []string
+	}{
+		"no rule applies": {
+			request:  Request{AccountID: "acc123", Amount: decimal.NewFromInt(100), Type: model.TransactionTypeWithdraw},
+			activity: model.AccountActivity{LastDepositAt: &longAgo, SettledCount: 3, AverageAmount: decimal.NewFromInt(50)},
+			decision: model.RiskDecisionAllow,
+		},
+		"blocklisted account": {
+			request:  Request{AccountID: "blocked", Amount: decimal.NewFromInt(100), Type: model.TransactionTypeDeposit},
+			decision: model.RiskDecisionDeny,
+			rules:    []string{"blocked"},
+		},
+		"first withdrawal after a deposit": {
+			request:  Request{AccountID: "acc123", Amount: decimal.NewFromInt(100), Type: model.TransactionTypeWithdraw},
+			activity: model.AccountActivity{LastDepositAt: &justNow},
+			decision: model.RiskDecisionReview,
+			rules:    []string{"withdrawal_after_deposit"},
+		},
+		"second withdrawal after a deposit": {
+			request:  Request{AccountID: "acc123", Amount: decimal.NewFromInt(100), Type: model.TransactionTypeWithdraw},
+			activity: model.AccountActivity{Withdrawals: 1, LastDepositAt: &justNow},
+			decision: model.RiskDecisionAllow,
+		},
+		"amount spike": {
+			request:  Request{AccountID: "acc123", Amount: decimal.NewFromInt(251), Type: model.TransactionTypeDeposit},
+			activity: model.AccountActivity{SettledCount: 3, AverageAmount: decimal.NewFromInt(50)},
+			decision: model.RiskDecisionReview,
+			rules:    []string{"amount_spike"},
+		},
+		"amount spike without enough history": {
+			request:  Request{AccountID: "acc123", Amount: decimal.NewFromInt(251), Type: model.TransactionTypeDeposit},
+			activity: model.AccountActivity{SettledCount: 2, AverageAmount: decimal.NewFromInt(50)},
+			decision: model.RiskDecisionAllow,
+		},
+		"review then deny": {
+			request:  Request{AccountID: "acc123", Amount: decimal.NewFromInt(100), Type: model.TransactionTypeWithdraw},
+			activity: model.AccountActivity{LastDepositAt: &justNow, Failures: 3},
+			decision: model.RiskDecisionDeny,
+			rules:    []string{"withdrawal_after_deposit", "repeated_failures"},
+		},
+	}
+
+	engine := EngineProvider(testRules(t))
+	for name, testCase := range testCases {
+		decision, hits, err := engine.Assess(context.Background(), testCase.request, fakeHistory{activity: testCase.activity})
+
+		assert.NoError(t, err, name)
+		assert.Equal(t, testCase.decision, decision, name)
+		rules := []string(nil)
+		for _, hit := range hits {
+			rules = append(rules, hit.Rule)
+			assert.NotEmpty(t, hit.Reason, name)
+		}
+		assert.Equal(t, testCase.rules, rules, name)
+	}
+}
+
+func TestEngine_DenyEndsAssessment(t *testing.T) {
+	justNow := time.Now().Add(-time.Minute)
+	engine := EngineProvider(testRules(t))
+
+	decision, hits, err := engine.Assess(context.Background(), Request{AccountID: "blocked", Amount: decimal.NewFromInt(100), Type: model.TransactionTypeWithdraw}, fakeHistory{activity: model.AccountActivity{LastDepositAt: &justNow}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.RiskDecisionDeny, decision)
+	assert.Len(t, hits, 1)
+}
@@ -0,0 +1,163 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"seta/pkg/model"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func init() {
+	Register("blocklist", newBlocklistRule)
+	Register("withdrawal_after_deposit", newWithdrawalAfterDepositRule)
+	Register("amount_spike", newAmountSpikeRule)
+	Register("repeated_failures", newRepeatedFailuresRule)
+}
+
+// BlocklistRule applies to every transaction of the listed accounts
+type BlocklistRule struct {
+	name     string
+	decision model.RiskDecision
+	accounts map[string]bool
+}
+
+func newBlocklistRule(ruleConfig RuleConfig) (Rule, error) {
+	if len(ruleConfig.Accounts) == 0 {
+		return nil, fmt.Errorf("accounts is required")
+	}
+
+	rule := &BlocklistRule{name: ruleConfig.Name, decision: ruleConfig.Decision, accounts: make(map[string]bool, len(ruleConfig.Accounts))}
+	for _, account := range ruleConfig.Accounts {
+		rule.accounts[account] = true
+	}
+	return rule, nil
+}
+
+func (r *BlocklistRule) Name() string {
+	return r.name
+}
+
+func (r *BlocklistRule) Evaluate(ctx context.Context, request Request, history History) (model.RiskDecision, string, error) {
+	if !r.accounts[request.AccountID] {
+		return model.RiskDecisionAllow, "", nil
+	}
+	return r.decision, fmt.Sprintf("account %s is blocklisted", request.AccountID), nil
+}
+
+// WithdrawalAfterDepositRule applies to the first withdrawal of an account made within the window of a deposit
+type WithdrawalAfterDepositRule struct {
+	name     string
+	decision model.RiskDecision
+	window   time.Duration
+}
+
+func newWithdrawalAfterDepositRule(ruleConfig RuleConfig) (Rule, error) {
+	window, err := parseWindow(ruleConfig.Window)
+	if err != nil {
+		return nil, err
+	}
+	return &WithdrawalAfterDepositRule{name: ruleConfig.Name, decision: ruleConfig.Decision, window: window}, nil
+}
+
+func (r *WithdrawalAfterDepositRule) Name() string {
+	return r.name
+}
+
+func (r *WithdrawalAfterDepositRule) Evaluate(ctx context.Context, request Request, history History) (model.RiskDecision, string, error) {
+	if request.Type != model.TransactionTypeWithdraw {
+		return model.RiskDecisionAllow, "", nil
+	}
+
+	activity, err := history.GetAccountActivity(ctx, request, time.Now())
+	if err != nil {
+		return "", "", err
+	}
+
+	if activity.Withdrawals > 0 || activity.LastDepositAt == nil || time.Since(*activity.LastDepositAt) > r.window {
+		return model.RiskDecisionAllow, "", nil
+	}
+	return r.decision, fmt.Sprintf("first withdrawal %s after a deposit", time.Since(*activity.LastDepositAt).Round(time.Second)), nil
+}
+
+// AmountSpikeRule applies to the transactions whose amount is more than factor times the average of the settled
+// transactions of the account of the same type, once the account has min_transactions of them
+type AmountSpikeRule struct {
+	name            string
+	decision        model.RiskDecision
+	factor          decimal.Decimal
+	minTransactions int
+}
+
+func newAmountSpikeRule(ruleConfig RuleConfig) (Rule, error) {
+	if ruleConfig.Factor == nil || !ruleConfig.Factor.GreaterThan(decimal.NewFromInt(1)) {
+		return nil, fmt.Errorf("factor must be greater than 1")
+	}
+
+	minTransactions := ruleConfig.MinTransactions
+	if minTransactions <= 0 {
+		minTransactions = 1
+	}
+	return &AmountSpikeRule{name: ruleConfig.Name, decision: ruleConfig.Decision, factor: *ruleConfig.Factor, minTransactions: minTransactions}, nil
+}
+
+func (r *AmountSpikeRule) Name() string {
+	return r.name
+}
+
+func (r *AmountSpikeRule) Evaluate(ctx context.Context, request Request, history History) (model.RiskDecision, string, error) {
+	activity, err := history.GetAccountActivity(ctx, request, time.Now())
+	if err != nil {
+		return "", "", err
+	}
+
+	if activity.SettledCount < r.minTransactions || !request.Amount.GreaterThan(activity.AverageAmount.Mul(r.factor)) {
+		return model.RiskDecisionAllow, "", nil
+	}
+	return r.decision, fmt.Sprintf("amount %s is more than %s times the average %s of %s", request.Amount, r.factor, activity.AverageAmount.Round(request.Currency.MinorUnits()), request.Type), nil
+}
+
+// RepeatedFailuresRule applies once the account had count failed transactions within the window
+type RepeatedFailuresRule struct {
+	name     string
+	decision model.RiskDecision
+	count    int
+	window   time.Duration
+}
+
+func newRepeatedFailuresRule(ruleConfig RuleConfig) (Rule, error) {
+	if ruleConfig.Count <= 0 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+
+	window, err := parseWindow(ruleConfig.Window)
+	if err != nil {
+		return nil, err
+	}
+	return &RepeatedFailuresRule{name: ruleConfig.Name, decision: ruleConfig.Decision, count: ruleConfig.Count, window: window}, nil
+}
+
+func (r *RepeatedFailuresRule) Name() string {
+	return r.name
+}
+
+func (r *RepeatedFailuresRule) Evaluate(ctx context.Context, request Request, history History) (model.RiskDecision, string, error) {
+	activity, err := history.GetAccountActivity(ctx, request, time.Now().Add(-r.window))
+	if err != nil {
+		return "", "", err
+	}
+
+	if activity.Failures < r.count {
+		return model.RiskDecisionAllow, "", nil
+	}
+	return r.decision, fmt.Sprintf("%d failed transactions in the last %s", activity.Failures, r.window), nil
+}
+
+func parseWindow(window string) (time.Duration, error) {
+	duration, err := time.ParseDuration(window)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid window %q", window)
+	}
+	return duration, nil
+}
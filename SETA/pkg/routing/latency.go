@@ -0,0 +1,120 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/config"
+	"seta/pkg/model"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// LatencyTracker wraps a payment gateway and keeps the latency of its most recent calls
+type LatencyTracker struct {
+	Gateway paymentgateway.IPaymentGateway
+
+	mu      sync.Mutex
+	samples []time.Duration // ring buffer of the last window calls
+	next    int
+	window  int
+}
+
+func LatencyTrackerProvider(gateway paymentgateway.IPaymentGateway, window int) *LatencyTracker {
+	return &LatencyTracker{
+		Gateway: gateway,
+		samples: make([]time.Duration, 0, window),
+		window:  window,
+	}
+}
+
+func (lt *LatencyTracker) Name() string {
+	return lt.Gateway.Name()
+}
+
+func (lt *LatencyTracker) Unwrap() paymentgateway.IPaymentGateway {
+	return lt.Gateway
+}
+
+func (lt *LatencyTracker) Deposit(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	start := time.Now()
+	transactionResponse, err := lt.Gateway.Deposit(ctx, AccountID, amount, currency)
+	lt.observe(time.Since(start), err)
+	return transactionResponse, err
+}
+
+func (lt *LatencyTracker) Withdraw(ctx context.Context, AccountID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	start := time.Now()
+	transactionResponse, err := lt.Gateway.Withdraw(ctx, AccountID, amount, currency)
+	lt.observe(time.Since(start), err)
+	return transactionResponse, err
+}
+
+func (lt *LatencyTracker) Refund(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	start := time.Now()
+	transactionResponse, err := lt.Gateway.Refund(ctx, gatewayTransactionID, amount, currency)
+	lt.observe(time.Since(start), err)
+	return transactionResponse, err
+}
+
+func (lt *LatencyTracker) Reverse(ctx context.Context, gatewayTransactionID string, amount decimal.Decimal, currency model.Currency) (*model.TransactionResponse, error) {
+	start := time.Now()
+	transactionResponse, err := lt.Gateway.Reverse(ctx, gatewayTransactionID, amount, currency)
+	lt.observe(time.Since(start), err)
+	return transactionResponse, err
+}
+
+func (lt *LatencyTracker) GetTransactionStatus(ctx context.Context, gatewayTransactionID string) (*model.TransactionResponse, error) {
+	start := time.Now()
+	transactionResponse, err := lt.Gateway.GetTransactionStatus(ctx, gatewayTransactionID)
+	lt.observe(time.Since(start), err)
+	return transactionResponse, err
+}
+
+func (lt *LatencyTracker) GetTransactionStatusByReference(ctx context.Context, clientReference string) (*model.TransactionResponse, error) {
+	start := time.Now()
+	transactionResponse, err := lt.Gateway.GetTransactionStatusByReference(ctx, clientReference)
+	lt.observe(time.Since(start), err)
+	return transactionResponse, err
+}
+
+// P95 returns the 95th percentile latency of the recent calls, 0 if the gateway has not been called yet
+func (lt *LatencyTracker) P95() time.Duration {
+	lt.mu.Lock()
+	sorted := append([]time.Duration(nil), lt.samples...)
+	lt.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	index := (len(sorted)*95+99)/100 - 1 // nearest rank
+	return sorted[index]
+}
+
+func (lt *LatencyTracker) observe(latency time.Duration, err error) {
+	// a skipped gateway was not called at all, and a call the caller gave up on says nothing about the gateway
+	if errors.Is(err, paymentgateway.ErrCircuitOpen) || errors.Is(err, context.Canceled) {
+		return
+	}
+	// a gateway that fails fast must not rank as the fastest, its failures count as calls that timed out
+	var gatewayError *paymentgateway.GatewayError
+	if errors.As(err, &gatewayError) && gatewayError.Retryable() {
+		latency = config.DefaultGatewayTimeout
+	}
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if len(lt.samples) < lt.window {
+		lt.samples = append(lt.samples, latency)
+		return
+	}
+
+	lt.samples[lt.next] = latency
+	lt.next = (lt.next + 1) % lt.window
+}
@@ -0,0 +1,68 @@
+package routing
+
+// routing decides in which order the payment gateways are tried for a transaction. The handler then walks the
+// returned gateways in that order, failing over from one to the next.
+
+import (
+	"context"
+	"fmt"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/model"
+
+	"github.com/shopspring/decimal"
+)
+
+type Strategy string
+
+const (
+	StrategyPriority     Strategy = "priority"      // always the configured order
+	StrategyWeighted     Strategy = "weighted"      // weighted random order
+	StrategyRoundRobin   Strategy = "round_robin"   // the first gateway rotates on every transaction
+	StrategyLeastLatency Strategy = "least_latency" // the gateway with the lowest recent p95 latency first
+)
+
+// RouteRequest describes the transaction being routed
+type RouteRequest struct {
+	AccountID string
+	Amount    decimal.Decimal
+	Currency  model.Currency
+	Type      model.TransactionType
+}
+
+type Router interface {
+	// Route returns the gateways to try for the transaction, in the order they should be tried
+	Route(ctx context.Context, request RouteRequest) ([]paymentgateway.IPaymentGateway, error)
+}
+
+type RouterConfig struct {
+	Strategy      Strategy
+	Weights       map[string]int // weight per gateway name, used by the weighted strategy
+	LatencyWindow int            // number of recent calls per gateway the p95 is computed on, used by the least latency strategy
+}
+
+// RoutedGateways returns the gateways as the router calls them, wrapped by a router that measures them. Another router
+// built on them, such as the rules router, then goes through the same wrappers
+func RoutedGateways(router Router, gateways []paymentgateway.IPaymentGateway) []paymentgateway.IPaymentGateway {
+	if wrapper, ok := router.(interface {
+		PaymentGateways() []paymentgateway.IPaymentGateway
+	}); ok {
+		return wrapper.PaymentGateways()
+	}
+	return gateways
+}
+
+// RouterProvider builds the router for the configured strategy, the gateways are given in priority order
+func RouterProvider(gateways []paymentgateway.IPaymentGateway, config RouterConfig) (Router, error) {
+	switch config.Strategy {
+	case StrategyPriority, "":
+		return PriorityRouterProvider(gateways), nil
+	case StrategyWeighted:
+		return WeightedRouterProvider(gateways, config.Weights), nil
+	case StrategyRoundRobin:
+		return RoundRobinRouterProvider(gateways), nil
+	case StrategyLeastLatency:
+		return LeastLatencyRouterProvider(gateways, config.LatencyWindow), nil
+	default:
+		return nil, fmt.Errorf("unknown routing strategy %q", config.Strategy)
+	}
+}
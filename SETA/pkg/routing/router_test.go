@@ -0,0 +1,200 @@
+package routing
+
+import (
+	"context"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/model"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func testGateways(names ...string) []paymentgateway.IPaymentGateway {
+	gateways := make([]paymentgateway.IPaymentGateway, 0, len(names))
+	for _, name := range names {
+		gateways = append(gateways, &paymentgateway.MockClient{GatewayName: name, StatusCode: 200, TransactionResponse: &model.TransactionResponse{}})
+	}
+	return gateways
+}
+
+func routeNames(t *testing.T, router Router) []string {
+	return routeRequestNames(t, router, RouteRequest{AccountID: "acc123", Amount: decimal.NewFromInt(100), Type: model.TransactionTypeDeposit})
+}
+
+func routeRequestNames(t *testing.T, router Router, request RouteRequest) []string {
+	gateways, err := router.Route(context.Background(), request)
+	assert.NoError(t, err)
+
+	names := make([]string, 0, len(gateways))
+	for _, gateway := range gateways {
+		names = append(names, gateway.Name())
+	}
+	return names
+}
+
+func TestRouterProvider_UnknownStrategy(t *testing.T) {
+	_, err := RouterProvider(testGateways("a"), RouterConfig{Strategy: "fastest"})
+	assert.Error(t, err)
+}
+
+func TestPriorityRouter(t *testing.T) {
+	router, err := RouterProvider(testGateways("a", "b", "c"), RouterConfig{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, routeNames(t, router))
+	assert.Equal(t, []string{"a", "b", "c"}, routeNames(t, router))
+}
+
+func TestRoundRobinRouter(t *testing.T) {
+	router := RoundRobinRouterProvider(testGateways("a", "b", "c"))
+
+	assert.Equal(t, []string{"a", "b", "c"}, routeNames(t, router))
+	assert.Equal(t, []string{"b", "c", "a"}, routeNames(t, router))
+	assert.Equal(t, []string{"c", "a", "b"}, routeNames(t, router))
+	assert.Equal(t, []string{"a", "b", "c"}, routeNames(t, router))
+}
+
+func TestWeightedRouter(t *testing.T) {
+	router := WeightedRouterProvider(testGateways("a", "b", "c"), map[string]int{"a": 3, "b": 1, "c": 0})
+
+	first := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		names := routeNames(t, router)
+		// every gateway is always returned for failover, the ones without weight last
+		assert.Len(t, names, 3)
+		assert.Equal(t, "c", names[2])
+		first[names[0]]++
+	}
+
+	assert.Zero(t, first["c"])
+	assert.InDelta(t, 3000, first["a"], 200)
+	assert.InDelta(t, 1000, first["b"], 200)
+}
+
+func TestLeastLatencyRouter(t *testing.T) {
+	gateways := testGateways("slow", "fast")
+	gateways[0].(*paymentgateway.MockClient).Delay = 20 * time.Millisecond
+	router := LeastLatencyRouterProvider(gateways, 10)
+
+	// gateways that have not been measured yet keep the configured order
+	assert.Equal(t, []string{"slow", "fast"}, routeNames(t, router))
+
+	for _, gateway := range router.Gateways {
+		_, err := gateway.Deposit(context.Background(), "acc123", decimal.NewFromInt(100), model.DefaultCurrency)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"fast", "slow"}, routeNames(t, router))
+	assert.GreaterOrEqual(t, router.Gateways[0].P95(), 20*time.Millisecond)
+}
+
+func TestLeastLatencyRouter_FailingGateway(t *testing.T) {
+	gateways := testGateways("failing", "slow")
+	gateways[0].(*paymentgateway.MockClient).StatusCode = 500
+	gateways[1].(*paymentgateway.MockClient).Delay = 20 * time.Millisecond
+	router := LeastLatencyRouterProvider(gateways, 10)
+
+	for _, gateway := range router.Gateways {
+		gateway.Deposit(context.Background(), "acc123", decimal.NewFromInt(100), model.DefaultCurrency)
+	}
+
+	// the instant 500 counts as a timed out call
+	assert.Equal(t, []string{"slow", "failing"}, routeNames(t, router))
+}
+
+func TestRulesRouter(t *testing.T) {
+	threshold := decimal.NewFromInt(1000)
+	gateways := testGateways("gatewaya", "gatewayb")
+	rules := []Rule{
+		{Name: "large-withdrawals", Type: model.TransactionTypeWithdraw, MinAmount: &threshold, Gateways: []string{"gatewayb"}},
+		{Name: "partner-accounts", AccountPattern: "partner-*", Gateways: []string{"gatewayb", "gatewaya"}},
+	}
+	router, err := RulesRouterProvider(rules, gateways, nil, StrategyPriority, PriorityRouterProvider(gateways))
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		request  RouteRequest
+		rule     string
+		gateways []string
+	}{
+		{RouteRequest{AccountID: "acc123", Amount: decimal.NewFromInt(1000), Type: model.TransactionTypeWithdraw}, "large-withdrawals", []string{"gatewayb"}},
+		{RouteRequest{AccountID: "acc123", Amount: decimal.NewFromInt(999), Type: model.TransactionTypeWithdraw}, "", []string{"gatewaya", "gatewayb"}},
+		{RouteRequest{AccountID: "acc123", Amount: decimal.NewFromInt(5000), Type: model.TransactionTypeDeposit}, "", []string{"gatewaya", "gatewayb"}},
+		{RouteRequest{AccountID: "partner-42", Amount: decimal.NewFromInt(10), Type: model.TransactionTypeDeposit}, "partner-accounts", []string{"gatewayb", "gatewaya"}},
+		// the first matching rule wins
+		{RouteRequest{AccountID: "partner-42", Amount: decimal.NewFromInt(5000), Type: model.TransactionTypeWithdraw}, "large-withdrawals", []string{"gatewayb"}},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.gateways, routeRequestNames(t, router, testCase.request))
+
+		explanation := router.Explain(testCase.request)
+		assert.Equal(t, testCase.rule, explanation.Rule)
+		assert.Equal(t, testCase.gateways, explanation.Gateways)
+	}
+}
+
+func TestRulesRouter_Currencies(t *testing.T) {
+	gateways := testGateways("gatewaya", "gatewayb")
+	currencies := map[string][]model.Currency{"gatewaya": {"USD", "EUR"}}
+	rules := []Rule{{Name: "yen", Currency: "JPY", Gateways: []string{"gatewaya", "gatewayb"}}}
+	router, err := RulesRouterProvider(rules, gateways, currencies, StrategyPriority, PriorityRouterProvider(gateways))
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		currency model.Currency
+		rule     string
+		gateways []string
+	}{
+		{"USD", "", []string{"gatewaya", "gatewayb"}},
+		// gatewayb declares no currencies so it supports them all, gatewaya is skipped even when the rule names it
+		{"JPY", "yen", []string{"gatewayb"}},
+		{"GBP", "", []string{"gatewayb"}},
+	}
+
+	for _, testCase := range testCases {
+		request := RouteRequest{AccountID: "acc123", Amount: decimal.NewFromInt(10), Currency: testCase.currency, Type: model.TransactionTypeDeposit}
+		assert.Equal(t, testCase.gateways, routeRequestNames(t, router, request), testCase.currency)
+
+		explanation := router.Explain(request)
+		assert.Equal(t, testCase.rule, explanation.Rule, testCase.currency)
+		assert.Equal(t, testCase.gateways, explanation.Gateways, testCase.currency)
+	}
+
+	onlyA, err := RulesRouterProvider(nil, gateways[:1], currencies, StrategyPriority, PriorityRouterProvider(gateways[:1]))
+	assert.NoError(t, err)
+	_, err = onlyA.Route(context.Background(), RouteRequest{AccountID: "acc123", Amount: decimal.NewFromInt(10), Currency: "JPY", Type: model.TransactionTypeDeposit})
+	assert.ErrorIs(t, err, ErrNoGatewayForCurrency)
+}
+
+func TestRulesRouter_LeastLatency(t *testing.T) {
+	gateways := testGateways("slow", "fast")
+	gateways[0].(*paymentgateway.MockClient).Delay = 20 * time.Millisecond
+	strategyRouter := LeastLatencyRouterProvider(gateways, 10)
+	rules := []Rule{{Name: "partner-accounts", AccountPattern: "partner-*", Gateways: []string{"slow", "fast"}}}
+	router, err := RulesRouterProvider(rules, RoutedGateways(strategyRouter, gateways), nil, StrategyLeastLatency, strategyRouter)
+	assert.NoError(t, err)
+
+	// the calls routed by the rule are measured by the strategy router
+	partner := RouteRequest{AccountID: "partner-1", Amount: decimal.NewFromInt(100), Type: model.TransactionTypeDeposit}
+	routed, err := router.Route(context.Background(), partner)
+	assert.NoError(t, err)
+	for _, gateway := range routed {
+		_, err := gateway.Deposit(context.Background(), "partner-1", decimal.NewFromInt(100), model.DefaultCurrency)
+		assert.NoError(t, err)
+	}
+
+	request := RouteRequest{AccountID: "acc123", Amount: decimal.NewFromInt(100), Type: model.TransactionTypeDeposit}
+	assert.Equal(t, []string{"fast", "slow"}, routeRequestNames(t, router, request))
+	assert.Equal(t, []string{"fast", "slow"}, router.Explain(request).Gateways)
+}
+
+func TestRulesRouterProvider_UnknownGateway(t *testing.T) {
+	gateways := testGateways("gatewaya")
+	rules := []Rule{{Name: "to-c", Gateways: []string{"gatewayc"}}}
+
+	_, err := RulesRouterProvider(rules, gateways, nil, StrategyPriority, PriorityRouterProvider(gateways))
+	assert.Error(t, err)
+}
@@ -0,0 +1,217 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrNoGatewayForCurrency is returned when none of the gateways a transaction would be sent to supports its currency
+var ErrNoGatewayForCurrency = errors.New("no payment gateway supports the currency")
+
+// Rule sends the transactions it matches to a fixed, ordered list of gateways. Every condition that is set must match,
+// a rule without conditions matches every transaction
+type Rule struct {
+	Name           string                `json:"name"`
+	Type           model.TransactionType `json:"type,omitempty"`            // deposit or withdraw
+	Currency       model.Currency        `json:"currency,omitempty"`        // ISO 4217 code, eg. "JPY"
+	MinAmount      *decimal.Decimal      `json:"min_amount,omitempty"`      // inclusive
+	MaxAmount      *decimal.Decimal      `json:"max_amount,omitempty"`      // inclusive
+	AccountPattern string                `json:"account_pattern,omitempty"` // glob matched against the account ID, eg. "vip-*"
+	Gateways       []string              `json:"gateways"`                  // gateway names, in the order they are tried
+}
+
+type rulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadRules reads the routing rules from a JSON file of the form {"rules": [...]}, rules are evaluated in file order
+func LoadRules(filePath string) ([]Rule, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing rules: %w", err)
+	}
+
+	var file rulesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse routing rules: %w", err)
+	}
+
+	return file.Rules, nil
+}
+
+// Matches reports whether the transaction satisfies every condition of the rule
+func (r *Rule) Matches(request RouteRequest) bool {
+	if r.Type != "" && r.Type != request.Type {
+		return false
+	}
+
+	if r.Currency != "" && r.Currency != request.Currency {
+		return false
+	}
+
+	if r.MinAmount != nil && request.Amount.LessThan(*r.MinAmount) {
+		return false
+	}
+
+	if r.MaxAmount != nil && request.Amount.GreaterThan(*r.MaxAmount) {
+		return false
+	}
+
+	if r.AccountPattern != "" {
+		matched, err := path.Match(r.AccountPattern, request.AccountID)
+		if err != nil || !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RulesRouter routes a transaction to the gateways of the first rule it matches, transactions that match no rule are
+// routed by the fallback router. Either way the gateways that do not support the currency of the transaction are skipped
+type RulesRouter struct {
+	Rules    []Rule
+	Fallback Router
+
+	strategy   Strategy
+	gateways   []paymentgateway.IPaymentGateway
+	byName     map[string]paymentgateway.IPaymentGateway
+	currencies map[string]map[model.Currency]bool // by gateway name, a gateway without an entry supports every currency
+}
+
+// RulesRouterProvider checks the rules against the available gateways, a rule naming an unknown gateway or with an
+// invalid account pattern is a configuration error. currencies lists the currencies of the gateways that do not
+// support them all, by gateway name
+func RulesRouterProvider(rules []Rule, gateways []paymentgateway.IPaymentGateway, currencies map[string][]model.Currency, fallbackStrategy Strategy, fallback Router) (*RulesRouter, error) {
+	byName := make(map[string]paymentgateway.IPaymentGateway, len(gateways))
+	for _, gateway := range gateways {
+		byName[gateway.Name()] = gateway
+	}
+
+	for _, rule := range rules {
+		if len(rule.Gateways) == 0 {
+			return nil, fmt.Errorf("routing rule %q has no gateways", rule.Name)
+		}
+
+		for _, name := range rule.Gateways {
+			if _, ok := byName[name]; !ok {
+				return nil, fmt.Errorf("routing rule %q uses unknown gateway %q", rule.Name, name)
+			}
+		}
+
+		if _, err := path.Match(rule.AccountPattern, ""); err != nil {
+			return nil, fmt.Errorf("routing rule %q has an invalid account pattern: %w", rule.Name, err)
+		}
+
+		if rule.Currency != "" {
+			// the code is compared as is with the one of the transaction, so it has to be given in upper case
+			if currency, ok := model.ParseCurrency(string(rule.Currency)); !ok || currency != rule.Currency {
+				return nil, fmt.Errorf("routing rule %q has an invalid currency %q", rule.Name, rule.Currency)
+			}
+		}
+	}
+
+	supported := make(map[string]map[model.Currency]bool, len(currencies))
+	for name, gatewayCurrencies := range currencies {
+		if len(gatewayCurrencies) == 0 {
+			continue
+		}
+		supported[name] = make(map[model.Currency]bool, len(gatewayCurrencies))
+		for _, currency := range gatewayCurrencies {
+			supported[name][currency] = true
+		}
+	}
+
+	if fallbackStrategy == "" {
+		fallbackStrategy = StrategyPriority
+	}
+
+	return &RulesRouter{
+		Rules:      rules,
+		Fallback:   fallback,
+		strategy:   fallbackStrategy,
+		gateways:   gateways,
+		byName:     byName,
+		currencies: supported,
+	}, nil
+}
+
+func (r *RulesRouter) Route(ctx context.Context, request RouteRequest) ([]paymentgateway.IPaymentGateway, error) {
+	var gateways []paymentgateway.IPaymentGateway
+	if rule := r.match(request); rule != nil {
+		for _, name := range rule.Gateways {
+			gateways = append(gateways, r.byName[name])
+		}
+	} else {
+		var err error
+		if gateways, err = r.Fallback.Route(ctx, request); err != nil {
+			return nil, err
+		}
+	}
+
+	supported := make([]paymentgateway.IPaymentGateway, 0, len(gateways))
+	for _, gateway := range gateways {
+		if r.supports(gateway.Name(), request.Currency) {
+			supported = append(supported, gateway)
+		}
+	}
+
+	if len(supported) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoGatewayForCurrency, request.Currency)
+	}
+	return supported, nil
+}
+
+// Explain reports which rule a transaction matches and the gateways it would be sent to, without routing it. When no
+// rule matches, the gateways are in the current order of the priority and least latency strategies, in their configured
+// order for the others as they decide the order per transaction
+func (r *RulesRouter) Explain(request RouteRequest) model.RoutingExplanation {
+	explanation := model.RoutingExplanation{Strategy: string(r.strategy)}
+	var names []string
+	if rule := r.match(request); rule != nil {
+		explanation.Rule = rule.Name
+		explanation.Strategy = "rule"
+		names = rule.Gateways
+	} else {
+		gateways := r.gateways
+		if r.strategy == StrategyPriority || r.strategy == StrategyLeastLatency {
+			if ordered, err := r.Fallback.Route(context.Background(), request); err == nil {
+				gateways = ordered
+			}
+		}
+		for _, gateway := range gateways {
+			names = append(names, gateway.Name())
+		}
+	}
+
+	explanation.Gateways = make([]string, 0, len(names))
+	for _, name := range names {
+		if r.supports(name, request.Currency) {
+			explanation.Gateways = append(explanation.Gateways, name)
+		}
+	}
+	return explanation
+}
+
+// supports reports whether the gateway accepts transactions in the currency, any currency when none is given
+func (r *RulesRouter) supports(gatewayName string, currency model.Currency) bool {
+	currencies, ok := r.currencies[gatewayName]
+	return !ok || currency == "" || currencies[currency]
+}
+
+func (r *RulesRouter) match(request RouteRequest) *Rule {
+	for i := range r.Rules {
+		if r.Rules[i].Matches(request) {
+			return &r.Rules[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package routing
+
+import (
+	"context"
+	"math/rand"
+	"seta/pkg/clients/paymentgateway"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//---------------- Priority ---------------- //
+
+// PriorityRouter always tries the gateways in the configured order, the next gateway only sees traffic when the previous ones fail
+type PriorityRouter struct {
+	Gateways []paymentgateway.IPaymentGateway
+}
+
+func PriorityRouterProvider(gateways []paymentgateway.IPaymentGateway) *PriorityRouter {
+	return &PriorityRouter{Gateways: gateways}
+}
+
+func (r *PriorityRouter) Route(ctx context.Context, request RouteRequest) ([]paymentgateway.IPaymentGateway, error) {
+	return append([]paymentgateway.IPaymentGateway(nil), r.Gateways...), nil
+}
+
+//---------------- Weighted ---------------- //
+
+// WeightedRouter picks the first gateway at random in proportion to its weight, then the next one among the remaining
+// gateways the same way, so every gateway is still available for failover
+type WeightedRouter struct {
+	Gateways []paymentgateway.IPaymentGateway
+	Weights  map[string]int
+
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+// WeightedRouterProvider builds a weighted router, a gateway without a weight counts as a weight of 1
+func WeightedRouterProvider(gateways []paymentgateway.IPaymentGateway, weights map[string]int) *WeightedRouter {
+	return &WeightedRouter{
+		Gateways: gateways,
+		Weights:  weights,
+		random:   rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+func (r *WeightedRouter) Route(ctx context.Context, request RouteRequest) ([]paymentgateway.IPaymentGateway, error) {
+	remaining := append([]paymentgateway.IPaymentGateway(nil), r.Gateways...)
+	ordered := make([]paymentgateway.IPaymentGateway, 0, len(remaining))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for len(remaining) > 0 {
+		total := 0
+		for _, gateway := range remaining {
+			total += r.weight(gateway)
+		}
+
+		// a gateway with a weight of 0 is only used for failover, after all the weighted ones
+		index := 0
+		if total > 0 {
+			pick := r.random.Intn(total)
+			for i, gateway := range remaining {
+				pick -= r.weight(gateway)
+				if pick < 0 {
+					index = i
+					break
+				}
+			}
+		}
+
+		ordered = append(ordered, remaining[index])
+		remaining = append(remaining[:index], remaining[index+1:]...)
+	}
+
+	return ordered, nil
+}
+
+func (r *WeightedRouter) weight(gateway paymentgateway.IPaymentGateway) int {
+	weight, ok := r.Weights[gateway.Name()]
+	if !ok {
+		return 1
+	}
+	if weight < 0 {
+		return 0
+	}
+	return weight
+}
+
+//---------------- Round robin ---------------- //
+
+// RoundRobinRouter rotates the gateway that is tried first on every transaction, keeping the configured order for failover
+type RoundRobinRouter struct {
+	Gateways []paymentgateway.IPaymentGateway
+
+	next uint64
+}
+
+func RoundRobinRouterProvider(gateways []paymentgateway.IPaymentGateway) *RoundRobinRouter {
+	return &RoundRobinRouter{Gateways: gateways}
+}
+
+func (r *RoundRobinRouter) Route(ctx context.Context, request RouteRequest) ([]paymentgateway.IPaymentGateway, error) {
+	if len(r.Gateways) == 0 {
+		return nil, nil
+	}
+
+	start := int((atomic.AddUint64(&r.next, 1) - 1) % uint64(len(r.Gateways)))
+	ordered := make([]paymentgateway.IPaymentGateway, 0, len(r.Gateways))
+	ordered = append(ordered, r.Gateways[start:]...)
+	ordered = append(ordered, r.Gateways[:start]...)
+
+	return ordered, nil
+}
+
+//---------------- Least latency ---------------- //
+
+// DefaultLatencyWindow is the number of recent calls the p95 latency of a gateway is computed on
+const DefaultLatencyWindow = 100
+
+// LeastLatencyRouter tries the gateway with the lowest p95 latency over its recent calls first. Gateways are wrapped
+// so that every call made through the router is measured, a gateway without measurements yet is tried first
+type LeastLatencyRouter struct {
+	Gateways []*LatencyTracker
+}
+
+func LeastLatencyRouterProvider(gateways []paymentgateway.IPaymentGateway, window int) *LeastLatencyRouter {
+	if window <= 0 {
+		window = DefaultLatencyWindow
+	}
+
+	trackers := make([]*LatencyTracker, 0, len(gateways))
+	for _, gateway := range gateways {
+		trackers = append(trackers, LatencyTrackerProvider(gateway, window))
+	}
+
+	return &LeastLatencyRouter{Gateways: trackers}
+}
+
+// PaymentGateways returns the measured gateways in their configured order
+func (r *LeastLatencyRouter) PaymentGateways() []paymentgateway.IPaymentGateway {
+	gateways := make([]paymentgateway.IPaymentGateway, 0, len(r.Gateways))
+	for _, gateway := range r.Gateways {
+		gateways = append(gateways, gateway)
+	}
+	return gateways
+}
+
+func (r *LeastLatencyRouter) Route(ctx context.Context, request RouteRequest) ([]paymentgateway.IPaymentGateway, error) {
+	type candidate struct {
+		gateway *LatencyTracker
+		p95     time.Duration
+	}
+
+	candidates := make([]candidate, 0, len(r.Gateways))
+	for _, gateway := range r.Gateways {
+		candidates = append(candidates, candidate{gateway: gateway, p95: gateway.P95()})
+	}
+
+	// stable so that gateways with the same latency keep their configured order
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].p95 < candidates[j].p95
+	})
+
+	ordered := make([]paymentgateway.IPaymentGateway, 0, len(candidates))
+	for _, c := range candidates {
+		ordered = append(ordered, c.gateway)
+	}
+
+	return ordered, nil
+}
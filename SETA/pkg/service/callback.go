@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/config"
+	"seta/pkg/logger"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrUnknownCallbackGateway = errors.New("unknown payment gateway")
+	ErrStaleCallback          = errors.New("callback timestamp is outside the tolerance")
+	ErrReplayedCallback       = errors.New("callback nonce was already used")
+	ErrInvalidCallbackPayload = errors.New("invalid callback payload")
+)
+
+type ICallbackService interface {
+	// HandleCallback verifies a callback of the named gateway and applies the transaction status it carries
+	HandleCallback(ctx context.Context, gatewayName string, signature model.CallbackSignature, body []byte) error
+}
+
+type callbackGateway struct {
+	parser paymentgateway.CallbackParser
+	config config.CallbackConfig
+}
+
+type CallbackService struct {
+	TransactionService ITransactionService
+	CallbackRepository repository.ICallbackRepository
+
+	gateways map[string]callbackGateway
+	now      func() time.Time
+}
+
+// CallbackServiceProvider accepts the callbacks of the gateways that can parse them and have a callback secret configured
+func CallbackServiceProvider(transactionService ITransactionService, callbackRepository repository.ICallbackRepository, gateways []paymentgateway.IPaymentGateway, gatewayConfigs []config.GatewayConfig) ICallbackService {
+	callbackConfigs := make(map[string]config.CallbackConfig, len(gatewayConfigs))
+	for _, gatewayConfig := range gatewayConfigs {
+		callbackConfigs[gatewayConfig.Name] = gatewayConfig.Callback
+	}
+
+	callbackGateways := make(map[string]callbackGateway, len(gateways))
+	for _, gateway := range gateways {
+		parser, ok := paymentgateway.AsCallbackParser(gateway)
+		callbackConfig := callbackConfigs[gateway.Name()]
+		if !ok || callbackConfig.Secret == "" {
+			continue
+		}
+		callbackGateways[gateway.Name()] = callbackGateway{parser: parser, config: callbackConfig}
+	}
+
+	return &CallbackService{
+		TransactionService: transactionService,
+		CallbackRepository: callbackRepository,
+		gateways:           callbackGateways,
+		now:                time.Now,
+	}
+}
+
+func (cs *CallbackService) HandleCallback(ctx context.Context, gatewayName string, signature model.CallbackSignature, body []byte) error {
+	gateway, ok := cs.gateways[gatewayName]
+	if !ok {
+		return ErrUnknownCallbackGateway
+	}
+
+	if err := cs.verify(ctx, gatewayName, gateway.config, signature, body); err != nil {
+		return err
+	}
+
+	// the nonce is only used up by a callback that was applied, the gateway retries the others with the same nonce
+	err := cs.apply(ctx, gatewayName, gateway.parser, signature, body)
+	if err != nil {
+		if deleteErr := cs.CallbackRepository.DeleteNonce(context.Background(), gatewayName, signature.Nonce); deleteErr != nil {
+			logger.WithRequestID(ctx).Errorf("failed to delete the nonce of a failed callback: %v", deleteErr)
+		}
+	}
+	return err
+}
+
+func (cs *CallbackService) apply(ctx context.Context, gatewayName string, parser paymentgateway.CallbackParser, signature model.CallbackSignature, body []byte) error {
+	callback, err := parser.ParseCallback(body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCallbackPayload, err)
+	}
+
+	data := callback.Data
+	if data.TransactionID == "" {
+		return fmt.Errorf("%w: transaction_id is required", ErrInvalidCallbackPayload)
+	}
+	if data.Status != model.TransactionStatusSuccess && data.Status != model.TransactionStatusFailed && data.Status != model.TransactionStatusPending {
+		return fmt.Errorf("%w: invalid status value %q", ErrInvalidCallbackPayload, data.Status)
+	}
+
+	// the gateway sends the ID it gave the transaction, it can only find the transactions it processed
+	transaction, err := cs.TransactionService.GetTransactionByGatewayReference(ctx, gatewayName, data.TransactionID)
+	if err != nil {
+		return err
+	}
+	if data.AccountID != "" && data.AccountID != transaction.Data.AccountID {
+		return fmt.Errorf("%w: transaction does not belong to account", ErrInvalidCallbackPayload)
+	}
+
+	logger.WithRequestID(ctx).Infof("payment gateway %s callback: transaction %s is %s", gatewayName, data.TransactionID, data.Status)
+
+	// the nonce identifies the callback in the gateway's records and in the logs
+	event := model.TransactionEvent{Type: model.TransactionEventCallback, Source: gatewayName, PayloadReference: signature.Nonce}
+	return cs.TransactionService.UpdateTransaction(ctx, transaction.Data.AccountID, transaction.Data.TransactionID, data.Status, event)
+}
+
+// verify rejects callbacks that are not signed with the gateway secret, too old or too far in the future, or replayed.
+// The nonce is only recorded once the signature is valid, so that nobody else can use up the gateway's nonces
+func (cs *CallbackService) verify(ctx context.Context, gatewayName string, callbackConfig config.CallbackConfig, signature model.CallbackSignature, body []byte) error {
+	if signature.Nonce == "" {
+		return fmt.Errorf("%w: the nonce is missing", paymentgateway.ErrInvalidCallbackSignature)
+	}
+
+	unixSeconds, err := strconv.ParseInt(signature.Timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: the timestamp is invalid", paymentgateway.ErrInvalidCallbackSignature)
+	}
+
+	now := cs.now()
+	age := now.Sub(time.Unix(unixSeconds, 0))
+	if age > callbackConfig.Tolerance || age < -callbackConfig.Tolerance {
+		return ErrStaleCallback
+	}
+
+	err = paymentgateway.VerifyCallbackSignature(callbackConfig.Secret, signature.Timestamp, signature.Nonce, body, signature.Signature)
+	if err != nil {
+		return err
+	}
+
+	saved, err := cs.CallbackRepository.SaveNonce(ctx, gatewayName, signature.Nonce, now)
+	if err != nil {
+		return err
+	}
+	if !saved {
+		return ErrReplayedCallback
+	}
+
+	// nonces older than the tolerance can go, their callbacks would be rejected by the timestamp check
+	if err := cs.CallbackRepository.DeleteNonces(ctx, now.Add(-2*callbackConfig.Tolerance)); err != nil {
+		logger.WithRequestID(ctx).Errorf("failed to delete old callback nonces: %v", err)
+	}
+
+	return nil
+}
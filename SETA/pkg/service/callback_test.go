@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/config"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testCallbackSecret = "s3cret"
+
+func callbackTestService(now time.Time) (*repository.MockTransactionRepository, ICallbackService) {
+	pending := model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusPendingDAO, Type: model.TransactionTypeDepositDAO, GatewayName: "gatewaya", GatewayReference: "gw123"}
+	mockRepo := repository.MockTransactionRepositoryProvider(&pending, false, nil)
+	gateways := []paymentgateway.IPaymentGateway{
+		// the callback parser is found through the wrappers
+		paymentgateway.CircuitBreakerProvider(&paymentgateway.MockClient{GatewayName: "gatewaya"}, config.CircuitBreakerConfig{FailureThreshold: 1}),
+		&paymentgateway.MockClient{GatewayName: "gatewayb"},
+	}
+	gatewayConfigs := []config.GatewayConfig{
+		{Name: "gatewaya", Callback: config.CallbackConfig{Secret: testCallbackSecret, Tolerance: time.Minute}},
+		{Name: "gatewayb", Callback: config.CallbackConfig{Secret: testCallbackSecret, Tolerance: time.Minute}},
+	}
+
+	transactionService := TransactionServiceProvider(mockRepo, nil)
+	callbackService := CallbackServiceProvider(transactionService, repository.MockCallbackRepositoryProvider(), gateways, gatewayConfigs)
+	callbackService.(*CallbackService).now = func() time.Time { return now }
+	return mockRepo, callbackService
+}
+
+func signedCallback(timestamp time.Time, nonce string, body string) model.CallbackSignature {
+	unixSeconds := strconv.FormatInt(timestamp.Unix(), 10)
+	return model.CallbackSignature{
+		Timestamp: unixSeconds,
+		Nonce:     nonce,
+		Signature: paymentgateway.SignCallback(testCallbackSecret, unixSeconds, nonce, []byte(body)),
+	}
+}
+
+func TestHandleCallback_Success(t *testing.T) {
+	now := time.Now()
+	mockRepo, callbackService := callbackTestService(now)
+	body := `{"data": {"transaction_id": "gw123", "account_id": "acc123", "status": "success"}}`
+
+	err := callbackService.HandleCallback(context.Background(), "gatewaya", signedCallback(now, "n1", body), []byte(body))
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.TransactionStatusSuccessDAO, mockRepo.Transaction.Status)
+	assert.Equal(t, []model.TransactionEventDAO{{TransactionID: "txn123", AccountID: "acc123", Type: "callback", Source: "gatewaya", PreviousStatus: "pending", Status: "success", PayloadReference: "n1"}}, mockRepo.Events)
+}
+
+func TestHandleCallback_Rejected(t *testing.T) {
+	now := time.Now()
+	body := `{"data": {"transaction_id": "gw123", "account_id": "acc123", "status": "success"}}`
+
+	tamperedSignature := signedCallback(now, "n1", body)
+	tamperedSignature.Signature = paymentgateway.SignCallback("guessed", tamperedSignature.Timestamp, "n1", []byte(body))
+
+	testCases := map[string]struct {
+		gateway   string
+		signature model.CallbackSignature
+		body      string
+		expected  error
+	}{
+		"unknown gateway":   {"gatewayc", signedCallback(now, "n1", body), body, ErrUnknownCallbackGateway},
+		"wrong secret":      {"gatewaya", tamperedSignature, body, paymentgateway.ErrInvalidCallbackSignature},
+		"tampered body":     {"gatewaya", signedCallback(now, "n1", body), `{"data": {"transaction_id": "gw123", "account_id": "acc123", "status": "failed"}}`, paymentgateway.ErrInvalidCallbackSignature},
+		"missing nonce":     {"gatewaya", signedCallback(now, "", body), body, paymentgateway.ErrInvalidCallbackSignature},
+		"stale":             {"gatewaya", signedCallback(now.Add(-2*time.Minute), "n1", body), body, ErrStaleCallback},
+		"future":            {"gatewaya", signedCallback(now.Add(2*time.Minute), "n1", body), body, ErrStaleCallback},
+		"invalid status":    {"gatewaya", signedCallback(now, "n1", `{"data": {"transaction_id": "gw123", "status": "done"}}`), `{"data": {"transaction_id": "gw123", "status": "done"}}`, ErrInvalidCallbackPayload},
+		"other gateway txn": {"gatewayb", signedCallback(now, "n1", body), body, ErrTransactionNotFound},
+	}
+
+	for name, testCase := range testCases {
+		mockRepo, callbackService := callbackTestService(now)
+
+		err := callbackService.HandleCallback(context.Background(), testCase.gateway, testCase.signature, []byte(testCase.body))
+
+		assert.ErrorIs(t, err, testCase.expected, name)
+		assert.Equal(t, model.TransactionStatusPendingDAO, mockRepo.Transaction.Status, name)
+	}
+}
+
+func TestHandleCallback_Replayed(t *testing.T) {
+	now := time.Now()
+	_, callbackService := callbackTestService(now)
+	body := `{"data": {"transaction_id": "gw123", "account_id": "acc123", "status": "success"}}`
+	signature := signedCallback(now, "n1", body)
+
+	assert.NoError(t, callbackService.HandleCallback(context.Background(), "gatewaya", signature, []byte(body)))
+	assert.ErrorIs(t, callbackService.HandleCallback(context.Background(), "gatewaya", signature, []byte(body)), ErrReplayedCallback)
+}
+
+func TestHandleCallback_RetriedAfterFailure(t *testing.T) {
+	now := time.Now()
+	mockRepo, callbackService := callbackTestService(now)
+	body := `{"data": {"transaction_id": "gw123", "account_id": "acc123", "status": "success"}}`
+	signature := signedCallback(now, "n1", body)
+
+	mockRepo.ShouldFail, mockRepo.ExpectedError = true, errors.New("connection refused")
+	assert.Error(t, callbackService.HandleCallback(context.Background(), "gatewaya", signature, []byte(body)))
+
+	mockRepo.ShouldFail = false
+	assert.NoError(t, callbackService.HandleCallback(context.Background(), "gatewaya", signature, []byte(body)))
+	assert.Equal(t, model.TransactionStatusSuccessDAO, mockRepo.Transaction.Status)
+}
+
+func TestHandleCallback_SettlesRefundedTransaction(t *testing.T) {
+	now := time.Now()
+	mockRepo, callbackService := callbackTestService(now)
+	original := *mockRepo.Transaction
+	original.Status = model.TransactionStatusSuccessDAO
+	refund := model.TransactionDAO{TransactionID: "rfd123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusPendingDAO, Type: model.TransactionTypeRefundDAO, GatewayName: "gatewaya", GatewayReference: "gw456", ParentTransactionID: "txn123"}
+	mockRepo.Transaction, mockRepo.Transactions, mockRepo.RefundedAmount = &refund, map[string]model.TransactionDAO{"txn123": original}, "100"
+
+	// the transaction is only refunded once its gateway settles the pending refund
+	body := `{"data": {"transaction_id": "gw456", "account_id": "acc123", "status": "success"}}`
+	err := callbackService.HandleCallback(context.Background(), "gatewaya", signedCallback(now, "n1", body), []byte(body))
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.TransactionStatusSuccessDAO, mockRepo.Transaction.Status)
+	assert.Equal(t, model.TransactionStatusRefundedDAO, mockRepo.Transactions["txn123"].Status)
+}
+
+func TestHandleCallback_FailedRefund(t *testing.T) {
+	now := time.Now()
+	mockRepo, callbackService := callbackTestService(now)
+	original := *mockRepo.Transaction
+	original.Status = model.TransactionStatusSuccessDAO
+	refund := model.TransactionDAO{TransactionID: "rfd123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusPendingDAO, Type: model.TransactionTypeRefundDAO, GatewayName: "gatewaya", GatewayReference: "gw456", ParentTransactionID: "txn123"}
+	mockRepo.Transaction, mockRepo.Transactions, mockRepo.RefundedAmount = &refund, map[string]model.TransactionDAO{"txn123": original}, "100"
+
+	body := `{"data": {"transaction_id": "gw456", "account_id": "acc123", "status": "failed"}}`
+	err := callbackService.HandleCallback(context.Background(), "gatewaya", signedCallback(now, "n1", body), []byte(body))
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.TransactionStatusFailedDAO, mockRepo.Transaction.Status)
+	assert.Equal(t, model.TransactionStatusSuccessDAO, mockRepo.Transactions["txn123"].Status)
+}
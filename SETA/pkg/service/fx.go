@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrInvalidFXRate    = errors.New("invalid exchange rate")
+	ErrFXRateNotFound   = errors.New("no exchange rate for the currency pair")
+	ErrQuoteNotFound    = errors.New("fx quote not found")
+	ErrQuoteUnavailable = errors.New("fx quote has expired or was already used")
+	ErrQuoteMismatch    = errors.New("fx quote does not match the transaction")
+)
+
+// DefaultQuoteTTL is how long a quote locks its rate when FX_QUOTE_TTL is not set
+const DefaultQuoteTTL = 30 * time.Second
+
+type IFXService interface {
+	// SaveRates validates and stores the rates, a rate without a start is valid from now on
+	SaveRates(ctx context.Context, rates []model.FXRate) error
+	// GetRate returns the rate valid now, ErrFXRateNotFound when there is none
+	GetRate(ctx context.Context, from model.Currency, to model.Currency) (*model.FXRate, error)
+	// CreateQuote locks the current rate for the conversion of the amount until the quote expires
+	CreateQuote(ctx context.Context, from model.Currency, to model.Currency, amount decimal.Decimal) (*model.FXQuote, error)
+	// GetQuote returns a quote that can still be used, ErrQuoteNotFound or ErrQuoteUnavailable otherwise
+	GetQuote(ctx context.Context, quoteID string) (*model.FXQuote, error)
+	// UseQuote marks the quote as used, it fails with ErrQuoteUnavailable when it expired or another transaction used it
+	UseQuote(ctx context.Context, quoteID string) error
+	// ReleaseQuote makes the quote of a transaction no gateway accepted usable again until it expires
+	ReleaseQuote(ctx context.Context, quoteID string) error
+}
+
+type FXService struct {
+	FXRepository repository.IFXRepository
+	QuoteTTL     time.Duration // how long a quote locks its rate
+}
+
+func FXServiceProvider(fxRepository repository.IFXRepository, quoteTTL time.Duration) IFXService {
+	if quoteTTL <= 0 {
+		quoteTTL = DefaultQuoteTTL
+	}
+
+	return &FXService{
+		FXRepository: fxRepository,
+		QuoteTTL:     quoteTTL,
+	}
+}
+
+// ratesFile is the format of the rates file, the rates have the format of the admin API
+type ratesFile struct {
+	Rates []model.FXRate `json:"rates"`
+}
+
+// LoadRates reads the rates of a JSON rates file, they are validated when saved
+func LoadRates(filePath string) ([]model.FXRate, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fx rates: %w", err)
+	}
+
+	var file ratesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse fx rates: %w", err)
+	}
+
+	return file.Rates, nil
+}
+
+func (fs *FXService) SaveRates(ctx context.Context, rates []model.FXRate) error {
+	now := time.Now()
+	rateDAOs := make([]model.FXRateDAO, 0, len(rates))
+	for i := range rates {
+		rate := rates[i]
+		from, fromOK := model.ParseCurrency(string(rate.From))
+		to, toOK := model.ParseCurrency(string(rate.To))
+		if !fromOK || !toOK {
+			return fmt.Errorf("%w: %s to %s is not a pair of ISO 4217 currencies", ErrInvalidFXRate, rate.From, rate.To)
+		}
+		if from == to {
+			return fmt.Errorf("%w: %s cannot be converted to itself", ErrInvalidFXRate, from)
+		}
+		if !rate.Rate.IsPositive() {
+			return fmt.Errorf("%w: the rate of %s to %s must be positive", ErrInvalidFXRate, from, to)
+		}
+
+		rate.From, rate.To = from, to
+		if rate.ValidFrom.IsZero() {
+			rate.ValidFrom = now
+		}
+		if rate.ValidTo != nil && !rate.ValidTo.After(rate.ValidFrom) {
+			return fmt.Errorf("%w: the rate of %s to %s ends before it starts", ErrInvalidFXRate, from, to)
+		}
+		rateDAOs = append(rateDAOs, model.MapFXRateToFXRateDAO(&rate))
+	}
+
+	return fs.FXRepository.SaveRates(ctx, rateDAOs)
+}
+
+func (fs *FXService) GetRate(ctx context.Context, from model.Currency, to model.Currency) (*model.FXRate, error) {
+	rateDAO, err := fs.FXRepository.GetRate(ctx, string(from), string(to), time.Now())
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s to %s", ErrFXRateNotFound, from, to)
+		}
+		return nil, err
+	}
+
+	rate := model.MapFXRateDAOToFXRate(&rateDAO)
+	return &rate, nil
+}
+
+func (fs *FXService) CreateQuote(ctx context.Context, from model.Currency, to model.Currency, amount decimal.Decimal) (*model.FXQuote, error) {
+	from, fromOK := model.ParseCurrency(string(from))
+	to, toOK := model.ParseCurrency(string(to))
+	if !fromOK || !toOK {
+		return nil, fmt.Errorf("%w: %s to %s", ErrUnsupportedCurrency, from, to)
+	}
+	if from == to {
+		return nil, fmt.Errorf("%w: %s cannot be converted to itself", ErrUnsupportedCurrency, from)
+	}
+	if !from.IsValidAmount(amount) {
+		return nil, fmt.Errorf("%w: %s has %d decimals", ErrInvalidAmountPrecision, from, from.MinorUnits())
+	}
+
+	rate, err := fs.GetRate(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := &model.FXQuote{
+		QuoteID:         uuid.New().String(),
+		From:            from,
+		To:              to,
+		Rate:            rate.Rate,
+		Amount:          amount,
+		ConvertedAmount: model.Convert(amount, rate.Rate, to),
+		ExpiresAt:       time.Now().Add(fs.QuoteTTL),
+	}
+
+	if err := fs.FXRepository.CreateQuote(ctx, model.MapFXQuoteToFXQuoteDAO(quote)); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+func (fs *FXService) GetQuote(ctx context.Context, quoteID string) (*model.FXQuote, error) {
+	// quote IDs are UUIDs, anything else cannot be one
+	if _, err := uuid.Parse(quoteID); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrQuoteNotFound, quoteID)
+	}
+
+	quoteDAO, err := fs.FXRepository.GetQuote(ctx, quoteID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrQuoteNotFound, quoteID)
+		}
+		return nil, err
+	}
+
+	if quoteDAO.UsedAt != nil || !quoteDAO.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: %s", ErrQuoteUnavailable, quoteID)
+	}
+
+	quote := model.MapFXQuoteDAOToFXQuote(&quoteDAO)
+	return &quote, nil
+}
+
+func (fs *FXService) UseQuote(ctx context.Context, quoteID string) error {
+	used, err := fs.FXRepository.UseQuote(ctx, quoteID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !used {
+		return fmt.Errorf("%w: %s", ErrQuoteUnavailable, quoteID)
+	}
+	return nil
+}
+
+func (fs *FXService) ReleaseQuote(ctx context.Context, quoteID string) error {
+	return fs.FXRepository.ReleaseQuote(ctx, quoteID)
+}
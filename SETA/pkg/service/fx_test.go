@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFXService_GetRate(t *testing.T) {
+	fx := FXServiceProvider(repository.MockFXRepositoryProvider(), time.Minute)
+	expired := time.Now().Add(-time.Hour)
+	err := fx.SaveRates(context.Background(), []model.FXRate{
+		{From: "EUR", To: "USD", Rate: decimal.RequireFromString("1.05"), ValidFrom: time.Now().Add(-2 * time.Hour), ValidTo: &expired},
+		{From: "eur", To: "usd", Rate: decimal.RequireFromString("1.1"), ValidFrom: time.Now().Add(-time.Minute)},
+		{From: "EUR", To: "USD", Rate: decimal.RequireFromString("1.2"), ValidFrom: time.Now().Add(time.Hour)},
+	})
+	assert.NoError(t, err)
+
+	// the latest rate that is valid now, neither the expired one nor the one that has not started yet
+	rate, err := fx.GetRate(context.Background(), "EUR", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.1", rate.Rate.String())
+
+	_, err = fx.GetRate(context.Background(), "USD", "EUR")
+	assert.ErrorIs(t, err, ErrFXRateNotFound)
+}
+
+func TestFXService_SaveRates_Invalid(t *testing.T) {
+	validFrom := time.Now()
+	testCases := map[string]model.FXRate{
+		"unknown currency": {From: "XYZ", To: "USD", Rate: decimal.NewFromInt(1)},
+		"same currency":    {From: "USD", To: "USD", Rate: decimal.NewFromInt(1)},
+		"zero rate":        {From: "EUR", To: "USD", Rate: decimal.Zero},
+		"empty window":     {From: "EUR", To: "USD", Rate: decimal.NewFromInt(1), ValidFrom: validFrom, ValidTo: &validFrom},
+	}
+
+	for name, rate := range testCases {
+		fx := FXServiceProvider(repository.MockFXRepositoryProvider(), time.Minute)
+		err := fx.SaveRates(context.Background(), []model.FXRate{rate})
+		assert.ErrorIs(t, err, ErrInvalidFXRate, name)
+	}
+}
+
+func TestFXService_Quote(t *testing.T) {
+	mockFXRepo := repository.MockFXRepositoryProvider()
+	fx := FXServiceProvider(mockFXRepo, time.Minute)
+	assert.NoError(t, fx.SaveRates(context.Background(), []model.FXRate{{From: "EUR", To: "JPY", Rate: decimal.RequireFromString("161.237")}}))
+
+	quote, err := fx.CreateQuote(context.Background(), "EUR", "JPY", decimal.RequireFromString("10.50"))
+	assert.NoError(t, err)
+	// rounded to the minor units of the target currency
+	assert.Equal(t, "1693", quote.ConvertedAmount.String())
+
+	// a quote is used once, unless the transaction it was used for is released
+	assert.NoError(t, fx.UseQuote(context.Background(), quote.QuoteID))
+	_, err = fx.GetQuote(context.Background(), quote.QuoteID)
+	assert.ErrorIs(t, err, ErrQuoteUnavailable)
+	assert.ErrorIs(t, fx.UseQuote(context.Background(), quote.QuoteID), ErrQuoteUnavailable)
+	assert.NoError(t, fx.ReleaseQuote(context.Background(), quote.QuoteID))
+	assert.NoError(t, fx.UseQuote(context.Background(), quote.QuoteID))
+
+	// an expired quote cannot be used
+	expired, err := fx.CreateQuote(context.Background(), "EUR", "JPY", decimal.NewFromInt(1))
+	assert.NoError(t, err)
+	quoteDAO := mockFXRepo.Quotes[expired.QuoteID]
+	quoteDAO.ExpiresAt = time.Now().Add(-time.Second)
+	mockFXRepo.Quotes[expired.QuoteID] = quoteDAO
+	assert.ErrorIs(t, fx.UseQuote(context.Background(), expired.QuoteID), ErrQuoteUnavailable)
+
+	_, err = fx.GetQuote(context.Background(), "not-a-quote")
+	assert.ErrorIs(t, err, ErrQuoteNotFound)
+	_, err = fx.CreateQuote(context.Background(), "JPY", "EUR", decimal.NewFromInt(1))
+	assert.ErrorIs(t, err, ErrFXRateNotFound)
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"seta/pkg/config"
+	"seta/pkg/logger"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrIdempotencyKeyInFlight = errors.New("a request with the idempotency key is still in progress")
+	ErrIdempotencyKeyMismatch = errors.New("the idempotency key was already used for another request")
+)
+
+type IIdempotencyService interface {
+	// Begin claims the key for the request with the hash and returns nil, the request can then be processed. When the
+	// key was already used for the same request its stored response is returned instead, ErrIdempotencyKeyInFlight
+	// while that request is still processed. A key used for another request fails with ErrIdempotencyKeyMismatch
+	Begin(ctx context.Context, key string, requestHash string) (*model.IdempotentResponse, error)
+	// Complete stores the final response of the request the key was claimed for, it is replayed until the key expires
+	Complete(ctx context.Context, key string, response model.IdempotentResponse) error
+	// Release forgets the key of a request that did not complete, so that it can be retried with the same key
+	Release(ctx context.Context, key string) error
+}
+
+type IdempotencyService struct {
+	IdempotencyRepository repository.IIdempotencyRepository
+	TTL                   time.Duration // how long a key is kept, from the time it was claimed
+}
+
+func IdempotencyServiceProvider(idempotencyRepository repository.IIdempotencyRepository, ttl time.Duration) IIdempotencyService {
+	if ttl <= 0 {
+		ttl = config.DefaultIdempotencyKeyTTL
+	}
+
+	return &IdempotencyService{
+		IdempotencyRepository: idempotencyRepository,
+		TTL:                   ttl,
+	}
+}
+
+func (is *IdempotencyService) Begin(ctx context.Context, key string, requestHash string) (*model.IdempotentResponse, error) {
+	return is.begin(ctx, key, requestHash, false)
+}
+
+func (is *IdempotencyService) begin(ctx context.Context, key string, requestHash string, retried bool) (*model.IdempotentResponse, error) {
+	now := time.Now()
+	claimed, err := is.IdempotencyRepository.ClaimKey(ctx, key, requestHash, now, now.Add(is.TTL))
+	if err != nil {
+		return nil, err
+	}
+	if claimed {
+		// an expired key is claimed again when it is reused, the others are forgotten here
+		if err := is.IdempotencyRepository.DeleteExpiredKeys(ctx, now); err != nil {
+			logger.WithRequestID(ctx).Errorf("failed to delete expired idempotency keys: %v", err)
+		}
+		return nil, nil
+	}
+
+	keyDAO, err := is.IdempotencyRepository.GetKey(ctx, key)
+	if err != nil {
+		// the request of the key was released in the meantime, the key is claimed again once
+		if errors.Is(err, pgx.ErrNoRows) {
+			if !retried {
+				return is.begin(ctx, key, requestHash, true)
+			}
+			return nil, ErrIdempotencyKeyInFlight
+		}
+		return nil, err
+	}
+
+	if keyDAO.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyMismatch
+	}
+	if keyDAO.StatusCode == 0 {
+		return nil, ErrIdempotencyKeyInFlight
+	}
+
+	response := model.MapIdempotencyKeyDAOToIdempotentResponse(&keyDAO)
+	return &response, nil
+}
+
+func (is *IdempotencyService) Complete(ctx context.Context, key string, response model.IdempotentResponse) error {
+	return is.IdempotencyRepository.CompleteKey(ctx, key, response.StatusCode, response.Body)
+}
+
+func (is *IdempotencyService) Release(ctx context.Context, key string) error {
+	return is.IdempotencyRepository.ReleaseKey(ctx, key)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyService_Replay(t *testing.T) {
+	idempotency := IdempotencyServiceProvider(repository.MockIdempotencyRepositoryProvider(), time.Hour)
+	ctx := context.Background()
+
+	stored, err := idempotency.Begin(ctx, "key1", "hash1")
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+
+	// the same request while the first one is processed
+	_, err = idempotency.Begin(ctx, "key1", "hash1")
+	assert.ErrorIs(t, err, ErrIdempotencyKeyInFlight)
+
+	response := model.IdempotentResponse{StatusCode: 200, Body: []byte(`{"data": {"transaction_id": "txn123"}}`)}
+	assert.NoError(t, idempotency.Complete(ctx, "key1", response))
+
+	stored, err = idempotency.Begin(ctx, "key1", "hash1")
+	assert.NoError(t, err)
+	assert.Equal(t, &response, stored)
+
+	// another request with the key, whether the first one completed or not
+	_, err = idempotency.Begin(ctx, "key1", "hash2")
+	assert.ErrorIs(t, err, ErrIdempotencyKeyMismatch)
+}
+
+func TestIdempotencyService_Release(t *testing.T) {
+	idempotency := IdempotencyServiceProvider(repository.MockIdempotencyRepositoryProvider(), time.Hour)
+	ctx := context.Background()
+
+	_, err := idempotency.Begin(ctx, "key1", "hash1")
+	assert.NoError(t, err)
+	assert.NoError(t, idempotency.Release(ctx, "key1"))
+
+	// a request that did not complete can be made again with its key
+	stored, err := idempotency.Begin(ctx, "key1", "hash1")
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+
+	// a completed one keeps its response
+	assert.NoError(t, idempotency.Complete(ctx, "key1", model.IdempotentResponse{StatusCode: 422, Body: []byte(`{}`)}))
+	assert.NoError(t, idempotency.Release(ctx, "key1"))
+	stored, err = idempotency.Begin(ctx, "key1", "hash1")
+	assert.NoError(t, err)
+	assert.Equal(t, 422, stored.StatusCode)
+}
+
+func TestIdempotencyService_Expiry(t *testing.T) {
+	mockRepo := repository.MockIdempotencyRepositoryProvider()
+	idempotency := IdempotencyServiceProvider(mockRepo, time.Hour)
+	ctx := context.Background()
+
+	mockRepo.Keys["expired"] = model.IdempotencyKeyDAO{Key: "expired", RequestHash: "hash1", StatusCode: 200, Response: []byte(`{}`), ExpiresAt: time.Now().Add(-time.Minute)}
+	mockRepo.Keys["old"] = model.IdempotencyKeyDAO{Key: "old", RequestHash: "hash1", StatusCode: 200, Response: []byte(`{}`), ExpiresAt: time.Now().Add(-time.Minute)}
+
+	// an expired key is a new key, even for another request
+	stored, err := idempotency.Begin(ctx, "expired", "hash2")
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+	assert.Equal(t, "hash2", mockRepo.Keys["expired"].RequestHash)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), mockRepo.Keys["expired"].ExpiresAt, time.Minute)
+
+	// and the other expired keys are forgotten
+	assert.NotContains(t, mockRepo.Keys, "old")
+}
+
+// releasingIdempotencyRepository releases the key of the first request between its claim and its read
+type releasingIdempotencyRepository struct {
+	*repository.MockIdempotencyRepository
+	released bool
+}
+
+func (r *releasingIdempotencyRepository) GetKey(ctx context.Context, key string) (model.IdempotencyKeyDAO, error) {
+	if !r.released {
+		r.released = true
+		_ = r.ReleaseKey(ctx, key)
+	}
+	return r.MockIdempotencyRepository.GetKey(ctx, key)
+}
+
+func TestIdempotencyService_ReleasedWhileClaimed(t *testing.T) {
+	repo := &releasingIdempotencyRepository{MockIdempotencyRepository: repository.MockIdempotencyRepositoryProvider()}
+	idempotency := IdempotencyServiceProvider(repo, time.Hour)
+	ctx := context.Background()
+
+	_, err := idempotency.Begin(ctx, "key1", "hash1")
+	assert.NoError(t, err)
+
+	// the first request is released while the retry reads its key, the retry claims it
+	stored, err := idempotency.Begin(ctx, "key1", "hash1")
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+	assert.Contains(t, repo.Keys, "key1")
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/shopspring/decimal"
+)
+
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+type ILedgerService interface {
+	// HoldWithdrawal reserves the amount of a withdrawal or of the refund of a deposit on the account before any gateway
+	// is called, it fails with ErrInsufficientFunds when the available balance does not cover it
+	HoldWithdrawal(ctx context.Context, accountID string, amount decimal.Decimal, currency model.Currency) (string, error)
+	// AttachHold links a hold to the withdrawal a gateway accepted, so that the hold settles with the transaction
+	AttachHold(ctx context.Context, holdID string, transactionID string) error
+	// ReleaseHold makes the amount of a withdrawal no gateway accepted available again
+	ReleaseHold(ctx context.Context, holdID string) error
+	// Apply posts what the status of the transaction means for the ledger. Postings are idempotent, so it is called
+	// after every change of the transaction
+	Apply(ctx context.Context, transaction model.TransactionDAO) error
+	// GetBalance returns the balance of the account in the currency
+	GetBalance(ctx context.Context, accountID string, currency model.Currency) (*model.AccountBalance, error)
+}
+
+type LedgerService struct {
+	LedgerRepository      repository.ILedgerRepository
+	TransactionRepository repository.ITransactionRepository // a refund posts the opposite of the transaction it undoes
+}
+
+func LedgerServiceProvider(ledgerRepository repository.ILedgerRepository, transactionRepository repository.ITransactionRepository) ILedgerService {
+	return &LedgerService{
+		LedgerRepository:      ledgerRepository,
+		TransactionRepository: transactionRepository,
+	}
+}
+
+func (ls *LedgerService) HoldWithdrawal(ctx context.Context, accountID string, amount decimal.Decimal, currency model.Currency) (string, error) {
+	hold := model.LedgerHoldDAO{
+		HoldID:    uuid.New().String(),
+		AccountID: accountID,
+		Amount:    amount.String(),
+		Currency:  string(currency),
+	}
+	entry := transfer("hold:"+hold.HoldID, "", amount, model.AvailableLedgerAccount(accountID, currency), model.HeldLedgerAccount(accountID, currency))
+
+	err := ls.LedgerRepository.CreateHold(ctx, hold, entry)
+	if err != nil {
+		if errors.Is(err, repository.ErrInsufficientFunds) {
+			return "", fmt.Errorf("%w: the available balance does not cover %s %s", ErrInsufficientFunds, amount, currency)
+		}
+		return "", err
+	}
+
+	return hold.HoldID, nil
+}
+
+func (ls *LedgerService) AttachHold(ctx context.Context, holdID string, transactionID string) error {
+	return ls.LedgerRepository.AttachHold(ctx, holdID, transactionID)
+}
+
+func (ls *LedgerService) ReleaseHold(ctx context.Context, holdID string) error {
+	hold, err := ls.LedgerRepository.GetHold(ctx, holdID)
+	if err != nil {
+		return err
+	}
+
+	return ls.closeHold(ctx, hold, model.LedgerHoldStatusReleasedDAO, nil)
+}
+
+func (ls *LedgerService) Apply(ctx context.Context, transaction model.TransactionDAO) error {
+	availableAccount := model.AvailableLedgerAccount(transaction.AccountID, model.Currency(transaction.Currency))
+
+	switch transaction.Type {
+	case model.TransactionTypeDepositDAO:
+		// the money is on the account once the deposit settled, whatever was refunded since is posted by the refunds
+		if settled(transaction.Status) {
+			return ls.LedgerRepository.Post(ctx, gatewayTransfer("deposit:"+transaction.TransactionID, transaction, availableAccount, false))
+		}
+
+	case model.TransactionTypeWithdrawDAO:
+		hold, err := ls.LedgerRepository.GetTransactionHold(ctx, transaction.TransactionID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// a withdrawal made before the ledger existed has nothing to settle
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return ls.settleHold(ctx, hold, transaction)
+
+	case model.TransactionTypeRefundDAO:
+		// the refund of a deposit settles the hold it was made with
+		hold, err := ls.LedgerRepository.GetTransactionHold(ctx, transaction.TransactionID)
+		if err == nil {
+			return ls.settleHold(ctx, hold, transaction)
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		if transaction.Status != model.TransactionStatusSuccessDAO {
+			return nil
+		}
+
+		original, err := ls.TransactionRepository.GetAccountTransaction(ctx, transaction.AccountID, transaction.ParentTransactionID)
+		if err != nil {
+			return err
+		}
+
+		// a refunded deposit leaves the account, a refunded withdrawal comes back to it
+		reference := "refund:" + transaction.TransactionID
+		return ls.LedgerRepository.Post(ctx, gatewayTransfer(reference, transaction, availableAccount, original.Type == model.TransactionTypeDepositDAO))
+	}
+
+	// a reversal has nothing to post, the reversed withdrawal releases its own hold
+	return nil
+}
+
+func (ls *LedgerService) GetBalance(ctx context.Context, accountID string, currency model.Currency) (*model.AccountBalance, error) {
+	availableAccount := model.AvailableLedgerAccount(accountID, currency)
+	heldAccount := model.HeldLedgerAccount(accountID, currency)
+
+	balances, err := ls.LedgerRepository.GetBalances(ctx, []string{availableAccount, heldAccount})
+	if err != nil {
+		return nil, err
+	}
+
+	balance := &model.AccountBalance{AccountID: accountID, Currency: currency}
+	if available, ok := balances[availableAccount]; ok {
+		balance.Available = decimal.RequireFromString(available)
+	}
+	if held, ok := balances[heldAccount]; ok {
+		balance.Held = decimal.RequireFromString(held)
+	}
+	return balance, nil
+}
+
+// settleHold captures the hold of a settled transaction and releases the one of a failed or reversed transaction
+func (ls *LedgerService) settleHold(ctx context.Context, hold model.LedgerHoldDAO, transaction model.TransactionDAO) error {
+	switch {
+	case settled(transaction.Status):
+		return ls.closeHold(ctx, hold, model.LedgerHoldStatusCapturedDAO, &transaction)
+	case transaction.Status == model.TransactionStatusFailedDAO, transaction.Status == model.TransactionStatusReversedDAO:
+		return ls.closeHold(ctx, hold, model.LedgerHoldStatusReleasedDAO, nil)
+	}
+	return nil
+}
+
+// closeHold captures the hold to the gateway of the withdrawal or releases it back to the available balance, the
+// withdrawal is only needed for a capture
+func (ls *LedgerService) closeHold(ctx context.Context, hold model.LedgerHoldDAO, status model.LedgerHoldStatusDAO, withdrawal *model.TransactionDAO) error {
+	currency := model.Currency(hold.Currency)
+	reference := string(status) + ":" + hold.HoldID
+	heldAccount := model.HeldLedgerAccount(hold.AccountID, currency)
+
+	entry := transfer(reference, hold.TransactionID, decimal.RequireFromString(hold.Amount), heldAccount, model.AvailableLedgerAccount(hold.AccountID, currency))
+	if status == model.LedgerHoldStatusCapturedDAO {
+		entry = gatewayTransfer(reference, *withdrawal, heldAccount, true)
+	}
+	return ls.LedgerRepository.CloseHold(ctx, hold, status, entry)
+}
+
+// settled reports whether the money of the transaction moved, refunds are posted separately
+func settled(status model.TransactionStatusDAO) bool {
+	return status == model.TransactionStatusSuccessDAO || status == model.TransactionStatusPartiallyRefundedDAO || status == model.TransactionStatusRefundedDAO
+}
+
+// gatewayTransfer is the entry that moves the amount of the transaction between a ledger account of its account and
+// its gateway. A converted transaction goes through the fx accounts of both currencies, so that the postings of each
+// currency still add up to zero
+func gatewayTransfer(reference string, transaction model.TransactionDAO, ledgerAccount string, toGateway bool) model.LedgerEntryDAO {
+	amount := decimal.RequireFromString(transaction.Amount)
+	currency := model.Currency(transaction.Currency)
+	if transaction.ConvertedCurrency == "" {
+		gatewayAccount := model.GatewayLedgerAccount(transaction.GatewayName, currency)
+		if toGateway {
+			return transfer(reference, transaction.TransactionID, amount, ledgerAccount, gatewayAccount)
+		}
+		return transfer(reference, transaction.TransactionID, amount, gatewayAccount, ledgerAccount)
+	}
+
+	convertedAmount := decimal.RequireFromString(transaction.ConvertedAmount)
+	convertedCurrency := model.Currency(transaction.ConvertedCurrency)
+	if !toGateway {
+		amount, convertedAmount = amount.Neg(), convertedAmount.Neg()
+	}
+
+	return model.LedgerEntryDAO{
+		Reference:     reference,
+		TransactionID: transaction.TransactionID,
+		Postings: []model.LedgerPostingDAO{
+			{LedgerAccountID: ledgerAccount, Amount: amount.Neg().String()},
+			{LedgerAccountID: model.FXLedgerAccount(currency), Amount: amount.String()},
+			{LedgerAccountID: model.FXLedgerAccount(convertedCurrency), Amount: convertedAmount.Neg().String()},
+			{LedgerAccountID: model.GatewayLedgerAccount(transaction.GatewayName, convertedCurrency), Amount: convertedAmount.String()},
+		},
+	}
+}
+
+// transfer is the entry that moves the amount from one ledger account to another
+func transfer(reference string, transactionID string, amount decimal.Decimal, from string, to string) model.LedgerEntryDAO {
+	return model.LedgerEntryDAO{
+		Reference:     reference,
+		TransactionID: transactionID,
+		Postings: []model.LedgerPostingDAO{
+			{LedgerAccountID: from, Amount: amount.Neg().String()},
+			{LedgerAccountID: to, Amount: amount.String()},
+		},
+	}
+}
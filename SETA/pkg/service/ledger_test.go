@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+	"seta/pkg/routing"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func ledgerTestService() (*repository.MockLedgerRepository, *paymentgateway.MockClient, ITransactionService, ILedgerService) {
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	mockLedgerRepo := repository.MockLedgerRepositoryProvider()
+	ledger := LedgerServiceProvider(mockLedgerRepo, mockRepo)
+	mockPaymentGatewayClient := &paymentgateway.MockClient{GatewayName: "gatewaya", StatusCode: 200}
+	gateways := []paymentgateway.IPaymentGateway{mockPaymentGatewayClient}
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider(gateways), WithPaymentGateways(gateways), WithLedger(ledger))
+	return mockLedgerRepo, mockPaymentGatewayClient, service, ledger
+}
+
+// gatewayResponds sets the transaction the mock gateway returns for the next call
+func gatewayResponds(mockPaymentGatewayClient *paymentgateway.MockClient, transactionID string, transactionType model.TransactionType, amount int64, status model.TransactionStatus) {
+	mockPaymentGatewayClient.TransactionResponse = &model.TransactionResponse{Data: model.TransactionData{
+		TransactionID: transactionID,
+		AccountID:     "acc123",
+		Amount:        decimal.NewFromInt(amount),
+		Status:        status,
+		Type:          transactionType,
+	}}
+}
+
+// fund gives the account a balance, as a settled deposit through gatewaya would
+func fund(mockLedgerRepo *repository.MockLedgerRepository, amount int64) {
+	mockLedgerRepo.Balances[model.AvailableLedgerAccount("acc123", "USD")] = decimal.NewFromInt(amount)
+	mockLedgerRepo.Balances[model.GatewayLedgerAccount("gatewaya", "USD")] = decimal.NewFromInt(-amount)
+}
+
+func assertBalance(t *testing.T, ledger ILedgerService, available int64, held int64) {
+	balance, err := ledger.GetBalance(context.Background(), "acc123", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, decimal.NewFromInt(available).String(), balance.Available.String(), "available")
+	assert.Equal(t, decimal.NewFromInt(held).String(), balance.Held.String(), "held")
+}
+
+// assertBalanced checks that the postings of every entry add up to zero
+func assertBalanced(t *testing.T, mockLedgerRepo *repository.MockLedgerRepository) {
+	total := decimal.Zero
+	for _, balance := range mockLedgerRepo.Balances {
+		total = total.Add(balance)
+	}
+	assert.True(t, total.IsZero(), "the ledger balances add up to %s", total)
+}
+
+func TestLedger_DepositThenWithdraw(t *testing.T) {
+	mockLedgerRepo, mockPaymentGatewayClient, service, ledger := ledgerTestService()
+
+	gatewayResponds(mockPaymentGatewayClient, "txn1", model.TransactionTypeDeposit, 100, model.TransactionStatusSuccess)
+	_, err := service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(100), "", "", model.TransactionTypeDeposit)
+	assert.NoError(t, err)
+	assertBalance(t, ledger, 100, 0)
+
+	gatewayResponds(mockPaymentGatewayClient, "txn2", model.TransactionTypeWithdraw, 30, model.TransactionStatusSuccess)
+	_, err = service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(30), "", "", model.TransactionTypeWithdraw)
+	assert.NoError(t, err)
+	assertBalance(t, ledger, 70, 0)
+	// the gateway owes what was deposited through it minus what was withdrawn
+	assert.Equal(t, "-70", mockLedgerRepo.Balances[model.GatewayLedgerAccount("gatewaya", "USD")].String())
+	assertBalanced(t, mockLedgerRepo)
+}
+
+func TestLedger_InsufficientFunds(t *testing.T) {
+	mockLedgerRepo, mockPaymentGatewayClient, service, ledger := ledgerTestService()
+	fund(mockLedgerRepo, 50)
+	gatewayResponds(mockPaymentGatewayClient, "txn1", model.TransactionTypeWithdraw, 51, model.TransactionStatusSuccess)
+
+	_, err := service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(51), "", "", model.TransactionTypeWithdraw)
+
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	assertBalance(t, ledger, 50, 0)
+}
+
+func TestLedger_PendingWithdrawSettles(t *testing.T) {
+	testCases := map[model.TransactionStatus]struct {
+		available int64
+		held      int64
+	}{
+		model.TransactionStatusPending: {70, 30},
+		model.TransactionStatusSuccess: {70, 0},
+		model.TransactionStatusFailed:  {100, 0},
+	}
+
+	for status, expected := range testCases {
+		mockLedgerRepo, mockPaymentGatewayClient, service, ledger := ledgerTestService()
+		fund(mockLedgerRepo, 100)
+		gatewayResponds(mockPaymentGatewayClient, "txn1", model.TransactionTypeWithdraw, 30, model.TransactionStatusPending)
+
+		withdrawal, err := service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(30), "", "", model.TransactionTypeWithdraw)
+		assert.NoError(t, err, status)
+
+		err = service.UpdateTransaction(context.Background(), "acc123", withdrawal.Data.TransactionID, status, model.TransactionEvent{Type: model.TransactionEventCallback, Source: "gatewaya"})
+		assert.NoError(t, err, status)
+		assertBalance(t, ledger, expected.available, expected.held)
+		assertBalanced(t, mockLedgerRepo)
+	}
+}
+
+func TestLedger_WithdrawGatewayFailedReleasesHold(t *testing.T) {
+	mockLedgerRepo, mockPaymentGatewayClient, service, ledger := ledgerTestService()
+	fund(mockLedgerRepo, 100)
+	mockPaymentGatewayClient.StatusCode = 402
+
+	_, err := service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(30), "", "", model.TransactionTypeWithdraw)
+
+	assert.Error(t, err)
+	assertBalance(t, ledger, 100, 0)
+	assertBalanced(t, mockLedgerRepo)
+}
+
+func TestLedger_RefundedDeposit(t *testing.T) {
+	mockLedgerRepo, mockPaymentGatewayClient, service, ledger := ledgerTestService()
+
+	gatewayResponds(mockPaymentGatewayClient, "txn1", model.TransactionTypeDeposit, 100, model.TransactionStatusSuccess)
+	deposit, err := service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(100), "", "", model.TransactionTypeDeposit)
+	assert.NoError(t, err)
+
+	gatewayResponds(mockPaymentGatewayClient, "rfd1", model.TransactionTypeRefund, 40, model.TransactionStatusSuccess)
+	_, err = service.RefundTransaction(context.Background(), deposit.Data.TransactionID, decimal.NewFromInt(40))
+	assert.NoError(t, err)
+
+	assertBalance(t, ledger, 60, 0)
+	assertBalanced(t, mockLedgerRepo)
+}
+
+func TestLedger_RefundedDepositAlreadyWithdrawn(t *testing.T) {
+	mockLedgerRepo, mockPaymentGatewayClient, service, ledger := ledgerTestService()
+
+	gatewayResponds(mockPaymentGatewayClient, "txn1", model.TransactionTypeDeposit, 100, model.TransactionStatusSuccess)
+	deposit, err := service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(100), "", "", model.TransactionTypeDeposit)
+	assert.NoError(t, err)
+	gatewayResponds(mockPaymentGatewayClient, "txn2", model.TransactionTypeWithdraw, 100, model.TransactionStatusSuccess)
+	_, err = service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(100), "", "", model.TransactionTypeWithdraw)
+	assert.NoError(t, err)
+
+	gatewayResponds(mockPaymentGatewayClient, "rfd1", model.TransactionTypeRefund, 100, model.TransactionStatusSuccess)
+	mockPaymentGatewayClient.IdempotencyKey = ""
+	_, err = service.RefundTransaction(context.Background(), deposit.Data.TransactionID, decimal.Zero)
+
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+	// the gateway was not asked to refund
+	assert.Empty(t, mockPaymentGatewayClient.IdempotencyKey)
+	assertBalance(t, ledger, 0, 0)
+	assertBalanced(t, mockLedgerRepo)
+}
+
+func TestLedger_RefundedDepositGatewayFailedReleasesHold(t *testing.T) {
+	mockLedgerRepo, mockPaymentGatewayClient, service, ledger := ledgerTestService()
+
+	gatewayResponds(mockPaymentGatewayClient, "txn1", model.TransactionTypeDeposit, 100, model.TransactionStatusSuccess)
+	deposit, err := service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(100), "", "", model.TransactionTypeDeposit)
+	assert.NoError(t, err)
+
+	mockPaymentGatewayClient.StatusCode = 402
+	_, err = service.RefundTransaction(context.Background(), deposit.Data.TransactionID, decimal.NewFromInt(40))
+
+	assert.Error(t, err)
+	assertBalance(t, ledger, 100, 0)
+	assertBalanced(t, mockLedgerRepo)
+}
+
+func TestLedger_BalancesPerCurrency(t *testing.T) {
+	mockLedgerRepo, mockPaymentGatewayClient, service, ledger := ledgerTestService()
+	fund(mockLedgerRepo, 100)
+
+	gatewayResponds(mockPaymentGatewayClient, "txn1", model.TransactionTypeDeposit, 5000, model.TransactionStatusSuccess)
+	_, err := service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(5000), "JPY", "", model.TransactionTypeDeposit)
+	assert.NoError(t, err)
+
+	// a deposit in one currency cannot be withdrawn in another
+	_, err = service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(101), "USD", "", model.TransactionTypeWithdraw)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	assertBalance(t, ledger, 100, 0)
+	balance, err := ledger.GetBalance(context.Background(), "acc123", "JPY")
+	assert.NoError(t, err)
+	assert.Equal(t, "5000", balance.Available.String())
+	assertBalanced(t, mockLedgerRepo)
+}
+
+func TestLedger_ConvertedWithdrawal(t *testing.T) {
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	mockLedgerRepo := repository.MockLedgerRepositoryProvider()
+	ledger := LedgerServiceProvider(mockLedgerRepo, mockRepo)
+	fx := FXServiceProvider(repository.MockFXRepositoryProvider(), time.Minute)
+	mockPaymentGatewayClient := &paymentgateway.MockClient{GatewayName: "gatewaya", StatusCode: 200}
+	gateways := []paymentgateway.IPaymentGateway{mockPaymentGatewayClient}
+	// the account is in EUR but gatewaya only settles in USD
+	router, err := routing.RulesRouterProvider(nil, gateways, map[string][]model.Currency{"gatewaya": {"USD"}}, routing.StrategyPriority, routing.PriorityRouterProvider(gateways))
+	assert.NoError(t, err)
+	service := TransactionServiceProvider(mockRepo, router, WithPaymentGateways(gateways), WithLedger(ledger), WithFX(fx))
+
+	mockLedgerRepo.Balances[model.AvailableLedgerAccount("acc123", "EUR")] = decimal.NewFromInt(200)
+	mockLedgerRepo.Balances[model.GatewayLedgerAccount("gatewayb", "EUR")] = decimal.NewFromInt(-200)
+	assert.NoError(t, fx.SaveRates(context.Background(), []model.FXRate{{From: "EUR", To: "USD", Rate: decimal.RequireFromString("1.1")}}))
+	quote, err := fx.CreateQuote(context.Background(), "EUR", "USD", decimal.NewFromInt(100))
+	assert.NoError(t, err)
+
+	// without a quote, no gateway accepts EUR
+	_, err = service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(100), "EUR", "", model.TransactionTypeWithdraw)
+	assert.ErrorIs(t, err, ErrUnsupportedCurrency)
+	_, err = service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(99), "EUR", quote.QuoteID, model.TransactionTypeWithdraw)
+	assert.ErrorIs(t, err, ErrQuoteMismatch)
+
+	mockPaymentGatewayClient.TransactionResponse = &model.TransactionResponse{Data: model.TransactionData{TransactionID: "txn1", AccountID: "acc123", Amount: decimal.NewFromInt(110), Currency: "USD", Status: model.TransactionStatusSuccess, Type: model.TransactionTypeWithdraw}}
+	transactionActual, err := service.CreateTransaction(context.Background(), "acc123", decimal.Zero, "", quote.QuoteID, model.TransactionTypeWithdraw)
+	assert.NoError(t, err)
+	// the transaction is in the currency of the account, the conversion says what the gateway processed
+	assert.Equal(t, "100", transactionActual.Data.Amount.String())
+	assert.Equal(t, model.Currency("EUR"), transactionActual.Data.Currency)
+	assert.Equal(t, &model.FXConversion{QuoteID: quote.QuoteID, Rate: quote.Rate, Amount: decimal.RequireFromString("110"), Currency: "USD"}, transactionActual.Data.Conversion)
+	assert.Equal(t, "110", mockRepo.Transaction.ConvertedAmount)
+
+	balance, err := ledger.GetBalance(context.Background(), "acc123", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, "100", balance.Available.String())
+	assert.Equal(t, "110", mockLedgerRepo.Balances[model.GatewayLedgerAccount("gatewaya", "USD")].String())
+	assert.Equal(t, "100", mockLedgerRepo.Balances[model.FXLedgerAccount("EUR")].String())
+	assert.Equal(t, "-110", mockLedgerRepo.Balances[model.FXLedgerAccount("USD")].String())
+	assertBalanced(t, mockLedgerRepo)
+
+	// the quote was used
+	_, err = service.CreateTransaction(context.Background(), "acc123", decimal.Zero, "", quote.QuoteID, model.TransactionTypeWithdraw)
+	assert.ErrorIs(t, err, ErrQuoteUnavailable)
+
+	// a refund goes back to the gateway in USD at the rate of the withdrawal
+	mockPaymentGatewayClient.TransactionResponse = &model.TransactionResponse{Data: model.TransactionData{TransactionID: "rfd1", Currency: "USD", Status: model.TransactionStatusSuccess}}
+	refund, err := service.RefundTransaction(context.Background(), transactionActual.Data.TransactionID, decimal.NewFromInt(40))
+	assert.NoError(t, err)
+	assert.Equal(t, "40", refund.Data.Amount.String())
+	assert.Equal(t, model.Currency("EUR"), refund.Data.Currency)
+	assert.Equal(t, "44", refund.Data.Conversion.Amount.String())
+
+	balance, err = ledger.GetBalance(context.Background(), "acc123", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, "140", balance.Available.String())
+	assert.Equal(t, "66", mockLedgerRepo.Balances[model.GatewayLedgerAccount("gatewaya", "USD")].String())
+	assertBalanced(t, mockLedgerRepo)
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrLimitExceeded = errors.New("transaction limit exceeded")
+
+// DefaultCountWindow is the window of a transaction count limit that does not give one
+const DefaultCountWindow = time.Minute
+
+type ILimitService interface {
+	// Check returns ErrLimitExceeded when the transaction would breach one of the limits of the account
+	Check(ctx context.Context, accountID string, transactionType model.TransactionType, amount decimal.Decimal, currency model.Currency) error
+}
+
+type LimitService struct {
+	LimitRepository repository.ILimitRepository
+	Rules           []model.LimitRule // the configured limits, the overrides of an account replace them
+}
+
+func LimitServiceProvider(limitRepository repository.ILimitRepository, rules []model.LimitRule) ILimitService {
+	return &LimitService{
+		LimitRepository: limitRepository,
+		Rules:           rules,
+	}
+}
+
+// limitsFile is the format of the limits file, amounts are decimal strings and windows Go durations
+type limitsFile struct {
+	Limits []struct {
+		Type          model.TransactionType `json:"type"`
+		Currency      string                `json:"currency"`
+		MinAmount     *decimal.Decimal      `json:"min_amount"`
+		MaxAmount     *decimal.Decimal      `json:"max_amount"`
+		DailyAmount   *decimal.Decimal      `json:"daily_amount"`
+		MonthlyAmount *decimal.Decimal      `json:"monthly_amount"`
+		MaxCount      *int                  `json:"max_count"`
+		CountWindow   string                `json:"count_window"`
+	} `json:"limits"`
+}
+
+// LoadLimits reads the limits of a JSON limits file, a limit without a currency applies to every currency
+func LoadLimits(filePath string) ([]model.LimitRule, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read limits: %w", err)
+	}
+
+	var file limitsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse limits: %w", err)
+	}
+
+	rules := make([]model.LimitRule, 0, len(file.Limits))
+	for _, limit := range file.Limits {
+		if limit.Type != model.TransactionTypeDeposit && limit.Type != model.TransactionTypeWithdraw {
+			return nil, fmt.Errorf("limits: invalid transaction type %q", limit.Type)
+		}
+
+		rule := model.LimitRule{
+			Type: limit.Type,
+			Limits: model.TransactionLimits{
+				MinAmount:     limit.MinAmount,
+				MaxAmount:     limit.MaxAmount,
+				DailyAmount:   limit.DailyAmount,
+				MonthlyAmount: limit.MonthlyAmount,
+				MaxCount:      limit.MaxCount,
+			},
+		}
+
+		if limit.Currency != "" {
+			var ok bool
+			if rule.Currency, ok = model.ParseCurrency(limit.Currency); !ok {
+				return nil, fmt.Errorf("limits: %q is not an ISO 4217 currency", limit.Currency)
+			}
+		}
+
+		if limit.CountWindow != "" {
+			if rule.Limits.CountWindow, err = time.ParseDuration(limit.CountWindow); err != nil || rule.Limits.CountWindow <= 0 {
+				return nil, fmt.Errorf("limits: invalid count_window %q", limit.CountWindow)
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func (ls *LimitService) Check(ctx context.Context, accountID string, transactionType model.TransactionType, amount decimal.Decimal, currency model.Currency) error {
+	accountLimitDAOs, err := ls.LimitRepository.GetAccountLimits(ctx, accountID, model.TransactionTypeDAO(transactionType))
+	if err != nil {
+		return err
+	}
+
+	overrides := make([]model.LimitRule, 0, len(accountLimitDAOs))
+	for i := range accountLimitDAOs {
+		overrides = append(overrides, model.MapAccountLimitDAOToLimitRule(&accountLimitDAOs[i]))
+	}
+
+	// the configured limits, then the overrides of the account, the limits of the currency replacing those of every currency
+	limits := model.TransactionLimits{}
+	limits = applyLimitRules(limits, ls.Rules, transactionType, currency)
+	limits = applyLimitRules(limits, overrides, transactionType, currency)
+
+	if limits.MinAmount != nil && amount.LessThan(*limits.MinAmount) {
+		return fmt.Errorf("%w: the minimum %s amount is %s %s", ErrLimitExceeded, transactionType, limits.MinAmount, currency)
+	}
+	if limits.MaxAmount != nil && amount.GreaterThan(*limits.MaxAmount) {
+		return fmt.Errorf("%w: the maximum %s amount is %s %s", ErrLimitExceeded, transactionType, limits.MaxAmount, currency)
+	}
+
+	if limits.DailyAmount == nil && limits.MonthlyAmount == nil && limits.MaxCount == nil {
+		return nil
+	}
+
+	countWindow := limits.CountWindow
+	if countWindow <= 0 {
+		countWindow = DefaultCountWindow
+	}
+
+	now := time.Now().UTC()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	usageDAO, err := ls.LimitRepository.GetUsage(ctx, accountID, model.TransactionTypeDAO(transactionType), string(currency), dayStart, monthStart, now.Add(-countWindow))
+	if err != nil {
+		return err
+	}
+	usage := model.MapLimitUsageDAOToLimitUsage(&usageDAO)
+
+	if limits.DailyAmount != nil && usage.DailyAmount.Add(amount).GreaterThan(*limits.DailyAmount) {
+		return fmt.Errorf("%w: the daily %s limit is %s %s, %s was already used", ErrLimitExceeded, transactionType, limits.DailyAmount, currency, usage.DailyAmount)
+	}
+	if limits.MonthlyAmount != nil && usage.MonthlyAmount.Add(amount).GreaterThan(*limits.MonthlyAmount) {
+		return fmt.Errorf("%w: the monthly %s limit is %s %s, %s was already used", ErrLimitExceeded, transactionType, limits.MonthlyAmount, currency, usage.MonthlyAmount)
+	}
+	if limits.MaxCount != nil && usage.Count+1 > *limits.MaxCount {
+		return fmt.Errorf("%w: at most %d %s transactions per %s", ErrLimitExceeded, *limits.MaxCount, transactionType, countWindow)
+	}
+
+	return nil
+}
+
+// applyLimitRules overrides the limits with the rules of the transaction type for every currency, then with those
+// for the currency
+func applyLimitRules(limits model.TransactionLimits, rules []model.LimitRule, transactionType model.TransactionType, currency model.Currency) model.TransactionLimits {
+	for _, rule := range rules {
+		if rule.Type == transactionType && rule.Currency == "" {
+			limits = limits.Override(rule.Limits)
+		}
+	}
+	for _, rule := range rules {
+		if rule.Type == transactionType && rule.Currency == currency {
+			limits = limits.Override(rule.Limits)
+		}
+	}
+	return limits
+}
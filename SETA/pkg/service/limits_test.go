@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+	"seta/pkg/routing"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadLimits(t *testing.T) {
+	rules, err := LoadLimits("../../../config/limits.example.json")
+
+	assert.NoError(t, err)
+	assert.Len(t, rules, 3)
+	assert.Equal(t, model.TransactionTypeWithdraw, rules[1].Type)
+	assert.Equal(t, "10000", rules[1].Limits.DailyAmount.String())
+	assert.Equal(t, time.Minute, rules[1].Limits.CountWindow)
+	assert.Equal(t, model.Currency("JPY"), rules[2].Currency)
+}
+
+func TestLimitService_Check(t *testing.T) {
+	amount := func(value string) *decimal.Decimal {
+		amount := decimal.RequireFromString(value)
+		return &amount
+	}
+	maxCount := 3
+	rules := []model.LimitRule{
+		{Type: model.TransactionTypeWithdraw, Limits: model.TransactionLimits{MinAmount: amount("1"), MaxAmount: amount("500"), DailyAmount: amount("1000"), MonthlyAmount: amount("5000"), MaxCount: &maxCount}},
+		{Type: model.TransactionTypeWithdraw, Currency: "JPY", Limits: model.TransactionLimits{MinAmount: amount("100"), MaxAmount: amount("50000")}},
+	}
+	vipMaxAmount := "2000"
+
+	testCases := map[string]struct {
+		accountID string
+		amount    string
+		currency  model.Currency
+		usage     model.LimitUsageDAO
+		exceeded  bool
+	}{
+		"within limits":                {"acc123", "100", "USD", model.LimitUsageDAO{DailyAmount: "800", MonthlyAmount: "4800", Count: 2}, false},
+		"below minimum":                {"acc123", "0.5", "USD", model.LimitUsageDAO{}, true},
+		"above maximum":                {"acc123", "501", "USD", model.LimitUsageDAO{}, true},
+		"daily amount":                 {"acc123", "201", "USD", model.LimitUsageDAO{DailyAmount: "800", MonthlyAmount: "800"}, true},
+		"monthly amount":               {"acc123", "201", "USD", model.LimitUsageDAO{DailyAmount: "0", MonthlyAmount: "4800"}, true},
+		"count":                        {"acc123", "1", "USD", model.LimitUsageDAO{Count: 3}, true},
+		"currency limits replace":      {"acc123", "800", "JPY", model.LimitUsageDAO{}, false},
+		"currency limits apply":        {"acc123", "50", "JPY", model.LimitUsageDAO{}, true},
+		"account override":             {"vip", "900", "USD", model.LimitUsageDAO{}, false},
+		"account override keeps daily": {"vip", "900", "USD", model.LimitUsageDAO{DailyAmount: "200", MonthlyAmount: "200"}, true},
+	}
+
+	for name, testCase := range testCases {
+		mockLimitRepo := repository.MockLimitRepositoryProvider()
+		mockLimitRepo.AccountLimits = []model.AccountLimitDAO{{AccountID: "vip", Type: model.TransactionTypeWithdrawDAO, MaxAmount: &vipMaxAmount}}
+		mockLimitRepo.Usage = testCase.usage
+		limits := LimitServiceProvider(mockLimitRepo, rules)
+
+		err := limits.Check(context.Background(), testCase.accountID, model.TransactionTypeWithdraw, decimal.RequireFromString(testCase.amount), testCase.currency)
+
+		if testCase.exceeded {
+			assert.ErrorIs(t, err, ErrLimitExceeded, name)
+		} else {
+			assert.NoError(t, err, name)
+		}
+	}
+}
+
+func TestCreateTransaction_LimitExceeded(t *testing.T) {
+	maxAmount := decimal.NewFromInt(100)
+	limits := LimitServiceProvider(repository.MockLimitRepositoryProvider(), []model.LimitRule{{Type: model.TransactionTypeDeposit, Limits: model.TransactionLimits{MaxAmount: &maxAmount}}})
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	mockPaymentGatewayClient := &paymentgateway.MockClient{StatusCode: 200, TransactionResponse: &model.TransactionResponse{Data: model.TransactionData{TransactionID: "txn123", Status: model.TransactionStatusSuccess}}}
+	gateways := []paymentgateway.IPaymentGateway{mockPaymentGatewayClient}
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider(gateways), WithLimits(limits))
+
+	_, err := service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(101), "", "", model.TransactionTypeDeposit)
+
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	assert.Nil(t, mockRepo.Transaction, "no transaction is created")
+
+	_, err = service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(100), "", "", model.TransactionTypeDeposit)
+	assert.NoError(t, err)
+}
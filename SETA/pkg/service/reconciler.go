@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/config"
+	"seta/pkg/logger"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Reconciler moves pending transactions forward by asking the gateway that processed them for their status. An unknown
+// transaction is looked up by its client reference, the gateway not knowing it means it was never processed. A
+// transaction that is still pending or unknown after the max age is no longer checked and has to be resolved manually
+type Reconciler struct {
+	TransactionRepository repository.ITransactionRepository
+	PaymentGateways       map[string]paymentgateway.IPaymentGateway // by name
+	Config                config.ReconcilerConfig
+	Ledger                ILedgerService // optional, the reconciled transactions are posted to it
+
+	now func() time.Time
+}
+
+func ReconcilerProvider(transactionRepository repository.ITransactionRepository, gateways []paymentgateway.IPaymentGateway, reconcilerConfig config.ReconcilerConfig, ledger ILedgerService) *Reconciler {
+	paymentGateways := make(map[string]paymentgateway.IPaymentGateway, len(gateways))
+	for _, gateway := range gateways {
+		paymentGateways[gateway.Name()] = gateway
+	}
+
+	return &Reconciler{
+		TransactionRepository: transactionRepository,
+		PaymentGateways:       paymentGateways,
+		Config:                reconcilerConfig,
+		Ledger:                ledger,
+		now:                   time.Now,
+	}
+}
+
+// Run reconciles pending transactions and repairs the missing ledger postings every interval until ctx is done
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Reconcile(ctx); err != nil {
+				logger.Logger.Errorf("failed to reconcile pending transactions: %v", err)
+			}
+			if _, err := r.RepairLedger(ctx); err != nil {
+				logger.Logger.Errorf("failed to repair the ledger: %v", err)
+			}
+		}
+	}
+}
+
+// Reconcile checks one batch of pending transactions and returns how many of them were updated. A failed status
+// query only skips that transaction, it is checked again on the next run
+func (r *Reconciler) Reconcile(ctx context.Context) (int, error) {
+	now := r.now()
+	transactions, err := r.TransactionRepository.GetPendingTransactions(ctx, now.Add(-r.Config.MaxAge), now.Add(-r.Config.MinAge), r.Config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, transaction := range transactions {
+		if ctx.Err() != nil {
+			return updated, ctx.Err()
+		}
+
+		if r.reconcile(ctx, transaction) {
+			updated++
+		}
+	}
+
+	return updated, nil
+}
+
+// RepairLedger posts one batch of the settled transactions whose posting failed and returns how many were posted
+func (r *Reconciler) RepairLedger(ctx context.Context) (int, error) {
+	if r.Ledger == nil {
+		return 0, nil
+	}
+
+	now := r.now()
+	transactions, err := r.TransactionRepository.GetUnpostedTransactions(ctx, now.Add(-r.Config.MaxAge), now.Add(-r.Config.MinAge), r.Config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	posted := 0
+	for _, transaction := range transactions {
+		if ctx.Err() != nil {
+			return posted, ctx.Err()
+		}
+
+		if err := r.Ledger.Apply(ctx, transaction); err != nil {
+			logger.Logger.WithField("transaction_id", transaction.TransactionID).Errorf("failed to repair the ledger posting: %v", err)
+			continue
+		}
+		posted++
+	}
+
+	return posted, nil
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, transaction model.TransactionDAO) bool {
+	log := logger.Logger.WithFields(logrus.Fields{
+		"transaction_id":    transaction.TransactionID,
+		"gateway":           transaction.GatewayName,
+		"gateway_reference": transaction.GatewayReference,
+	})
+
+	paymentGateway, ok := r.PaymentGateways[transaction.GatewayName]
+	if !ok {
+		log.Warn("cannot reconcile transaction, its payment gateway is not configured")
+		return false
+	}
+
+	gatewayCtx, cancel := context.WithTimeout(ctx, r.Config.Timeout)
+	defer cancel()
+
+	current := transaction.Status
+	transactionResponse, err := r.getStatus(gatewayCtx, paymentGateway, transaction)
+	if err != nil {
+		log.Errorf("failed to get the transaction status from the payment gateway: %v", err)
+		return false
+	}
+
+	status := transactionResponse.Data.Status
+	if status == model.TransactionStatus(current) {
+		return false
+	}
+	if status != model.TransactionStatusPending && status != model.TransactionStatusSuccess && status != model.TransactionStatusFailed {
+		log.Errorf("payment gateway returned an unknown transaction status %q", status)
+		return false
+	}
+	if !model.TransactionStatus(current).CanTransitionTo(status) {
+		log.Errorf("payment gateway returned status %s, which a %s transaction cannot move to", status, current)
+		return false
+	}
+
+	// only applies while the transaction is still in its status, a callback may have settled it in the meantime
+	event := model.TransactionEvent{
+		Type:           model.TransactionEventStatusChanged,
+		Source:         model.TransactionEventSourceReconciler,
+		PreviousStatus: model.TransactionStatus(current),
+		Status:         status,
+	}
+	transaction.Status = model.TransactionStatusDAO(status)
+	if transaction.GatewayReference == "" {
+		transaction.GatewayReference = transactionResponse.Data.TransactionID
+	}
+	eventDAO := model.MapTransactionEventToTransactionEventDAO(transaction.TransactionID, transaction.AccountID, &event)
+	err = r.TransactionRepository.UpdateTransaction(ctx, transaction, current, eventDAO)
+	if errors.Is(err, repository.ErrTransactionStatusChanged) {
+		log.Infof("%s transaction was updated in the meantime, nothing to reconcile", current)
+		return false
+	}
+	if err != nil {
+		log.Errorf("failed to update the reconciled transaction: %v", err)
+		return false
+	}
+
+	applyOutcome(ctx, r.TransactionRepository, r.Ledger, transaction)
+
+	log.Infof("%s transaction reconciled as %s", current, status)
+	return true
+}
+
+// getStatus asks the gateway for the transaction, an unknown one by its client reference as the gateway may not have
+// given it an ID. A gateway that has no transaction with the reference never processed it, so it failed
+func (r *Reconciler) getStatus(ctx context.Context, paymentGateway paymentgateway.IPaymentGateway, transaction model.TransactionDAO) (*model.TransactionResponse, error) {
+	if transaction.Status != model.TransactionStatusUnknownDAO {
+		return paymentGateway.GetTransactionStatus(ctx, transaction.GatewayReference)
+	}
+
+	transactionResponse, err := paymentGateway.GetTransactionStatusByReference(ctx, transaction.TransactionID)
+	if errors.Is(err, paymentgateway.ErrReferenceNotFound) {
+		return &model.TransactionResponse{Data: model.TransactionData{Status: model.TransactionStatusFailed}}, nil
+	}
+	return transactionResponse, err
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/config"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func reconcilerTestConfig() config.ReconcilerConfig {
+	return config.ReconcilerConfig{Interval: time.Minute, MaxAge: time.Hour, BatchSize: 10, Timeout: time.Second}
+}
+
+func TestReconcile_Settled(t *testing.T) {
+	pending := model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusPendingDAO, Type: model.TransactionTypeDepositDAO, GatewayName: "gatewaya"}
+	mockRepo := repository.MockTransactionRepositoryProvider(&pending, false, nil)
+	mockPaymentGatewayClient := &paymentgateway.MockClient{GatewayName: "gatewaya", StatusCode: 200, TransactionResponse: &model.TransactionResponse{Data: model.TransactionData{TransactionID: "txn123", Status: model.TransactionStatusSuccess}}}
+	reconciler := ReconcilerProvider(mockRepo, []paymentgateway.IPaymentGateway{mockPaymentGatewayClient}, reconcilerTestConfig(), nil)
+
+	updated, err := reconciler.Reconcile(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updated)
+	assert.Equal(t, model.TransactionStatusSuccessDAO, mockRepo.Transaction.Status)
+}
+
+func TestReconcile_StillPendingOrFailing(t *testing.T) {
+	testCases := map[string]*paymentgateway.MockClient{
+		"still pending":      {GatewayName: "gatewaya", StatusCode: 200, TransactionResponse: &model.TransactionResponse{Data: model.TransactionData{Status: model.TransactionStatusPending}}},
+		"gateway down":       {GatewayName: "gatewaya", IsServiceDown: true},
+		"unknown status":     {GatewayName: "gatewaya", StatusCode: 200, TransactionResponse: &model.TransactionResponse{Data: model.TransactionData{Status: "settling"}}},
+		"gateway not listed": {GatewayName: "gatewayb", StatusCode: 200, TransactionResponse: &model.TransactionResponse{Data: model.TransactionData{Status: model.TransactionStatusSuccess}}},
+	}
+
+	for name, mockPaymentGatewayClient := range testCases {
+		pending := model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusPendingDAO, Type: model.TransactionTypeDepositDAO, GatewayName: "gatewaya"}
+		mockRepo := repository.MockTransactionRepositoryProvider(&pending, false, nil)
+		reconciler := ReconcilerProvider(mockRepo, []paymentgateway.IPaymentGateway{mockPaymentGatewayClient}, reconcilerTestConfig(), nil)
+
+		// the transaction is left pending and checked again on the next run
+		updated, err := reconciler.Reconcile(context.Background())
+
+		assert.NoError(t, err, name)
+		assert.Zero(t, updated, name)
+		assert.Equal(t, model.TransactionStatusPendingDAO, mockRepo.Transaction.Status, name)
+	}
+}
+
+func TestReconcile_Unknown(t *testing.T) {
+	testCases := map[string]struct {
+		gateway          *paymentgateway.MockClient
+		status           model.TransactionStatusDAO
+		gatewayReference string
+	}{
+		"processed":    {gateway: &paymentgateway.MockClient{GatewayName: "gatewaya", ReferenceResponse: &model.TransactionResponse{Data: model.TransactionData{TransactionID: "gw123", Status: model.TransactionStatusSuccess}}}, status: model.TransactionStatusSuccessDAO, gatewayReference: "gw123"},
+		"still open":   {gateway: &paymentgateway.MockClient{GatewayName: "gatewaya", ReferenceResponse: &model.TransactionResponse{Data: model.TransactionData{TransactionID: "gw123", Status: model.TransactionStatusPending}}}, status: model.TransactionStatusPendingDAO, gatewayReference: "gw123"},
+		"never sent":   {gateway: &paymentgateway.MockClient{GatewayName: "gatewaya"}, status: model.TransactionStatusFailedDAO},
+		"gateway down": {gateway: &paymentgateway.MockClient{GatewayName: "gatewaya", ReferenceErr: paymentgateway.NewGatewayError("gatewaya", paymentgateway.ErrorCategoryNetwork, 0, errors.New("connection reset"))}, status: model.TransactionStatusUnknownDAO},
+	}
+
+	for name, testCase := range testCases {
+		unknown := model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusUnknownDAO, Type: model.TransactionTypeDepositDAO, GatewayName: "gatewaya"}
+		mockRepo := repository.MockTransactionRepositoryProvider(&unknown, false, nil)
+		reconciler := ReconcilerProvider(mockRepo, []paymentgateway.IPaymentGateway{testCase.gateway}, reconcilerTestConfig(), nil)
+
+		_, err := reconciler.Reconcile(context.Background())
+
+		assert.NoError(t, err, name)
+		assert.Equal(t, testCase.status, mockRepo.Transaction.Status, name)
+		assert.Equal(t, testCase.gatewayReference, mockRepo.Transaction.GatewayReference, name)
+	}
+}
+
+func TestRepairLedger(t *testing.T) {
+	settled := model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Currency: "USD", Status: model.TransactionStatusSuccessDAO, Type: model.TransactionTypeDepositDAO, GatewayName: "gatewaya"}
+	mockRepo := repository.MockTransactionRepositoryProvider(&settled, false, nil)
+	mockLedgerRepo := repository.MockLedgerRepositoryProvider()
+	ledger := LedgerServiceProvider(mockLedgerRepo, mockRepo)
+	reconciler := ReconcilerProvider(mockRepo, nil, reconcilerTestConfig(), ledger)
+
+	// the posting is idempotent, repairing a transaction twice credits it once
+	for range []int{1, 2} {
+		posted, err := reconciler.RepairLedger(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, posted)
+	}
+
+	assertBalance(t, ledger, 100, 0)
+}
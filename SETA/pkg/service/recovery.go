@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/config"
+	"seta/pkg/handler"
+	"seta/pkg/logger"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// Recovery resolves the transactions left initiated when SETA stopped between recording their intent and their outcome:
+// one no gateway has by its client reference failed, one a gateway could not tell about is left to the reconciler
+type Recovery struct {
+	TransactionRepository repository.ITransactionRepository
+	PaymentGateways       []paymentgateway.IPaymentGateway // asked in turn
+	Config                config.RecoveryConfig
+	Ledger                ILedgerService // optional, the recovered transactions are posted to it
+
+	now func() time.Time
+}
+
+func RecoveryProvider(transactionRepository repository.ITransactionRepository, paymentGateways []paymentgateway.IPaymentGateway, recoveryConfig config.RecoveryConfig, ledger ILedgerService) *Recovery {
+	return &Recovery{
+		TransactionRepository: transactionRepository,
+		PaymentGateways:       paymentGateways,
+		Config:                recoveryConfig,
+		Ledger:                ledger,
+		now:                   time.Now,
+	}
+}
+
+// Run recovers the stale initiated transactions batch after batch, until a batch is not fully recovered or ctx is done
+func (r *Recovery) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		recovered, err := r.Recover(ctx)
+		if err != nil {
+			logger.Logger.Errorf("failed to recover initiated transactions: %v", err)
+			return
+		}
+		if recovered > 0 {
+			logger.Logger.Infof("%d initiated transactions recovered", recovered)
+		}
+		if recovered < r.Config.BatchSize {
+			return
+		}
+	}
+}
+
+// Recover resolves one batch of stale initiated transactions and returns how many of them were recorded. A transaction
+// whose outcome could not be recorded stays initiated and is recovered on the next start
+func (r *Recovery) Recover(ctx context.Context) (int, error) {
+	transactions, err := r.TransactionRepository.GetInitiatedTransactions(ctx, r.now().Add(-r.Config.StaleAfter), r.Config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	recovered := 0
+	for _, transaction := range transactions {
+		if ctx.Err() != nil {
+			return recovered, ctx.Err()
+		}
+
+		if r.recover(ctx, transaction) {
+			recovered++
+		}
+	}
+
+	return recovered, nil
+}
+
+func (r *Recovery) recover(ctx context.Context, transaction model.TransactionDAO) bool {
+	log := logger.Logger.WithFields(logrus.Fields{
+		"transaction_id": transaction.TransactionID,
+		"account_id":     transaction.AccountID,
+	})
+
+	// the gateways were sent the converted amount of a converted transaction
+	amount, currency := transaction.Amount, transaction.Currency
+	if transaction.ConvertedCurrency != "" {
+		amount, currency = transaction.ConvertedAmount, transaction.ConvertedCurrency
+	}
+	gatewayAmount, err := decimal.NewFromString(amount)
+	if err != nil {
+		log.Errorf("cannot recover transaction, invalid amount %q: %v", amount, err)
+		return false
+	}
+
+	// a refund or reversal was only sent to the gateway of the transaction it undoes
+	paymentGateways := r.PaymentGateways
+	if transaction.GatewayName != "" {
+		paymentGateways = nil
+		for _, paymentGateway := range r.PaymentGateways {
+			if paymentGateway.Name() == transaction.GatewayName {
+				paymentGateways = append(paymentGateways, paymentGateway)
+			}
+		}
+	}
+
+	gatewayCtx, cancel := context.WithTimeout(ctx, r.Config.Timeout)
+	defer cancel()
+
+	transactionResponse, attempts, err := handler.FindTransactionInPaymentGateways(gatewayCtx, paymentGateways, transaction.TransactionID, transaction.AccountID, gatewayAmount, model.Currency(currency), model.TransactionType(transaction.Type))
+	var detail string
+	switch {
+	case errors.Is(err, handler.ErrNotProcessedByPaymentGateways):
+		transaction.Status = model.TransactionStatusFailedDAO
+		detail = err.Error()
+	case err != nil:
+		log.Errorf("failed to look the transaction up in the payment gateways: %v", err)
+		return false
+	default:
+		// the transaction keeps the amounts of its intent, only its outcome comes from the gateway
+		transaction.Status = model.TransactionStatusDAO(transactionResponse.Data.Status)
+		transaction.GatewayName = transactionResponse.Data.Gateway
+		transaction.GatewayReference = transactionResponse.Data.GatewayReference
+		transaction.GatewayResponse = transactionResponse.Data.GatewayResponse
+	}
+
+	if !model.TransactionStatusInitiated.CanTransitionTo(model.TransactionStatus(transaction.Status)) {
+		log.Errorf("payment gateway returned status %s, which an initiated transaction cannot move to", transaction.Status)
+		return false
+	}
+
+	transaction.Attempts = creationAttempts(transaction, attempts)
+	events := attemptEvents(transaction, attempts)
+	event := model.TransactionEvent{
+		Type:           model.TransactionEventStatusChanged,
+		Source:         model.TransactionEventSourceRecovery,
+		PreviousStatus: model.TransactionStatusInitiated,
+		Status:         model.TransactionStatus(transaction.Status),
+		Detail:         detail,
+	}
+	events = append(events, model.MapTransactionEventToTransactionEventDAO(transaction.TransactionID, transaction.AccountID, &event))
+
+	// only applies while the transaction is still initiated, the request that created it may have finished meanwhile
+	err = r.TransactionRepository.CompleteTransaction(ctx, transaction, events...)
+	if errors.Is(err, repository.ErrTransactionStatusChanged) {
+		log.Info("initiated transaction was completed in the meantime, nothing to recover")
+		return false
+	}
+	if err != nil {
+		log.Errorf("failed to record the recovered transaction: %v", err)
+		return false
+	}
+
+	applyOutcome(ctx, r.TransactionRepository, r.Ledger, transaction)
+
+	log.Infof("initiated transaction recovered as %s", transaction.Status)
+	return true
+}
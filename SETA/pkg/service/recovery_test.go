@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/config"
+	"seta/pkg/model"
+	"seta/pkg/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func recoveryTestConfig() config.RecoveryConfig {
+	return config.RecoveryConfig{StaleAfter: time.Minute, BatchSize: 10, Timeout: time.Second}
+}
+
+func TestRecover(t *testing.T) {
+	testCases := map[string]struct {
+		gateways         []paymentgateway.IPaymentGateway
+		status           model.TransactionStatusDAO
+		gatewayName      string
+		gatewayReference string
+	}{
+		"processed by the second gateway": {
+			gateways: []paymentgateway.IPaymentGateway{
+				&paymentgateway.MockClient{GatewayName: "gatewaya"},
+				&paymentgateway.MockClient{GatewayName: "gatewayb", ReferenceResponse: &model.TransactionResponse{Data: model.TransactionData{TransactionID: "gw123", Status: model.TransactionStatusSuccess}}},
+			},
+			status:           model.TransactionStatusSuccessDAO,
+			gatewayName:      "gatewayb",
+			gatewayReference: "gw123",
+		},
+		"never sent": {
+			gateways: []paymentgateway.IPaymentGateway{
+				&paymentgateway.MockClient{GatewayName: "gatewaya"},
+				&paymentgateway.MockClient{GatewayName: "gatewayb"},
+			},
+			status: model.TransactionStatusFailedDAO,
+		},
+		"gateway down": {
+			gateways: []paymentgateway.IPaymentGateway{
+				&paymentgateway.MockClient{GatewayName: "gatewaya", ReferenceErr: paymentgateway.NewGatewayError("gatewaya", paymentgateway.ErrorCategoryNetwork, 0, errors.New("connection reset"))},
+				&paymentgateway.MockClient{GatewayName: "gatewayb"},
+			},
+			status:      model.TransactionStatusUnknownDAO,
+			gatewayName: "gatewaya",
+		},
+	}
+
+	for name, testCase := range testCases {
+		initiated := model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Currency: "USD", Status: model.TransactionStatusInitiatedDAO, Type: model.TransactionTypeDepositDAO}
+		mockRepo := repository.MockTransactionRepositoryProvider(&initiated, false, nil)
+		recovery := RecoveryProvider(mockRepo, testCase.gateways, recoveryTestConfig(), nil)
+
+		recovered, err := recovery.Recover(context.Background())
+
+		assert.NoError(t, err, name)
+		assert.Equal(t, 1, recovered, name)
+		assert.Equal(t, testCase.status, mockRepo.Transaction.Status, name)
+		assert.Equal(t, testCase.gatewayName, mockRepo.Transaction.GatewayName, name)
+		assert.Equal(t, testCase.gatewayReference, mockRepo.Transaction.GatewayReference, name)
+		// the transaction keeps the amount of its intent
+		assert.Equal(t, "100", mockRepo.Transaction.Amount, name)
+		assert.Equal(t, model.TransactionEventSourceRecovery, mockRepo.Events[len(mockRepo.Events)-1].Source, name)
+	}
+}
+
+func TestRecover_NothingInitiated(t *testing.T) {
+	pending := model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusPendingDAO, Type: model.TransactionTypeDepositDAO, GatewayName: "gatewaya"}
+	mockRepo := repository.MockTransactionRepositoryProvider(&pending, false, nil)
+	recovery := RecoveryProvider(mockRepo, []paymentgateway.IPaymentGateway{&paymentgateway.MockClient{GatewayName: "gatewaya"}}, recoveryTestConfig(), nil)
+
+	recovered, err := recovery.Recover(context.Background())
+
+	assert.NoError(t, err)
+	assert.Zero(t, recovered)
+	assert.Equal(t, model.TransactionStatusPendingDAO, mockRepo.Transaction.Status)
+}
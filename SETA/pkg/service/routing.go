@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"seta/pkg/model"
+	"seta/pkg/routing"
+
+	"github.com/shopspring/decimal"
+)
+
+type IRoutingService interface {
+	ExplainRoute(ctx context.Context, accountID string, amount decimal.Decimal, currency model.Currency, transactionType model.TransactionType) (*model.RoutingExplanation, error)
+}
+
+type RoutingService struct {
+	Router *routing.RulesRouter
+}
+
+func RoutingServiceProvider(router *routing.RulesRouter) IRoutingService {
+	return &RoutingService{Router: router}
+}
+
+func (rs *RoutingService) ExplainRoute(ctx context.Context, accountID string, amount decimal.Decimal, currency model.Currency, transactionType model.TransactionType) (*model.RoutingExplanation, error) {
+	explanation := rs.Router.Explain(routing.RouteRequest{
+		AccountID: accountID,
+		Amount:    amount,
+		Currency:  currency,
+		Type:      transactionType,
+	})
+
+	return &explanation, nil
+}
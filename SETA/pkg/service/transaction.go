@@ -2,81 +2,974 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"seta/pkg/clients/paymentgateway"
 	"seta/pkg/handler"
 	"seta/pkg/logger"
 	"seta/pkg/model"
 	"seta/pkg/repository"
+	"seta/pkg/risk"
+	"seta/pkg/routing"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
 	"github.com/shopspring/decimal"
 )
 
+var (
+	ErrTransactionNotFound      = errors.New("transaction not found")
+	ErrTransactionNotRefundable = errors.New("transaction cannot be refunded")
+	ErrRefundExceedsAmount      = errors.New("refund amount exceeds the amount left to refund")
+	ErrInvalidStatusTransition  = errors.New("transaction status transition is not allowed")
+	ErrTransactionStatusChanged = errors.New("transaction status was changed by a concurrent update")
+	ErrUnsupportedCurrency      = errors.New("currency is not supported")
+	ErrInvalidAmountPrecision   = errors.New("amount has more decimals than the currency allows")
+	ErrRiskDenied               = errors.New("transaction denied by the risk rules")
+	ErrInvalidCursor            = errors.New("invalid cursor")
+	// ErrAmbiguousTransaction is returned as is from the repository when several accounts have a transaction with the ID
+	ErrAmbiguousTransaction = repository.ErrAmbiguousTransaction
+)
+
+// RecordedError is returned once the intent of the transaction is recorded, a gateway may have processed it
+type RecordedError struct {
+	TransactionID string
+	Err           error
+}
+
+func (e *RecordedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RecordedError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	// DefaultListLimit is the page size of a listing that does not give one
+	DefaultListLimit = 50
+	// MaxListLimit is the largest page size of a listing
+	MaxListLimit = 200
+)
+
+// maxStatusUpdateAttempts bounds how often a status update derived from the transaction is retried after a concurrent update
+const maxStatusUpdateAttempts = 3
+
 type ITransactionService interface {
-	CreateTransaction(ctx context.Context, accountID string, amount decimal.Decimal, transactionType model.TransactionType) (*model.TransactionResponse, error)
+	// CreateTransaction sends the transaction to the payment gateways, the default currency is used when currency is empty.
+	// With a quote ID the gateways are sent the amount converted at the rate of the quote, the amount and currency are
+	// those of the quote when omitted
+	CreateTransaction(ctx context.Context, accountID string, amount decimal.Decimal, currency model.Currency, quoteID string, transactionType model.TransactionType) (*model.TransactionResponse, error)
 	GetTransaction(ctx context.Context, transactionID string) (*model.TransactionResponse, error)
-	UpdateTransaction(ctx context.Context, accountID string, transactionID string, status model.TransactionStatus) error
+	// GetTransactionByGatewayReference returns the transaction the named gateway knows by the reference
+	GetTransactionByGatewayReference(ctx context.Context, gatewayName string, gatewayReference string) (*model.TransactionResponse, error)
+	// UpdateTransaction moves the transaction to the status, the event says what caused the update and is recorded with it.
+	// Moving a transaction in review to initiated approves it and sends it to the payment gateways
+	UpdateTransaction(ctx context.Context, accountID string, transactionID string, status model.TransactionStatus, event model.TransactionEvent) error
+	GetTransactionEvents(ctx context.Context, transactionID string) ([]model.TransactionEvent, error)
+	// GetTransactionAttempts returns the calls made to the payment gateways for the transaction, in the order they were made
+	GetTransactionAttempts(ctx context.Context, transactionID string) ([]model.TransactionAttempt, error)
+	// ListTransactions returns a page of the transactions matching the filter, the next one starts at its NextCursor
+	ListTransactions(ctx context.Context, filter model.TransactionFilter) (*model.TransactionPage, error)
+	// RefundTransaction refunds the amount (the whole amount left when zero) of a transaction on the gateway that processed it
+	RefundTransaction(ctx context.Context, transactionID string, amount decimal.Decimal) (*model.TransactionResponse, error)
 }
 
 type TransactionService struct {
 	TransactionRepository repository.ITransactionRepository
-	PaymentGateways       []paymentgateway.IPaymentGateway
+	Router                routing.Router                            // decides the order the payment gateways are tried in
+	TransactionTimeout    time.Duration                             // total time budget shared by all payment gateways for a single transaction
+	PaymentGateways       map[string]paymentgateway.IPaymentGateway // by name, refunds go to the gateway that processed the original transaction
+	Ledger                ILedgerService                            // optional, withdrawals are only sent to a gateway once their amount is held
+	DefaultCurrency       model.Currency                            // currency of the transactions created without one
+	Currencies            map[model.Currency]bool                   // supported currencies, every ISO 4217 currency when empty
+	FX                    IFXService                                // optional, converts the transactions created with a quote
+	Limits                ILimitService                             // optional, rejects the transactions that breach the limits of their account
+	Risk                  *risk.Engine                              // optional, assesses the transactions before any gateway is called
+}
+
+// TransactionServiceOption configures optional settings of the TransactionService
+type TransactionServiceOption func(*TransactionService)
+
+// WithTransactionTimeout sets the total time budget a transaction has across the whole payment gateway failover chain
+func WithTransactionTimeout(timeout time.Duration) TransactionServiceOption {
+	return func(ts *TransactionService) {
+		ts.TransactionTimeout = timeout
+	}
+}
+
+// WithPaymentGateways makes the gateways available by name for refunds, which cannot be routed
+func WithPaymentGateways(gateways []paymentgateway.IPaymentGateway) TransactionServiceOption {
+	return func(ts *TransactionService) {
+		ts.PaymentGateways = make(map[string]paymentgateway.IPaymentGateway, len(gateways))
+		for _, gateway := range gateways {
+			ts.PaymentGateways[gateway.Name()] = gateway
+		}
+	}
+}
+
+// WithLedger keeps the account balances in the ledger up to date and rejects withdrawals the balance does not cover
+func WithLedger(ledger ILedgerService) TransactionServiceOption {
+	return func(ts *TransactionService) {
+		ts.Ledger = ledger
+	}
+}
+
+// WithCurrencies restricts transactions to the supported currencies, defaultCurrency is used when a request gives none
+func WithCurrencies(defaultCurrency model.Currency, supported []model.Currency) TransactionServiceOption {
+	return func(ts *TransactionService) {
+		ts.DefaultCurrency = defaultCurrency
+		ts.Currencies = make(map[model.Currency]bool, len(supported))
+		for _, currency := range supported {
+			ts.Currencies[currency] = true
+		}
+	}
+}
+
+// WithFX lets transactions be created with an FX quote, the gateways are then sent the converted amount
+func WithFX(fx IFXService) TransactionServiceOption {
+	return func(ts *TransactionService) {
+		ts.FX = fx
+	}
+}
+
+// WithLimits rejects the deposits and withdrawals that breach the limits of their account before any gateway is called
+func WithLimits(limits ILimitService) TransactionServiceOption {
+	return func(ts *TransactionService) {
+		ts.Limits = limits
+	}
 }
 
-func TransactionServiceProvider(transactionRepository repository.ITransactionRepository, paymentGateways []paymentgateway.IPaymentGateway) ITransactionService {
-	return &TransactionService{
+// WithRisk assesses every deposit and withdrawal with the risk rules before any gateway is called
+func WithRisk(engine *risk.Engine) TransactionServiceOption {
+	return func(ts *TransactionService) {
+		ts.Risk = engine
+	}
+}
+
+func TransactionServiceProvider(transactionRepository repository.ITransactionRepository, router routing.Router, options ...TransactionServiceOption) ITransactionService {
+	transactionService := &TransactionService{
 		TransactionRepository: transactionRepository,
-		PaymentGateways:       paymentGateways,
+		Router:                router,
+		DefaultCurrency:       model.DefaultCurrency,
+	}
+
+	for _, option := range options {
+		option(transactionService)
 	}
+
+	return transactionService
 }
 
-func (ts *TransactionService) CreateTransaction(ctx context.Context, accountID string, amount decimal.Decimal, transactionType model.TransactionType) (*model.TransactionResponse, error) {
-	transactionResponse, err := handler.CreateTransactionFromPaymentGateways(ctx, ts.PaymentGateways, accountID, amount, transactionType)
+func (ts *TransactionService) CreateTransaction(ctx context.Context, accountID string, amount decimal.Decimal, currency model.Currency, quoteID string, transactionType model.TransactionType) (*model.TransactionResponse, error) {
+	var quote *model.FXQuote
+	if quoteID != "" {
+		var err error
+		if quote, err = ts.getQuote(ctx, quoteID, amount, currency); err != nil {
+			return nil, err
+		}
+		amount, currency = quote.Amount, quote.From
+	}
+
+	currency, err := ts.validateCurrency(currency, amount)
 	if err != nil {
 		return nil, err
 	}
 
-	transactionDAO := model.MapTransactionResponseToTransactionDAO(transactionResponse)
-	err = ts.TransactionRepository.CreateTransaction(ctx, transactionDAO)
+	// limits are in the currency of the account, a converted transaction is checked before its conversion
+	if ts.Limits != nil {
+		if err := ts.Limits.Check(ctx, accountID, transactionType, amount, currency); err != nil {
+			return nil, err
+		}
+	}
+
+	// a transaction the risk rules do not allow is never sent to a gateway
+	if ts.Risk != nil {
+		decision, hits, err := ts.Risk.Assess(ctx, risk.Request{AccountID: accountID, Amount: amount, Currency: currency, Type: transactionType}, riskHistory{ts.TransactionRepository})
+		if err != nil {
+			return nil, err
+		}
+		if decision != model.RiskDecisionAllow {
+			return ts.createAssessedTransaction(ctx, accountID, amount, currency, quote, transactionType, decision, hits)
+		}
+	}
+
+	// the gateways process the converted amount, the account is credited or debited the amount in its currency
+	gatewayAmount, gatewayCurrency := amount, currency
+	if quote != nil {
+		gatewayAmount, gatewayCurrency = quote.ConvertedAmount, quote.To
+	}
+
+	gatewayCtx, cancel := ts.gatewayContext(ctx)
+	defer cancel()
+
+	paymentGateways, err := ts.Router.Route(ctx, routing.RouteRequest{AccountID: accountID, Amount: gatewayAmount, Currency: gatewayCurrency, Type: transactionType})
 	if err != nil {
-		logger.WithRequestID(ctx).Errorf("failed to create transaction in database: %v", err)
+		if errors.Is(err, routing.ErrNoGatewayForCurrency) {
+			return nil, fmt.Errorf("%w: no payment gateway accepts %s", ErrUnsupportedCurrency, gatewayCurrency)
+		}
+		return nil, err
+	}
+
+	// the quote is used before any gateway is called, so that two transactions cannot be converted with it
+	if quote != nil {
+		if err := ts.FX.UseQuote(ctx, quote.QuoteID); err != nil {
+			return nil, err
+		}
+	}
+
+	// the amount of a withdrawal is held before any gateway is called, so the balance cannot be withdrawn twice
+	var holdID string
+	if ts.Ledger != nil && transactionType == model.TransactionTypeWithdraw {
+		holdID, err = ts.Ledger.HoldWithdrawal(ctx, accountID, amount, currency)
+		if err != nil {
+			ts.releaseQuote(ctx, quote)
+			return nil, err
+		}
+	}
+
+	// SETA gives the transaction its own ID, the gateways' IDs are only unique per gateway. Its intent is recorded before
+	// any gateway is called, so that SETA knows of every transaction a gateway may have processed
+	transactionID := uuid.New().String()
+	intent := model.TransactionResponse{
+		Data: model.TransactionData{
+			TransactionID: transactionID,
+			AccountID:     accountID,
+			Amount:        amount,
+			Currency:      currency,
+			Type:          transactionType,
+			Status:        model.TransactionStatusInitiated,
+			Conversion:    quoteConversion(quote),
+		},
+	}
+	intentDAO := model.MapTransactionResponseToTransactionDAO(&intent)
+	if err := ts.TransactionRepository.CreateTransaction(ctx, intentDAO, creationEvents(ctx, intentDAO, nil, model.TransactionEventSourceAPI)...); err != nil {
+		logger.WithRequestID(ctx).Errorf("failed to create transaction intent in database: %v", err)
+		ts.releaseHold(ctx, holdID)
+		ts.releaseQuote(ctx, quote)
 		return nil, err
 	}
 
+	// attached to the intent, so that the hold is settled with the transaction whoever records its outcome
+	if holdID != "" {
+		if err := ts.Ledger.AttachHold(ctx, holdID, transactionID); err != nil {
+			logger.WithRequestID(ctx).Errorf("failed to attach ledger hold %s to transaction %s: %v", holdID, transactionID, err)
+		}
+	}
+
+	transactionResponse, attempts, err := handler.CreateTransactionFromPaymentGateways(gatewayCtx, paymentGateways, transactionID, accountID, gatewayAmount, gatewayCurrency, transactionType)
+	if err != nil {
+		// no gateway processed the transaction
+		intentDAO.Status = model.TransactionStatusFailedDAO
+		intentDAO.Attempts = creationAttempts(intentDAO, attempts)
+		ts.completeTransaction(ctx, intentDAO, attempts, model.TransactionEventSourceAPI, err.Error())
+		ts.releaseHold(ctx, holdID)
+		ts.releaseQuote(ctx, quote)
+		return nil, &RecordedError{TransactionID: transactionID, Err: err}
+	}
+
+	if quote != nil {
+		transactionResponse.Data.Conversion = quoteConversion(quote)
+		transactionResponse.Data.Amount = amount
+		transactionResponse.Data.Currency = currency
+	}
+
+	transactionDAO := model.MapTransactionResponseToTransactionDAO(transactionResponse)
+	transactionDAO.Attempts = creationAttempts(transactionDAO, attempts)
+	if err := ts.completeTransaction(ctx, transactionDAO, attempts, model.TransactionEventSourceAPI, ""); err != nil {
+		return nil, &RecordedError{TransactionID: transactionID, Err: err}
+	}
+	ts.applyLedger(ctx, transactionDAO)
+
 	return transactionResponse, nil
 }
 
+// completeTransaction records the outcome of the gateways for an intent. It is recorded even if the caller gave up in
+// the meantime, a gateway may have processed the transaction. An intent that could not be completed is left to the
+// recovery
+func (ts *TransactionService) completeTransaction(ctx context.Context, transactionDAO model.TransactionDAO, attempts []model.GatewayAttempt, source string, detail string) error {
+	events := attemptEvents(transactionDAO, attempts)
+	event := model.TransactionEvent{
+		Type:             model.TransactionEventStatusChanged,
+		Source:           source,
+		PreviousStatus:   model.TransactionStatusInitiated,
+		Status:           model.TransactionStatus(transactionDAO.Status),
+		Detail:           detail,
+		PayloadReference: logger.RequestID(ctx),
+	}
+	events = append(events, model.MapTransactionEventToTransactionEventDAO(transactionDAO.TransactionID, transactionDAO.AccountID, &event))
+
+	err := ts.TransactionRepository.CompleteTransaction(context.Background(), transactionDAO, events...)
+	if err != nil {
+		logger.WithRequestID(ctx).Errorf("failed to record the outcome of transaction %s in database, it is left to the recovery: %v", transactionDAO.TransactionID, err)
+	}
+	return err
+}
+
+// releaseHold gives back the amount held for a withdrawal no gateway processed
+func (ts *TransactionService) releaseHold(ctx context.Context, holdID string) {
+	if holdID == "" {
+		return
+	}
+
+	if err := ts.Ledger.ReleaseHold(ctx, holdID); err != nil {
+		logger.WithRequestID(ctx).Errorf("failed to release ledger hold %s: %v", holdID, err)
+	}
+}
+
+// quoteConversion is the conversion of a transaction made with the quote, nil without one
+func quoteConversion(quote *model.FXQuote) *model.FXConversion {
+	if quote == nil {
+		return nil
+	}
+
+	return &model.FXConversion{
+		QuoteID:  quote.QuoteID,
+		Rate:     quote.Rate,
+		Amount:   quote.ConvertedAmount,
+		Currency: quote.To,
+	}
+}
+
 func (ts *TransactionService) GetTransaction(ctx context.Context, transactionID string) (*model.TransactionResponse, error) {
 	transactionDAO, err := ts.TransactionRepository.GetTransaction(context.Background(), transactionID)
 	if err != nil {
 		if err.Error() == pgx.ErrNoRows.Error() {
-			return nil, fmt.Errorf("transaction not found")
+			return nil, ErrTransactionNotFound
 		}
 		return nil, err
 	}
 
 	logger.WithRequestID(ctx).Infof("transaction found: %v", transactionDAO)
 
+	transactionDAO.RiskHits, err = ts.TransactionRepository.GetRiskHits(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+
 	transactionResponse := model.MapTransactionDAOToTransactionResponse(&transactionDAO)
 	return &transactionResponse, nil
 }
 
-func (ts *TransactionService) UpdateTransaction(ctx context.Context, accountID string, transactionID string, status model.TransactionStatus) error {
-	transactionDAO, err := ts.TransactionRepository.GetTransaction(ctx, transactionID)
+func (ts *TransactionService) GetTransactionByGatewayReference(ctx context.Context, gatewayName string, gatewayReference string) (*model.TransactionResponse, error) {
+	transactionDAO, err := ts.TransactionRepository.GetTransactionByGatewayReference(ctx, gatewayName, gatewayReference)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s has no transaction %s", ErrTransactionNotFound, gatewayName, gatewayReference)
+		}
+		return nil, err
+	}
+
+	transactionResponse := model.MapTransactionDAOToTransactionResponse(&transactionDAO)
+	return &transactionResponse, nil
+}
+
+func (ts *TransactionService) UpdateTransaction(ctx context.Context, accountID string, transactionID string, status model.TransactionStatus, event model.TransactionEvent) error {
+	transactionDAO, err := ts.TransactionRepository.GetAccountTransaction(ctx, accountID, transactionID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTransactionNotFound
+		}
+		return err
+	}
+
+	if transactionDAO.Status == model.TransactionStatusPendingReviewDAO && status == model.TransactionStatusInitiated {
+		return ts.approveTransaction(ctx, transactionDAO, event)
+	}
+
+	return ts.transition(ctx, transactionDAO, status, event)
+}
+
+// approveTransaction sends a transaction the risk rules held for review to the payment gateways, as initiated first so
+// that the recovery resolves it if SETA stops meanwhile. It keeps the hold and the FX rate it was reviewed with
+func (ts *TransactionService) approveTransaction(ctx context.Context, transactionDAO model.TransactionDAO, event model.TransactionEvent) error {
+	amount := decimal.RequireFromString(transactionDAO.Amount)
+	currency := model.Currency(transactionDAO.Currency)
+	transactionType := model.TransactionType(transactionDAO.Type)
+
+	// a converted transaction is sent to the gateways at the rate of the quote it was reviewed with
+	gatewayAmount, gatewayCurrency := amount, currency
+	conversion := model.MapTransactionDAOToTransactionResponse(&transactionDAO).Data.Conversion
+	if conversion != nil {
+		gatewayAmount, gatewayCurrency = conversion.Amount, conversion.Currency
+	}
+
+	paymentGateways, err := ts.Router.Route(ctx, routing.RouteRequest{AccountID: transactionDAO.AccountID, Amount: gatewayAmount, Currency: gatewayCurrency, Type: transactionType})
 	if err != nil {
+		if errors.Is(err, routing.ErrNoGatewayForCurrency) {
+			return fmt.Errorf("%w: no payment gateway accepts %s", ErrUnsupportedCurrency, gatewayCurrency)
+		}
+		return err
+	}
+
+	if err := ts.transition(ctx, transactionDAO, model.TransactionStatusInitiated, event); err != nil {
+		return err
+	}
+
+	gatewayCtx, cancel := ts.gatewayContext(ctx)
+	defer cancel()
+
+	transactionResponse, attempts, err := handler.CreateTransactionFromPaymentGateways(gatewayCtx, paymentGateways, transactionDAO.TransactionID, transactionDAO.AccountID, gatewayAmount, gatewayCurrency, transactionType)
+	if err != nil {
+		transactionDAO.Status = model.TransactionStatusFailedDAO
+		transactionDAO.Attempts = creationAttempts(transactionDAO, attempts)
+		ts.completeTransaction(ctx, transactionDAO, attempts, event.Source, err.Error())
+		ts.applyLedger(ctx, transactionDAO)
 		return err
 	}
 
-	if transactionDAO.AccountID != accountID {
-		return fmt.Errorf("transaction does not belong to account")
+	if conversion != nil {
+		transactionResponse.Data.Conversion = conversion
+		transactionResponse.Data.Amount = amount
+		transactionResponse.Data.Currency = currency
+	}
+
+	completed := model.MapTransactionResponseToTransactionDAO(transactionResponse)
+	completed.Attempts = creationAttempts(completed, attempts)
+	if err := ts.completeTransaction(ctx, completed, attempts, event.Source, ""); err != nil {
+		return err
+	}
+	ts.applyLedger(ctx, completed)
+	return nil
+}
+
+func (ts *TransactionService) GetTransactionEvents(ctx context.Context, transactionID string) ([]model.TransactionEvent, error) {
+	// an unknown transaction is not found rather than a transaction without history
+	if _, err := ts.GetTransaction(ctx, transactionID); err != nil {
+		return nil, err
+	}
+
+	eventDAOs, err := ts.TransactionRepository.GetTransactionEvents(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]model.TransactionEvent, 0, len(eventDAOs))
+	for i := range eventDAOs {
+		events = append(events, model.MapTransactionEventDAOToTransactionEvent(&eventDAOs[i]))
+	}
+	return events, nil
+}
+
+func (ts *TransactionService) GetTransactionAttempts(ctx context.Context, transactionID string) ([]model.TransactionAttempt, error) {
+	// an unknown transaction is not found rather than a transaction no gateway was called for
+	if _, err := ts.GetTransaction(ctx, transactionID); err != nil {
+		return nil, err
+	}
+
+	attemptDAOs, err := ts.TransactionRepository.GetTransactionAttempts(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make([]model.TransactionAttempt, 0, len(attemptDAOs))
+	for i := range attemptDAOs {
+		attempts = append(attempts, model.MapTransactionAttemptDAOToTransactionAttempt(&attemptDAOs[i]))
+	}
+	return attempts, nil
+}
+
+// transition moves the transaction to the status if the state machine allows it and records the event with it. The
+// update only applies if the status is still the one that was read, so two concurrent updates cannot overwrite each other
+func (ts *TransactionService) transition(ctx context.Context, transactionDAO model.TransactionDAO, status model.TransactionStatus, event model.TransactionEvent) error {
+	return transition(ctx, ts.TransactionRepository, ts.Ledger, transactionDAO, status, event)
+}
+
+func transition(ctx context.Context, transactionRepository repository.ITransactionRepository, ledger ILedgerService, transactionDAO model.TransactionDAO, status model.TransactionStatus, event model.TransactionEvent) error {
+	current := model.TransactionStatus(transactionDAO.Status)
+	event.PreviousStatus = current
+	event.Status = status
+	eventDAO := model.MapTransactionEventToTransactionEventDAO(transactionDAO.TransactionID, transactionDAO.AccountID, &event)
+
+	if current == status {
+		// eg. a gateway sending the same callback twice, nothing changes but it is part of the history
+		return transactionRepository.CreateTransactionEvent(ctx, eventDAO)
+	}
+
+	if !current.CanTransitionTo(status) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidStatusTransition, current, status)
 	}
 
 	transactionDAO.Status = model.TransactionStatusDAO(status)
-	err = ts.TransactionRepository.UpdateTransaction(ctx, transactionDAO)
+	err := transactionRepository.UpdateTransaction(ctx, transactionDAO, model.TransactionStatusDAO(current), eventDAO)
 	if err != nil {
+		if errors.Is(err, repository.ErrTransactionStatusChanged) {
+			return fmt.Errorf("%w: it is no longer %s", ErrTransactionStatusChanged, current)
+		}
 		return err
 	}
 
+	applyOutcome(ctx, transactionRepository, ledger, transactionDAO)
 	return nil
 }
+
+func (ts *TransactionService) applyLedger(ctx context.Context, transactionDAO model.TransactionDAO) {
+	applyOutcome(ctx, ts.TransactionRepository, ts.Ledger, transactionDAO)
+}
+
+// applyOutcome posts a recorded transaction to the ledger, the reconciler repairs the postings that fail. A refund or
+// reversal that succeeded then settles the transaction it undoes, whichever of the request, a callback, the reconciler
+// or the recovery recorded it
+func applyOutcome(ctx context.Context, transactionRepository repository.ITransactionRepository, ledger ILedgerService, transactionDAO model.TransactionDAO) {
+	// the transaction is recorded, a client that went away must not leave it unposted
+	if ledger != nil {
+		if err := ledger.Apply(context.Background(), transactionDAO); err != nil {
+			logger.WithRequestID(ctx).Errorf("failed to post transaction %s to the ledger: %v", transactionDAO.TransactionID, err)
+		}
+	}
+
+	refund := transactionDAO.Type == model.TransactionTypeRefundDAO || transactionDAO.Type == model.TransactionTypeReversalDAO
+	if refund && transactionDAO.Status == model.TransactionStatusSuccessDAO {
+		settleRefundedTransaction(context.Background(), transactionRepository, ledger, transactionDAO)
+	}
+}
+
+func (ts *TransactionService) RefundTransaction(ctx context.Context, transactionID string, amount decimal.Decimal) (*model.TransactionResponse, error) {
+	original, err := ts.TransactionRepository.GetTransaction(ctx, transactionID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTransactionNotFound
+		}
+		return nil, err
+	}
+
+	if original.Type != model.TransactionTypeDepositDAO && original.Type != model.TransactionTypeWithdrawDAO {
+		return nil, fmt.Errorf("%w: a %s cannot be refunded", ErrTransactionNotRefundable, original.Type)
+	}
+
+	// a settled transaction is refunded, one the gateway has not settled yet is reversed so that it never reaches the account
+	var refundType model.TransactionType
+	switch model.TransactionStatus(original.Status) {
+	case model.TransactionStatusSuccess, model.TransactionStatusPartiallyRefunded:
+		refundType = model.TransactionTypeRefund
+	case model.TransactionStatusPending:
+		refundType = model.TransactionTypeReversal
+	default:
+		return nil, fmt.Errorf("%w: the transaction is %s", ErrTransactionNotRefundable, original.Status)
+	}
+
+	refunded, err := ts.TransactionRepository.GetRefundedAmount(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := decimal.RequireFromString(original.Amount).Sub(decimal.RequireFromString(refunded))
+	if !remaining.IsPositive() {
+		return nil, fmt.Errorf("%w: the transaction is already fully refunded", ErrTransactionNotRefundable)
+	}
+
+	// the refund is in the currency of the transaction, rows from before currencies were supported are in the default one
+	currency := model.Currency(original.Currency)
+	if currency == "" {
+		currency = ts.DefaultCurrency
+	}
+
+	if amount.IsZero() {
+		amount = remaining
+	}
+	if !currency.IsValidAmount(amount) {
+		return nil, fmt.Errorf("%w: %s has %d decimals", ErrInvalidAmountPrecision, currency, currency.MinorUnits())
+	}
+	if amount.GreaterThan(remaining) {
+		return nil, fmt.Errorf("%w (%s)", ErrRefundExceedsAmount, remaining)
+	}
+	if refundType == model.TransactionTypeReversal && !amount.Equal(remaining) {
+		return nil, fmt.Errorf("%w: a pending transaction can only be reversed in full", ErrTransactionNotRefundable)
+	}
+
+	paymentGateway, ok := ts.PaymentGateways[original.GatewayName]
+	if !ok {
+		return nil, fmt.Errorf("payment gateway %q that processed the transaction is not configured", original.GatewayName)
+	}
+
+	// a converted transaction is refunded on the gateway in the currency it processed, at the rate it was converted at
+	gatewayAmount, gatewayCurrency := amount, currency
+	var conversion *model.FXConversion
+	if original.ConvertedCurrency != "" {
+		conversion = &model.FXConversion{
+			QuoteID:  original.FXQuoteID,
+			Rate:     decimal.RequireFromString(original.FXRate),
+			Currency: model.Currency(original.ConvertedCurrency),
+		}
+		conversion.Amount = model.Convert(amount, conversion.Rate, conversion.Currency)
+		if amount.Equal(decimal.RequireFromString(original.Amount)) {
+			// converting again could round differently, the whole transaction gives back exactly what the gateway processed
+			conversion.Amount = decimal.RequireFromString(original.ConvertedAmount)
+		}
+		gatewayAmount, gatewayCurrency = conversion.Amount, conversion.Currency
+	}
+
+	// a refunded deposit leaves the account, its amount is held so that the balance cannot go below zero
+	var holdID string
+	if ts.Ledger != nil && original.Type == model.TransactionTypeDepositDAO && refundType == model.TransactionTypeRefund {
+		if holdID, err = ts.Ledger.HoldWithdrawal(ctx, original.AccountID, amount, currency); err != nil {
+			return nil, err
+		}
+	}
+
+	// the refund is recorded as a transaction of its own, linked to the one it undoes. It is reserved before the gateway
+	// is called, so that concurrent refunds cannot add up to more than the transaction
+	refundID := uuid.New().String()
+	intent := model.TransactionResponse{
+		Data: model.TransactionData{
+			TransactionID:       refundID,
+			AccountID:           original.AccountID,
+			Amount:              amount,
+			Currency:            currency,
+			Type:                refundType,
+			Status:              model.TransactionStatusInitiated,
+			Gateway:             original.GatewayName,
+			ParentTransactionID: original.TransactionID,
+			Conversion:          conversion,
+		},
+	}
+	intentDAO := model.MapTransactionResponseToTransactionDAO(&intent)
+	err = ts.TransactionRepository.ReserveRefund(ctx, intentDAO, creationEvents(ctx, intentDAO, nil, model.TransactionEventSourceRefund)...)
+	if err != nil {
+		ts.releaseHold(ctx, holdID)
+		if errors.Is(err, repository.ErrRefundExceedsRemaining) {
+			return nil, fmt.Errorf("%w: another refund of the transaction was made meanwhile", ErrRefundExceedsAmount)
+		}
+		logger.WithRequestID(ctx).Errorf("failed to reserve refund in database: %v", err)
+		return nil, err
+	}
+
+	// the hold settles with the refund
+	if holdID != "" {
+		if err := ts.Ledger.AttachHold(ctx, holdID, refundID); err != nil {
+			logger.WithRequestID(ctx).Errorf("failed to attach ledger hold %s to transaction %s: %v", holdID, refundID, err)
+		}
+	}
+
+	gatewayCtx, cancel := ts.gatewayContext(ctx)
+	defer cancel()
+
+	transactionResponse, attempts, err := handler.RefundTransactionFromPaymentGateway(gatewayCtx, paymentGateway, refundID, original.GatewayReference, gatewayAmount, gatewayCurrency, refundType)
+	if err != nil {
+		// the gateway did not refund, the reserved amount is released with the failed refund
+		intentDAO.Status = model.TransactionStatusFailedDAO
+		intentDAO.Attempts = creationAttempts(intentDAO, attempts)
+		ts.completeTransaction(ctx, intentDAO, attempts, model.TransactionEventSourceRefund, err.Error())
+		ts.applyLedger(ctx, intentDAO)
+		return nil, err
+	}
+
+	transactionResponse.Data.Type = refundType
+	transactionResponse.Data.ParentTransactionID = original.TransactionID
+	if transactionResponse.Data.AccountID == "" {
+		transactionResponse.Data.AccountID = original.AccountID
+	}
+	if transactionResponse.Data.Amount.IsZero() || conversion != nil {
+		transactionResponse.Data.Amount = amount
+	}
+	if conversion != nil {
+		transactionResponse.Data.Currency = currency
+		transactionResponse.Data.Conversion = conversion
+	}
+
+	transactionDAO := model.MapTransactionResponseToTransactionDAO(transactionResponse)
+	transactionDAO.Attempts = creationAttempts(transactionDAO, attempts)
+	if err := ts.completeTransaction(ctx, transactionDAO, attempts, model.TransactionEventSourceRefund, ""); err != nil {
+		return nil, err
+	}
+	// the original transaction is settled once the refund succeeded, a pending or unknown one waits for its gateway
+	ts.applyLedger(ctx, transactionDAO)
+
+	return transactionResponse, nil
+}
+
+// createAssessedTransaction records a transaction the risk rules did not allow, with the rules that did not allow it. A
+// denied transaction is recorded as failed and ErrRiskDenied returned, one in review waits in pending_review for an
+// analyst with the amount of a withdrawal held and its quote used
+func (ts *TransactionService) createAssessedTransaction(ctx context.Context, accountID string, amount decimal.Decimal, currency model.Currency, quote *model.FXQuote, transactionType model.TransactionType, decision model.RiskDecision, hits []model.RiskHit) (*model.TransactionResponse, error) {
+	status := model.TransactionStatusFailed
+	if decision == model.RiskDecisionReview {
+		status = model.TransactionStatusPendingReview
+	}
+
+	// a transaction in review uses its quote, so that it keeps the rate until an analyst approves it
+	if status != model.TransactionStatusPendingReview {
+		quote = nil
+	}
+	if quote != nil {
+		if err := ts.FX.UseQuote(ctx, quote.QuoteID); err != nil {
+			return nil, err
+		}
+	}
+
+	var holdID string
+	if ts.Ledger != nil && status == model.TransactionStatusPendingReview && transactionType == model.TransactionTypeWithdraw {
+		var err error
+		if holdID, err = ts.Ledger.HoldWithdrawal(ctx, accountID, amount, currency); err != nil {
+			ts.releaseQuote(ctx, quote)
+			return nil, err
+		}
+	}
+
+	// no gateway has seen the transaction, so it gets an ID of its own
+	transactionResponse := &model.TransactionResponse{Data: model.TransactionData{
+		TransactionID: uuid.New().String(),
+		AccountID:     accountID,
+		Amount:        amount,
+		Currency:      currency,
+		Status:        status,
+		Type:          transactionType,
+		RiskHits:      hits,
+		Conversion:    quoteConversion(quote),
+	}}
+
+	transactionDAO := model.MapTransactionResponseToTransactionDAO(transactionResponse)
+	err := ts.TransactionRepository.CreateTransaction(ctx, transactionDAO, creationEvents(ctx, transactionDAO, nil, model.TransactionEventSourceAPI)...)
+	if err != nil {
+		logger.WithRequestID(ctx).Errorf("failed to create transaction in database: %v", err)
+		if holdID != "" {
+			if err := ts.Ledger.ReleaseHold(ctx, holdID); err != nil {
+				logger.WithRequestID(ctx).Errorf("failed to release ledger hold %s: %v", holdID, err)
+			}
+		}
+		ts.releaseQuote(ctx, quote)
+		return nil, err
+	}
+
+	if holdID != "" {
+		if err := ts.Ledger.AttachHold(ctx, holdID, transactionDAO.TransactionID); err != nil {
+			logger.WithRequestID(ctx).Errorf("failed to attach ledger hold %s to transaction %s: %v", holdID, transactionDAO.TransactionID, err)
+		}
+	}
+
+	if decision == model.RiskDecisionDeny {
+		reasons := make([]string, 0, len(hits))
+		for _, hit := range hits {
+			reasons = append(reasons, hit.Rule+" ("+hit.Reason+")")
+		}
+		return nil, fmt.Errorf("%w: %s, transaction %s", ErrRiskDenied, strings.Join(reasons, ", "), transactionDAO.TransactionID)
+	}
+
+	return transactionResponse, nil
+}
+
+// riskHistory gives the risk rules the activity of the accounts from the transactions
+type riskHistory struct {
+	transactionRepository repository.ITransactionRepository
+}
+
+func (rh riskHistory) GetAccountActivity(ctx context.Context, request risk.Request, failuresSince time.Time) (model.AccountActivity, error) {
+	activityDAO, err := rh.transactionRepository.GetAccountActivity(ctx, request.AccountID, string(request.Currency), model.TransactionTypeDAO(request.Type), failuresSince)
+	if err != nil {
+		return model.AccountActivity{}, err
+	}
+	return model.MapAccountActivityDAOToAccountActivity(&activityDAO), nil
+}
+
+// getQuote returns the quote of a transaction, the amount and currency of the request must be those of the quote when given
+func (ts *TransactionService) getQuote(ctx context.Context, quoteID string, amount decimal.Decimal, currency model.Currency) (*model.FXQuote, error) {
+	if ts.FX == nil {
+		return nil, fmt.Errorf("%w: currency conversion is not enabled", ErrQuoteNotFound)
+	}
+
+	quote, err := ts.FX.GetQuote(ctx, quoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if currency != "" {
+		if parsed, _ := model.ParseCurrency(string(currency)); parsed != quote.From {
+			return nil, fmt.Errorf("%w: the quote converts from %s, not %s", ErrQuoteMismatch, quote.From, currency)
+		}
+	}
+	if !amount.IsZero() && !amount.Equal(quote.Amount) {
+		return nil, fmt.Errorf("%w: the quote is for %s %s, not %s", ErrQuoteMismatch, quote.Amount, quote.From, amount)
+	}
+
+	return quote, nil
+}
+
+// releaseQuote makes the quote of a transaction no gateway accepted usable again, a failure is only logged as the quote
+// expires anyway
+func (ts *TransactionService) releaseQuote(ctx context.Context, quote *model.FXQuote) {
+	if quote == nil {
+		return
+	}
+
+	if err := ts.FX.ReleaseQuote(ctx, quote.QuoteID); err != nil {
+		logger.WithRequestID(ctx).Errorf("failed to release fx quote %s: %v", quote.QuoteID, err)
+	}
+}
+
+// validateCurrency checks that the currency is supported and that the amount has no more decimals than it allows, the
+// currency is returned normalised to its ISO 4217 code
+func (ts *TransactionService) validateCurrency(currency model.Currency, amount decimal.Decimal) (model.Currency, error) {
+	if currency == "" {
+		currency = ts.DefaultCurrency
+	}
+
+	currency, ok := model.ParseCurrency(string(currency))
+	if !ok || (len(ts.Currencies) > 0 && !ts.Currencies[currency]) {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedCurrency, currency)
+	}
+
+	if !currency.IsValidAmount(amount) {
+		return "", fmt.Errorf("%w: %s has %d decimals", ErrInvalidAmountPrecision, currency, currency.MinorUnits())
+	}
+
+	return currency, nil
+}
+
+// settleRefundedTransaction moves the transaction a refund or reversal that succeeded undoes to the status that
+// reflects what is left of it. After a concurrent update the transaction is read again, the refund itself is already
+// recorded so a failure is only logged
+func settleRefundedTransaction(ctx context.Context, transactionRepository repository.ITransactionRepository, ledger ILedgerService, refund model.TransactionDAO) {
+	event := model.TransactionEvent{
+		Type:             model.TransactionEventStatusChanged,
+		Source:           model.TransactionEventSourceRefund,
+		PayloadReference: refund.TransactionID,
+	}
+
+	for attempt := 1; ; attempt++ {
+		original, err := transactionRepository.GetAccountTransaction(ctx, refund.AccountID, refund.ParentTransactionID)
+		if err != nil {
+			logger.WithRequestID(ctx).Errorf("failed to update the status of refunded transaction %s: %v", refund.ParentTransactionID, err)
+			return
+		}
+		refunded, err := transactionRepository.GetSettledRefundedAmount(ctx, original.TransactionID)
+		if err != nil {
+			logger.WithRequestID(ctx).Errorf("failed to update the status of refunded transaction %s: %v", original.TransactionID, err)
+			return
+		}
+
+		status := model.TransactionStatusReversed
+		if refund.Type == model.TransactionTypeRefundDAO {
+			status = model.TransactionStatusRefunded
+			if decimal.RequireFromString(original.Amount).GreaterThan(decimal.RequireFromString(refunded)) {
+				status = model.TransactionStatusPartiallyRefunded
+			}
+		}
+
+		err = transition(ctx, transactionRepository, ledger, original, status, event)
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, ErrTransactionStatusChanged) || attempt == maxStatusUpdateAttempts {
+			logger.WithRequestID(ctx).Errorf("failed to update the status of refunded transaction %s: %v", original.TransactionID, err)
+			return
+		}
+	}
+}
+
+// creationEvents are the events recorded with a new transaction: the gateway attempts that led to it, then its creation
+func creationEvents(ctx context.Context, transaction model.TransactionDAO, attempts []model.GatewayAttempt, source string) []model.TransactionEventDAO {
+	events := attemptEvents(transaction, attempts)
+	event := model.TransactionEvent{
+		Type:             model.TransactionEventCreated,
+		Source:           source,
+		Status:           model.TransactionStatus(transaction.Status),
+		PayloadReference: logger.RequestID(ctx),
+	}
+	return append(events, model.MapTransactionEventToTransactionEventDAO(transaction.TransactionID, transaction.AccountID, &event))
+}
+
+// attemptEvents are the events of the gateway attempts made for a transaction, in the order they were made
+func attemptEvents(transaction model.TransactionDAO, attempts []model.GatewayAttempt) []model.TransactionEventDAO {
+	events := make([]model.TransactionEventDAO, 0, len(attempts)+1)
+	for _, attempt := range attempts {
+		event := model.TransactionEvent{Type: model.TransactionEventGatewayAttempt, Source: attempt.Gateway}
+		if attempt.Err != nil {
+			event.Detail = attempt.Err.Error()
+		} else {
+			event.Status = model.TransactionStatus(transaction.Status)
+		}
+		events = append(events, model.MapTransactionEventToTransactionEventDAO(transaction.TransactionID, transaction.AccountID, &event))
+	}
+	return events
+}
+
+// creationAttempts are the gateway attempts recorded with a new transaction, in the order they were made
+func creationAttempts(transaction model.TransactionDAO, attempts []model.GatewayAttempt) []model.TransactionAttemptDAO {
+	attemptDAOs := make([]model.TransactionAttemptDAO, 0, len(attempts))
+	for i := range attempts {
+		attemptDAOs = append(attemptDAOs, model.MapGatewayAttemptToTransactionAttemptDAO(transaction.TransactionID, transaction.AccountID, &attempts[i]))
+	}
+	return attemptDAOs
+}
+
+// gatewayContext bounds the calls made to the payment gateways for a single transaction by the transaction timeout
+func (ts *TransactionService) gatewayContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ts.TransactionTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, ts.TransactionTimeout)
+}
+
+func (ts *TransactionService) ListTransactions(ctx context.Context, filter model.TransactionFilter) (*model.TransactionPage, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	filterDAO := model.MapTransactionFilterToTransactionFilterDAO(&filter)
+	if filter.Cursor != "" {
+		after, err := decodeTransactionCursor(filter.Cursor, filterDAO.Descending)
+		if err != nil {
+			return nil, err
+		}
+		filterDAO.After = &after
+	}
+	// one more than the page, there is a next page when it is found
+	filterDAO.Limit = limit + 1
+
+	transactionDAOs, err := ts.TransactionRepository.ListTransactions(ctx, filterDAO)
+	if err != nil {
+		logger.WithRequestID(ctx).Errorf("failed to list transactions: %v", err)
+		return nil, err
+	}
+
+	page := &model.TransactionPage{Transactions: make([]model.TransactionData, 0, len(transactionDAOs))}
+	if len(transactionDAOs) > limit {
+		transactionDAOs = transactionDAOs[:limit]
+		last := transactionDAOs[limit-1]
+		page.NextCursor = encodeTransactionCursor(model.TransactionCursorDAO{CreatedAt: last.CreatedAt, ID: last.ID}, filterDAO.Descending)
+	}
+	for i := range transactionDAOs {
+		page.Transactions = append(page.Transactions, model.MapTransactionDAOToTransactionResponse(&transactionDAOs[i]).Data)
+	}
+
+	return page, nil
+}
+
+// encodeTransactionCursor makes the opaque cursor of a position in a listing, it carries the order of the listing so
+// that it cannot be used to page through the other order
+func encodeTransactionCursor(cursor model.TransactionCursorDAO, descending bool) string {
+	order := model.SortOrderAsc
+	if descending {
+		order = model.SortOrderDesc
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(string(order) + "|" + cursor.CreatedAt.Format(time.RFC3339Nano) + "|" + cursor.ID))
+}
+
+func decodeTransactionCursor(encoded string, descending bool) (model.TransactionCursorDAO, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return model.TransactionCursorDAO{}, fmt.Errorf("%w: %s", ErrInvalidCursor, encoded)
+	}
+
+	parts := strings.Split(string(data), "|")
+	if len(parts) != 3 || (parts[0] == string(model.SortOrderDesc)) != descending {
+		return model.TransactionCursorDAO{}, fmt.Errorf("%w: %s is not a cursor of this order", ErrInvalidCursor, encoded)
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return model.TransactionCursorDAO{}, fmt.Errorf("%w: %s", ErrInvalidCursor, encoded)
+	}
+	if _, err := uuid.Parse(parts[2]); err != nil {
+		return model.TransactionCursorDAO{}, fmt.Errorf("%w: %s", ErrInvalidCursor, encoded)
+	}
+
+	return model.TransactionCursorDAO{CreatedAt: createdAt, ID: parts[2]}, nil
+}
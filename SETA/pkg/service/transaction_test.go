@@ -3,16 +3,42 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
 
 	"seta/pkg/clients/paymentgateway"
+	"seta/pkg/config"
 	"seta/pkg/model"
 	"seta/pkg/repository"
+	"seta/pkg/risk"
+	"seta/pkg/routing"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 )
 
+// recordedFrom is the response SETA returns once the named gateway answered with expected: the transaction
+// gets its own ID, the gateway's ID is kept as the reference and the currency defaults to the one of the request. The
+// mock gateways answer with a 200
+func recordedFrom(t *testing.T, expected model.TransactionResponse, gatewayName string, actual *model.TransactionResponse) model.TransactionResponse {
+	_, err := uuid.Parse(actual.Data.TransactionID)
+	assert.NoError(t, err)
+
+	expected.Data.Gateway = gatewayName
+	expected.Data.GatewayReference = expected.Data.TransactionID
+	expected.Data.TransactionID = actual.Data.TransactionID
+	expected.Data.GatewayStatusCode = http.StatusOK
+	if expected.Data.Currency == "" {
+		expected.Data.Currency = model.DefaultCurrency
+	}
+	return expected
+}
+
 func TestCreateTransaction_Success(t *testing.T) {
 	// Initialize mock repository and service
 	amount := decimal.NewFromFloat(100.0)
@@ -30,15 +56,15 @@ func TestCreateTransaction_Success(t *testing.T) {
 
 	mockRepo := repository.MockTransactionRepositoryProvider(&transactionDAO, false, nil)
 	mockPaymentGatewayClient := paymentgateway.MockClientProvider(&transactionExpected, 200, nil, false)
-	service := TransactionServiceProvider(mockRepo, []paymentgateway.IPaymentGateway{mockPaymentGatewayClient})
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider([]paymentgateway.IPaymentGateway{mockPaymentGatewayClient}))
 
 	// Test CreateTransaction
-	transactionActual, err := service.CreateTransaction(context.Background(), transactionExpected.Data.AccountID, transactionExpected.Data.Amount, transactionExpected.Data.Type)
+	transactionActual, err := service.CreateTransaction(context.Background(), transactionExpected.Data.AccountID, transactionExpected.Data.Amount, "", "", transactionExpected.Data.Type)
 
 	// Assertions
 	assert.NoError(t, err)
 	assert.NotNil(t, transactionActual)
-	assert.Equal(t, transactionExpected, *transactionActual)
+	assert.Equal(t, recordedFrom(t, transactionExpected, paymentgateway.MockClientName, transactionActual), *transactionActual)
 }
 
 func TestCreateTransaction_TwoGateways_OneActive_Success(t *testing.T) {
@@ -59,15 +85,15 @@ func TestCreateTransaction_TwoGateways_OneActive_Success(t *testing.T) {
 	mockRepo := repository.MockTransactionRepositoryProvider(&transactionDAO, false, nil)
 	mockPaymentGatewayClient1 := paymentgateway.MockClientProvider(nil, 500, nil, false)
 	mockPaymentGatewayClient2 := paymentgateway.MockClientProvider(&transactionExpected, 200, nil, false)
-	service := TransactionServiceProvider(mockRepo, []paymentgateway.IPaymentGateway{mockPaymentGatewayClient1, mockPaymentGatewayClient2})
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider([]paymentgateway.IPaymentGateway{mockPaymentGatewayClient1, mockPaymentGatewayClient2}))
 
 	// Test CreateTransaction
-	transactionActual, err := service.CreateTransaction(context.Background(), transactionExpected.Data.AccountID, transactionExpected.Data.Amount, transactionExpected.Data.Type)
+	transactionActual, err := service.CreateTransaction(context.Background(), transactionExpected.Data.AccountID, transactionExpected.Data.Amount, "", "", transactionExpected.Data.Type)
 
 	// Assertions
 	assert.NoError(t, err)
 	assert.NotNil(t, transactionActual)
-	assert.Equal(t, transactionExpected, *transactionActual)
+	assert.Equal(t, recordedFrom(t, transactionExpected, paymentgateway.MockClientName, transactionActual), *transactionActual)
 }
 
 func TestCreateTransaction_TwoGateways_OneActive_Failure(t *testing.T) {
@@ -88,12 +114,778 @@ func TestCreateTransaction_TwoGateways_OneActive_Failure(t *testing.T) {
 	mockRepo := repository.MockTransactionRepositoryProvider(&transactionDAO, false, nil)
 	mockPaymentGatewayClient1 := paymentgateway.MockClientProvider(nil, 500, nil, false)
 	mockPaymentGatewayClient2 := paymentgateway.MockClientProvider(nil, 500, nil, false)
-	service := TransactionServiceProvider(mockRepo, []paymentgateway.IPaymentGateway{mockPaymentGatewayClient1, mockPaymentGatewayClient2})
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider([]paymentgateway.IPaymentGateway{mockPaymentGatewayClient1, mockPaymentGatewayClient2}))
+
+	// Test CreateTransaction
+	transactionActual, err := service.CreateTransaction(context.Background(), transactionExpected.Data.AccountID, transactionExpected.Data.Amount, "", "", transactionExpected.Data.Type)
+
+	// Assertions
+	assert.Error(t, err)
+	assert.Nil(t, transactionActual)
+}
+
+func TestCreateTransaction_TwoGateways_SlowGateway_FailsOverWithinBudget(t *testing.T) {
+	// Initialize mock repository and service
+	amount := decimal.NewFromFloat(100.0)
+	transactionExpected := model.TransactionResponse{
+		Data: model.TransactionData{
+			TransactionID: "txn123",
+			AccountID:     "acc123",
+			Amount:        amount,
+			Status:        model.TransactionStatusSuccess,
+			Type:          model.TransactionTypeDeposit,
+		},
+	}
+
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	// the first gateway would hang well past the transaction budget, it should only be given its share of the budget
+	mockPaymentGatewayClient1 := &paymentgateway.MockClient{TransactionResponse: &transactionExpected, StatusCode: 200, Delay: 5 * time.Second}
+	mockPaymentGatewayClient2 := paymentgateway.MockClientProvider(&transactionExpected, 200, nil, false)
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider([]paymentgateway.IPaymentGateway{mockPaymentGatewayClient1, mockPaymentGatewayClient2}), WithTransactionTimeout(time.Second))
 
 	// Test CreateTransaction
-	transactionActual, err := service.CreateTransaction(context.Background(), transactionExpected.Data.AccountID, transactionExpected.Data.Amount, transactionExpected.Data.Type)
+	start := time.Now()
+	transactionActual, err := service.CreateTransaction(context.Background(), transactionExpected.Data.AccountID, transactionExpected.Data.Amount, "", "", transactionExpected.Data.Type)
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.NotNil(t, transactionActual)
+	assert.Equal(t, recordedFrom(t, transactionExpected, paymentgateway.MockClientName, transactionActual), *transactionActual)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestCreateTransaction_CancelledContext_Failure(t *testing.T) {
+	// Initialize mock repository and service
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	mockPaymentGatewayClient := &paymentgateway.MockClient{StatusCode: 200, Delay: 5 * time.Second}
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider([]paymentgateway.IPaymentGateway{mockPaymentGatewayClient}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Test CreateTransaction
+	transactionActual, err := service.CreateTransaction(ctx, "acc123", decimal.NewFromFloat(100.0), "", "", model.TransactionTypeDeposit)
 
 	// Assertions
 	assert.Error(t, err)
 	assert.Nil(t, transactionActual)
 }
+
+func TestCreateTransaction_TwoGateways_ClientError_NoFailover(t *testing.T) {
+	// Initialize mock repository and service
+	amount := decimal.NewFromFloat(100.0)
+	transactionExpected := model.TransactionResponse{
+		Data: model.TransactionData{
+			TransactionID: "txn123",
+			AccountID:     "acc123",
+			Amount:        amount,
+			Status:        model.TransactionStatusSuccess,
+			Type:          model.TransactionTypeDeposit,
+		},
+	}
+
+	// a rejected request (401, 404, 409 etc.) would fail the same way on every gateway
+	for _, statusCode := range []int{400, 401, 402, 404, 409} {
+		mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+		mockPaymentGatewayClient1 := paymentgateway.MockClientProvider(nil, statusCode, nil, false)
+		mockPaymentGatewayClient2 := paymentgateway.MockClientProvider(&transactionExpected, 200, nil, false)
+		service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider([]paymentgateway.IPaymentGateway{mockPaymentGatewayClient1, mockPaymentGatewayClient2}))
+
+		// Test CreateTransaction
+		transactionActual, err := service.CreateTransaction(context.Background(), transactionExpected.Data.AccountID, transactionExpected.Data.Amount, "", "", transactionExpected.Data.Type)
+
+		// Assertions
+		var gatewayError *paymentgateway.GatewayError
+		assert.ErrorAs(t, err, &gatewayError)
+		assert.Equal(t, statusCode, gatewayError.StatusCode)
+		assert.False(t, gatewayError.Retryable())
+		assert.Nil(t, transactionActual)
+		// the intent recorded before the gateway call is kept as failed
+		assert.Equal(t, model.TransactionStatusFailedDAO, mockRepo.Transaction.Status)
+		assert.Len(t, mockRepo.Transaction.Attempts, 1)
+	}
+}
+
+func TestCreateTransaction_TwoGateways_ValidationError_NoFailover(t *testing.T) {
+	// Initialize mock repository and service
+	amount := decimal.NewFromFloat(100.0)
+	transactionExpected := model.TransactionResponse{
+		Data: model.TransactionData{
+			TransactionID: "txn123",
+			AccountID:     "acc123",
+			Amount:        amount,
+			Status:        model.TransactionStatusSuccess,
+			Type:          model.TransactionTypeDeposit,
+		},
+	}
+
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	// soap 1.1 gateways report client faults with a 500, the category and not the status code decides the failover
+	gatewayError := paymentgateway.NewGatewayError("gatewayb", paymentgateway.ErrorCategoryValidation, 500, errors.New("soap fault Client: invalid account"))
+	mockPaymentGatewayClient1 := paymentgateway.MockClientProvider(nil, 500, gatewayError, false)
+	mockPaymentGatewayClient2 := paymentgateway.MockClientProvider(&transactionExpected, 200, nil, false)
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider([]paymentgateway.IPaymentGateway{mockPaymentGatewayClient1, mockPaymentGatewayClient2}))
+
+	// Test CreateTransaction
+	transactionActual, err := service.CreateTransaction(context.Background(), transactionExpected.Data.AccountID, transactionExpected.Data.Amount, "", "", transactionExpected.Data.Type)
+
+	// Assertions
+	assert.ErrorIs(t, err, gatewayError)
+	assert.Nil(t, transactionActual)
+}
+
+func TestCreateTransaction_TwoGateways_NetworkError_Failover(t *testing.T) {
+	// Initialize mock repository and service
+	amount := decimal.NewFromFloat(100.0)
+	transactionExpected := model.TransactionResponse{
+		Data: model.TransactionData{
+			TransactionID: "txn123",
+			AccountID:     "acc123",
+			Amount:        amount,
+			Status:        model.TransactionStatusSuccess,
+			Type:          model.TransactionTypeDeposit,
+		},
+	}
+
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	mockPaymentGatewayClient1 := paymentgateway.MockClientProvider(nil, 0, nil, true)
+	mockPaymentGatewayClient2 := paymentgateway.MockClientProvider(&transactionExpected, 200, nil, false)
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider([]paymentgateway.IPaymentGateway{mockPaymentGatewayClient1, mockPaymentGatewayClient2}))
+
+	// Test CreateTransaction
+	transactionActual, err := service.CreateTransaction(context.Background(), transactionExpected.Data.AccountID, transactionExpected.Data.Amount, "", "", transactionExpected.Data.Type)
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.NotNil(t, transactionActual)
+	assert.Equal(t, recordedFrom(t, transactionExpected, paymentgateway.MockClientName, transactionActual), *transactionActual)
+}
+
+func TestCreateTransaction_TwoGateways_AmbiguousFailure_ProcessedByFirst(t *testing.T) {
+	// Initialize mock repository and service
+	amount := decimal.NewFromFloat(100.0)
+	transactionExpected := model.TransactionResponse{
+		Data: model.TransactionData{
+			TransactionID: "txn123",
+			AccountID:     "acc123",
+			Amount:        amount,
+			Status:        model.TransactionStatusSuccess,
+			Type:          model.TransactionTypeDeposit,
+		},
+	}
+
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	// the first gateway failed with a 500 after it processed the transaction, it finds it by its client reference
+	mockPaymentGatewayClient1 := &paymentgateway.MockClient{GatewayName: "gatewaya", StatusCode: 500, ReferenceResponse: &transactionExpected}
+	mockPaymentGatewayClient2 := &paymentgateway.MockClient{GatewayName: "gatewayb", StatusCode: 200, TransactionResponse: &transactionExpected}
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider([]paymentgateway.IPaymentGateway{mockPaymentGatewayClient1, mockPaymentGatewayClient2}))
+
+	// Test CreateTransaction
+	transactionActual, err := service.CreateTransaction(context.Background(), transactionExpected.Data.AccountID, transactionExpected.Data.Amount, "", "", transactionExpected.Data.Type)
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, recordedFrom(t, transactionExpected, "gatewaya", transactionActual), *transactionActual)
+	assert.Equal(t, "gatewaya", mockRepo.Transaction.GatewayName)
+}
+
+func TestCreateTransaction_TwoGateways_AmbiguousFailure_Unknown(t *testing.T) {
+	// Initialize mock repository and service
+	amount := decimal.NewFromFloat(100.0)
+	transactionExpected := model.TransactionResponse{
+		Data: model.TransactionData{
+			TransactionID: "txn123",
+			AccountID:     "acc123",
+			Amount:        amount,
+			Status:        model.TransactionStatusSuccess,
+			Type:          model.TransactionTypeWithdraw,
+		},
+	}
+
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	// the first gateway failed with a 500 and cannot be asked whether it processed the transaction
+	lookupError := paymentgateway.NewGatewayError("gatewaya", paymentgateway.ErrorCategoryTimeout, 0, context.DeadlineExceeded)
+	mockPaymentGatewayClient1 := &paymentgateway.MockClient{GatewayName: "gatewaya", StatusCode: 500, ReferenceErr: lookupError}
+	mockPaymentGatewayClient2 := &paymentgateway.MockClient{GatewayName: "gatewayb", StatusCode: 200, TransactionResponse: &transactionExpected}
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider([]paymentgateway.IPaymentGateway{mockPaymentGatewayClient1, mockPaymentGatewayClient2}))
+
+	// Test CreateTransaction
+	transactionActual, err := service.CreateTransaction(context.Background(), transactionExpected.Data.AccountID, transactionExpected.Data.Amount, "", "", transactionExpected.Data.Type)
+
+	// Assertions, it is not sent to the second gateway but left for the reconciler
+	assert.NoError(t, err)
+	assert.Equal(t, model.TransactionStatusUnknown, transactionActual.Data.Status)
+	assert.Equal(t, "gatewaya", transactionActual.Data.Gateway)
+	assert.Empty(t, transactionActual.Data.GatewayReference)
+	assert.Equal(t, model.TransactionStatusUnknownDAO, mockRepo.Transaction.Status)
+	assert.Equal(t, transactionActual.Data.TransactionID, mockRepo.Transaction.TransactionID)
+}
+
+func TestCreateTransaction_TwoGateways_OpenCircuit_Skipped(t *testing.T) {
+	// Initialize mock repository and service
+	amount := decimal.NewFromFloat(100.0)
+	transactionExpected := model.TransactionResponse{
+		Data: model.TransactionData{
+			TransactionID: "txn123",
+			AccountID:     "acc123",
+			Amount:        amount,
+			Status:        model.TransactionStatusSuccess,
+			Type:          model.TransactionTypeDeposit,
+		},
+	}
+
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	mockPaymentGatewayClient1 := &paymentgateway.MockClient{StatusCode: 500}
+	circuitBreaker := paymentgateway.CircuitBreakerProvider(mockPaymentGatewayClient1, config.CircuitBreakerConfig{FailureThreshold: 1, CoolDown: time.Minute})
+	mockPaymentGatewayClient2 := paymentgateway.MockClientProvider(&transactionExpected, 200, nil, false)
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider([]paymentgateway.IPaymentGateway{circuitBreaker, mockPaymentGatewayClient2}), WithTransactionTimeout(time.Second))
+
+	// the first transaction fails over and opens the circuit of the first gateway
+	_, err := service.CreateTransaction(context.Background(), transactionExpected.Data.AccountID, transactionExpected.Data.Amount, "", "", transactionExpected.Data.Type)
+	assert.NoError(t, err)
+	assert.Equal(t, paymentgateway.CircuitStateOpen, circuitBreaker.State())
+
+	// the next one must not wait on the first gateway at all
+	mockPaymentGatewayClient1.Delay = time.Hour
+	start := time.Now()
+	transactionActual, err := service.CreateTransaction(context.Background(), transactionExpected.Data.AccountID, transactionExpected.Data.Amount, "", "", transactionExpected.Data.Type)
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, recordedFrom(t, transactionExpected, paymentgateway.MockClientName, transactionActual), *transactionActual)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestUpdateTransaction_Transitions(t *testing.T) {
+	testCases := []struct {
+		from model.TransactionStatusDAO
+		to   model.TransactionStatus
+		err  error
+	}{
+		{model.TransactionStatusPendingDAO, model.TransactionStatusSuccess, nil},
+		{model.TransactionStatusPendingDAO, model.TransactionStatusFailed, nil},
+		{model.TransactionStatusSuccessDAO, model.TransactionStatusSuccess, nil}, // repeated update, nothing to do
+		{model.TransactionStatusSuccessDAO, model.TransactionStatusPending, ErrInvalidStatusTransition},
+		{model.TransactionStatusSuccessDAO, model.TransactionStatusFailed, ErrInvalidStatusTransition},
+		{model.TransactionStatusFailedDAO, model.TransactionStatusSuccess, ErrInvalidStatusTransition},
+		{model.TransactionStatusRefundedDAO, model.TransactionStatusSuccess, ErrInvalidStatusTransition},
+	}
+
+	for _, testCase := range testCases {
+		name := fmt.Sprintf("%s to %s", testCase.from, testCase.to)
+		mockRepo := repository.MockTransactionRepositoryProvider(&model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Status: testCase.from, Type: model.TransactionTypeDepositDAO}, false, nil)
+		service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider(nil))
+
+		err := service.UpdateTransaction(context.Background(), "acc123", "txn123", testCase.to, model.TransactionEvent{Type: model.TransactionEventStatusChanged, Source: model.TransactionEventSourceAPI})
+
+		if testCase.err != nil {
+			assert.ErrorIs(t, err, testCase.err, name)
+			assert.Equal(t, testCase.from, mockRepo.Transaction.Status, name)
+			assert.Empty(t, mockRepo.Events, name)
+			continue
+		}
+		assert.NoError(t, err, name)
+		assert.Equal(t, model.TransactionStatusDAO(testCase.to), mockRepo.Transaction.Status, name)
+		assert.Equal(t, []model.TransactionEventDAO{{
+			TransactionID:  "txn123",
+			AccountID:      "acc123",
+			Type:           "status_changed",
+			Source:         "api",
+			PreviousStatus: string(testCase.from),
+			Status:         string(testCase.to),
+		}}, mockRepo.Events, name)
+	}
+}
+
+// concurrentUpdateRepository changes the status of the transaction between the read and the update of the service
+type concurrentUpdateRepository struct {
+	*repository.MockTransactionRepository
+}
+
+func (r concurrentUpdateRepository) GetAccountTransaction(ctx context.Context, accountID string, transactionID string) (model.TransactionDAO, error) {
+	transaction, err := r.MockTransactionRepository.GetAccountTransaction(ctx, accountID, transactionID)
+	r.Transaction.Status = model.TransactionStatusFailedDAO
+	return transaction, err
+}
+
+func TestUpdateTransaction_ConcurrentUpdate(t *testing.T) {
+	mockRepo := repository.MockTransactionRepositoryProvider(&model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusPendingDAO, Type: model.TransactionTypeDepositDAO}, false, nil)
+	service := TransactionServiceProvider(concurrentUpdateRepository{mockRepo}, routing.PriorityRouterProvider(nil))
+
+	err := service.UpdateTransaction(context.Background(), "acc123", "txn123", model.TransactionStatusSuccess, model.TransactionEvent{Type: model.TransactionEventStatusChanged, Source: model.TransactionEventSourceAPI})
+
+	assert.ErrorIs(t, err, ErrTransactionStatusChanged)
+	assert.Equal(t, model.TransactionStatusFailedDAO, mockRepo.Transaction.Status)
+	assert.Empty(t, mockRepo.Events)
+}
+
+func TestGetTransactionEvents(t *testing.T) {
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	mockPaymentGatewayClient1 := &paymentgateway.MockClient{GatewayName: "gatewaya", StatusCode: 500}
+	mockPaymentGatewayClient2 := &paymentgateway.MockClient{GatewayName: "gatewayb", StatusCode: 200, TransactionResponse: &model.TransactionResponse{Data: model.TransactionData{TransactionID: "txn123", AccountID: "acc123", Amount: decimal.NewFromInt(100), Status: model.TransactionStatusPending, Type: model.TransactionTypeDeposit}}}
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider([]paymentgateway.IPaymentGateway{mockPaymentGatewayClient1, mockPaymentGatewayClient2}))
+
+	transaction, err := service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(100), "", "", model.TransactionTypeDeposit)
+	assert.NoError(t, err)
+	err = service.UpdateTransaction(context.Background(), "acc123", transaction.Data.TransactionID, model.TransactionStatusSuccess, model.TransactionEvent{Type: model.TransactionEventCallback, Source: "gatewayb", PayloadReference: "n1"})
+	assert.NoError(t, err)
+
+	events, err := service.GetTransactionEvents(context.Background(), transaction.Data.TransactionID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []model.TransactionEvent{
+		// the intent is recorded before any gateway is called
+		{Type: model.TransactionEventCreated, Source: model.TransactionEventSourceAPI, Status: model.TransactionStatusInitiated},
+		{Type: model.TransactionEventGatewayAttempt, Source: "gatewaya", Detail: "payment gateway gatewaya failed with server error (status code 500): unexpected status code 500"},
+		// gateway a is asked whether it processed the transaction before it is sent to gateway b
+		{Type: model.TransactionEventGatewayAttempt, Source: "gatewaya", Detail: "payment gateway gatewaya failed with validation error (status code 404): no transaction with the client reference: " + transaction.Data.TransactionID},
+		{Type: model.TransactionEventGatewayAttempt, Source: "gatewayb", Status: model.TransactionStatusPending},
+		{Type: model.TransactionEventStatusChanged, Source: model.TransactionEventSourceAPI, PreviousStatus: model.TransactionStatusInitiated, Status: model.TransactionStatusPending},
+		{Type: model.TransactionEventCallback, Source: "gatewayb", PreviousStatus: model.TransactionStatusPending, Status: model.TransactionStatusSuccess, PayloadReference: "n1"},
+	}, events)
+
+	_, err = service.GetTransactionEvents(context.Background(), "txn456")
+	assert.Error(t, err)
+}
+
+func TestGetTransactionAttempts(t *testing.T) {
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	gatewayResponse := `{"id": "txn123", "card_number": "4111111111111111"}`
+	mockPaymentGatewayClient1 := &paymentgateway.MockClient{GatewayName: "gatewaya", StatusCode: 500}
+	mockPaymentGatewayClient2 := &paymentgateway.MockClient{GatewayName: "gatewayb", StatusCode: 201, TransactionResponse: &model.TransactionResponse{Data: model.TransactionData{TransactionID: "txn123", AccountID: "acc123", Amount: decimal.NewFromInt(100), Status: model.TransactionStatusPending, Type: model.TransactionTypeDeposit, GatewayResponse: []byte(gatewayResponse)}}}
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider([]paymentgateway.IPaymentGateway{mockPaymentGatewayClient1, mockPaymentGatewayClient2}))
+
+	transaction, err := service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(100), "", "", model.TransactionTypeDeposit)
+	assert.NoError(t, err)
+
+	attempts, err := service.GetTransactionAttempts(context.Background(), transaction.Data.TransactionID)
+
+	assert.NoError(t, err)
+	assert.Len(t, attempts, 3)
+	assert.Equal(t, "gatewaya", attempts[0].Gateway)
+	assert.Equal(t, 500, attempts[0].StatusCode)
+	assert.Equal(t, string(paymentgateway.ErrorCategoryServer), attempts[0].ErrorCategory)
+	assert.NotEmpty(t, attempts[0].Error)
+	assert.Empty(t, attempts[0].ResponseFingerprint)
+	// the lookup by client reference that made it safe to fail over
+	assert.Equal(t, "gatewaya", attempts[1].Gateway)
+	assert.Equal(t, 404, attempts[1].StatusCode)
+	assert.Equal(t, string(paymentgateway.ErrorCategoryValidation), attempts[1].ErrorCategory)
+	assert.Equal(t, "gatewayb", attempts[2].Gateway)
+	assert.Equal(t, 201, attempts[2].StatusCode)
+	assert.Empty(t, attempts[2].ErrorCategory)
+	assert.Empty(t, attempts[2].Error)
+	// the response is fingerprinted as it was received, it is only redacted to be stored
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256([]byte(gatewayResponse))), attempts[2].ResponseFingerprint)
+	assert.NotContains(t, string(transaction.Data.GatewayResponse), "4111111111111111")
+
+	// the same request is sent to each gateway, but it is fingerprinted with the gateway it was sent to
+	assert.Len(t, attempts[0].RequestFingerprint, 64)
+	assert.NotEqual(t, attempts[0].RequestFingerprint, attempts[2].RequestFingerprint)
+	for _, attempt := range attempts {
+		assert.False(t, attempt.EndedAt.Before(attempt.StartedAt))
+		assert.Equal(t, attempt.EndedAt.Sub(attempt.StartedAt).Milliseconds(), attempt.LatencyMs)
+	}
+	assert.False(t, attempts[2].StartedAt.Before(attempts[0].EndedAt))
+
+	_, err = service.GetTransactionAttempts(context.Background(), "txn456")
+	assert.Error(t, err)
+}
+
+func TestCreateTransaction_Currency(t *testing.T) {
+	testCases := []struct {
+		amount   string
+		currency model.Currency
+		expected model.Currency
+		err      error
+	}{
+		{"10.25", "", "USD", nil},
+		{"10.25", "eur", "EUR", nil},
+		{"1000", "JPY", "JPY", nil},
+		{"10.5", "JPY", "", ErrInvalidAmountPrecision},
+		{"10.255", "USD", "", ErrInvalidAmountPrecision},
+		{"10.255", "KWD", "", ErrUnsupportedCurrency},
+		{"10", "XYZ", "", ErrUnsupportedCurrency},
+	}
+
+	for _, testCase := range testCases {
+		mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+		mockPaymentGatewayClient := &paymentgateway.MockClient{StatusCode: 200, TransactionResponse: &model.TransactionResponse{Data: model.TransactionData{TransactionID: "txn123", Status: model.TransactionStatusSuccess}}}
+		gateways := []paymentgateway.IPaymentGateway{mockPaymentGatewayClient}
+		service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider(gateways), WithCurrencies("USD", []model.Currency{"USD", "EUR", "JPY"}))
+
+		transactionActual, err := service.CreateTransaction(context.Background(), "acc123", decimal.RequireFromString(testCase.amount), testCase.currency, "", model.TransactionTypeDeposit)
+
+		if testCase.err != nil {
+			assert.ErrorIs(t, err, testCase.err, "%s %s", testCase.amount, testCase.currency)
+			continue
+		}
+		assert.NoError(t, err, "%s %s", testCase.amount, testCase.currency)
+		// the currency of the request is kept when the gateway response has none
+		assert.Equal(t, testCase.expected, transactionActual.Data.Currency)
+		assert.Equal(t, string(testCase.expected), mockRepo.Transaction.Currency)
+	}
+}
+
+func refundTestService(original model.TransactionDAO, refunded string, refundResponse *model.TransactionResponse) (*repository.MockTransactionRepository, ITransactionService) {
+	mockRepo := repository.MockTransactionRepositoryProvider(&original, false, nil)
+	mockRepo.RefundedAmount = refunded
+	mockPaymentGatewayClient := &paymentgateway.MockClient{GatewayName: "gatewaya", StatusCode: 200, TransactionResponse: refundResponse}
+	gateways := []paymentgateway.IPaymentGateway{mockPaymentGatewayClient}
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider(gateways), WithPaymentGateways(gateways))
+	return mockRepo, service
+}
+
+func TestRefundTransaction_Full(t *testing.T) {
+	original := model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Currency: "EUR", Status: model.TransactionStatusSuccessDAO, Type: model.TransactionTypeDepositDAO, GatewayName: "gatewaya"}
+	refundResponse := &model.TransactionResponse{Data: model.TransactionData{TransactionID: "rfd123", Status: model.TransactionStatusSuccess}}
+	mockRepo, service := refundTestService(original, "40", refundResponse)
+
+	// without an amount, everything that has not been refunded yet is refunded
+	transactionActual, err := service.RefundTransaction(context.Background(), "txn123", decimal.Zero)
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.TransactionData{
+		TransactionID:       transactionActual.Data.TransactionID,
+		AccountID:           "acc123",
+		Amount:              decimal.NewFromInt(60),
+		Currency:            "EUR",
+		Status:              model.TransactionStatusSuccess,
+		Type:                model.TransactionTypeRefund,
+		Gateway:             "gatewaya",
+		GatewayReference:    "rfd123",
+		GatewayStatusCode:   http.StatusOK,
+		ParentTransactionID: "txn123",
+	}, transactionActual.Data)
+	assert.NotEqual(t, "rfd123", transactionActual.Data.TransactionID)
+	assert.Equal(t, "txn123", mockRepo.Transaction.ParentTransactionID)
+	assert.Equal(t, model.TransactionTypeRefundDAO, mockRepo.Transaction.Type)
+	assert.Equal(t, model.TransactionStatusRefundedDAO, mockRepo.Transactions["txn123"].Status)
+}
+
+func TestRefundTransaction_Partial(t *testing.T) {
+	original := model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusSuccessDAO, Type: model.TransactionTypeDepositDAO, GatewayName: "gatewaya"}
+	refundResponse := &model.TransactionResponse{Data: model.TransactionData{TransactionID: "rfd123", Status: model.TransactionStatusSuccess}}
+	mockRepo, service := refundTestService(original, "", refundResponse)
+
+	_, err := service.RefundTransaction(context.Background(), "txn123", decimal.NewFromInt(30))
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.TransactionStatusPartiallyRefundedDAO, mockRepo.Transactions["txn123"].Status)
+}
+
+func TestRefundTransaction_ExceedsAmount(t *testing.T) {
+	original := model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusSuccessDAO, Type: model.TransactionTypeDepositDAO, GatewayName: "gatewaya"}
+	_, service := refundTestService(original, "40", &model.TransactionResponse{})
+
+	_, err := service.RefundTransaction(context.Background(), "txn123", decimal.NewFromInt(61))
+	assert.ErrorIs(t, err, ErrRefundExceedsAmount)
+}
+
+func TestRefundTransaction_PendingIsReversed(t *testing.T) {
+	original := model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusPendingDAO, Type: model.TransactionTypeWithdrawDAO, GatewayName: "gatewaya"}
+	mockRepo, service := refundTestService(original, "", &model.TransactionResponse{Data: model.TransactionData{TransactionID: "rev123", Status: model.TransactionStatusSuccess}})
+
+	// a pending transaction can only be reversed as a whole
+	_, err := service.RefundTransaction(context.Background(), "txn123", decimal.NewFromInt(50))
+	assert.ErrorIs(t, err, ErrTransactionNotRefundable)
+
+	transactionActual, err := service.RefundTransaction(context.Background(), "txn123", decimal.Zero)
+	assert.NoError(t, err)
+	assert.Equal(t, model.TransactionTypeReversal, transactionActual.Data.Type)
+	assert.Equal(t, model.TransactionStatusReversedDAO, mockRepo.Transactions["txn123"].Status)
+}
+
+func TestRefundTransaction_NotRefundable(t *testing.T) {
+	testCases := map[string]model.TransactionDAO{
+		"failed":         {TransactionID: "txn123", Amount: "100", Status: model.TransactionStatusFailedDAO, Type: model.TransactionTypeDepositDAO, GatewayName: "gatewaya"},
+		"refund":         {TransactionID: "txn123", Amount: "100", Status: model.TransactionStatusSuccessDAO, Type: model.TransactionTypeRefundDAO, GatewayName: "gatewaya"},
+		"fully refunded": {TransactionID: "txn123", Amount: "40", Status: model.TransactionStatusSuccessDAO, Type: model.TransactionTypeDepositDAO, GatewayName: "gatewaya"},
+	}
+
+	for name, original := range testCases {
+		_, service := refundTestService(original, "40", &model.TransactionResponse{})
+
+		_, err := service.RefundTransaction(context.Background(), "txn123", decimal.Zero)
+		assert.ErrorIs(t, err, ErrTransactionNotRefundable, name)
+	}
+}
+
+func TestRefundTransaction_GatewayDeclined(t *testing.T) {
+	original := model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusSuccessDAO, Type: model.TransactionTypeDepositDAO, GatewayName: "gatewaya"}
+	mockRepo, service := refundTestService(original, "", nil)
+	service.(*TransactionService).PaymentGateways["gatewaya"].(*paymentgateway.MockClient).StatusCode = 402
+
+	_, err := service.RefundTransaction(context.Background(), "txn123", decimal.Zero)
+
+	var gatewayError *paymentgateway.GatewayError
+	assert.True(t, errors.As(err, &gatewayError))
+	assert.Equal(t, paymentgateway.ErrorCategoryDeclined, gatewayError.Category)
+	// the refund reserved before the gateway call is recorded as failed
+	assert.Equal(t, "txn123", mockRepo.Transaction.ParentTransactionID)
+	assert.Equal(t, model.TransactionStatusFailedDAO, mockRepo.Transaction.Status)
+	assert.Equal(t, model.TransactionStatusSuccessDAO, mockRepo.Transactions["txn123"].Status)
+}
+
+func TestRefundTransaction_Reserved(t *testing.T) {
+	original := model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusSuccessDAO, Type: model.TransactionTypeDepositDAO, GatewayName: "gatewaya"}
+	refundResponse := &model.TransactionResponse{Data: model.TransactionData{TransactionID: "rfd123", Status: model.TransactionStatusPending}}
+	mockRepo, service := refundTestService(original, "", refundResponse)
+	gateway := service.(*TransactionService).PaymentGateways["gatewaya"].(*paymentgateway.MockClient)
+
+	transactionActual, err := service.RefundTransaction(context.Background(), "txn123", decimal.NewFromInt(60))
+
+	assert.NoError(t, err)
+	// the gateway is sent the refund ID, so that a retried refund is not executed twice
+	assert.Equal(t, transactionActual.Data.TransactionID, gateway.IdempotencyKey)
+	assert.Equal(t, transactionActual.Data.TransactionID, gateway.ClientReference)
+
+	// the pending refund is reserved, a second one cannot go over what is left
+	_, err = service.RefundTransaction(context.Background(), "txn123", decimal.NewFromInt(60))
+	assert.ErrorIs(t, err, ErrRefundExceedsAmount)
+	// the transaction is only refunded once the gateway settles the refund
+	assert.Equal(t, model.TransactionStatusSuccessDAO, mockRepo.Transactions["txn123"].Status)
+}
+
+func TestRefundTransaction_Unknown(t *testing.T) {
+	original := model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusSuccessDAO, Type: model.TransactionTypeDepositDAO, GatewayName: "gatewaya"}
+	mockRepo, service := refundTestService(original, "", nil)
+	gateway := service.(*TransactionService).PaymentGateways["gatewaya"].(*paymentgateway.MockClient)
+	gateway.StatusCode = 504
+	gateway.ReferenceErr = paymentgateway.NewGatewayError("gatewaya", paymentgateway.ErrorCategoryTimeout, 0, errors.New("timeout"))
+
+	transactionActual, err := service.RefundTransaction(context.Background(), "txn123", decimal.Zero)
+
+	// the gateway may have refunded, the refund is left to the reconciler and the transaction is not settled yet
+	assert.NoError(t, err)
+	assert.Equal(t, model.TransactionStatusUnknown, transactionActual.Data.Status)
+	assert.Equal(t, model.TransactionStatusUnknownDAO, mockRepo.Transaction.Status)
+	assert.Equal(t, "acc123", mockRepo.Transaction.AccountID)
+	assert.Equal(t, model.TransactionStatusSuccessDAO, mockRepo.Transactions["txn123"].Status)
+}
+
+// riskTestService is a service with a funded account whose withdrawals go to review right after a deposit and whose
+// transactions are denied after two failures, its gateway fails every call
+func riskTestService(t *testing.T) (*repository.MockTransactionRepository, ITransactionService, ILedgerService) {
+	rules, err := risk.BuildAll([]risk.RuleConfig{
+		{Name: "quick_withdrawal", Type: "withdrawal_after_deposit", Decision: model.RiskDecisionReview, Window: "1h"},
+		{Name: "failures", Type: "repeated_failures", Decision: model.RiskDecisionDeny, Count: 2, Window: "10m"},
+	})
+	assert.NoError(t, err)
+
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	mockLedgerRepo := repository.MockLedgerRepositoryProvider()
+	ledger := LedgerServiceProvider(mockLedgerRepo, mockRepo)
+	fund(mockLedgerRepo, 100)
+	gateways := []paymentgateway.IPaymentGateway{&paymentgateway.MockClient{GatewayName: "gatewaya", StatusCode: 500}}
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider(gateways), WithPaymentGateways(gateways), WithLedger(ledger), WithRisk(risk.EngineProvider(rules)))
+	return mockRepo, service, ledger
+}
+
+func TestCreateTransaction_RiskReview(t *testing.T) {
+	mockRepo, service, ledger := riskTestService(t)
+	depositedAt := time.Now().Add(-time.Minute)
+	mockRepo.Activity = model.AccountActivityDAO{LastDepositAt: &depositedAt}
+
+	transactionResponse, err := service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(30), "", "", model.TransactionTypeWithdraw)
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.TransactionStatusPendingReview, transactionResponse.Data.Status)
+	assertBalance(t, ledger, 70, 30)
+
+	transaction, err := service.GetTransaction(context.Background(), transactionResponse.Data.TransactionID)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.RiskHit{{Rule: "quick_withdrawal", Decision: model.RiskDecisionReview, Reason: transactionResponse.Data.RiskHits[0].Reason}}, transaction.Data.RiskHits)
+
+	// the analyst rejects it
+	err = service.UpdateTransaction(context.Background(), "acc123", transactionResponse.Data.TransactionID, model.TransactionStatusFailed, model.TransactionEvent{Type: model.TransactionEventStatusChanged, Source: model.TransactionEventSourceAPI})
+	assert.NoError(t, err)
+	assertBalance(t, ledger, 100, 0)
+}
+
+func TestCreateTransaction_RiskReviewApproved(t *testing.T) {
+	mockRepo, service, ledger := riskTestService(t)
+	depositedAt := time.Now().Add(-time.Minute)
+	mockRepo.Activity = model.AccountActivityDAO{LastDepositAt: &depositedAt}
+	transactionResponse, err := service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(30), "", "", model.TransactionTypeWithdraw)
+	assert.NoError(t, err)
+
+	gateway := service.(*TransactionService).PaymentGateways["gatewaya"].(*paymentgateway.MockClient)
+	gateway.StatusCode = 200
+	gateway.TransactionResponse = &model.TransactionResponse{Data: model.TransactionData{TransactionID: "gw123", AccountID: "acc123", Amount: decimal.NewFromInt(30), Status: model.TransactionStatusSuccess, Type: model.TransactionTypeWithdraw}}
+
+	// the analyst approves it, it is sent to the gateway with its own ID and settles the hold
+	err = service.UpdateTransaction(context.Background(), "acc123", transactionResponse.Data.TransactionID, model.TransactionStatusInitiated, model.TransactionEvent{Type: model.TransactionEventStatusChanged, Source: model.TransactionEventSourceAPI})
+
+	assert.NoError(t, err)
+	assert.Equal(t, transactionResponse.Data.TransactionID, gateway.ClientReference)
+	assert.Equal(t, model.TransactionStatusSuccessDAO, mockRepo.Transaction.Status)
+	assert.Equal(t, "gw123", mockRepo.Transaction.GatewayReference)
+	assertBalance(t, ledger, 70, 0)
+}
+
+func TestCreateTransaction_RiskReviewApprovedConverted(t *testing.T) {
+	rules, err := risk.BuildAll([]risk.RuleConfig{{Name: "quick_withdrawal", Type: "withdrawal_after_deposit", Decision: model.RiskDecisionReview, Window: "1h"}})
+	assert.NoError(t, err)
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	mockLedgerRepo := repository.MockLedgerRepositoryProvider()
+	ledger := LedgerServiceProvider(mockLedgerRepo, mockRepo)
+	fx := FXServiceProvider(repository.MockFXRepositoryProvider(), time.Minute)
+	gateway := &paymentgateway.MockClient{GatewayName: "gatewaya", StatusCode: 200}
+	gateways := []paymentgateway.IPaymentGateway{gateway}
+	router, err := routing.RulesRouterProvider(nil, gateways, map[string][]model.Currency{"gatewaya": {"USD"}}, routing.StrategyPriority, routing.PriorityRouterProvider(gateways))
+	assert.NoError(t, err)
+	service := TransactionServiceProvider(mockRepo, router, WithPaymentGateways(gateways), WithLedger(ledger), WithFX(fx), WithRisk(risk.EngineProvider(rules)))
+
+	mockLedgerRepo.Balances[model.AvailableLedgerAccount("acc123", "EUR")] = decimal.NewFromInt(200)
+	mockLedgerRepo.Balances[model.GatewayLedgerAccount("gatewayb", "EUR")] = decimal.NewFromInt(-200)
+	assert.NoError(t, fx.SaveRates(context.Background(), []model.FXRate{{From: "EUR", To: "USD", Rate: decimal.RequireFromString("1.1")}}))
+	quote, err := fx.CreateQuote(context.Background(), "EUR", "USD", decimal.NewFromInt(100))
+	assert.NoError(t, err)
+	depositedAt := time.Now().Add(-time.Minute)
+	mockRepo.Activity = model.AccountActivityDAO{LastDepositAt: &depositedAt}
+
+	// the transaction in review keeps its quote, the quote cannot be used again
+	transactionResponse, err := service.CreateTransaction(context.Background(), "acc123", decimal.Zero, "", quote.QuoteID, model.TransactionTypeWithdraw)
+	assert.NoError(t, err)
+	assert.Equal(t, model.TransactionStatusPendingReview, transactionResponse.Data.Status)
+	assert.Equal(t, &model.FXConversion{QuoteID: quote.QuoteID, Rate: quote.Rate, Amount: decimal.RequireFromString("110"), Currency: "USD"}, transactionResponse.Data.Conversion)
+	_, err = service.CreateTransaction(context.Background(), "acc123", decimal.Zero, "", quote.QuoteID, model.TransactionTypeWithdraw)
+	assert.ErrorIs(t, err, ErrQuoteUnavailable)
+
+	// the analyst approves it a while later, it is sent to the gateway in USD at the quoted rate
+	assert.NoError(t, fx.SaveRates(context.Background(), []model.FXRate{{From: "EUR", To: "USD", Rate: decimal.RequireFromString("1.3")}}))
+	gateway.TransactionResponse = &model.TransactionResponse{Data: model.TransactionData{TransactionID: "gw123", AccountID: "acc123", Amount: decimal.NewFromInt(110), Currency: "USD", Status: model.TransactionStatusSuccess, Type: model.TransactionTypeWithdraw}}
+	err = service.UpdateTransaction(context.Background(), "acc123", transactionResponse.Data.TransactionID, model.TransactionStatusInitiated, model.TransactionEvent{Type: model.TransactionEventStatusChanged, Source: model.TransactionEventSourceAPI})
+
+	assert.NoError(t, err)
+	assert.Equal(t, model.TransactionStatusSuccessDAO, mockRepo.Transaction.Status)
+	assert.Equal(t, "100", mockRepo.Transaction.Amount)
+	assert.Equal(t, "EUR", mockRepo.Transaction.Currency)
+	assert.Equal(t, "110", mockRepo.Transaction.ConvertedAmount)
+	assert.Equal(t, quote.QuoteID, mockRepo.Transaction.FXQuoteID)
+	balance, err := ledger.GetBalance(context.Background(), "acc123", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, "100", balance.Available.String())
+	assert.Equal(t, "0", balance.Held.String())
+	assert.Equal(t, "110", mockLedgerRepo.Balances[model.GatewayLedgerAccount("gatewaya", "USD")].String())
+	assertBalanced(t, mockLedgerRepo)
+}
+func TestCreateTransaction_RiskDenied(t *testing.T) {
+	mockRepo, service, ledger := riskTestService(t)
+	mockRepo.Activity = model.AccountActivityDAO{Failures: 2}
+
+	_, err := service.CreateTransaction(context.Background(), "acc123", decimal.NewFromInt(30), "", "", model.TransactionTypeWithdraw)
+
+	assert.ErrorIs(t, err, ErrRiskDenied)
+	assert.Equal(t, model.TransactionStatusFailedDAO, mockRepo.Transaction.Status)
+	assert.Equal(t, "failures", mockRepo.Transaction.RiskHits[0].Rule)
+	assertBalance(t, ledger, 100, 0)
+}
+
+// listTestRepository has five deposits of acc123 created a minute apart, every other one failed
+func listTestRepository() *repository.MockTransactionRepository {
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, false, nil)
+	mockRepo.Transactions = map[string]model.TransactionDAO{}
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		status := model.TransactionStatusSuccessDAO
+		if i%2 == 1 {
+			status = model.TransactionStatusFailedDAO
+		}
+		transactionID := fmt.Sprintf("txn%d", i)
+		mockRepo.Transactions[transactionID] = model.TransactionDAO{
+			ID:            fmt.Sprintf("00000000-0000-0000-0000-00000000000%d", i),
+			TransactionID: transactionID,
+			AccountID:     "acc123",
+			Amount:        fmt.Sprintf("%d", (i+1)*10),
+			Currency:      "USD",
+			Status:        status,
+			Type:          model.TransactionTypeDepositDAO,
+			CreatedAt:     createdAt.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	return mockRepo
+}
+
+func transactionIDs(page *model.TransactionPage) []string {
+	var transactionIDs []string
+	for _, transaction := range page.Transactions {
+		transactionIDs = append(transactionIDs, transaction.TransactionID)
+	}
+	return transactionIDs
+}
+
+func TestListTransactions_Pages(t *testing.T) {
+	service := TransactionServiceProvider(listTestRepository(), nil)
+
+	var pages [][]string
+	filter := model.TransactionFilter{AccountID: "acc123", Limit: 2}
+	for {
+		page, err := service.ListTransactions(context.Background(), filter)
+		assert.NoError(t, err)
+		pages = append(pages, transactionIDs(page))
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+
+	assert.Equal(t, [][]string{{"txn4", "txn3"}, {"txn2", "txn1"}, {"txn0"}}, pages)
+}
+
+func TestListTransactions_Filters(t *testing.T) {
+	minAmount := decimal.NewFromInt(20)
+	createdTo := time.Date(2024, 1, 1, 12, 4, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		filter         model.TransactionFilter
+		transactionIDs []string
+	}{
+		"status":        {model.TransactionFilter{Status: model.TransactionStatusFailed}, []string{"txn3", "txn1"}},
+		"amount":        {model.TransactionFilter{MinAmount: &minAmount, Order: model.SortOrderAsc}, []string{"txn1", "txn2", "txn3", "txn4"}},
+		"created range": {model.TransactionFilter{CreatedTo: &createdTo, Status: model.TransactionStatusSuccess}, []string{"txn2", "txn0"}},
+		"other account": {model.TransactionFilter{AccountID: "acc456"}, nil},
+	}
+
+	service := TransactionServiceProvider(listTestRepository(), nil)
+	for name, testCase := range testCases {
+		page, err := service.ListTransactions(context.Background(), testCase.filter)
+
+		assert.NoError(t, err, name)
+		assert.Equal(t, testCase.transactionIDs, transactionIDs(page), name)
+		assert.Empty(t, page.NextCursor, name)
+	}
+}
+
+func TestListTransactions_InvalidCursor(t *testing.T) {
+	service := TransactionServiceProvider(listTestRepository(), nil)
+	page, err := service.ListTransactions(context.Background(), model.TransactionFilter{Limit: 1})
+	assert.NoError(t, err)
+
+	// a cursor of the newest first listing cannot page through the oldest first one
+	_, err = service.ListTransactions(context.Background(), model.TransactionFilter{Limit: 1, Order: model.SortOrderAsc, Cursor: page.NextCursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = service.ListTransactions(context.Background(), model.TransactionFilter{Cursor: "not a cursor"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestGetTransaction_Ambiguous(t *testing.T) {
+	mockRepo := repository.MockTransactionRepositoryProvider(nil, true, repository.ErrAmbiguousTransaction)
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider(nil))
+
+	_, err := service.GetTransaction(context.Background(), "txn123")
+
+	assert.ErrorIs(t, err, ErrAmbiguousTransaction)
+}
+
+func TestUpdateTransaction_OtherAccount(t *testing.T) {
+	mockRepo := repository.MockTransactionRepositoryProvider(&model.TransactionDAO{TransactionID: "txn123", AccountID: "acc123", Amount: "100", Status: model.TransactionStatusPendingDAO, Type: model.TransactionTypeDepositDAO}, false, nil)
+	service := TransactionServiceProvider(mockRepo, routing.PriorityRouterProvider(nil))
+
+	err := service.UpdateTransaction(context.Background(), "acc456", "txn123", model.TransactionStatusSuccess, model.TransactionEvent{Type: model.TransactionEventStatusChanged, Source: model.TransactionEventSourceAPI})
+
+	assert.ErrorIs(t, err, ErrTransactionNotFound)
+	assert.Equal(t, model.TransactionStatusPendingDAO, mockRepo.Transaction.Status)
+}
@@ -4,10 +4,191 @@ CREATE TABLE transactions (
     id uuid default uuid_generate_v4() primary key,
     transaction_id varchar(255) not null,
     account_id varchar(255) not null,
-    amount numeric(10, 2) not null,
+    amount numeric(20, 4) not null, -- up to 4 decimals, the most an ISO 4217 currency has
+    currency char(3) not null default 'USD', -- ISO 4217 code
     status varchar(255) not null,
     type varchar(255) not null,
+    gateway_name varchar(255) not null default '',
+    -- the ID the gateway gave the transaction, transaction_id is minted by SETA. Rows from before SETA minted its own
+    -- IDs have none and carry the gateway's ID in transaction_id
+    gateway_reference varchar(255),
+    gateway_response jsonb, -- the last response of the gateway, with credentials and card data redacted
+    parent_transaction_id varchar(255),
+    -- set when the gateway processed the transaction in another currency, amount and currency are those of the account
+    converted_amount numeric(20, 4),
+    converted_currency char(3),
+    fx_rate numeric(20, 10),
+    fx_quote_id uuid,
     created_at timestamp not null default now(),
     updated_at timestamp not null default now(),
     unique (transaction_id, account_id)
 );
+
+CREATE INDEX transactions_parent_transaction_id_idx ON transactions (parent_transaction_id);
+-- callbacks and the reconciler look transactions up by the gateway's ID
+CREATE INDEX transactions_gateway_reference_idx ON transactions (gateway_name, COALESCE(gateway_reference, transaction_id));
+-- the reconciler works through the pending transactions and the unknown ones, which it finds by their client reference
+CREATE INDEX transactions_pending_created_at_idx ON transactions (created_at) WHERE status IN ('pending', 'unknown');
+-- intents are recorded before any gateway is called, the recovery resolves those that never got their outcome
+CREATE INDEX transactions_initiated_created_at_idx ON transactions (created_at) WHERE status = 'initiated';
+-- the listing is ordered by (created_at, id), with or without its most selective filters
+CREATE INDEX transactions_created_at_id_idx ON transactions (created_at, id);
+CREATE INDEX transactions_account_id_created_at_id_idx ON transactions (account_id, created_at, id);
+CREATE INDEX transactions_status_created_at_id_idx ON transactions (status, created_at, id);
+CREATE INDEX transactions_gateway_name_created_at_id_idx ON transactions (gateway_name, created_at, id);
+
+-- history of every transaction, written in the same database transaction as the change it records
+CREATE TABLE transaction_events (
+    id uuid default uuid_generate_v4() primary key,
+    transaction_id varchar(255) not null,
+    account_id varchar(255) not null,
+    type varchar(255) not null,
+    source varchar(255) not null,
+    previous_status varchar(255),
+    status varchar(255),
+    detail text,
+    payload_reference varchar(255),
+    created_at timestamp not null default clock_timestamp(),
+    foreign key (transaction_id, account_id) references transactions (transaction_id, account_id)
+);
+
+CREATE INDEX transaction_events_transaction_id_idx ON transaction_events (transaction_id, created_at);
+
+-- the risk rules that sent a transaction to review or denied it
+CREATE TABLE transaction_risk_hits (
+    id uuid default uuid_generate_v4() primary key,
+    transaction_id varchar(255) not null,
+    account_id varchar(255) not null,
+    rule varchar(255) not null,
+    decision varchar(255) not null, -- review or deny
+    reason text not null,
+    created_at timestamp not null default clock_timestamp(),
+    foreign key (transaction_id, account_id) references transactions (transaction_id, account_id)
+);
+
+CREATE INDEX transaction_risk_hits_transaction_id_idx ON transaction_risk_hits (transaction_id, created_at);
+
+-- every call made to a payment gateway for a transaction, stored with the transaction it led to
+CREATE TABLE transaction_attempts (
+    id uuid default uuid_generate_v4() primary key,
+    transaction_id varchar(255) not null,
+    account_id varchar(255) not null,
+    gateway_name varchar(255) not null,
+    started_at timestamp not null, -- UTC
+    ended_at timestamp not null, -- UTC
+    latency_ms bigint not null,
+    status_code integer, -- null when no response was received
+    error_category varchar(255), -- null for the attempt that succeeded
+    error text,
+    request_fingerprint char(64) not null, -- hex SHA-256 of what was sent to the gateway
+    response_fingerprint char(64), -- hex SHA-256 of the raw response
+    foreign key (transaction_id, account_id) references transactions (transaction_id, account_id)
+);
+
+CREATE INDEX transaction_attempts_transaction_id_idx ON transaction_attempts (transaction_id, started_at);
+
+-- nonces of the gateway callbacks received within the callback tolerance, a repeated nonce is a replayed callback
+CREATE TABLE callback_nonces (
+    gateway_name varchar(255) not null,
+    nonce varchar(255) not null,
+    received_at timestamp not null,
+    primary key (gateway_name, nonce)
+);
+
+CREATE INDEX callback_nonces_received_at_idx ON callback_nonces (received_at);
+
+-- the Idempotency-Key of the deposits and withdrawals, with the response that is replayed when the request is retried
+CREATE TABLE idempotency_keys (
+    key varchar(255) primary key,
+    request_hash char(64) not null, -- hex SHA-256 of the route and the request body
+    status_code integer, -- null while the request is in flight
+    response bytea, -- the JSON body as it was sent, null while the request is in flight
+    created_at timestamp not null,
+    expires_at timestamp not null
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+
+-- double-entry ledger: every entry is a set of postings that add up to zero, the balance of a ledger account is the
+-- projection of its postings and is updated in the same database transaction
+CREATE TABLE ledger_accounts (
+    id varchar(255) primary key, -- account:<account ID>:<currency>:available, account:<account ID>:<currency>:held, gateway:<gateway name>:<currency> or fx:<currency>
+    balance numeric(20, 4) not null default 0,
+    updated_at timestamp not null default now()
+);
+
+CREATE TABLE ledger_entries (
+    reference varchar(255) primary key, -- eg. deposit:<transaction ID>, an entry is only ever posted once
+    transaction_id varchar(255) not null,
+    created_at timestamp not null default now()
+);
+
+CREATE INDEX ledger_entries_transaction_id_idx ON ledger_entries (transaction_id);
+
+CREATE TABLE ledger_postings (
+    id uuid default uuid_generate_v4() primary key,
+    reference varchar(255) not null references ledger_entries (reference),
+    ledger_account_id varchar(255) not null references ledger_accounts (id),
+    amount numeric(20, 4) not null -- a credit is positive, a debit negative
+);
+
+CREATE INDEX ledger_postings_ledger_account_id_idx ON ledger_postings (ledger_account_id);
+
+-- the amounts reserved for withdrawals, a hold is created before the gateway is called and captured or released
+-- once the withdrawal settles
+CREATE TABLE ledger_holds (
+    id uuid primary key,
+    account_id varchar(255) not null,
+    amount numeric(20, 4) not null,
+    currency char(3) not null,
+    transaction_id varchar(255),
+    status varchar(255) not null,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now()
+);
+
+CREATE INDEX ledger_holds_transaction_id_idx ON ledger_holds (transaction_id);
+
+-- exchange rates, amount in from_currency * rate = amount in to_currency. The rate of a pair at a time is the latest one
+-- whose validity window includes it
+CREATE TABLE fx_rates (
+    id uuid default uuid_generate_v4() primary key,
+    from_currency char(3) not null,
+    to_currency char(3) not null,
+    rate numeric(20, 10) not null,
+    valid_from timestamp not null,
+    valid_to timestamp, -- open-ended when null
+    created_at timestamp not null default now(),
+    unique (from_currency, to_currency, valid_from)
+);
+
+-- a quote locks a rate until it expires, used_at is set by the transaction converted with it
+CREATE TABLE fx_quotes (
+    id uuid primary key,
+    from_currency char(3) not null,
+    to_currency char(3) not null,
+    rate numeric(20, 10) not null,
+    amount numeric(20, 4) not null,
+    converted_amount numeric(20, 4) not null,
+    expires_at timestamp not null,
+    used_at timestamp,
+    created_at timestamp not null default now()
+);
+
+-- limits of one account that replace the configured ones, the columns that are null are not overridden. An empty
+-- currency overrides the limits of every currency
+CREATE TABLE account_limits (
+    account_id varchar(255) not null,
+    type varchar(255) not null, -- deposit or withdraw
+    currency varchar(3) not null default '',
+    min_amount numeric(20, 4),
+    max_amount numeric(20, 4),
+    daily_amount numeric(20, 4),
+    monthly_amount numeric(20, 4),
+    max_count integer,
+    count_window_seconds integer,
+    updated_at timestamp not null default now(),
+    primary key (account_id, type, currency)
+);
+
+CREATE INDEX transactions_account_id_type_created_at_idx ON transactions (account_id, type, currency, created_at);